@@ -8,6 +8,7 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
+	"git.ronaksoft.com/nested/server/pkg/webpush"
 	"github.com/spf13/cobra"
 	"io"
 	"log"
@@ -31,7 +32,7 @@ import (
 
 func init() {
 	RootCmd.AddCommand(GenCmd)
-	GenCmd.AddCommand(GenDKIMCmd, GenRandomKey)
+	GenCmd.AddCommand(GenDKIMCmd, GenRandomKey, GenVAPIDCmd)
 }
 
 var GenCmd = &cobra.Command{
@@ -75,6 +76,21 @@ var GenRandomKey = &cobra.Command{
 	},
 }
 
+// GenVAPIDCmd Generates the VAPID key-pair of Web Push, the private key must be set as
+// NST_WEBPUSH_PRIVATE_KEY on the api servers.
+var GenVAPIDCmd = &cobra.Command{
+	Use:   "vapid",
+	Short: "generate vapid (web push) public and private key",
+	Run: func(cmd *cobra.Command, args []string) {
+		priv, pub, err := webpush.GenerateVAPIDKeys()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println("VAPID Private Key (NST_WEBPUSH_PRIVATE_KEY):\r\n", priv)
+		fmt.Println("VAPID Public Key:\r\n", pub)
+	},
+}
+
 // CreateDKIMKeys produces a pair of public and private keys
 func CreateDKIMKeys() (priv, pub string) {
 	privateKey, _ := rsa.GenerateKey(rand.Reader, 1024)
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/mail/lmtp"
+	"github.com/spf13/cobra"
+)
+
+var ImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import data into Nested",
+}
+
+// ImportMailCmd imports mbox, eml or maildir archives into places. It connects to the database using
+// the server configs (NST_MONGO_DSN, NST_REDIS_DSN, ...) and uploads the attachments through
+// NST_MAIL_UPLOAD_BASE_URL exactly like the LMTP server does.
+var ImportMailCmd = &cobra.Command{
+	Use:   "mail [path]",
+	Short: "Import mbox file, eml files or maildir directory into places",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		placeIDs, _ := cmd.Flags().GetStringSlice("place")
+		placeMap, _ := cmd.Flags().GetStringToString("map")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		opts := lmtp.ImportOptions{
+			Format:          format,
+			PlaceMap:        map[string]string{},
+			DefaultPlaceIDs: placeIDs,
+			DryRun:          dryRun,
+		}
+		for addr, placeID := range placeMap {
+			opts.PlaceMap[strings.ToLower(addr)] = placeID
+		}
+
+		model, err := nested.NewManager(
+			config.GetString(config.InstanceID),
+			config.GetString(config.MongoDSN),
+			config.GetString(config.RedisDSN),
+			config.GetInt(config.LogLevel),
+		)
+		if err != nil {
+			fmt.Println("could not connect to database:", err.Error())
+			os.Exit(1)
+		}
+		defer model.Shutdown()
+
+		for _, placeID := range append(placeIDs, values(opts.PlaceMap)...) {
+			if !model.Place.Exists(placeID) {
+				fmt.Println("place does not exist:", placeID)
+				os.Exit(1)
+			}
+		}
+
+		importer, err := lmtp.NewImporter(model, opts)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		res, err := importer.Import(args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+		}
+		if res != nil {
+			b, _ := json.MarshalIndent(res, "", "  ")
+			fmt.Println(string(b))
+		}
+	},
+}
+
+func values(m map[string]string) []string {
+	vals := make([]string, 0, len(m))
+	for _, v := range m {
+		vals = append(vals, v)
+	}
+	return vals
+}
+
+func init() {
+	ImportMailCmd.Flags().String("format", "", "archive format (mbox | eml | maildir), detected if not set")
+	ImportMailCmd.Flags().StringSlice("place", nil, "place ids which get the messages that none of their recipients could be mapped")
+	ImportMailCmd.Flags().StringToString("map", nil, "email=place_id pairs to map recipients to places")
+	ImportMailCmd.Flags().Bool("dry-run", false, "only parse the archive and report what would be imported")
+
+	ImportCmd.AddCommand(ImportMailCmd)
+	RootCmd.AddCommand(ImportCmd)
+}
@@ -3,9 +3,12 @@ package main
 import (
     "encoding/json"
     "fmt"
+    "io"
     "net/http"
+    "net/url"
     "os"
     "path/filepath"
+    "strconv"
     "strings"
     "sync"
     "time"
@@ -37,7 +40,9 @@ import (
     "git.ronaksoft.com/nested/server/pkg/rpc/api/system"
     "git.ronaksoft.com/nested/server/pkg/rpc/api/task"
     "git.ronaksoft.com/nested/server/pkg/rpc/file"
+    "git.ronaksoft.com/nested/server/pkg/sms"
     tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+    "github.com/globalsign/mgo/bson"
     "github.com/iris-contrib/middleware/cors"
     "github.com/kataras/iris/v12"
     "github.com/kataras/iris/v12/websocket"
@@ -149,6 +154,12 @@ func NewAPP() *APP {
     app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 1*time.Minute, api.JobReporter))
     app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 1*time.Minute, api.JobOverdueTasks))
     app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 1*time.Hour, api.JobLicenseManager))
+    app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 10*time.Minute, api.JobEmailDigest))
+    app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 1*time.Hour, api.JobPasswordExpiry))
+    app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, 1*time.Hour, api.JobSessionCleanup))
+    if d := config.GetInt(config.LdapSyncInterval); d > 0 && len(config.GetString(config.LdapURL)) > 0 {
+        app.api.RegisterBackgroundJob(api.NewBackgroundJob(app.api, time.Duration(d)*time.Minute, api.JobDirectorySync))
+    }
 
     // Initialize File Server
     app.file = file.NewServer(app.model)
@@ -169,6 +180,26 @@ func NewAPP() *APP {
     app.iris.Get("/ws", websocket.Handler(app.ws))
     apiParty := app.iris.Party("/api")
     apiParty.Get("/check_auth", app.httpCheckAuth)
+    apiV1Party := apiParty.Party("/v1")
+    apiV1Party.Get("/openapi.json", app.httpOpenAPI)
+    apiV1Party.Post("/{service:string}/{command:string}", app.httpOnCommand)
+
+    // Single Sign-On Handlers
+    oidcParty := app.iris.Party("/oidc")
+    oidcParty.Get("/{provider:string}/login", app.httpSSOLogin)
+    oidcParty.Get("/{provider:string}/callback", app.httpSSOCallback)
+
+    // Session Handlers
+    app.iris.Get(fmt.Sprintf(api.SessionRevokePath, "{token:string}"), app.httpConfirmRevokeSession)
+    app.iris.Post(fmt.Sprintf(api.SessionRevokePath, "{token:string}"), app.httpRevokeSession)
+
+    // SMS Handlers
+    app.iris.Get(fmt.Sprintf(api.SMSReceiptPath, "{provider:string}"), app.httpSMSReceipt)
+    app.iris.Post(fmt.Sprintf(api.SMSReceiptPath, "{provider:string}"), app.httpSMSReceipt)
+
+    // SCIM Handlers
+    scimHandler := iris.FromStd(app.api.ScimHandler())
+    app.iris.Any(api.ScimPath+"/{resource:path}", scimHandler)
 
     // File Handlers
     fileParty := app.iris.Party("/file")
@@ -225,6 +256,7 @@ func (gw *APP) Run() {
 // Shutdown clean up services before exiting
 func (gw *APP) Shutdown() {
     gw.mailStore.Close()
+    gw.pusher.Close()
     gw.model.Shutdown()
 }
 
@@ -235,7 +267,7 @@ func (gw *APP) httpOnConnection(ctx iris.Context) {
     startTime := time.Now()
 
     userRequest := new(rpc.Request)
-    if err := ctx.ReadJSON(userRequest); err != nil {
+    if err := gw.readHttpRequest(ctx, userRequest); err != nil {
         _ = ctx.JSON(iris.Map{
             "status":     "err",
             "error_code": global.ErrInvalid,
@@ -251,6 +283,7 @@ func (gw *APP) httpOnConnection(ctx iris.Context) {
     if appToken := ctx.GetHeader("X-APP-TOKEN"); len(appToken) > 0 {
         userRequest.AppToken = appToken
     }
+    userRequest.AccessToken = bearerToken(ctx)
 
     // Send to Server
     userResponse := new(rpc.Response)
@@ -264,11 +297,120 @@ func (gw *APP) httpOnConnection(ctx iris.Context) {
         zap.Any("Response", userResponse.Data),
     )
 
+    gw.writeHttpResponse(ctx, userRequest, userResponse)
+}
+
+// httpOnCommand
+// This function serves the stateless HTTP gateway: POST /api/v1/{service}/{command}. The body is the
+// data of the command and the credentials are read from the headers.
+func (gw *APP) httpOnCommand(ctx iris.Context) {
+    startTime := time.Now()
+
+    userRequest := &rpc.Request{
+        Format:      "json",
+        RequestID:   ctx.GetHeader("X-Request-ID"),
+        Command:     fmt.Sprintf("%s/%s", ctx.Params().Get("service"), ctx.Params().Get("command")),
+        AppID:       ctx.GetHeader("X-APP-ID"),
+        AppToken:    ctx.GetHeader("X-APP-TOKEN"),
+        AccessToken: bearerToken(ctx),
+        ClientID:    ctx.GetHeader("X-Client-ID"),
+        ClientIP:    ctx.RemoteAddr(),
+        UserAgent:   ctx.GetHeader("User-Agent"),
+        Data:        tools.M{},
+    }
+    if sk := ctx.GetHeader("X-Session-Key"); bson.IsObjectIdHex(sk) {
+        userRequest.SessionKey = bson.ObjectIdHex(sk)
+        userRequest.SessionSec = ctx.GetHeader("X-Session-Secret")
+    }
+    if ctx.GetContentLength() != 0 {
+        body, err := rpc.NewDecompressReader(ctx.GetHeader("Content-Encoding"), ctx.Request().Body)
+        if err == nil {
+            err = json.NewDecoder(io.LimitReader(body, rpc.MaxDecompressedSize)).Decode(&userRequest.Data)
+            _ = body.Close()
+        }
+        if err != nil && err != io.EOF {
+            ctx.StatusCode(http.StatusBadRequest)
+            _ = ctx.JSON(iris.Map{
+                "status": "err",
+                "data": iris.Map{
+                    "err_code": global.ErrInvalid,
+                    "items":    []string{"not_valid_json"},
+                },
+            })
+            return
+        }
+    }
+
+    userResponse := new(rpc.Response)
+    gw.api.Execute(userRequest, userResponse)
+
+    log.Debug("HTTP Command Received",
+        zap.String("AppID", userRequest.AppID),
+        zap.String("Cmd", userRequest.Command),
+        zap.String("Status", userResponse.Status),
+        zap.Duration("Duration", time.Now().Sub(startTime)),
+    )
+
+    gw.writeHttpResponse(ctx, userRequest, userResponse)
+}
+
+// bearerToken returns the personal access token of the 'Authorization: Bearer' header
+func bearerToken(ctx iris.Context) string {
+    auth := ctx.GetHeader("Authorization")
+    if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+        return strings.TrimSpace(auth[7:])
+    }
+    return ""
+}
+
+// httpOpenAPI serves the OpenAPI document of the HTTP gateway
+func (gw *APP) httpOpenAPI(ctx iris.Context) {
+    ctx.ContentType("application/json")
+    _, _ = ctx.Write(api.OpenAPISpec)
+}
+
+// writeHttpResponse writes the response, compressed if the client accepts it
+func (gw *APP) writeHttpResponse(ctx iris.Context, userRequest *rpc.Request, userResponse *rpc.Response) {
+    if retryAfter := userResponse.RetryAfter(); retryAfter > 0 {
+        ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+        ctx.StatusCode(http.StatusTooManyRequests)
+    }
     responseBytes, _ := json.Marshal(userResponse)
+    if encoding := gw.responseEncoding(rpc.NegotiateEncoding(ctx.GetHeader("Accept-Encoding")), userRequest, responseBytes); encoding != rpc.EncodingIdentity {
+        if b, err := rpc.Compress(encoding, responseBytes); err == nil {
+            ctx.Header("Content-Encoding", encoding)
+            responseBytes = b
+        }
+    }
+    ctx.Header("Vary", "Accept-Encoding")
+    ctx.ContentType("application/json")
     n, _ := ctx.Write(responseBytes)
     gw.model.Report.CountDataOut(n)
 }
 
+// readHttpRequest decodes the body of the request which might have been compressed by gzip or deflate
+func (gw *APP) readHttpRequest(ctx iris.Context, userRequest *rpc.Request) error {
+    body, err := rpc.NewDecompressReader(ctx.GetHeader("Content-Encoding"), ctx.Request().Body)
+    if err != nil {
+        return err
+    }
+    defer body.Close()
+    return json.NewDecoder(io.LimitReader(body, rpc.MaxDecompressedSize)).Decode(userRequest)
+}
+
+// responseEncoding returns the encoding which the response must be compressed by. Small responses are
+// not compressed. Clients which have not negotiated any encoding, could still ask for a gzip response
+// by setting the 'gzip' flag of the request.
+func (gw *APP) responseEncoding(negotiated string, userRequest *rpc.Request, response []byte) string {
+    if len(response) < config.GetInt(config.CompressThreshold) {
+        return rpc.EncodingIdentity
+    }
+    if negotiated == rpc.EncodingIdentity && userRequest.Compressed {
+        return rpc.EncodingGzip
+    }
+    return negotiated
+}
+
 // httpCheckAuth
 func (gw *APP) httpCheckAuth(ctx iris.Context) {
     appToken := gw.model.Token.GetAppToken(ctx.GetHeader("X-APP-TOKEN"))
@@ -288,12 +430,128 @@ func (gw *APP) httpCheckAuth(ctx iris.Context) {
     return
 }
 
+// httpSSOLogin redirects the user to the login page of the identity provider
+func (gw *APP) httpSSOLogin(ctx iris.Context) {
+    authURL, state, err := gw.api.StartSSO(ctx.Params().Get("provider"))
+    if err != nil {
+        log.Warn("got error on starting sso", zap.Error(err), zap.String("Provider", ctx.Params().Get("provider")))
+        gw.redirectSSO(ctx, url.Values{"error": []string{"sso_unavailable"}})
+        return
+    }
+    gw.setSSOStateCookie(ctx, api.SSOStateHash(state), int(nested.SSOStateLifetime.Seconds()))
+    ctx.Redirect(authURL, http.StatusFound)
+}
+
+// setSSOStateCookie sets the cookie which binds the login to the browser, it is sent back by the
+// redirect of the provider hence SameSite must be Lax. A negative maxAge removes the cookie.
+func (gw *APP) setSSOStateCookie(ctx iris.Context, value string, maxAge int) {
+    ctx.SetCookie(&http.Cookie{
+        Name:     api.SSOStateCookie,
+        Value:    value,
+        Path:     "/oidc/",
+        MaxAge:   maxAge,
+        HttpOnly: true,
+        Secure:   strings.HasPrefix(config.GetString(config.OIDCBaseURL), "https://"),
+        SameSite: http.SameSiteLaxMode,
+    })
+}
+
+// httpSSOCallback handles the redirect of the identity provider and opens a session for the user. The
+// accounts which have two factor authentication get a ticket instead which is exchanged by session/sso_login.
+func (gw *APP) httpSSOCallback(ctx iris.Context) {
+    if e := ctx.URLParam("error"); len(e) > 0 {
+        gw.redirectSSO(ctx, url.Values{"error": []string{e}})
+        return
+    }
+    stateHash := ctx.GetCookie(api.SSOStateCookie)
+    gw.setSSOStateCookie(ctx, "", -1)
+    account, err := gw.api.FinishSSO(ctx.Params().Get("provider"), ctx.URLParam("state"), stateHash, ctx.URLParam("code"))
+    switch err {
+    case nil:
+    case api.ErrSSODisabled:
+        gw.redirectSSO(ctx, url.Values{"error": []string{"disabled"}})
+        return
+    case api.ErrSSOAdminLink:
+        gw.redirectSSO(ctx, url.Values{"error": []string{"admin_link"}})
+        return
+    default:
+        log.Warn("got error on finishing sso", zap.Error(err), zap.String("Provider", ctx.Params().Get("provider")))
+        gw.redirectSSO(ctx, url.Values{"error": []string{"sso_failed"}})
+        return
+    }
+    if account.Flags.TwoFactor {
+        ticket := gw.model.Identity.CreateTicket(account.ID)
+        if len(ticket) == 0 {
+            gw.redirectSSO(ctx, url.Values{"error": []string{"sso_failed"}})
+            return
+        }
+        gw.redirectSSO(ctx, url.Values{"ticket": []string{ticket}})
+        return
+    }
+    sk, ss, err := gw.api.CreateSession(account.ID, api.SessionInfo{
+        ClientIP:  ctx.RemoteAddr(),
+        UserAgent: ctx.GetHeader("User-Agent"),
+    })
+    if err != nil {
+        gw.redirectSSO(ctx, url.Values{"error": []string{"sso_failed"}})
+        return
+    }
+    gw.redirectSSO(ctx, url.Values{"_sk": []string{sk.Hex()}, "_ss": []string{ss}})
+}
+
+// redirectSSO opens the web app, the values are in the fragment so they are never sent to any server
+func (gw *APP) redirectSSO(ctx iris.Context, values url.Values) {
+    ctx.Header("Cache-Control", "no-store")
+    ctx.Header("Referrer-Policy", "no-referrer")
+    ctx.Redirect(fmt.Sprintf("%s/#/sso?%s", strings.TrimRight(config.GetString(config.WebAppBaseURL), "/"), values.Encode()), http.StatusFound)
+}
+
+// httpConfirmRevokeSession serves the page of the link in the new session alert. The session is not
+// closed by the link itself, since the scanners of the mail servers follow the links of the emails.
+func (gw *APP) httpConfirmRevokeSession(ctx iris.Context) {
+    ctx.Header("Cache-Control", "no-store")
+    ctx.Header("Referrer-Policy", "no-referrer")
+    _, _ = ctx.HTML("<form method=\"post\"><p>If you have not signed in from this device, close its session " +
+        "and change the password of your account.</p><button type=\"submit\">Close the session</button></form>")
+}
+
+// httpRevokeSession closes the session of the link in the new session alert, the owner of the account
+// uses it when the session has not been opened by them.
+func (gw *APP) httpRevokeSession(ctx iris.Context) {
+    ctx.Header("Cache-Control", "no-store")
+    ctx.Header("Referrer-Policy", "no-referrer")
+    if !gw.api.RevokeSession(ctx.Params().Get("token")) {
+        ctx.StatusCode(http.StatusNotFound)
+        _, _ = ctx.HTML("<p>This link is invalid or has been expired.</p>")
+        return
+    }
+    _, _ = ctx.HTML("<p>The session has been closed. Please change the password of your account.</p>")
+}
+
+// httpSMSReceipt handles the delivery receipts of the sms providers
+func (gw *APP) httpSMSReceipt(ctx iris.Context) {
+    switch err := gw.api.SMSReceipt(ctx.Params().Get("provider"), ctx.Request()); err {
+    case nil:
+        ctx.StatusCode(http.StatusNoContent)
+    case sms.ErrUnknownProvider, sms.ErrNoReceipts:
+        ctx.StatusCode(http.StatusNotFound)
+    case sms.ErrInvalidReceipt:
+        ctx.StatusCode(http.StatusForbidden)
+    default:
+        log.Warn("got error on sms receipt", zap.Error(err), zap.String("Provider", ctx.Params().Get("provider")))
+        ctx.StatusCode(http.StatusBadRequest)
+    }
+}
+
 func (gw *APP) websocketOnConnect(c *websocket.Conn) error {
     log.Debug("Websocket Connected",
         zap.String("ConnID", c.ID()),
         zap.String("RemoteIP", c.Socket().Request().RemoteAddr),
     )
 
+    // Keep the connection, so pushes could be delivered to it after session/recall
+    gw.api.Pusher().AddWebsocket(c)
+
     c.Write(websocket.Message{
         IsNative: true,
         Body:     _WelcomeMsgBytes,
@@ -303,7 +561,16 @@ func (gw *APP) websocketOnConnect(c *websocket.Conn) error {
 }
 
 func (gw *APP) websocketOnDisconnect(c *websocket.Conn) {
-    _ = gw.api.Pusher().UnregisterWebsocket(c.ID(), config.GetString(config.BundleID))
+    gw.api.Pusher().RemoveWebsocket(c)
+}
+
+// websocketEncoding returns the encoding which the client has negotiated when it connected, i.e.
+// '/ws?encoding=gzip'. Compressed responses are sent in binary frames.
+func websocketEncoding(c *websocket.Conn) string {
+    if r := c.Socket().Request(); r != nil {
+        return rpc.NegotiateEncoding(r.URL.Query().Get("encoding"))
+    }
+    return rpc.EncodingIdentity
 }
 
 func (gw *APP) websocketOnMessage(conn *neffos.NSConn, message neffos.Message) error {
@@ -315,7 +582,17 @@ func (gw *APP) websocketOnMessage(conn *neffos.NSConn, message neffos.Message) e
     } else {
         startTime := time.Now()
         userRequest := &rpc.Request{}
-        _ = json.Unmarshal(message.Body, userRequest)
+        body := message.Body
+        if message.SetBinary {
+            // Binary frames are compressed, the others are plain json
+            b, err := rpc.Decompress(rpc.DetectEncoding(body), body)
+            if err != nil {
+                log.Debug("got error on decompressing websocket message", zap.Error(err))
+                return nil
+            }
+            body = b
+        }
+        _ = json.Unmarshal(body, userRequest)
         userRequest.ClientIP = conn.Conn.Socket().Request().RemoteAddr
         userRequest.UserAgent = conn.Conn.Socket().Request().Header.Get("User-Agent")
         userRequest.WebsocketID = conn.Conn.ID()
@@ -330,10 +607,17 @@ func (gw *APP) websocketOnMessage(conn *neffos.NSConn, message neffos.Message) e
             zap.Duration("Duration", time.Now().Sub(startTime)),
         )
         bytes, _ := json.Marshal(userResponse)
+        binary := false
+        if encoding := gw.responseEncoding(websocketEncoding(conn.Conn), userRequest, bytes); encoding != rpc.EncodingIdentity {
+            if b, err := rpc.Compress(encoding, bytes); err == nil {
+                bytes, binary = b, true
+            }
+        }
         conn.Conn.Write(
             websocket.Message{
-                IsNative: true,
-                Body:     bytes,
+                IsNative:  true,
+                Body:      bytes,
+                SetBinary: binary,
             },
         )
         gw.model.Report.CountDataOut(len(bytes))
@@ -1,4 +1,4 @@
 #!/usr/bin/env bash
-cd ./gateway_api/
+cd ./pkg/rpc/api/
 doc-gen
 #cp api-doc.json ../../
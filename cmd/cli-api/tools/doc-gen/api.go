@@ -72,7 +72,7 @@ func main() {
         }
         return nil
     })
-
+    ExecuteOpenAPI("openapi.json", apiDoc)
 }
 
 func ScanComments(path string) []Line {
@@ -0,0 +1,151 @@
+package main
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "log"
+    "sort"
+    "strings"
+)
+
+// OpenAPIPathPrefix is the prefix of the commands in the HTTP gateway, i.e. POST /api/v1/account/get
+const OpenAPIPathPrefix = "/api/v1/"
+
+type M map[string]interface{}
+
+// ExecuteOpenAPI writes the OpenAPI 3 document of the services into filename. Each command is a POST
+// operation which takes the inputs of the command as a json object.
+func ExecuteOpenAPI(filename string, apis ApiDoc) {
+    paths := M{}
+    for _, service := range apis.Services {
+        for _, method := range service.Methods {
+            if len(method.Command) == 0 {
+                continue
+            }
+            paths[OpenAPIPathPrefix+method.Command] = M{
+                "post": openAPIOperation(service.Name, method),
+            }
+        }
+    }
+    doc := M{
+        "openapi": "3.0.3",
+        "info": M{
+            "title":   "Nested API",
+            "version": "1.0",
+        },
+        "paths": paths,
+        "components": M{
+            "securitySchemes": M{
+                "SessionKey":    M{"type": "apiKey", "in": "header", "name": "X-Session-Key"},
+                "SessionSec":    M{"type": "apiKey", "in": "header", "name": "X-Session-Secret"},
+                "AppID":         M{"type": "apiKey", "in": "header", "name": "X-APP-ID"},
+                "AppToken":      M{"type": "apiKey", "in": "header", "name": "X-APP-TOKEN"},
+                "PersonalToken": M{"type": "http", "scheme": "bearer"},
+            },
+            "schemas": M{
+                "Response": M{
+                    "type": "object",
+                    "properties": M{
+                        "status": M{"type": "string", "enum": []string{"ok", "err"}},
+                        "data":   M{"type": "object"},
+                    },
+                },
+                "Error": M{
+                    "type": "object",
+                    "properties": M{
+                        "err_code":    M{"type": "integer"},
+                        "items":       M{"type": "array", "items": M{"type": "string"}},
+                        "retry_after": M{"type": "integer"},
+                    },
+                },
+            },
+        },
+        "security": []M{
+            {"SessionKey": []string{}, "SessionSec": []string{}},
+            {"AppID": []string{}, "AppToken": []string{}},
+            {"PersonalToken": []string{}},
+            {},
+        },
+    }
+    b, err := json.MarshalIndent(doc, "", "  ")
+    if err != nil {
+        log.Println("ExecuteOpenAPI::", err.Error())
+        return
+    }
+    if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+        log.Println("ExecuteOpenAPI::", err.Error())
+    }
+}
+
+func openAPIOperation(serviceName string, method ServiceMethod) M {
+    properties := M{}
+    var required []string
+    for _, arg := range method.Arguments {
+        for _, name := range strings.Split(arg.Name, ",") {
+            name = strings.TrimSpace(name)
+            if len(name) == 0 {
+                continue
+            }
+            schema := openAPISchema(arg.Type)
+            if len(arg.Comment) > 0 {
+                schema["description"] = arg.Comment
+            }
+            properties[name] = schema
+            if arg.Required {
+                required = append(required, name)
+            }
+        }
+    }
+    if method.Pagination {
+        properties["skip"] = M{"type": "integer"}
+        properties["limit"] = M{"type": "integer"}
+        properties["before"] = M{"type": "integer"}
+        properties["after"] = M{"type": "integer"}
+    }
+    body := M{
+        "type":       "object",
+        "properties": properties,
+    }
+    if len(required) > 0 {
+        sort.Strings(required)
+        body["required"] = required
+    }
+    return M{
+        "tags":        []string{serviceName},
+        "operationId": strings.Replace(method.Command, "/", "_", -1),
+        "requestBody": M{
+            "content": M{
+                "application/json": M{"schema": body},
+            },
+        },
+        "responses": M{
+            "200": M{
+                "description": "ok or err, the error is in the data of the response",
+                "content": M{
+                    "application/json": M{"schema": M{"$ref": "#/components/schemas/Response"}},
+                },
+            },
+            "429": M{
+                "description": "rate limited",
+                "content": M{
+                    "application/json": M{"schema": M{"$ref": "#/components/schemas/Response"}},
+                },
+            },
+        },
+    }
+}
+
+func openAPISchema(argType string) M {
+    switch argType {
+    case "int":
+        return M{"type": "integer"}
+    case "float64":
+        return M{"type": "number"}
+    case "bool":
+        return M{"type": "boolean"}
+    case "[]string", "array":
+        return M{"type": "array", "items": M{}}
+    default:
+        return M{"type": "string"}
+    }
+}
@@ -23,6 +23,9 @@ func StartupCheckups() {
 	_ = _MongoDB.C(global.CollectionAccountsAccounts).EnsureIndex(mgo.Index{Key: []string{"account_id", "-pts"}, Background: true})
 	_ = _MongoDB.C(global.CollectionAccountsRecipients).EnsureIndex(mgo.Index{Key: []string{"account_id", "-pts"}, Background: true})
 	_ = _MongoDB.C(global.CollectionAccountsRecipients).EnsureIndex(mgo.Index{Key: []string{"account_id", "recipient"}, Background: true})
+	_ = _MongoDB.C(global.CollectionAccountsIdentities).EnsureIndex(mgo.Index{Key: []string{"account_id", "provider"}, Background: true})
+	_ = _MongoDB.C(global.CollectionScimTokens).EnsureIndex(mgo.Index{Key: []string{"account_id"}, Background: true})
+	_ = _MongoDB.C(global.CollectionScimGroups).EnsureIndex(mgo.Index{Key: []string{"display_name"}, Background: true})
 	_ = _MongoDB.C(global.CollectionAccountsDevices).EnsureIndex(mgo.Index{Key: []string{"uid"}, Background: true})
 	_ = _MongoDB.C(global.CollectionAccountsLabels).EnsureIndex(mgo.Index{Key: []string{"labels"}, Background: true})
 
@@ -46,6 +49,7 @@ func StartupCheckups() {
 		Background: true,
 	})
 	_ = _MongoDB.C(global.CollectionPosts).EnsureIndex(mgo.Index{Key: []string{"labels"}, Background: true})
+	_ = _MongoDB.C(global.CollectionPosts).EnsureIndex(mgo.Index{Key: []string{"email_meta.message_id"}, Background: true, Sparse: true})
 	_ = _MongoDB.C(global.CollectionPostsReads).EnsureIndex(mgo.Index{
 		Key:        []string{"account_id", "place_id", "-timestamp"},
 		Unique:     true,
@@ -62,6 +66,11 @@ func StartupCheckups() {
 	_ = _MongoDB.C(global.CollectionPostsSpams).EnsureIndex(mgo.Index{Key: []string{"places", "-timestamp"}, Background: true})
 	_ = _MongoDB.C(global.CollectionPostsSpams).EnsureIndex(mgo.Index{Key: []string{"recipients", "-timestamp"}, Background: true})
 	_ = _MongoDB.C(global.CollectionPostsSpams).EnsureIndex(mgo.Index{Key: []string{"sender", "-timestamp"}, Background: true})
+	_ = _MongoDB.C(global.CollectionPostsSpams).EnsureIndex(mgo.Index{Key: []string{"email_meta.message_id"}, Background: true, Sparse: true})
+
+	// CALENDAR.INVITES
+	_ = _MongoDB.C(global.CollectionCalendarInvites).EnsureIndex(mgo.Index{Key: []string{"uid"}, Background: true, Unique: true})
+	_ = _MongoDB.C(global.CollectionCalendarInvites).EnsureIndex(mgo.Index{Key: []string{"post_ids"}, Background: true})
 
 	// Tasks
 	_ = _MongoDB.C(global.CollectionTasks).EnsureIndex(mgo.Index{Key: []string{"members"}, Background: true})
@@ -87,6 +96,7 @@ func StartupCheckups() {
 	// Notifications
 	_ = _MongoDB.C(global.CollectionNotifications).EnsureIndex(mgo.Index{Key: []string{"account_id", "type"}, Background: true})
 	_ = _MongoDB.C(global.CollectionNotifications).EnsureIndex(mgo.Index{Key: []string{"account_id", "post_id"}, Background: true})
+	_ = _MongoDB.C(global.CollectionNotifications).EnsureIndex(mgo.Index{Key: []string{"account_id", "read"}, Background: true})
 
 	// Files
 	_ = _MongoDB.C(global.CollectionFiles).EnsureIndex(mgo.Index{Key: []string{"owners", "-upload_time"}, Background: true})
@@ -104,6 +114,12 @@ func StartupCheckups() {
 	// Tokens
 	_ = _MongoDB.C(global.CollectionTokensFiles).EnsureIndex(mgo.Index{Key: []string{"universal_id"}, Background: true})
 	_ = _MongoDB.C(global.CollectionTokensApps).EnsureIndex(mgo.Index{Key: []string{"account_id", "app_id"}, Background: true})
+	_ = _MongoDB.C(global.CollectionTokensApps).EnsureIndex(mgo.Index{Key: []string{"refresh_token"}, Background: true, Sparse: true})
+	_ = _MongoDB.C(global.CollectionTokensPersonal).EnsureIndex(mgo.Index{Key: []string{"hash"}, Unique: true, Background: true})
+	_ = _MongoDB.C(global.CollectionTokensPersonal).EnsureIndex(mgo.Index{Key: []string{"account_id"}, Background: true})
+
+	// Verifications
+	_ = _MongoDB.C(global.CollectionVerifications).EnsureIndex(mgo.Index{Key: []string{"messages"}, Background: true, Sparse: true})
 
 	// Reports
 	_ = _MongoDB.C(global.CollectionReportsCounters).EnsureIndex(mgo.Index{Key: []string{"key", "-date"}, Background: true})
@@ -242,7 +242,7 @@ func SyncSystemCounters() {
 }
 
 func CleanupSessions() {
-	_MongoDB.C(global.CollectionSessions).RemoveAll(bson.M{"expired": true})
+	_Manager.Session.RemoveExpired()
 }
 
 func CleanupTasks() {
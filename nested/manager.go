@@ -49,19 +49,25 @@ func init() {
 type Manager struct {
 	Account       *AccountManager
 	App           *AppManager
+	Calendar      *CalendarManager
 	Contact       *ContactManager
+	Directory     *DirectoryManager
 	File          *FileManager
 	Group         *GroupManager
 	Hook          *HookManager
+	Identity      *IdentityManager
 	Label         *LabelManager
 	License       *LicenseManager
+	Lockout       *LockoutManager
 	Notification  *NotificationManager
+	PersonalToken *PersonalTokenManager
 	Phone         *PhoneManager
 	Place         *PlaceManager
 	PlaceActivity *PlaceActivityManager
 	Post          *PostManager
 	PostActivity  *PostActivityManager
 	Report        *ReportManager
+	Scim          *ScimManager
 	Search        *SearchManager
 	Session       *SessionManager
 	Store         *StoreManager
@@ -70,6 +76,7 @@ type Manager struct {
 	TaskActivity  *TaskActivityManager
 	TimeBucket    *TimeBucketManager
 	Token         *TokenManager
+	TwoFactor     *TwoFactorManager
 	Verification  *VerificationManager
 }
 
@@ -87,19 +94,25 @@ func NewManager(instanceID, mongoDSN, redisDSN string, logLevel int) (*Manager,
 	_Manager = &Manager{
 		Account:       newAccountManager(),
 		App:           newAppManager(),
+		Calendar:      newCalendarManager(),
 		Contact:       newContactManager(),
+		Directory:     newDirectoryManager(),
 		File:          newFileManager(),
 		Group:         newGroupManager(),
 		Hook:          newHookManager(),
+		Identity:      newIdentityManager(),
 		Label:         newLabelManager(),
 		License:       newLicenceManager(),
+		Lockout:       newLockoutManager(),
 		Notification:  newNotificationManager(),
+		PersonalToken: newPersonalTokenManager(),
 		Phone:         newPhoneManager(),
 		Place:         newPlaceManager(),
 		PlaceActivity: newPlaceActivityManager(),
 		Post:          newPostManager(),
 		PostActivity:  newPostActivityManager(),
 		Report:        newReportManager(),
+		Scim:          newScimManager(),
 		Search:        newSearchManager(),
 		Session:       newSessionManager(),
 		Store:         newStoreManager(),
@@ -108,6 +121,7 @@ func NewManager(instanceID, mongoDSN, redisDSN string, logLevel int) (*Manager,
 		TaskActivity:  newTaskActivityManager(),
 		TimeBucket:    newTimeBucketManager(),
 		Token:         newTokenManager(),
+		TwoFactor:     newTwoFactorManager(),
 		Verification:  newVerificationManager(),
 	}
 	return _Manager, nil
@@ -56,6 +56,7 @@ type Account struct {
 	Flags              AccountFlags     `json:"flags" bson:"flags"`
 	Mail               AccountMail      `json:"mail" bson:"mail"`
 	JoinedOn           uint64           `json:"joined_on" bson:"joined_on"`
+	SecretChangedOn    uint64           `json:"secret_changed_on" bson:"secret_changed_on"`
 }
 type AccountCounters struct {
 	TotalNotifications  int `json:"total_notifications" bson:"total_notifications"`
@@ -70,11 +71,13 @@ type AccountLimits struct {
 }
 type AccountFlags struct {
 	ForcePasswordChange bool `json:"force_password_change" bson:"force_password_change"`
+	TwoFactor           bool `json:"two_factor" bson:"two_factor"`
 }
 type AccountPrivacy struct {
 	Searchable    bool `json:"searchable" bson:"searchable"`
 	ChangePicture bool `json:"change_picture" bson:"change_picture"`
 	ChangeProfile bool `json:"change_profile" bson:"change_profile"`
+	HidePresence  bool `json:"hide_presence" bson:"hide_presence"`
 }
 type AccountAuthority struct {
 	LabelEditor bool `json:"label_editor" bson:"label_editor"`
@@ -243,6 +246,7 @@ func (am *AccountManager) CreateUser(uid, pass, phone, country, fname, lname, em
 		JoinedOn: Timestamp(),
 		AuthKey:  RandomID(32),
 	}
+	acc.SecretChangedOn = acc.JoinedOn
 
 	// Set Default Privacy Settings
 	acc.Privacy.Searchable = true
@@ -675,7 +679,7 @@ func (am *AccountManager) SetLimit(accountID, limitKey string, n int) bool {
 }
 
 // SetPrivacy updates the account's privacy properties
-// 	Available privacy keys: searchable | change_picture | change_profile
+// 	Available privacy keys: searchable | change_picture | change_profile | hide_presence
 func (am *AccountManager) SetPrivacy(accountID, privacyKey string, privacyValue interface{}) {
 	// Remove the old document from cache
 	defer _Manager.Account.removeCache(accountID)
@@ -688,6 +692,8 @@ func (am *AccountManager) SetPrivacy(accountID, privacyKey string, privacyValue
 		q["privacy.change_picture"], ok = privacyValue.(bool)
 	case "change_profile":
 		q["privacy.change_profile"], ok = privacyValue.(bool)
+	case "hide_presence":
+		q["privacy.hide_presence"], ok = privacyValue.(bool)
 	}
 	if ok {
 		_MongoDB.C(global.CollectionAccounts).UpdateId(
@@ -730,20 +736,30 @@ func (am *AccountManager) SetPlaceNotification(accountID, placeID string, on boo
 }
 
 // SetPassword set the password for "accountID" if everything was going through with no problem it returns true
-// otherwise returns false
+// otherwise returns false. The previous password is kept in the history of the account.
 func (am *AccountManager) SetPassword(accountID, newPass string) bool {
 	defer _Manager.Account.removeCache(accountID)
+	acc := new(Account)
+	if err := _MongoDB.C(global.CollectionAccounts).FindId(accountID).Select(bson.M{"secret": 1}).One(acc); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
 	if hashed_pass, err := bcrypt.GenerateFromPassword([]byte(newPass), bcrypt.DefaultCost); err != nil {
 		log.Sugar().Info("Model::AccountManager::SetPassword::Error 1::", err.Error())
 		return false
 	} else {
-		if err := _MongoDB.C(global.CollectionAccounts).UpdateId(
-			accountID,
-			bson.M{"$set": bson.M{
-				"secret":                      string(hashed_pass),
-				"flags.force_password_change": false,
-			}},
-		); err != nil {
+		q := bson.M{"$set": bson.M{
+			"secret":                      string(hashed_pass),
+			"secret_changed_on":           Timestamp(),
+			"flags.force_password_change": false,
+		}}
+		if len(acc.Secret) > 0 {
+			q["$push"] = bson.M{"secret_history": bson.M{
+				"$each":  []string{acc.Secret},
+				"$slice": -global.SystemConstantsPasswordHistoryUL,
+			}}
+		}
+		if err := _MongoDB.C(global.CollectionAccounts).UpdateId(accountID, q); err != nil {
 			log.Sugar().Info("Model::AccountManager::SetPassword::Error 2::", err.Error())
 			return false
 		}
@@ -751,29 +767,76 @@ func (am *AccountManager) SetPassword(accountID, newPass string) bool {
 	return true
 }
 
-// Verify verifies if the username and password match and returns true if they were matched
-func (am *AccountManager) Verify(accountID, pass string) bool {
-	//
+// PasswordUsed returns true if the password matches any of the last n passwords of the account,
+// including the current one
+func (am *AccountManager) PasswordUsed(accountID, pass string, n int) bool {
+	if n <= 0 {
+		return false
+	}
+	doc := struct {
+		Secret  string   `bson:"secret"`
+		History []string `bson:"secret_history"`
+	}{}
+	if err := _MongoDB.C(global.CollectionAccounts).FindId(accountID).Select(bson.M{"secret": 1, "secret_history": 1}).One(&doc); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return false
+	}
+	hashes := append(doc.History, doc.Secret)
+	if len(hashes) > n {
+		hashes = hashes[len(hashes)-n:]
+	}
+	for _, h := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(h), []byte(pass)) == nil {
+			return true
+		}
+	}
+	return false
+}
 
-	acc := new(Account)
-	ch := mgo.Change{
-		Update:    bson.M{"$inc": bson.M{"counters.incorrect_attempts": 1}},
-		ReturnNew: true,
+// ExpirePasswords forces the user accounts to change their passwords if they have not been changed
+// since before. The accounts which have never changed their passwords are checked by their join time.
+// It returns the number of the accounts which have been forced.
+func (am *AccountManager) ExpirePasswords(before uint64, excludedIDs []string) int {
+	if excludedIDs == nil {
+		excludedIDs = []string{}
+	}
+	accounts := make([]Account, 0)
+	if err := _MongoDB.C(global.CollectionAccounts).Find(bson.M{
+		"_id":                         bson.M{"$nin": excludedIDs},
+		"acc_type":                    ACCOUNT_TYPE_USER,
+		"disabled":                    false,
+		"flags.force_password_change": bson.M{"$ne": true},
+		"$or": []bson.M{
+			{"secret_changed_on": bson.M{"$lt": before}},
+			{"secret_changed_on": bson.M{"$exists": false}, "joined_on": bson.M{"$lt": before}},
+		},
+	}).Select(bson.M{"_id": 1}).All(&accounts); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return 0
 	}
-	if _, err := _MongoDB.C(global.CollectionAccounts).Find(
-		bson.M{"_id": accountID},
-	).Apply(ch, acc); err != nil {
-		log.Sugar().Info("Model::AccountManager::Verify::Error 1::", err.Error())
+	n := 0
+	for _, acc := range accounts {
+		if am.ForcePasswordChange(acc.ID, true) {
+			n++
+		}
+	}
+	return n
+}
+
+// Verify verifies if the username and password match and returns true if they were matched. The
+// failed attempts are limited by the lockouts of the caller.
+func (am *AccountManager) Verify(accountID, pass string) bool {
+	acc := new(Account)
+	if err := _MongoDB.C(global.CollectionAccounts).FindId(accountID).Select(bson.M{"secret": 1}).One(acc); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
 		return false
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(acc.Secret), []byte(pass)); err != nil {
-		if acc.Counters.IncorrectAttempts > 10 {
-			_Manager.Account.Disable(accountID)
-		}
-		log.Sugar().Info("Model::AccountManager::Verify::Error 2::", err.Error())
 		return false
-	} else {
-		_Manager.Account.ResetLoginAttempts(accountID)
 	}
 	return true
 }
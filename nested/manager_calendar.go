@@ -0,0 +1,287 @@
+package nested
+
+import (
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+// Attendee statuses, they follow the PARTSTAT values of iCalendar
+const (
+	CalendarStatusNeedsAction = "NEEDS-ACTION"
+	CalendarStatusAccepted    = "ACCEPTED"
+	CalendarStatusDeclined    = "DECLINED"
+	CalendarStatusTentative   = "TENTATIVE"
+)
+
+type CalendarManager struct{}
+
+func newCalendarManager() *CalendarManager {
+	return new(CalendarManager)
+}
+
+// CalendarInvite is the meeting invitation which has been received by email. Each invite is identified by
+// the UID of the iCalendar event, and all the posts which carry the same event are linked to it.
+type CalendarInvite struct {
+	ID             bson.ObjectId      `json:"_id" bson:"_id"`
+	UID            string             `json:"uid" bson:"uid"`
+	Sequence       int                `json:"sequence" bson:"sequence"`
+	Summary        string             `json:"summary" bson:"summary"`
+	Description    string             `json:"description" bson:"description"`
+	Location       string             `json:"location" bson:"location"`
+	Start          uint64             `json:"start" bson:"start"`
+	End            uint64             `json:"end" bson:"end"`
+	AllDay         bool               `json:"all_day" bson:"all_day"`
+	OrganizerEmail string             `json:"organizer_email" bson:"organizer_email"`
+	OrganizerName  string             `json:"organizer_name" bson:"organizer_name"`
+	OrganizerID    string             `json:"organizer_id,omitempty" bson:"organizer_id,omitempty"`
+	Attendees      []CalendarAttendee `json:"attendees" bson:"attendees"`
+	PostIDs        []bson.ObjectId    `json:"post_ids" bson:"post_ids"`
+	TaskID         bson.ObjectId      `json:"task_id,omitempty" bson:"task_id,omitempty"`
+	Cancelled      bool               `json:"cancelled" bson:"cancelled"`
+	Timestamp      uint64             `json:"timestamp" bson:"timestamp"`
+	LastUpdate     uint64             `json:"last_update" bson:"last_update"`
+}
+
+type CalendarAttendee struct {
+	Email     string `json:"email" bson:"email"`
+	Name      string `json:"name" bson:"name"`
+	AccountID string `json:"account_id,omitempty" bson:"account_id,omitempty"`
+	Role      string `json:"role" bson:"role"`
+	Status    string `json:"status" bson:"status"`
+}
+
+// GetAttendeeByAccountID returns the attendee which is mapped to accountID
+func (ci *CalendarInvite) GetAttendeeByAccountID(accountID string) *CalendarAttendee {
+	for idx := range ci.Attendees {
+		if ci.Attendees[idx].AccountID == accountID {
+			return &ci.Attendees[idx]
+		}
+	}
+	return nil
+}
+
+func (ci *CalendarInvite) accountIDs() []string {
+	ids := make([]string, 0, len(ci.Attendees)+1)
+	if len(ci.OrganizerID) > 0 {
+		ids = append(ids, ci.OrganizerID)
+	}
+	for _, a := range ci.Attendees {
+		if len(a.AccountID) > 0 && a.AccountID != ci.OrganizerID {
+			ids = append(ids, a.AccountID)
+		}
+	}
+	return ids
+}
+
+// GetByID returns the invite identified by inviteID
+func (cm *CalendarManager) GetByID(inviteID bson.ObjectId) *CalendarInvite {
+	invite := new(CalendarInvite)
+	if err := _MongoDB.C(global.CollectionCalendarInvites).FindId(inviteID).One(invite); err != nil {
+		return nil
+	}
+	return invite
+}
+
+// GetByUID returns the invite which has been created by the iCalendar event identified by uid
+func (cm *CalendarManager) GetByUID(uid string) *CalendarInvite {
+	invite := new(CalendarInvite)
+	if err := _MongoDB.C(global.CollectionCalendarInvites).Find(bson.M{"uid": uid}).One(invite); err != nil {
+		return nil
+	}
+	return invite
+}
+
+// GetByPostID returns the invite which postID carries
+func (cm *CalendarManager) GetByPostID(postID bson.ObjectId) *CalendarInvite {
+	invite := new(CalendarInvite)
+	if err := _MongoDB.C(global.CollectionCalendarInvites).Find(bson.M{"post_ids": postID}).One(invite); err != nil {
+		return nil
+	}
+	return invite
+}
+
+// Request handles the iTIP REQUEST method. It creates the invite or updates it if the sequence of the
+// request is not older than the saved one. A task linked to postID is created for the invite with the
+// start time as its due date, organizer as its assignor and the attendees as its watchers.
+func (cm *CalendarManager) Request(req CalendarInvite, postID bson.ObjectId) *CalendarInvite {
+	dbSession := _MongoSession.Clone()
+	db := dbSession.DB(global.DbName)
+	defer dbSession.Close()
+
+	ts := Timestamp()
+	invite := cm.GetByUID(req.UID)
+	if invite == nil {
+		invite = &req
+		invite.ID = bson.NewObjectId()
+		invite.Timestamp = ts
+		invite.LastUpdate = ts
+		invite.PostIDs = []bson.ObjectId{postID}
+		if err := db.C(global.CollectionCalendarInvites).Insert(invite); err != nil {
+			log.Warn("Got error", zap.Error(err))
+			return nil
+		}
+	} else if req.Sequence < invite.Sequence {
+		// It is an outdated request, only link the post
+		if err := db.C(global.CollectionCalendarInvites).UpdateId(
+			invite.ID,
+			bson.M{"$addToSet": bson.M{"post_ids": postID}},
+		); err != nil {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return invite
+	} else {
+		// Keep the replies we already have if the organizer did not change the sequence
+		if req.Sequence == invite.Sequence {
+			for idx := range req.Attendees {
+				if old := findAttendee(invite.Attendees, req.Attendees[idx].Email); old != nil && old.Status != CalendarStatusNeedsAction {
+					req.Attendees[idx].Status = old.Status
+				}
+			}
+		}
+		invite.Sequence = req.Sequence
+		invite.Summary = req.Summary
+		invite.Description = req.Description
+		invite.Location = req.Location
+		invite.Start, invite.End, invite.AllDay = req.Start, req.End, req.AllDay
+		invite.OrganizerEmail, invite.OrganizerName, invite.OrganizerID = req.OrganizerEmail, req.OrganizerName, req.OrganizerID
+		invite.Attendees = req.Attendees
+		invite.Cancelled = false
+		invite.LastUpdate = ts
+		if err := db.C(global.CollectionCalendarInvites).UpdateId(
+			invite.ID,
+			bson.M{
+				"$set": bson.M{
+					"sequence":        invite.Sequence,
+					"summary":         invite.Summary,
+					"description":     invite.Description,
+					"location":        invite.Location,
+					"start":           invite.Start,
+					"end":             invite.End,
+					"all_day":         invite.AllDay,
+					"organizer_email": invite.OrganizerEmail,
+					"organizer_name":  invite.OrganizerName,
+					"organizer_id":    invite.OrganizerID,
+					"attendees":       invite.Attendees,
+					"cancelled":       false,
+					"last_update":     ts,
+				},
+				"$addToSet": bson.M{"post_ids": postID},
+			},
+		); err != nil {
+			log.Warn("Got error", zap.Error(err))
+			return nil
+		}
+	}
+	cm.syncTask(invite, postID)
+	return invite
+}
+
+// Cancel handles the iTIP CANCEL method, the linked task will be canceled too.
+func (cm *CalendarManager) Cancel(uid string, sequence int, postID bson.ObjectId) *CalendarInvite {
+	invite := cm.GetByUID(uid)
+	if invite == nil || sequence < invite.Sequence {
+		return nil
+	}
+	if err := _MongoDB.C(global.CollectionCalendarInvites).UpdateId(
+		invite.ID,
+		bson.M{
+			"$set":      bson.M{"cancelled": true, "last_update": Timestamp()},
+			"$addToSet": bson.M{"post_ids": postID},
+		},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return nil
+	}
+	invite.Cancelled = true
+	if invite.TaskID.Valid() {
+		if task := _Manager.Task.GetByID(invite.TaskID); task != nil {
+			task.UpdateStatus(task.AssignorID, TaskStatusCanceled)
+		}
+	}
+	return invite
+}
+
+// SetAttendeeStatus sets the participation status of the attendee identified by email. It is used for
+// the iTIP REPLY method and also when one of our accounts responds to the invite.
+func (cm *CalendarManager) SetAttendeeStatus(inviteID bson.ObjectId, email, status string) bool {
+	if err := _MongoDB.C(global.CollectionCalendarInvites).Update(
+		bson.M{"_id": inviteID, "attendees.email": email},
+		bson.M{"$set": bson.M{
+			"attendees.$.status": status,
+			"last_update":        Timestamp(),
+		}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// syncTask creates the task of the invite or updates it
+func (cm *CalendarManager) syncTask(invite *CalendarInvite, postID bson.ObjectId) {
+	accountIDs := invite.accountIDs()
+	if len(accountIDs) == 0 {
+		return
+	}
+	var task *Task
+	if invite.TaskID.Valid() {
+		task = _Manager.Task.GetByID(invite.TaskID)
+	}
+	if task == nil {
+		task = _Manager.Task.CreateTask(TaskCreateRequest{
+			AssignorID:      accountIDs[0],
+			WatcherIDs:      accountIDs[1:],
+			Title:           invite.Summary,
+			Description:     invite.taskDescription(),
+			RelatedPost:     postID,
+			DueDate:         invite.Start,
+			DueDateHasClock: !invite.AllDay,
+		})
+		if task == nil {
+			return
+		}
+		invite.TaskID = task.ID
+		if err := _MongoDB.C(global.CollectionCalendarInvites).UpdateId(
+			invite.ID,
+			bson.M{"$set": bson.M{"task_id": task.ID}},
+		); err != nil {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return
+	}
+
+	task.Update(task.AssignorID, invite.Summary, invite.taskDescription(), invite.Start, !invite.AllDay)
+	if task.Status == TaskStatusCanceled {
+		task.UpdateStatus(task.AssignorID, TaskStatusNotAssigned)
+	}
+	var newWatchers []string
+	for _, accountID := range accountIDs {
+		if accountID != task.AssignorID && !task.IsWatcher(accountID) {
+			newWatchers = append(newWatchers, accountID)
+		}
+	}
+	if len(newWatchers) > 0 {
+		task.AddWatchers(task.AssignorID, newWatchers)
+	}
+}
+
+func (ci *CalendarInvite) taskDescription() string {
+	if len(ci.Location) == 0 {
+		return ci.Description
+	}
+	if len(ci.Description) == 0 {
+		return ci.Location
+	}
+	return ci.Location + "\n\n" + ci.Description
+}
+
+func findAttendee(attendees []CalendarAttendee, email string) *CalendarAttendee {
+	for idx := range attendees {
+		if attendees[idx].Email == email {
+			return &attendees[idx]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package nested
+
+import (
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+// DirectoryAccount links an account to its entry in the LDAP directory. Disabled is set if the
+// account has been disabled by the sync, hence only those accounts are enabled again by the sync.
+type DirectoryAccount struct {
+	ID       string `bson:"_id" json:"_id"`
+	DN       string `bson:"dn" json:"dn"`
+	SyncedOn uint64 `bson:"synced_on" json:"synced_on"`
+	Disabled bool   `bson:"disabled" json:"disabled"`
+}
+
+type DirectoryManager struct{}
+
+func newDirectoryManager() *DirectoryManager {
+	return new(DirectoryManager)
+}
+
+// Get returns the directory link of the account or nil if the account is not from the directory
+func (m *DirectoryManager) Get(accountID string) *DirectoryAccount {
+	da := new(DirectoryAccount)
+	if err := _MongoDB.C(global.CollectionAccountsDirectory).FindId(accountID).One(da); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return da
+}
+
+// GetAll returns all the accounts which are linked to the directory
+func (m *DirectoryManager) GetAll() []DirectoryAccount {
+	das := make([]DirectoryAccount, 0)
+	if err := _MongoDB.C(global.CollectionAccountsDirectory).Find(bson.M{}).All(&das); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return das
+}
+
+// Save links the account to the directory entry and clears its Disabled flag
+func (m *DirectoryManager) Save(accountID, dn string) bool {
+	if _, err := _MongoDB.C(global.CollectionAccountsDirectory).UpsertId(
+		accountID,
+		bson.M{"$set": bson.M{
+			"dn":        dn,
+			"synced_on": Timestamp(),
+			"disabled":  false,
+		}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// SetDisabled marks the account as disabled by the sync
+func (m *DirectoryManager) SetDisabled(accountID string) bool {
+	if err := _MongoDB.C(global.CollectionAccountsDirectory).UpdateId(
+		accountID,
+		bson.M{"$set": bson.M{"disabled": true, "synced_on": Timestamp()}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,164 @@
+package nested
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+const (
+	// SSOStateLifetime is the time which user has to log in at the identity provider
+	SSOStateLifetime = 10 * time.Minute
+	// SSOTicketLifetime is the time which client has to finish the login by session/sso_login
+	SSOTicketLifetime = 5 * time.Minute
+)
+
+// Identity links an account to a user of an external identity provider
+type Identity struct {
+	ID        string `bson:"_id" json:"-"`
+	AccountID string `bson:"account_id" json:"account_id"`
+	Provider  string `bson:"provider" json:"provider"`
+	Subject   string `bson:"subject" json:"subject"`
+	Email     string `bson:"email" json:"email"`
+	LinkedOn  uint64 `bson:"linked_on" json:"linked_on"`
+}
+
+// SSOState is kept while the user is logging in at the identity provider
+type SSOState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+type IdentityManager struct{}
+
+func newIdentityManager() *IdentityManager {
+	return new(IdentityManager)
+}
+
+func identityID(provider, subject string) string {
+	return fmt.Sprintf("%s|%s", provider, subject)
+}
+
+// Get returns the identity of the subject at the provider or nil if it has not been linked
+func (m *IdentityManager) Get(provider, subject string) *Identity {
+	identity := new(Identity)
+	if err := _MongoDB.C(global.CollectionAccountsIdentities).FindId(identityID(provider, subject)).One(identity); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return identity
+}
+
+// GetByAccount returns the identities which have been linked to the account
+func (m *IdentityManager) GetByAccount(accountID string) []Identity {
+	identities := make([]Identity, 0)
+	if err := _MongoDB.C(global.CollectionAccountsIdentities).Find(bson.M{"account_id": accountID}).All(&identities); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return identities
+}
+
+// Link links the subject of the provider to the account, each subject is linked to only one account
+func (m *IdentityManager) Link(provider, subject, accountID, email string) bool {
+	if err := _MongoDB.C(global.CollectionAccountsIdentities).Insert(Identity{
+		ID:        identityID(provider, subject),
+		AccountID: accountID,
+		Provider:  provider,
+		Subject:   subject,
+		Email:     email,
+		LinkedOn:  Timestamp(),
+	}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// Unlink removes the identities of the provider from the account
+func (m *IdentityManager) Unlink(provider, accountID string) bool {
+	if _, err := _MongoDB.C(global.CollectionAccountsIdentities).RemoveAll(
+		bson.M{"account_id": accountID, "provider": provider},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// CreateState keeps the state of the login for SSOStateLifetime
+func (m *IdentityManager) CreateState(state string, s SSOState) bool {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	if _, err := c.Do("SETEX", fmt.Sprintf("sso-state:json:%s", state), int(SSOStateLifetime.Seconds()), b); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// ConsumeState returns the state and removes it, hence each state is used once
+func (m *IdentityManager) ConsumeState(state string) *SSOState {
+	b := consumeKey(fmt.Sprintf("sso-state:json:%s", state))
+	if b == nil {
+		return nil
+	}
+	s := new(SSOState)
+	if err := json.Unmarshal(b, s); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return nil
+	}
+	return s
+}
+
+// CreateTicket returns a one-time ticket which is exchanged with a session of the account
+func (m *IdentityManager) CreateTicket(accountID string) string {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	ticket := RandomID(48)
+	if _, err := c.Do("SETEX", fmt.Sprintf("sso-ticket:%s", ticket), int(SSOTicketLifetime.Seconds()), accountID); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return ""
+	}
+	return ticket
+}
+
+// ConsumeTicket returns the account of the ticket and removes the ticket
+func (m *IdentityManager) ConsumeTicket(ticket string) string {
+	return string(consumeKey(fmt.Sprintf("sso-ticket:%s", ticket)))
+}
+
+// consumeKey gets and deletes the key atomically
+func consumeKey(keyID string) []byte {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	_ = c.Send("MULTI")
+	_ = c.Send("GET", keyID)
+	_ = c.Send("DEL", keyID)
+	values, err := redis.Values(c.Do("EXEC"))
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	b, err := redis.Bytes(values[0], nil)
+	if err != nil {
+		return nil
+	}
+	return b
+}
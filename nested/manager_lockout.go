@@ -0,0 +1,125 @@
+package nested
+
+import (
+	"fmt"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Lockout Subjects
+const (
+	LockoutAccount = "account"
+	LockoutIP      = "ip"
+)
+
+// LockoutMemory is the time which the level of the lockouts is remembered after the last lockout
+const LockoutMemory = 24 * time.Hour
+
+// Lockout is the state of the failed logins of an account or a client ip. Level is the number of
+// the lockouts which have happened in the last LockoutMemory.
+type Lockout struct {
+	Failures    int    `json:"failures"`
+	Level       int    `json:"level"`
+	LockedUntil uint64 `json:"locked_until"`
+}
+
+// Locked returns true if the lockout has not been expired yet
+func (l Lockout) Locked() bool {
+	return l.LockedUntil > Timestamp()
+}
+
+// Remaining returns the time which is remained to the end of the lockout
+func (l Lockout) Remaining() time.Duration {
+	now := Timestamp()
+	if l.LockedUntil <= now {
+		return 0
+	}
+	return time.Duration(l.LockedUntil-now) * time.Millisecond
+}
+
+// lockoutFailScript counts a failed login, when the failures reach the threshold (ARGV[1]) the
+// subject is locked for ARGV[2] milliseconds which is doubled on each level up to ARGV[3].
+var lockoutFailScript = redis.NewScript(1, `
+local threshold = tonumber(ARGV[1])
+local base = tonumber(ARGV[2])
+local max = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local memory = tonumber(ARGV[5])
+local b = redis.call('HMGET', KEYS[1], 'failures', 'level', 'until')
+local failures = (tonumber(b[1]) or 0) + 1
+local level = tonumber(b[2]) or 0
+local lockedUntil = tonumber(b[3]) or 0
+if failures >= threshold then
+	level = level + 1
+	lockedUntil = now + math.min(base * math.pow(2, level - 1), max)
+	failures = 0
+end
+redis.call('HSET', KEYS[1], 'failures', failures, 'level', level, 'until', lockedUntil)
+redis.call('PEXPIRE', KEYS[1], math.max(lockedUntil - now, 0) + memory)
+return {failures, level, lockedUntil}
+`)
+
+type LockoutManager struct{}
+
+func newLockoutManager() *LockoutManager {
+	return new(LockoutManager)
+}
+
+func lockoutKey(subject, id string) string {
+	return fmt.Sprintf("lockout:%s:%s", subject, id)
+}
+
+// Get returns the lockout state of the account or the client ip
+func (m *LockoutManager) Get(subject, id string) Lockout {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	l := Lockout{}
+	values, err := redis.Values(c.Do("HMGET", lockoutKey(subject, id), "failures", "level", "until"))
+	if err != nil || len(values) != 3 {
+		log.Warn("Got error", zap.Error(err))
+		return l
+	}
+	failures, _ := redis.Int(values[0], nil)
+	level, _ := redis.Int(values[1], nil)
+	lockedUntil, _ := redis.Uint64(values[2], nil)
+	l.Failures, l.Level, l.LockedUntil = failures, level, lockedUntil
+	return l
+}
+
+// Fail counts a failed login of the account or the client ip and returns the new lockout state.
+// The subject is locked for the duration after threshold failures, the durations of the next
+// lockouts are doubled up to maxDuration.
+func (m *LockoutManager) Fail(subject, id string, threshold int, duration, maxDuration time.Duration) Lockout {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	l := Lockout{}
+	values, err := redis.Int64s(lockoutFailScript.Do(c,
+		lockoutKey(subject, id), threshold,
+		duration.Milliseconds(), maxDuration.Milliseconds(), Timestamp(), LockoutMemory.Milliseconds(),
+	))
+	if err != nil || len(values) != 3 {
+		log.Warn("Got error", zap.Error(err))
+		return l
+	}
+	l.Failures = int(values[0])
+	l.Level = int(values[1])
+	l.LockedUntil = uint64(values[2])
+	return l
+}
+
+// Reset removes the lockout and the failures of the account or the client ip
+func (m *LockoutManager) Reset(subject, id string) bool {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	if _, err := c.Do("DEL", lockoutKey(subject, id)); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
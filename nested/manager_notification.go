@@ -24,6 +24,7 @@ const (
 	NotificationTypeDemoted              = 0x007
 	NotificationTypePlaceSettingsChanged = 0x008
 	NotificationTypeNewSession           = 0x009
+	NotificationTypeLoginLocked          = 0x00A
 	NotificationTypeLabelRequestApproved = 0x011
 	NotificationTypeLabelRequestRejected = 0x012
 	NotificationTypeLabelRequestCreated  = 0x013
@@ -75,12 +76,14 @@ type Notification struct {
 	Timestamp      uint64           `json:"timestamp" bson:"timestamp"`
 	LastUpdate     uint64           `json:"last_update" bson:"last_update"`
 	Removed        bool             `json:"_removed,omitempty" bson:"_removed"`
+	Hidden         bool             `json:"-" bson:"_hidden,omitempty"`
 }
 type NotificationData struct {
 	Others     []string      `json:"others,omitempty" bson:"others"`
 	TaskTitle  string        `json:"task_title,omitempty" bson:"task_title,omitempty"`
 	TaskDesc   string        `json:"task_desc,omitempty" bson:"task_desc,omitempty"`
 	ActivityID bson.ObjectId `json:"activity_id,omitempty" bson:"activity_id,omitempty"`
+	SessionID  bson.ObjectId `json:"session_id,omitempty" bson:"session_id,omitempty"`
 	Text       string        `json:"text,omitempty" bson:"text,omitempty"`
 }
 
@@ -108,6 +111,29 @@ func (n *Notification) incrementCounter() {
 	)
 }
 
+// insert stores the notification if its owner wants it in-app or in the email digest, and returns it
+// to be pushed through the other channels. Notifications which are only stored for the digest are
+// hidden in-app and do not increment the counters, and the ones which have not been stored are
+// returned without ID.
+func (nm *NotificationManager) insert(db *mgo.Database, n *Notification) *Notification {
+	settings := nm.GetSettings(n.AccountID)
+	inApp := settings.Allowed(n.Type, NotificationChannelInApp)
+	digest := settings.Digest.Enabled && settings.Allowed(n.Type, NotificationChannelEmailDigest)
+	if !inApp && !digest {
+		n.ID = ""
+		return n
+	}
+	n.Hidden = !inApp
+	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return nil
+	}
+	if inApp {
+		n.incrementCounter()
+	}
+	return n
+}
+
 // GetByAccountID returns an array of Notifications which belong to accountID.
 // If only_unread is set to TRUE then this function returns only unread notifications otherwise returns read or unread
 // notifications.
@@ -125,6 +151,7 @@ func (nm *NotificationManager) GetByAccountID(
 	query := bson.M{
 		"account_id": accountID,
 		"_removed":   false,
+		"_hidden":    bson.M{"$ne": true},
 	}
 	switch subject {
 	case "task":
@@ -148,6 +175,36 @@ func (nm *NotificationManager) GetByAccountID(
 	return n
 }
 
+// GetUnreadByTypes returns the unread notifications of accountID with one of the types which have been
+// created after 'since'
+func (nm *NotificationManager) GetUnreadByTypes(accountID string, types []int, since uint64, limit int) []Notification {
+	n := make([]Notification, 0, limit)
+	if err := _MongoDB.C(global.CollectionNotifications).Find(bson.M{
+		"account_id": accountID,
+		"type":       bson.M{"$in": types},
+		"read":       false,
+		"_removed":   false,
+		"timestamp":  bson.M{"$gt": since},
+	}).Sort("-timestamp").Limit(limit).All(&n); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return n
+}
+
+// CountUnread returns the number of the unread notifications of the account
+func (nm *NotificationManager) CountUnread(accountID string) int {
+	n, err := _MongoDB.C(global.CollectionNotifications).Find(bson.M{
+		"account_id": accountID,
+		"read":       false,
+		"_removed":   false,
+		"_hidden":    bson.M{"$ne": true},
+	}).Count()
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return n
+}
+
 // GetByID returns a pointer to Notification object identified by notificationID
 func (nm *NotificationManager) GetByID(notificationID string) (n *Notification) {
 	//
@@ -281,12 +338,7 @@ func (nm *NotificationManager) AddMention(senderID, mentionedID string, postID,
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) JoinedPlace(adderID, addedID, placeID string) *Notification {
@@ -308,12 +360,7 @@ func (nm *NotificationManager) JoinedPlace(adderID, addedID, placeID string) *No
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) Comment(accountID, commenterID string, postID, commentID bson.ObjectId) *Notification {
@@ -362,12 +409,7 @@ func (nm *NotificationManager) Comment(accountID, commenterID string, postID, co
 	}
 
 	n.Data.Others = []string{n.ActorID}
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) Promoted(promotedID, promoterID, placeID string) *Notification {
@@ -389,12 +431,7 @@ func (nm *NotificationManager) Promoted(promotedID, promoterID, placeID string)
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) Demoted(demotedID, demoterID, placeID string) *Notification {
@@ -416,12 +453,7 @@ func (nm *NotificationManager) Demoted(demotedID, demoterID, placeID string) *No
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) PlaceSettingsChanged(accountID, changerID, placeID string) *Notification {
@@ -459,15 +491,12 @@ func (nm *NotificationManager) PlaceSettingsChanged(accountID, changerID, placeI
 			return n
 		}
 	}
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
-func (nm *NotificationManager) NewSession(accountID, clientID string) *Notification {
+// NewSession notifies the owner of the account that a session has been opened from a new device or
+// network, device describes the device and its location
+func (nm *NotificationManager) NewSession(accountID, clientID string, sessionKey bson.ObjectId, device string) *Notification {
 	//
 
 	dbSession := _MongoSession.Clone()
@@ -481,17 +510,30 @@ func (nm *NotificationManager) NewSession(accountID, clientID string) *Notificat
 	n.ActorID = "nested"
 	n.AccountID = accountID
 	n.ClientID = clientID
+	n.Data.SessionID = sessionKey
+	n.Data.Text = device
 	n.Timestamp = Timestamp()
 	n.LastUpdate = n.Timestamp
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
+}
+
+// LoginLocked notifies the owner of the account that the account has been locked by the failed
+// logins from the client ip
+func (nm *NotificationManager) LoginLocked(accountID, clientIP string) *Notification {
+	n := new(Notification)
+	n.ID = strings.ToUpper("LCK" + strconv.Itoa(int(Timestamp())) + RandomID(32))
+	n.Type = NotificationTypeLoginLocked
+	n.Subject = NotificationSubjectPost
+	n.ActorID = "nested"
+	n.AccountID = accountID
+	n.Data.Text = clientIP
+	n.Timestamp = Timestamp()
+	n.LastUpdate = n.Timestamp
+
+	return nm.insert(_MongoDB, n)
 }
 
 func (nm *NotificationManager) LabelRequestApproved(
@@ -516,12 +558,7 @@ func (nm *NotificationManager) LabelRequestApproved(
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 
 }
 
@@ -547,12 +584,7 @@ func (nm *NotificationManager) LabelRequestRejected(
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 
 }
 
@@ -596,12 +628,7 @@ func (nm *NotificationManager) LabelRequest(accountID, requesterID string) *Noti
 		}
 	}
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) LabelJoined(accountID, labelID, adderID string) *Notification {
@@ -623,12 +650,7 @@ func (nm *NotificationManager) LabelJoined(accountID, labelID, adderID string) *
 	n.Read = false
 	n.Removed = false
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 // Task Notifications
@@ -652,12 +674,7 @@ func (nm *NotificationManager) TaskAssigned(accountID, assignorID string, task *
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 
 }
 
@@ -682,12 +699,7 @@ func (nm *NotificationManager) TaskWatcherAdded(accountID, adderID string, task
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskEditorAdded(accountID, adderID string, task *Task) *Notification {
@@ -711,12 +723,7 @@ func (nm *NotificationManager) TaskEditorAdded(accountID, adderID string, task *
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskCandidateAdded(accountID, adderID string, task *Task) *Notification {
@@ -740,13 +747,7 @@ func (nm *NotificationManager) TaskCandidateAdded(accountID, adderID string, tas
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskAssigneeChanged(accountID, newAssigneeID, actorID string, task *Task) *Notification {
@@ -770,11 +771,7 @@ func (nm *NotificationManager) TaskAssigneeChanged(accountID, newAssigneeID, act
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskUpdated(
@@ -800,12 +797,7 @@ func (nm *NotificationManager) TaskUpdated(
 	n.Removed = false
 	n.Data.TaskDesc = newDesc
 	n.Data.TaskTitle = newTitle
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskOverdue(accountID string, task *Task) *Notification {
@@ -829,13 +821,7 @@ func (nm *NotificationManager) TaskOverdue(accountID string, task *Task) *Notifi
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskDueTimeUpdated(accountID string, task *Task) *Notification {
@@ -859,13 +845,7 @@ func (nm *NotificationManager) TaskDueTimeUpdated(accountID string, task *Task)
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskRejected(accountID, actorID string, task *Task) *Notification {
@@ -889,13 +869,7 @@ func (nm *NotificationManager) TaskRejected(accountID, actorID string, task *Tas
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskAccepted(accountID, actorID string, task *Task) *Notification {
@@ -919,13 +893,7 @@ func (nm *NotificationManager) TaskAccepted(accountID, actorID string, task *Tas
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskCompleted(accountID, actorID string, task *Task) *Notification {
@@ -949,13 +917,7 @@ func (nm *NotificationManager) TaskCompleted(accountID, actorID string, task *Ta
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskHold(accountID, actorID string, task *Task) *Notification {
@@ -979,13 +941,7 @@ func (nm *NotificationManager) TaskHold(accountID, actorID string, task *Task) *
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskInProgress(accountID, actorID string, task *Task) *Notification {
@@ -1009,13 +965,7 @@ func (nm *NotificationManager) TaskInProgress(accountID, actorID string, task *T
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskFailed(accountID, actorID string, task *Task) *Notification {
@@ -1039,13 +989,7 @@ func (nm *NotificationManager) TaskFailed(accountID, actorID string, task *Task)
 	n.Removed = false
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskCommentMentioned(
@@ -1072,12 +1016,7 @@ func (nm *NotificationManager) TaskCommentMentioned(
 	n.Data.ActivityID = activityID
 	n.Data.TaskTitle = task.Title
 
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
 
 func (nm *NotificationManager) TaskComment(accountID, actorID string, task *Task, activityID bson.ObjectId) *Notification {
@@ -1129,10 +1068,5 @@ func (nm *NotificationManager) TaskComment(accountID, actorID string, task *Task
 	}
 
 	n.Data.Others = []string{n.ActorID}
-	if err := db.C(global.CollectionNotifications).Insert(n); err != nil {
-		log.Warn("Got error", zap.Error(err))
-		return nil
-	}
-	n.incrementCounter()
-	return n
+	return nm.insert(db, n)
 }
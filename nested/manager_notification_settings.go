@@ -0,0 +1,263 @@
+package nested
+
+import (
+	"fmt"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+// Notification Channels
+const (
+	NotificationChannelInApp       = "in_app"
+	NotificationChannelMobilePush  = "mobile_push"
+	NotificationChannelWebPush     = "web_push"
+	NotificationChannelEmailDigest = "email_digest"
+)
+
+// Notification Categories, each notification type belongs to one category and users set their
+// preferences per category.
+const (
+	NotificationCategoryMention      = "mention"
+	NotificationCategoryComment      = "comment"
+	NotificationCategoryPlace        = "place"
+	NotificationCategorySession      = "session"
+	NotificationCategoryLabelRequest = "label_request"
+	NotificationCategoryTaskAssigned = "task_assigned"
+	NotificationCategoryTaskOverdue  = "task_overdue"
+	NotificationCategoryTaskUpdate   = "task_update"
+)
+
+var (
+	NotificationChannels = []string{
+		NotificationChannelInApp, NotificationChannelMobilePush,
+		NotificationChannelWebPush, NotificationChannelEmailDigest,
+	}
+	NotificationCategories = []string{
+		NotificationCategoryMention, NotificationCategoryComment, NotificationCategoryPlace,
+		NotificationCategorySession, NotificationCategoryLabelRequest, NotificationCategoryTaskAssigned,
+		NotificationCategoryTaskOverdue, NotificationCategoryTaskUpdate,
+	}
+)
+
+// NotificationCategory returns the category of the notification type
+func NotificationCategory(notificationType int) string {
+	switch notificationType {
+	case NotificationTypeMention, NotificationTypeTaskMention:
+		return NotificationCategoryMention
+	case NotificationTypeComment, NotificationTypeTaskComment:
+		return NotificationCategoryComment
+	case NotificationTypeJoinedPlace, NotificationTypePromoted, NotificationTypeDemoted,
+		NotificationTypePlaceSettingsChanged:
+		return NotificationCategoryPlace
+	case NotificationTypeNewSession, NotificationTypeLoginLocked:
+		return NotificationCategorySession
+	case NotificationTypeLabelRequestApproved, NotificationTypeLabelRequestRejected,
+		NotificationTypeLabelRequestCreated, NotificationTypeLabelJoined:
+		return NotificationCategoryLabelRequest
+	case NotificationTypeTaskAssigned, NotificationTypeTaskAssigneeChanged, NotificationTypeTaskAddToCandidates,
+		NotificationTypeTaskAddToWatchers, NotificationTypeTaskAddToEditors:
+		return NotificationCategoryTaskAssigned
+	case NotificationTypeTaskOverDue, NotificationTypeTaskDueTimeUpdated:
+		return NotificationCategoryTaskOverdue
+	default:
+		return NotificationCategoryTaskUpdate
+	}
+}
+
+// NotificationSettings are the notification preferences of an account. Channels of a category which
+// are not set are enabled. Quiet hours only mute the pushes (mobile and web).
+type NotificationSettings struct {
+	AccountID  string                     `json:"-" bson:"_id"`
+	Categories map[string]map[string]bool `json:"categories" bson:"categories"`
+	QuietHours QuietHours                 `json:"quiet_hours" bson:"quiet_hours"`
+	Digest     DigestSettings             `json:"digest" bson:"digest"`
+	LastUpdate uint64                     `json:"last_update" bson:"last_update"`
+}
+
+type QuietHours struct {
+	Enabled bool `json:"enabled" bson:"enabled"`
+	// Start and End are in 'HH:MM' format, if End is before Start the period passes midnight
+	Start    string `json:"start" bson:"start"`
+	End      string `json:"end" bson:"end"`
+	Timezone string `json:"timezone" bson:"timezone"`
+}
+
+// Digest Frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSettings are the settings of the email digest, Hour (and Weekday for the weekly digests)
+// are in the timezone of the quiet hours.
+type DigestSettings struct {
+	Enabled   bool   `json:"enabled" bson:"enabled"`
+	Frequency string `json:"frequency" bson:"frequency"`
+	Hour      int    `json:"hour" bson:"hour"`
+	Weekday   int    `json:"weekday" bson:"weekday"`
+	LastSent  uint64 `json:"last_sent" bson:"last_sent"`
+}
+
+// Validate checks the digest settings
+func (ds *DigestSettings) Validate() error {
+	switch ds.Frequency {
+	case DigestDaily, DigestWeekly:
+	default:
+		return fmt.Errorf("invalid frequency: %s", ds.Frequency)
+	}
+	if ds.Hour < 0 || ds.Hour > 23 {
+		return fmt.Errorf("invalid hour: %d", ds.Hour)
+	}
+	if ds.Weekday < 0 || ds.Weekday > 6 {
+		return fmt.Errorf("invalid weekday: %d", ds.Weekday)
+	}
+	return nil
+}
+
+// Period returns the duration between two digests
+func (ds *DigestSettings) Period() time.Duration {
+	if ds.Frequency == DigestWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Scheduled returns the last time before now which the digest should have been sent at
+func (ds *DigestSettings) Scheduled(now time.Time, timezone string) time.Time {
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		now = now.In(loc)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), ds.Hour, 0, 0, 0, now.Location())
+	days := 1
+	if ds.Frequency == DigestWeekly {
+		t = t.AddDate(0, 0, ds.Weekday-int(t.Weekday()))
+		days = 7
+	}
+	// days are not always 24 hours long, i.e. when the daylight saving time changes
+	for t.After(now) {
+		t = t.AddDate(0, 0, -days)
+	}
+	return t
+}
+
+// Allowed returns true if the notifications of the type could be delivered through the channel
+func (ns *NotificationSettings) Allowed(notificationType int, channel string) bool {
+	if ns == nil || ns.Categories == nil {
+		return true
+	}
+	channels, ok := ns.Categories[NotificationCategory(notificationType)]
+	if !ok {
+		return true
+	}
+	enabled, ok := channels[channel]
+	return !ok || enabled
+}
+
+// Set enables/disables the channel of the category
+func (ns *NotificationSettings) Set(category, channel string, enabled bool) {
+	if ns.Categories == nil {
+		ns.Categories = map[string]map[string]bool{}
+	}
+	if ns.Categories[category] == nil {
+		ns.Categories[category] = map[string]bool{}
+	}
+	ns.Categories[category][channel] = enabled
+}
+
+// Validate checks the quiet hours
+func (qh *QuietHours) Validate() error {
+	if _, err := time.LoadLocation(qh.Timezone); err != nil {
+		return err
+	}
+	if !qh.Enabled {
+		return nil
+	}
+	if _, err := parseClock(qh.Start); err != nil {
+		return err
+	}
+	_, err := parseClock(qh.End)
+	return err
+}
+
+// Active returns true if t is in the quiet hours
+func (qh *QuietHours) Active(t time.Time) bool {
+	if !qh.Enabled {
+		return false
+	}
+	start, err1 := parseClock(qh.Start)
+	end, err2 := parseClock(qh.End)
+	if err1 != nil || err2 != nil || start == end {
+		return false
+	}
+	if loc, err := time.LoadLocation(qh.Timezone); err == nil {
+		t = t.In(loc)
+	}
+	now := t.Hour()*60 + t.Minute()
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// parseClock returns the minutes of the day of 'HH:MM'
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// GetSettings returns the notification settings of the account, accounts which have not set their
+// settings get the defaults.
+func (nm *NotificationManager) GetSettings(accountID string) *NotificationSettings {
+	ns := new(NotificationSettings)
+	if err := _MongoDB.C(global.CollectionNotificationSettings).FindId(accountID).One(ns); err != nil {
+		ns = &NotificationSettings{
+			AccountID:  accountID,
+			Categories: map[string]map[string]bool{},
+			QuietHours: QuietHours{Timezone: "UTC"},
+			Digest:     DigestSettings{Frequency: DigestDaily, Hour: 8},
+		}
+	}
+	if ns.Digest.Frequency == "" {
+		ns.Digest.Frequency, ns.Digest.Hour = DigestDaily, 8
+	}
+	return ns
+}
+
+// SaveSettings saves the notification settings of the account
+func (nm *NotificationManager) SaveSettings(accountID string, ns *NotificationSettings) bool {
+	ns.AccountID = accountID
+	ns.LastUpdate = Timestamp()
+	if _, err := _MongoDB.C(global.CollectionNotificationSettings).UpsertId(accountID, ns); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// GetDigestSubscribers returns the settings of the accounts which have enabled the email digest
+func (nm *NotificationManager) GetDigestSubscribers() []NotificationSettings {
+	settings := make([]NotificationSettings, 0)
+	if err := _MongoDB.C(global.CollectionNotificationSettings).Find(bson.M{"digest.enabled": true}).All(&settings); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return settings
+}
+
+// ClaimDigest marks the digest of the account as sent if it has not been sent after scheduled. It
+// returns false if the digest has already been sent, i.e. by another instance.
+func (nm *NotificationManager) ClaimDigest(accountID string, scheduled uint64) bool {
+	if err := _MongoDB.C(global.CollectionNotificationSettings).Update(
+		bson.M{"_id": accountID, "digest.last_sent": bson.M{"$lt": scheduled}},
+		bson.M{"$set": bson.M{"digest.last_sent": Timestamp()}},
+	); err != nil {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package nested_test
+
+import (
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDigestSettings(t *testing.T) {
+	Convey("DigestSettings", t, func(c C) {
+		Convey("Validate", func(c C) {
+			for _, tc := range []struct {
+				ds    nested.DigestSettings
+				valid bool
+			}{
+				{nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8}, true},
+				{nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 23, Weekday: 6}, true},
+				{nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 0, Weekday: 0}, true},
+				{nested.DigestSettings{Frequency: "monthly", Hour: 8}, false},
+				{nested.DigestSettings{Frequency: "", Hour: 8}, false},
+				{nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 24}, false},
+				{nested.DigestSettings{Frequency: nested.DigestDaily, Hour: -1}, false},
+				{nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 8, Weekday: 7}, false},
+			} {
+				err := tc.ds.Validate()
+				c.So(err == nil, ShouldEqual, tc.valid)
+			}
+		})
+		Convey("Scheduled", func(c C) {
+			berlin, err := time.LoadLocation("Europe/Berlin")
+			c.So(err, ShouldBeNil)
+			for _, tc := range []struct {
+				ds       nested.DigestSettings
+				now      time.Time
+				timezone string
+				expected time.Time
+			}{
+				// daily, before and after the hour
+				{
+					nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8},
+					time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC), "UTC",
+					time.Date(2021, 8, 4, 8, 0, 0, 0, time.UTC),
+				},
+				{
+					nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8},
+					time.Date(2021, 8, 4, 7, 59, 0, 0, time.UTC), "UTC",
+					time.Date(2021, 8, 3, 8, 0, 0, 0, time.UTC),
+				},
+				// invalid timezones fall back to the timezone of now
+				{
+					nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8},
+					time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC), "Invalid/Zone",
+					time.Date(2021, 8, 4, 8, 0, 0, 0, time.UTC),
+				},
+				// the hour is in the timezone
+				{
+					nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8},
+					time.Date(2021, 8, 4, 7, 0, 0, 0, time.UTC), "Europe/Berlin",
+					time.Date(2021, 8, 4, 8, 0, 0, 0, berlin),
+				},
+				// the day before the daylight saving time started was 23 hours long
+				{
+					nested.DigestSettings{Frequency: nested.DigestDaily, Hour: 8},
+					time.Date(2021, 3, 28, 7, 30, 0, 0, berlin), "Europe/Berlin",
+					time.Date(2021, 3, 27, 8, 0, 0, 0, berlin),
+				},
+				// weekly, 2021-08-04 is a Wednesday
+				{
+					nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 8, Weekday: int(time.Monday)},
+					time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC), "UTC",
+					time.Date(2021, 8, 2, 8, 0, 0, 0, time.UTC),
+				},
+				{
+					nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 8, Weekday: int(time.Friday)},
+					time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC), "UTC",
+					time.Date(2021, 7, 30, 8, 0, 0, 0, time.UTC),
+				},
+				{
+					nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 10, Weekday: int(time.Wednesday)},
+					time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC), "UTC",
+					time.Date(2021, 7, 28, 10, 0, 0, 0, time.UTC),
+				},
+				// the week of the daylight saving time change
+				{
+					nested.DigestSettings{Frequency: nested.DigestWeekly, Hour: 8, Weekday: int(time.Sunday)},
+					time.Date(2021, 3, 28, 7, 0, 0, 0, berlin), "Europe/Berlin",
+					time.Date(2021, 3, 21, 8, 0, 0, 0, berlin),
+				},
+			} {
+				scheduled := tc.ds.Scheduled(tc.now, tc.timezone)
+				c.So(scheduled.Equal(tc.expected), ShouldBeTrue)
+				c.So(scheduled.After(tc.now), ShouldBeFalse)
+			}
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package nested
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	// PersonalTokenPrefix is the prefix of the personal access tokens, so they could be found by the
+	// secret scanners
+	PersonalTokenPrefix = "npat_"
+	// PersonalTokensLimit is the maximum number of the personal access tokens of each account
+	PersonalTokensLimit = 20
+	// PersonalTokenMaxDays is the maximum lifetime of the tokens which expire
+	PersonalTokenMaxDays = 3650
+)
+
+// PersonalToken is a personal access token which is created by the user for the scripts and the
+// CI jobs. It acts on behalf of the user but only within its scopes. Only the hash of the token
+// is kept, Hint is the last characters of the token to tell the tokens apart.
+type PersonalToken struct {
+	ID         string   `bson:"_id" json:"_id"`
+	Hash       string   `bson:"hash" json:"-"`
+	Hint       string   `bson:"hint" json:"hint"`
+	AccountID  string   `bson:"account_id" json:"account_id"`
+	Name       string   `bson:"name" json:"name"`
+	Scopes     []string `bson:"scopes" json:"scopes"`
+	CreatedOn  uint64   `bson:"created_on" json:"created_on"`
+	ExpireOn   uint64   `bson:"expire_on,omitempty" json:"expire_on,omitempty"`
+	LastUsedOn uint64   `bson:"last_used_on,omitempty" json:"last_used_on,omitempty"`
+	LastUsedIP string   `bson:"last_used_ip,omitempty" json:"last_used_ip,omitempty"`
+}
+
+// Active returns TRUE if the token has not been expired
+func (t PersonalToken) Active() bool {
+	return t.ExpireOn == 0 || t.ExpireOn > Timestamp()
+}
+
+type PersonalTokenManager struct{}
+
+func newPersonalTokenManager() *PersonalTokenManager {
+	return new(PersonalTokenManager)
+}
+
+func personalTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// Create creates a new token for the account and returns it, the token cannot be retrieved later.
+// expireOn is zero for the tokens which never expire.
+func (m *PersonalTokenManager) Create(accountID, name string, scopes []string, expireOn uint64) (string, *PersonalToken) {
+	token := PersonalTokenPrefix + RandomID(48)
+	t := &PersonalToken{
+		ID:        RandomID(24),
+		Hash:      personalTokenHash(token),
+		Hint:      token[len(token)-4:],
+		AccountID: accountID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedOn: Timestamp(),
+		ExpireOn:  expireOn,
+	}
+	if err := _MongoDB.C(global.CollectionTokensPersonal).Insert(t); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return "", nil
+	}
+	return token, t
+}
+
+// GetByToken returns the token or nil if it does not exist
+func (m *PersonalTokenManager) GetByToken(token string) *PersonalToken {
+	if !strings.HasPrefix(token, PersonalTokenPrefix) {
+		return nil
+	}
+	t := new(PersonalToken)
+	if err := _MongoDB.C(global.CollectionTokensPersonal).Find(bson.M{"hash": personalTokenHash(token)}).One(t); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return t
+}
+
+// GetByID returns the token identified by tokenID or nil if it does not exist
+func (m *PersonalTokenManager) GetByID(tokenID string) *PersonalToken {
+	t := new(PersonalToken)
+	if err := _MongoDB.C(global.CollectionTokensPersonal).FindId(tokenID).One(t); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return t
+}
+
+// GetByAccountID returns the tokens of the account, the newest first
+func (m *PersonalTokenManager) GetByAccountID(accountID string, pg Pagination) []PersonalToken {
+	return m.find(bson.M{"account_id": accountID}, pg)
+}
+
+// GetAll returns the tokens of all the accounts, the newest first
+func (m *PersonalTokenManager) GetAll(pg Pagination) []PersonalToken {
+	return m.find(bson.M{}, pg)
+}
+
+func (m *PersonalTokenManager) find(q bson.M, pg Pagination) []PersonalToken {
+	tokens := make([]PersonalToken, 0, pg.GetLimit())
+	if err := _MongoDB.C(global.CollectionTokensPersonal).Find(q).
+		Sort("-created_on").Skip(pg.GetSkip()).Limit(pg.GetLimit()).All(&tokens); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return tokens
+}
+
+// Count returns the number of the tokens of the account
+func (m *PersonalTokenManager) Count(accountID string) int {
+	n, err := _MongoDB.C(global.CollectionTokensPersonal).Find(bson.M{"account_id": accountID}).Count()
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return n
+}
+
+// UpdateLastUsed sets the last time and the ip which the token has been used by
+func (m *PersonalTokenManager) UpdateLastUsed(tokenID, ip string) {
+	if err := _MongoDB.C(global.CollectionTokensPersonal).UpdateId(
+		tokenID,
+		bson.M{"$set": bson.M{"last_used_on": Timestamp(), "last_used_ip": ip}},
+	); err != nil && err != mgo.ErrNotFound {
+		log.Warn("Got error", zap.Error(err))
+	}
+}
+
+// Revoke removes the token of the account, the requests of the token will be failed after revoking it
+func (m *PersonalTokenManager) Revoke(accountID, tokenID string) bool {
+	if err := _MongoDB.C(global.CollectionTokensPersonal).Remove(bson.M{
+		"_id":        tokenID,
+		"account_id": accountID,
+	}); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return false
+	}
+	return true
+}
+
+// RevokeAll removes all the tokens of the account
+func (m *PersonalTokenManager) RevokeAll(accountID string) bool {
+	if _, err := _MongoDB.C(global.CollectionTokensPersonal).RemoveAll(bson.M{"account_id": accountID}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// RemoveExpired removes the tokens which have been expired and returns their number
+func (m *PersonalTokenManager) RemoveExpired() int {
+	info, err := _MongoDB.C(global.CollectionTokensPersonal).RemoveAll(bson.M{
+		"expire_on": bson.M{"$gt": 0, "$lt": Timestamp()},
+	})
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return 0
+	}
+	return info.Removed
+}
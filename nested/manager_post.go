@@ -282,6 +282,9 @@ func (pm *PostManager) AddPost(pcr PostCreateRequest) *Post {
 
 	post := Post{}
 	ts := Timestamp()
+	if pcr.Timestamp > 0 {
+		ts = pcr.Timestamp
+	}
 	post.Type = PostTypeNormal
 	post.ReplyTo = pcr.ReplyTo
 	post.ForwardFrom = pcr.ForwardFrom
@@ -1359,6 +1362,22 @@ func (pm *PostManager) RemoveAccountFromWatcherList(postID bson.ObjectId, accoun
 	return true
 }
 
+// ExistsByMessageID returns true if there is a post (or spam) which has been created from an email with messageID
+func (pm *PostManager) ExistsByMessageID(messageID string) bool {
+	dbSession := _MongoSession.Clone()
+	db := dbSession.DB(global.DbName)
+	defer dbSession.Close()
+
+	q := bson.M{"email_meta.message_id": messageID}
+	if n, _ := db.C(global.CollectionPosts).Find(q).Count(); n > 0 {
+		return true
+	}
+	if n, _ := db.C(global.CollectionPostsSpams).Find(q).Count(); n > 0 {
+		return true
+	}
+	return false
+}
+
 // SetEmailMessageID set MessageID for the post, this function will be used by Gobryas service
 func (pm *PostManager) SetEmailMessageID(postID bson.ObjectId, messageID string) bool {
 	dbSession := _MongoSession.Clone()
@@ -1435,6 +1454,7 @@ type PostCreateRequest struct {
 	EmailMetadata   EmailMetadata  `json:"email_meta"`
 	SystemData      PostSystemData `json:"system_data"`
 	SpamScore       float64        `json:"spam_score"`
+	Timestamp       uint64         `json:"timestamp,omitempty"`
 }
 type Post struct {
 	ID              bson.ObjectId   `json:"_id" bson:"_id"`
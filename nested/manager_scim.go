@@ -0,0 +1,179 @@
+package nested
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	ScimGroupTypeLabel = "label"
+	ScimGroupTypePlace = "place"
+)
+
+// ScimToken is the bearer token of a SCIM client, only the hash of the token is kept
+type ScimToken struct {
+	ID        string `bson:"_id" json:"-"`
+	AccountID string `bson:"account_id" json:"account_id"`
+	CreatedOn uint64 `bson:"created_on" json:"created_on"`
+}
+
+// ScimGroup is a group of the identity provider which is mapped to a label or a place. Members are
+// the accounts which have been added by the identity provider. Owned is set if the label has been
+// created for the group, hence it is removed with the group.
+type ScimGroup struct {
+	ID          string   `bson:"_id" json:"_id"`
+	DisplayName string   `bson:"display_name" json:"display_name"`
+	ExternalID  string   `bson:"external_id" json:"external_id"`
+	Type        string   `bson:"type" json:"type"`
+	TargetID    string   `bson:"target_id" json:"target_id"`
+	Members     []string `bson:"members" json:"members"`
+	Owned       bool     `bson:"owned" json:"owned"`
+	CreatedOn   uint64   `bson:"created_on" json:"created_on"`
+	LastUpdate  uint64   `bson:"last_update" json:"last_update"`
+}
+
+type ScimManager struct{}
+
+func newScimManager() *ScimManager {
+	return new(ScimManager)
+}
+
+func scimTokenHash(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// CreateToken creates a new token for the account and returns it, the token cannot be retrieved later
+func (m *ScimManager) CreateToken(accountID string) string {
+	token := RandomID(64)
+	if err := _MongoDB.C(global.CollectionScimTokens).Insert(ScimToken{
+		ID:        scimTokenHash(token),
+		AccountID: accountID,
+		CreatedOn: Timestamp(),
+	}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return ""
+	}
+	return token
+}
+
+// GetTokenOwner returns the id of the account which owns the token or an empty string
+func (m *ScimManager) GetTokenOwner(token string) string {
+	t := new(ScimToken)
+	if err := _MongoDB.C(global.CollectionScimTokens).FindId(scimTokenHash(token)).One(t); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return ""
+	}
+	return t.AccountID
+}
+
+// RevokeTokens removes all the tokens of the account
+func (m *ScimManager) RevokeTokens(accountID string) bool {
+	if _, err := _MongoDB.C(global.CollectionScimTokens).RemoveAll(bson.M{"account_id": accountID}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// Users returns the user accounts sorted by their ids and the number of all the user accounts
+func (m *ScimManager) Users(skip, limit int) ([]Account, int) {
+	accounts := make([]Account, 0, limit)
+	q := _MongoDB.C(global.CollectionAccounts).Find(bson.M{"acc_type": ACCOUNT_TYPE_USER})
+	total, err := q.Count()
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return accounts, 0
+	}
+	if err := q.Sort("_id").Skip(skip).Limit(limit).All(&accounts); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return accounts, total
+}
+
+// CreateGroup creates the group, the id of the group is set by this function
+func (m *ScimManager) CreateGroup(g *ScimGroup) bool {
+	g.ID = bson.NewObjectId().Hex()
+	g.CreatedOn = Timestamp()
+	g.LastUpdate = g.CreatedOn
+	if g.Members == nil {
+		g.Members = []string{}
+	}
+	if err := _MongoDB.C(global.CollectionScimGroups).Insert(g); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// GetGroup returns the group or nil if it does not exist
+func (m *ScimManager) GetGroup(groupID string) *ScimGroup {
+	g := new(ScimGroup)
+	if err := _MongoDB.C(global.CollectionScimGroups).FindId(groupID).One(g); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return g
+}
+
+// GetGroups returns the groups which match the query and the number of all the matched groups
+func (m *ScimManager) GetGroups(q bson.M, skip, limit int) ([]ScimGroup, int) {
+	groups := make([]ScimGroup, 0, limit)
+	query := _MongoDB.C(global.CollectionScimGroups).Find(q)
+	total, err := query.Count()
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return groups, 0
+	}
+	if err := query.Sort("created_on").Skip(skip).Limit(limit).All(&groups); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return groups, total
+}
+
+// TargetMapped returns true if the label or the place has been mapped to a group already
+func (m *ScimManager) TargetMapped(groupType, targetID string) bool {
+	n, err := _MongoDB.C(global.CollectionScimGroups).Find(bson.M{"type": groupType, "target_id": targetID}).Count()
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return true
+	}
+	return n > 0
+}
+
+// UpdateGroup updates the name, the external id and the members of the group
+func (m *ScimManager) UpdateGroup(g *ScimGroup) bool {
+	g.LastUpdate = Timestamp()
+	if g.Members == nil {
+		g.Members = []string{}
+	}
+	if err := _MongoDB.C(global.CollectionScimGroups).UpdateId(g.ID, bson.M{"$set": bson.M{
+		"display_name": g.DisplayName,
+		"external_id":  g.ExternalID,
+		"members":      g.Members,
+		"last_update":  g.LastUpdate,
+	}}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// RemoveGroup removes the group, the label or the place of the group is not touched
+func (m *ScimManager) RemoveGroup(groupID string) bool {
+	if err := _MongoDB.C(global.CollectionScimGroups).RemoveId(groupID); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
@@ -7,11 +7,22 @@ import (
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/log"
 	"go.uber.org/zap"
+	"time"
 
+	"github.com/globalsign/mgo"
 	"github.com/globalsign/mgo/bson"
 	"github.com/gomodule/redigo/redis"
 )
 
+const (
+	// SessionTouchInterval is the minimum time between the updates of the last access of a session
+	SessionTouchInterval = time.Minute
+	// SessionRevokeLifetime is the time which the revoke links of the new sessions could be used in
+	SessionRevokeLifetime = 7 * 24 * time.Hour
+	// LoginsMemory is the number of the devices and the networks which are remembered for each account
+	LoginsMemory = 50
+)
+
 type Session struct {
 	ID            bson.ObjectId   `json:"_id" bson:"_id"`
 	SessionSecret string          `json:"_ss" bson:"_ss,omitempty"`
@@ -24,6 +35,7 @@ type Session struct {
 	DeviceID      string          `json:"_did,omitempty" bson:"_did,omitempty"`
 	DeviceToken   string          `json:"_dt,omitempty" bson:"_dt,omitempty"`
 	DeviceOS      string          `json:"_os,omitempty" bson:"_os,omitempty"`
+	DeviceName    string          `json:"device_name,omitempty" bson:"device_name,omitempty"`
 	ClientID      string          `json:"_cid" bson:"_cid"`
 	ClientVersion int             `json:"_cver" bson:"_cver"`
 }
@@ -31,6 +43,15 @@ type SessionSecurity struct {
 	CreatorIP string `json:"creator_ip" bson:"creator_ip"`
 	LastIP    string `json:"last_ip" bson:"last_ip"`
 	UserAgent string `json:"ua" bson:"ua"`
+	Location  string `json:"location,omitempty" bson:"location,omitempty"`
+}
+
+// AccountLogins are the devices and the networks which the account has logged in from
+type AccountLogins struct {
+	AccountID  string   `bson:"_id"`
+	Devices    []string `bson:"devices"`
+	Networks   []string `bson:"networks"`
+	LastUpdate uint64   `bson:"last_update"`
 }
 
 type SessionManager struct{}
@@ -93,6 +114,8 @@ func (sm *SessionManager) Create(in MS) (bson.ObjectId, error) {
 	sk := bson.NewObjectId()
 	creatorIP := in["ip"]
 	userAgent := in["ua"]
+	location := in["location"]
+	deviceName := in["device_name"]
 
 	// Increment Counters
 	_Manager.Report.CountSessionLogin()
@@ -104,10 +127,12 @@ func (sm *SessionManager) Create(in MS) (bson.ObjectId, error) {
 			CreatedOn:  ts,
 			LastUpdate: ts,
 			LastAccess: ts,
+			DeviceName: deviceName,
 			Security: SessionSecurity{
 				CreatorIP: creatorIP,
 				LastIP:    creatorIP,
 				UserAgent: userAgent,
+				Location:  location,
 			},
 			Expired: false,
 		},
@@ -220,22 +245,126 @@ func (sm *SessionManager) UpdateLastAccess(sk bson.ObjectId) bool {
 
 // Verify
 // verifies if the SessionKey(sk) and SessionSecret(ss) are matched and the session
-// with these keys are exists and valid
+// with these keys are exists and valid. The sessions which have been timed out are expired
+// and the last access of the valid sessions is updated.
 func (sm *SessionManager) Verify(sk bson.ObjectId, ss string) (r bool) {
 	//
 
-	if session := _Manager.Session.GetByID(sk); session == nil {
+	session := _Manager.Session.GetByID(sk)
+	if session == nil {
 		return false
 	} else if session.Expired || session.SessionSecret != ss {
 		return false
 	}
+	now := Timestamp()
+	if session.TimedOut(now) {
+		_Manager.Session.Expire(sk)
+		return false
+	}
+	if now-session.LastAccess > uint64(SessionTouchInterval.Milliseconds()) {
+		_Manager.Session.UpdateLastAccess(sk)
+	}
 	return true
 }
 
+// RemoveExpired removes the sessions which have been expired or timed out and returns the number of
+// the removed sessions
+func (sm *SessionManager) RemoveExpired() int {
+	or := []bson.M{{"expired": true}}
+	now := Timestamp()
+	if global.DefaultSessionIdleTimeout > 0 {
+		or = append(or, bson.M{"last_access": bson.M{"$lt": now - minutes(global.DefaultSessionIdleTimeout)}})
+	}
+	if global.DefaultSessionLifetime > 0 {
+		or = append(or, bson.M{"created_on": bson.M{"$lt": now - minutes(global.DefaultSessionLifetime)}})
+	}
+	info, err := _MongoDB.C(global.CollectionSessions).RemoveAll(bson.M{"$or": or})
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return 0
+	}
+	return info.Removed
+}
+
+// CreateRevokeToken returns a token which revokes the session without logging in, i.e. by the link
+// of the new session alerts
+func (sm *SessionManager) CreateRevokeToken(sk bson.ObjectId) string {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	token := RandomID(48)
+	if _, err := c.Do("SETEX", fmt.Sprintf("session-revoke:%s", token), int(SessionRevokeLifetime.Seconds()), sk.Hex()); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return ""
+	}
+	return token
+}
+
+// ConsumeRevokeToken returns the session of the token and removes the token
+func (sm *SessionManager) ConsumeRevokeToken(token string) bson.ObjectId {
+	sk := string(consumeKey(fmt.Sprintf("session-revoke:%s", token)))
+	if !bson.IsObjectIdHex(sk) {
+		return ""
+	}
+	return bson.ObjectIdHex(sk)
+}
+
+// RememberLogin remembers the device and the network of the login and returns true if the account
+// has logged in before but not from this device or network
+func (sm *SessionManager) RememberLogin(accountID, device, network string) bool {
+	logins := new(AccountLogins)
+	first := false
+	if err := _MongoDB.C(global.CollectionAccountsLogins).FindId(accountID).One(logins); err == mgo.ErrNotFound {
+		first = true
+	} else if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	q := bson.M{"$set": bson.M{"last_update": Timestamp()}}
+	push := bson.M{}
+	if !containsString(logins.Devices, device) {
+		push["devices"] = bson.M{"$each": []string{device}, "$slice": -LoginsMemory}
+	}
+	if !containsString(logins.Networks, network) {
+		push["networks"] = bson.M{"$each": []string{network}, "$slice": -LoginsMemory}
+	}
+	if len(push) > 0 {
+		q["$push"] = push
+	}
+	if _, err := _MongoDB.C(global.CollectionAccountsLogins).UpsertId(accountID, q); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+	return !first && len(push) > 0
+}
+
 /*
    Session
 */
 
+// TimedOut returns true if the session has been idle or alive longer than the lifetimes of the sessions
+func (s *Session) TimedOut(now uint64) bool {
+	if global.DefaultSessionIdleTimeout > 0 && s.LastAccess+minutes(global.DefaultSessionIdleTimeout) < now {
+		return true
+	}
+	if global.DefaultSessionLifetime > 0 && s.CreatedOn+minutes(global.DefaultSessionLifetime) < now {
+		return true
+	}
+	return false
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func minutes(n int) uint64 {
+	return uint64(time.Duration(n) * time.Minute / time.Millisecond)
+}
+
 func (s *Session) Login() {
 	//
 
@@ -99,6 +99,37 @@ func (sm *SystemManager) GetIntegerConstants() MI {
 	if _, ok := r.Integers[global.SystemConstantsRegisterMode]; !ok {
 		r.Integers[global.SystemConstantsRegisterMode] = global.RegisterMode
 	}
+	if _, ok := r.Integers[global.SystemConstantsTwoFactorPolicy]; !ok {
+		r.Integers[global.SystemConstantsTwoFactorPolicy] = global.TwoFactorPolicy
+	}
+
+	// Rate Limit Constants
+	for key, v := range rateLimitConstants() {
+		if _, ok := r.Integers[key]; !ok {
+			r.Integers[key] = *v.val
+		}
+	}
+
+	// Lockout Constants
+	for key, v := range lockoutConstants() {
+		if _, ok := r.Integers[key]; !ok {
+			r.Integers[key] = *v.val
+		}
+	}
+
+	// Password Policy Constants
+	for key, v := range passwordConstants() {
+		if _, ok := r.Integers[key]; !ok {
+			r.Integers[key] = *v.val
+		}
+	}
+
+	// Session Constants
+	for key, v := range sessionConstants() {
+		if _, ok := r.Integers[key]; !ok {
+			r.Integers[key] = *v.val
+		}
+	}
 
 	return r.Integers
 }
@@ -236,6 +267,25 @@ func (sm *SystemManager) SetIntegerConstants(m tools.M) {
 				global.SystemConstantsCacheLifetimeLL,
 				global.SystemConstantsCacheLifetimeUL,
 			)
+		case global.SystemConstantsRateLimit, global.SystemConstantsRateLimitBurst,
+			global.SystemConstantsRateLimitAuth, global.SystemConstantsRateLimitAuthBurst,
+			global.SystemConstantsRateLimitPostAdd, global.SystemConstantsRateLimitPostAddBurst,
+			global.SystemConstantsRateLimitSearch, global.SystemConstantsRateLimitSearchBurst,
+			global.SystemConstantsRateLimitIPFactor:
+			rl := rateLimitConstants()[key]
+			q[fmt.Sprintf("integers.%s", key)] = ClampInteger(iVal, rl.ll, rl.ul)
+		case global.SystemConstantsLockoutThreshold, global.SystemConstantsLockoutIPThreshold,
+			global.SystemConstantsLockoutDuration, global.SystemConstantsLockoutMaxDuration:
+			lc := lockoutConstants()[key]
+			q[fmt.Sprintf("integers.%s", key)] = ClampInteger(iVal, lc.ll, lc.ul)
+		case global.SystemConstantsPasswordMinLength, global.SystemConstantsPasswordMinClasses,
+			global.SystemConstantsPasswordNoAccountInfo, global.SystemConstantsPasswordHistory,
+			global.SystemConstantsPasswordMaxAge:
+			pc := passwordConstants()[key]
+			q[fmt.Sprintf("integers.%s", key)] = ClampInteger(iVal, pc.ll, pc.ul)
+		case global.SystemConstantsSessionIdleTimeout, global.SystemConstantsSessionLifetime:
+			sc := sessionConstants()[key]
+			q[fmt.Sprintf("integers.%s", key)] = ClampInteger(iVal, sc.ll, sc.ul)
 		case global.SystemConstantsRegisterMode:
 			switch iVal {
 			case global.RegisterModeAdminOnly, global.RegisterModeEveryone:
@@ -243,6 +293,13 @@ func (sm *SystemManager) SetIntegerConstants(m tools.M) {
 				iVal = global.RegisterModeAdminOnly
 			}
 			q[fmt.Sprintf("integers.%s", key)] = iVal
+		case global.SystemConstantsTwoFactorPolicy:
+			switch iVal {
+			case global.TwoFactorPolicyOptional, global.TwoFactorPolicyAdmins, global.TwoFactorPolicyEveryone:
+			default:
+				iVal = global.TwoFactorPolicyOptional
+			}
+			q[fmt.Sprintf("integers.%s", key)] = iVal
 		}
 
 	}
@@ -350,6 +407,129 @@ func (sm *SystemManager) LoadIntegerConstants() {
 	default:
 		global.RegisterMode = global.RegisterModeAdminOnly
 	}
+	switch iConstants[global.SystemConstantsTwoFactorPolicy] {
+	case global.TwoFactorPolicyOptional, global.TwoFactorPolicyAdmins, global.TwoFactorPolicyEveryone:
+		global.TwoFactorPolicy = iConstants[global.SystemConstantsTwoFactorPolicy]
+	default:
+		global.TwoFactorPolicy = global.TwoFactorPolicyOptional
+	}
+
+	// Rate Limit Constants
+	for key, rl := range rateLimitConstants() {
+		if v, ok := iConstants[key]; ok {
+			*rl.val = ClampInteger(v, rl.ll, rl.ul)
+		}
+	}
+
+	// Lockout Constants
+	for key, lc := range lockoutConstants() {
+		if v, ok := iConstants[key]; ok {
+			*lc.val = ClampInteger(v, lc.ll, lc.ul)
+		}
+	}
+
+	// Password Policy Constants
+	for key, pc := range passwordConstants() {
+		if v, ok := iConstants[key]; ok {
+			*pc.val = ClampInteger(v, pc.ll, pc.ul)
+		}
+	}
+
+	// Session Constants
+	for key, sc := range sessionConstants() {
+		if v, ok := iConstants[key]; ok {
+			*sc.val = ClampInteger(v, sc.ll, sc.ul)
+		}
+	}
+}
+
+type intConstant struct {
+	val    *int
+	ll, ul int
+}
+
+// rateLimitConstants returns the adjustable rate limits by their keys
+func rateLimitConstants() map[string]intConstant {
+	rate := func(v *int) intConstant {
+		return intConstant{val: v, ll: global.SystemConstantsRateLimitLL, ul: global.SystemConstantsRateLimitUL}
+	}
+	burst := func(v *int) intConstant {
+		return intConstant{val: v, ll: global.SystemConstantsRateLimitBurstLL, ul: global.SystemConstantsRateLimitBurstUL}
+	}
+	return map[string]intConstant{
+		global.SystemConstantsRateLimit:             rate(&global.DefaultRateLimit),
+		global.SystemConstantsRateLimitBurst:        burst(&global.DefaultRateLimitBurst),
+		global.SystemConstantsRateLimitAuth:         rate(&global.DefaultRateLimitAuth),
+		global.SystemConstantsRateLimitAuthBurst:    burst(&global.DefaultRateLimitAuthBurst),
+		global.SystemConstantsRateLimitPostAdd:      rate(&global.DefaultRateLimitPostAdd),
+		global.SystemConstantsRateLimitPostAddBurst: burst(&global.DefaultRateLimitPostAddBurst),
+		global.SystemConstantsRateLimitSearch:       rate(&global.DefaultRateLimitSearch),
+		global.SystemConstantsRateLimitSearchBurst:  burst(&global.DefaultRateLimitSearchBurst),
+		global.SystemConstantsRateLimitIPFactor: {
+			val: &global.DefaultRateLimitIPFactor,
+			ll:  global.SystemConstantsRateLimitIPFactorLL,
+			ul:  global.SystemConstantsRateLimitIPFactorUL,
+		},
+	}
+}
+
+// lockoutConstants returns the adjustable lockout parameters by their keys, zero thresholds disable
+// the lockouts
+func lockoutConstants() map[string]intConstant {
+	threshold := func(v *int) intConstant {
+		return intConstant{val: v, ll: global.SystemConstantsLockoutThresholdLL, ul: global.SystemConstantsLockoutThresholdUL}
+	}
+	duration := func(v *int) intConstant {
+		return intConstant{val: v, ll: global.SystemConstantsLockoutDurationLL, ul: global.SystemConstantsLockoutDurationUL}
+	}
+	return map[string]intConstant{
+		global.SystemConstantsLockoutThreshold:   threshold(&global.DefaultLockoutThreshold),
+		global.SystemConstantsLockoutIPThreshold: threshold(&global.DefaultLockoutIPThreshold),
+		global.SystemConstantsLockoutDuration:    duration(&global.DefaultLockoutDuration),
+		global.SystemConstantsLockoutMaxDuration: duration(&global.DefaultLockoutMaxDuration),
+	}
+}
+
+// passwordConstants returns the adjustable rules of the password policy by their keys
+func passwordConstants() map[string]intConstant {
+	return map[string]intConstant{
+		global.SystemConstantsPasswordMinLength: {
+			val: &global.DefaultPasswordMinLength,
+			ll:  global.SystemConstantsPasswordMinLengthLL,
+			ul:  global.SystemConstantsPasswordMinLengthUL,
+		},
+		global.SystemConstantsPasswordMinClasses: {
+			val: &global.DefaultPasswordMinClasses,
+			ll:  global.SystemConstantsPasswordMinClassesLL,
+			ul:  global.SystemConstantsPasswordMinClassesUL,
+		},
+		global.SystemConstantsPasswordNoAccountInfo: {
+			val: &global.DefaultPasswordNoAccountInfo,
+			ll:  global.SystemConstantsPasswordNoAccountInfoLL,
+			ul:  global.SystemConstantsPasswordNoAccountInfoUL,
+		},
+		global.SystemConstantsPasswordHistory: {
+			val: &global.DefaultPasswordHistory,
+			ll:  global.SystemConstantsPasswordHistoryLL,
+			ul:  global.SystemConstantsPasswordHistoryUL,
+		},
+		global.SystemConstantsPasswordMaxAge: {
+			val: &global.DefaultPasswordMaxAge,
+			ll:  global.SystemConstantsPasswordMaxAgeLL,
+			ul:  global.SystemConstantsPasswordMaxAgeUL,
+		},
+	}
+}
+
+// sessionConstants returns the adjustable lifetimes of the sessions by their keys
+func sessionConstants() map[string]intConstant {
+	lifetime := func(v *int) intConstant {
+		return intConstant{val: v, ll: global.SystemConstantsSessionLifetimeLL, ul: global.SystemConstantsSessionLifetimeUL}
+	}
+	return map[string]intConstant{
+		global.SystemConstantsSessionIdleTimeout: lifetime(&global.DefaultSessionIdleTimeout),
+		global.SystemConstantsSessionLifetime:    lifetime(&global.DefaultSessionLifetime),
+	}
 }
 
 func (sm *SystemManager) LoadStringConstants() {
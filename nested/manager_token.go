@@ -3,6 +3,7 @@ package nested
 import (
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/log"
@@ -17,6 +18,13 @@ const (
 	TokenTypeApp  string = "app"
 )
 
+// OAuth2 Lifetimes
+const (
+	AppTokenLifetime          = time.Hour
+	AppRefreshTokenLifetime   = 30 * 24 * time.Hour
+	AuthorizationCodeLifetime = 10 * time.Minute
+)
+
 type FileToken struct {
 	ID            string      `bson:"_id" json:"_id"`
 	Type          string      `json:"type" bson:"type"`
@@ -37,6 +45,33 @@ type AppToken struct {
 	AppID     string `bson:"app_id" json:"app_id"`
 	Expired   bool   `bson:"expired" json:"-"`
 	Favorite  bool   `bson:"favorite" json:"-"`
+
+	// The tokens which are issued by the authorization code flow are limited to the Scopes
+	// which user has granted. Tokens created before OAuth2 have nil Scopes and never expire.
+	Scopes          []string `bson:"scopes,omitempty" json:"scopes,omitempty"`
+	ExpireOn        uint64   `bson:"expire_on,omitempty" json:"expire_on,omitempty"`
+	RefreshToken    string   `bson:"refresh_token,omitempty" json:"-"`
+	RefreshExpireOn uint64   `bson:"refresh_expire_on,omitempty" json:"-"`
+}
+
+// Active returns TRUE if the token could be used to access the API
+func (t AppToken) Active() bool {
+	if t.Expired {
+		return false
+	}
+	return t.ExpireOn == 0 || t.ExpireOn > Timestamp()
+}
+
+// AuthorizationCode is the short-lived code which is given to the app after the user's consent.
+// It is exchanged with an AppToken only once and only by presenting the verifier of the
+// CodeChallenge (PKCE).
+type AuthorizationCode struct {
+	AppID               string   `json:"app_id"`
+	AccountID           string   `json:"account_id"`
+	RedirectURI         string   `json:"redirect_uri"`
+	Scopes              []string `json:"scopes"`
+	CodeChallenge       string   `json:"code_challenge"`
+	CodeChallengeMethod string   `json:"code_challenge_method"`
 }
 
 type TokenManager struct{}
@@ -139,6 +174,110 @@ func (tm *TokenManager) CreateAppToken(accountID, appID string) string {
 	return token.ID
 }
 
+// CreateScopedAppToken issues an access token limited to the scopes with a refresh token. The previous
+// tokens of the account for the app are replaced.
+func (tm *TokenManager) CreateScopedAppToken(accountID, appID string, scopes []string) *AppToken {
+	dbSession := _MongoSession.Clone()
+	db := dbSession.DB(global.DbName)
+	defer dbSession.Close()
+
+	var favorite bool
+	old := AppToken{}
+	if err := db.C(global.CollectionTokensApps).Find(bson.M{
+		"account_id": accountID,
+		"app_id":     appID,
+	}).One(&old); err == nil {
+		favorite = old.Favorite
+	}
+	if _, err := db.C(global.CollectionTokensApps).RemoveAll(bson.M{
+		"account_id": accountID,
+		"app_id":     appID,
+	}); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+
+	token := &AppToken{
+		ID:              RandomID(36),
+		AccountID:       accountID,
+		AppID:           appID,
+		Favorite:        favorite,
+		Scopes:          scopes,
+		ExpireOn:        uint64(time.Now().Add(AppTokenLifetime).UnixNano() / 1000000),
+		RefreshToken:    RandomID(48),
+		RefreshExpireOn: uint64(time.Now().Add(AppRefreshTokenLifetime).UnixNano() / 1000000),
+	}
+	if err := db.C(global.CollectionTokensApps).Insert(token); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return nil
+	}
+	return token
+}
+
+// RefreshAppToken rotates the access and the refresh tokens of the app. It returns nil if the refresh token
+// is not valid anymore.
+func (tm *TokenManager) RefreshAppToken(appID, refreshToken string) *AppToken {
+	dbSession := _MongoSession.Clone()
+	db := dbSession.DB(global.DbName)
+	defer dbSession.Close()
+
+	old := AppToken{}
+	if err := db.C(global.CollectionTokensApps).Find(bson.M{
+		"app_id":        appID,
+		"refresh_token": refreshToken,
+	}).One(&old); err != nil {
+		return nil
+	}
+	if old.Expired || old.RefreshExpireOn < Timestamp() {
+		_ = db.C(global.CollectionTokensApps).RemoveId(old.ID)
+		return nil
+	}
+	return tm.CreateScopedAppToken(old.AccountID, old.AppID, old.Scopes)
+}
+
+// CreateAuthorizationCode keeps the code in the cache for AuthorizationCodeLifetime
+func (tm *TokenManager) CreateAuthorizationCode(ac AuthorizationCode) string {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	b, err := json.Marshal(ac)
+	if err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return ""
+	}
+	code := RandomID(48)
+	if _, err := c.Do("SETEX", fmt.Sprintf("oauth-code:json:%s", code), int(AuthorizationCodeLifetime.Seconds()), b); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return ""
+	}
+	return code
+}
+
+// ConsumeAuthorizationCode returns the authorization code and removes it, hence each code could be used once.
+// It returns nil if the code does not exist or has been expired.
+func (tm *TokenManager) ConsumeAuthorizationCode(code string) *AuthorizationCode {
+	c := _Cache.Pool.Get()
+	defer c.Close()
+
+	keyID := fmt.Sprintf("oauth-code:json:%s", code)
+	_ = c.Send("MULTI")
+	_ = c.Send("GET", keyID)
+	_ = c.Send("DEL", keyID)
+	values, err := redis.Values(c.Do("EXEC"))
+	if err != nil || len(values) == 0 {
+		return nil
+	}
+	b, err := redis.Bytes(values[0], nil)
+	if err != nil {
+		return nil
+	}
+	ac := new(AuthorizationCode)
+	if err := json.Unmarshal(b, ac); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return nil
+	}
+	return ac
+}
+
 // GetFileByToken returns the universalID of the file which is attached to this token,
 // if any error happens it returns the error message as second return argument
 func (tm *TokenManager) GetFileByToken(token string) (UniversalID, error) {
@@ -0,0 +1,132 @@
+package nested
+
+import (
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"go.uber.org/zap"
+)
+
+// TwoFactor keeps the TOTP secret of the account. Secret is encrypted by the caller and the
+// RecoveryCodes are the hashes of the one-time recovery codes.
+type TwoFactor struct {
+	ID            string   `bson:"_id" json:"_id"`
+	Secret        string   `bson:"secret" json:"-"`
+	Enabled       bool     `bson:"enabled" json:"enabled"`
+	EnabledOn     uint64   `bson:"enabled_on" json:"enabled_on"`
+	RecoveryCodes []string `bson:"recovery_codes" json:"-"`
+	LastStep      int64    `bson:"last_step" json:"-"`
+}
+
+type TwoFactorManager struct{}
+
+func newTwoFactorManager() *TwoFactorManager {
+	return new(TwoFactorManager)
+}
+
+// Get returns the two factor settings of the account or nil if the account has not enrolled
+func (m *TwoFactorManager) Get(accountID string) *TwoFactor {
+	tf := new(TwoFactor)
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).FindId(accountID).One(tf); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return nil
+	}
+	return tf
+}
+
+// Enroll keeps the secret until user confirms it, the enabled two factors could not be enrolled again
+func (m *TwoFactorManager) Enroll(accountID, secret string) bool {
+	if _, err := _MongoDB.C(global.CollectionAccountsTwoFactor).Upsert(
+		bson.M{"_id": accountID, "enabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{
+			"secret":         secret,
+			"enabled":        false,
+			"recovery_codes": []string{},
+			"last_step":      0,
+		}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// Enable enables the two factor of the account and sets its recovery codes
+func (m *TwoFactorManager) Enable(accountID string, recoveryCodes []string, step int64) bool {
+	defer _Manager.Account.removeCache(accountID)
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).UpdateId(
+		accountID,
+		bson.M{"$set": bson.M{
+			"enabled":        true,
+			"enabled_on":     Timestamp(),
+			"recovery_codes": recoveryCodes,
+			"last_step":      step,
+		}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	if err := _MongoDB.C(global.CollectionAccounts).UpdateId(
+		accountID,
+		bson.M{"$set": bson.M{"flags.two_factor": true}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// Disable removes the two factor of the account
+func (m *TwoFactorManager) Disable(accountID string) bool {
+	defer _Manager.Account.removeCache(accountID)
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).RemoveId(accountID); err != nil && err != mgo.ErrNotFound {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	if err := _MongoDB.C(global.CollectionAccounts).UpdateId(
+		accountID,
+		bson.M{"$set": bson.M{"flags.two_factor": false}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// SetRecoveryCodes replaces the recovery codes of the account
+func (m *TwoFactorManager) SetRecoveryCodes(accountID string, recoveryCodes []string) bool {
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).UpdateId(
+		accountID,
+		bson.M{"$set": bson.M{"recovery_codes": recoveryCodes}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// UseStep marks the time step as used. It returns FALSE if the step or a newer one has been used
+// before, hence each code could be used only once.
+func (m *TwoFactorManager) UseStep(accountID string, step int64) bool {
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).Update(
+		bson.M{"_id": accountID, "last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"last_step": step}},
+	); err != nil {
+		return false
+	}
+	return true
+}
+
+// UseRecoveryCode removes the recovery code. It returns FALSE if the code does not exist.
+func (m *TwoFactorManager) UseRecoveryCode(accountID, recoveryCode string) bool {
+	if err := _MongoDB.C(global.CollectionAccountsTwoFactor).Update(
+		bson.M{"_id": accountID, "enabled": true, "recovery_codes": recoveryCode},
+		bson.M{"$pull": bson.M{"recovery_codes": recoveryCode}},
+	); err != nil {
+		return false
+	}
+	return true
+}
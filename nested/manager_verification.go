@@ -3,6 +3,7 @@ package nested
 import (
 	"crypto/md5"
 	"encoding/base64"
+	"fmt"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/log"
 	"go.uber.org/zap"
@@ -28,12 +29,17 @@ type Verification struct {
 	Verified  bool                `json:"verified" bson:"verified"`
 	Timestamp int64               `json:"timestamp" bson:"timestamp"`
 	Expired   bool                `json:"expired" bson:"expired"`
+	// Messages are the sms messages and calls which wait for their delivery receipts, in the format of
+	// provider:messageID
+	Messages []string `json:"-" bson:"messages,omitempty"`
 }
 type VerificationCounter struct {
-	Attempts int `json:"attempts" bson:"attempts"`
-	Sms      int `json:"sms" bson:"sms"`
-	Email    int `json:"email" bson:"email"`
-	Call     int `json:"call" bson:"call"`
+	Attempts  int `json:"attempts" bson:"attempts"`
+	Sms       int `json:"sms" bson:"sms"`
+	Email     int `json:"email" bson:"email"`
+	Call      int `json:"call" bson:"call"`
+	Delivered int `json:"delivered" bson:"delivered"`
+	Failed    int `json:"failed" bson:"failed"`
 }
 type VerificationManager struct{}
 
@@ -228,3 +234,38 @@ func (vm *VerificationManager) Expire(verifyID string) {
 		log.Warn("Got error", zap.Error(err))
 	}
 }
+
+// AddMessage adds the sms message or the call which has been sent for this Verification object, its
+// delivery receipt updates the counters of the Verification.
+func (vm *VerificationManager) AddMessage(verifyID, provider, messageID string) {
+	if err := _MongoDB.C(global.CollectionVerifications).UpdateId(
+		verifyID,
+		bson.M{"$push": bson.M{"messages": fmt.Sprintf("%s:%s", provider, messageID)}},
+	); err != nil {
+		log.Warn("Got error", zap.Error(err))
+	}
+}
+
+// UpdateDelivery increments the delivered or failed counter of the Verification object which the
+// message has been sent for. Each message is counted once, it returns false if the message is unknown
+// or has been counted before.
+func (vm *VerificationManager) UpdateDelivery(provider, messageID string, delivered bool) bool {
+	counter := "counters.failed"
+	if delivered {
+		counter = "counters.delivered"
+	}
+	message := fmt.Sprintf("%s:%s", provider, messageID)
+	if err := _MongoDB.C(global.CollectionVerifications).Update(
+		bson.M{"messages": message},
+		bson.M{
+			"$pull": bson.M{"messages": message},
+			"$inc":  bson.M{counter: 1},
+		},
+	); err != nil {
+		if err != mgo.ErrNotFound {
+			log.Warn("Got error", zap.Error(err))
+		}
+		return false
+	}
+	return true
+}
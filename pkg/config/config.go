@@ -22,6 +22,7 @@ const (
 	ADPMessageUrl      = "ADP_MESSAGE_URL"
 	ADPUsername        = "ADP_USERNAME"
 	ADPPassword        = "ADP_PASSWORD"
+	ADPSender          = "ADP_SENDER"
 	MonitorAccessToken = "MONITOR_ACCESS_TOKEN"
 	SystemAPIKey       = "SYSTEM_API_KEY"
 	SmtpUser           = "SMTP_USER"
@@ -33,8 +34,38 @@ const (
 	PostfixCHRoot      = "POSTFIX_CHROOT"
 	MailStoreSock      = "MAIL_STORE_SOCK"
 	MailUploadBaseURL  = "MAIL_UPLOAD_BASE_URL"
+	MailImportRoot     = "MAIL_IMPORT_ROOT" // directory of the archives which admin/import_mail could read
 	MailerDaemon       = "MAILER_DAEMON"
 	FirebaseCredPath   = "FIREBASE_CRED_PATH"
+	APNsKeyPath        = "APNS_KEY_PATH" // .p8 key for token based authentication
+	APNsKeyID          = "APNS_KEY_ID"
+	APNsTeamID         = "APNS_TEAM_ID"
+	APNsTopic          = "APNS_TOPIC" // bundle id of the iOS app
+	APNsSandbox        = "APNS_SANDBOX"
+	WebPushPrivateKey  = "WEBPUSH_PRIVATE_KEY" // VAPID private key (url safe base64)
+	WebPushSubject     = "WEBPUSH_SUBJECT"     // mailto: or https: contact of the push sender
+	CompressThreshold  = "COMPRESS_THRESHOLD"  // responses smaller than this (bytes) are not compressed
+	SecretsKey         = "SECRETS_KEY"         // encrypts the secrets which are kept in the db, i.e. 2FA secrets
+	AuthBackend        = "AUTH_BACKEND"        // local | ldap | ldap,local (ldap first then local accounts)
+	LdapURL            = "LDAP_URL"            // ldap://host:389 or ldaps://host:636
+	LdapBindDN         = "LDAP_BIND_DN"
+	LdapBindPassword   = "LDAP_BIND_PASSWORD"
+	LdapBaseDN         = "LDAP_BASE_DN"
+	LdapUserFilter     = "LDAP_USER_FILTER" // %s is replaced by the username
+	LdapSyncFilter     = "LDAP_SYNC_FILTER"
+	LdapAttrUID        = "LDAP_ATTR_UID"
+	LdapAttrFirstName  = "LDAP_ATTR_FIRST_NAME"
+	LdapAttrLastName   = "LDAP_ATTR_LAST_NAME"
+	LdapAttrEmail      = "LDAP_ATTR_EMAIL"
+	LdapAttrGroups     = "LDAP_ATTR_GROUPS"
+	LdapGroupMap       = "LDAP_GROUP_MAP"     // group:place:placeID;group:label:labelID
+	LdapSyncInterval   = "LDAP_SYNC_INTERVAL" // minutes, 0 disables the sync
+	OIDCProviders      = "OIDC_PROVIDERS"     // json array of the identity providers
+	OIDCBaseURL        = "OIDC_BASE_URL"      // public url of the api, callbacks are {OIDC_BASE_URL}/oidc/{name}/callback
+	BreachedPasswords  = "BREACHED_PASSWORDS" // directory of the k-anonymity range files of the breached passwords
+	GeoIPDatabase      = "GEOIP_DATABASE"     // csv file of the ip ranges and their locations
+	APIBaseURL         = "API_BASE_URL"       // public url of the api, i.e. for the links of the emails
+	SMSProviders       = "SMS_PROVIDERS"      // json array of the sms providers, in the order of failover
 )
 
 var (
@@ -47,6 +78,7 @@ func init() {
 	_ = dl.SetDefault(MailStoreSock, "private/nested-mail")
 	_ = dl.SetDefault(MailerDaemon, "MAILER_DAEMON")
 	_ = dl.SetDefault(MailUploadBaseURL, "http://127.0.0.1:8080")
+	_ = dl.SetDefault(MailImportRoot, "")
 	_ = dl.SetDefault(CyrusURL, "http://cyrus.nested.local")
 	_ = dl.SetDefault(Domains, "nested.me") // comma separated
 	_ = dl.SetDefault(SenderDomain, "nested.local")
@@ -70,9 +102,13 @@ func init() {
 	// Debugging
 	_ = dl.SetDefault(LogLevel, 2)
 
-	// ADP Configs
-	_ = dl.SetDefault(ADPUsername, "ronak")
-	_ = dl.SetDefault(ADPPassword, "E2e2374k19743")
+	// SMS Providers
+	_ = dl.SetDefault(SMSProviders, "")
+
+	// ADP Configs (used if SMS_PROVIDERS is not set)
+	_ = dl.SetDefault(ADPUsername, "")
+	_ = dl.SetDefault(ADPPassword, "")
+	_ = dl.SetDefault(ADPSender, "")
 	_ = dl.SetDefault(ADPMessageUrl, "https://ws.adpdigital.com/url/send")
 
 	// SMTP
@@ -81,6 +117,46 @@ func init() {
 	_ = dl.SetDefault(SmtpUser, "user")
 	_ = dl.SetDefault(SmtpPass, "pa$$word")
 
+	// APNs
+	_ = dl.SetDefault(APNsKeyPath, "")
+	_ = dl.SetDefault(APNsKeyID, "")
+	_ = dl.SetDefault(APNsTeamID, "")
+	_ = dl.SetDefault(APNsTopic, "")
+	_ = dl.SetDefault(APNsSandbox, false)
+
+	// Web Push (VAPID)
+	_ = dl.SetDefault(WebPushPrivateKey, "")
+	_ = dl.SetDefault(WebPushSubject, "mailto:admin@nested.me")
+
+	// Responses
+	_ = dl.SetDefault(CompressThreshold, 1024)
+
+	// Secrets
+	_ = dl.SetDefault(SecretsKey, "")
+
+	// Authentication
+	_ = dl.SetDefault(AuthBackend, "local")
+	_ = dl.SetDefault(LdapURL, "")
+	_ = dl.SetDefault(LdapBindDN, "")
+	_ = dl.SetDefault(LdapBindPassword, "")
+	_ = dl.SetDefault(LdapBaseDN, "")
+	_ = dl.SetDefault(LdapUserFilter, "(uid=%s)")
+	_ = dl.SetDefault(LdapSyncFilter, "(objectClass=person)")
+	_ = dl.SetDefault(LdapAttrUID, "uid")
+	_ = dl.SetDefault(LdapAttrFirstName, "givenName")
+	_ = dl.SetDefault(LdapAttrLastName, "sn")
+	_ = dl.SetDefault(LdapAttrEmail, "mail")
+	_ = dl.SetDefault(LdapAttrGroups, "memberOf")
+	_ = dl.SetDefault(LdapGroupMap, "")
+	_ = dl.SetDefault(LdapSyncInterval, 0)
+	_ = dl.SetDefault(OIDCProviders, "")
+	_ = dl.SetDefault(OIDCBaseURL, "")
+	_ = dl.SetDefault(BreachedPasswords, "")
+
+	// Sessions
+	_ = dl.SetDefault(GeoIPDatabase, "")
+	_ = dl.SetDefault(APIBaseURL, "")
+
 	// Extra Configs
 	_ = dl.SetDefault(MonitorAccessToken, "!@NES##monitor##TED@!")
 	_ = dl.SetDefault(SystemAPIKey, "testKey")
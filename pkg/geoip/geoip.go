@@ -0,0 +1,143 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DB finds the approximate locations of the ip addresses by the ranges of a csv file. Each row of
+// the file is 'start,end,country_code,country,region,city' (the layout of the IP2Location LITE
+// databases), where the region and the city are optional. The ranges are either ip addresses or
+// decimal numbers, the IPv4 addresses are mapped into IPv6 hence both could be in the same file.
+type DB struct {
+	ranges []ipRange
+}
+
+type ipRange struct {
+	start, end net.IP
+	location   string
+}
+
+// Load reads the csv file of the ranges
+func Load(path string) (*DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads the ranges from the csv reader
+func Read(r io.Reader) (*DB, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	db := &DB{}
+	locations := map[string]string{}
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(rec) < 3 {
+			return nil, fmt.Errorf("line %d: too few columns", line)
+		}
+		start, end := parseIP(rec[0]), parseIP(rec[1])
+		if start == nil || end == nil {
+			// the header of the file
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid range", line)
+		}
+		loc := location(rec)
+		if len(loc) == 0 {
+			continue
+		}
+		// the locations are repeated a lot, hence they are shared between the ranges
+		if l, ok := locations[loc]; ok {
+			loc = l
+		} else {
+			locations[loc] = loc
+		}
+		db.ranges = append(db.ranges, ipRange{start: start, end: end, location: loc})
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+	return db, nil
+}
+
+// Lookup returns the location of the ip address, i.e. 'Tehran, Iran', or an empty string if the ip
+// is not in any range
+func (db *DB) Lookup(addr string) string {
+	ip := net.ParseIP(addr).To16()
+	if ip == nil {
+		return ""
+	}
+	idx := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	}) - 1
+	if idx < 0 || bytes.Compare(ip, db.ranges[idx].end) > 0 {
+		return ""
+	}
+	return db.ranges[idx].location
+}
+
+// Len returns the number of the ranges
+func (db *DB) Len() int {
+	return len(db.ranges)
+}
+
+// location returns the city and the country of the record
+func location(rec []string) string {
+	var country, city string
+	switch {
+	case len(rec) >= 6:
+		country, city = rec[3], rec[5]
+	case len(rec) >= 4:
+		country = rec[3]
+	default:
+		country = rec[2]
+	}
+	parts := make([]string, 0, 2)
+	for _, p := range []string{city, country} {
+		if p = strings.TrimSpace(p); len(p) > 0 && p != "-" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+var maxIPv4 = big.NewInt(1<<32 - 1)
+
+// parseIP parses the ip address or its decimal number and returns it in 16 bytes
+func parseIP(s string) net.IP {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, ".:") {
+		return net.ParseIP(s).To16()
+	}
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return nil
+	}
+	if n.Cmp(maxIPv4) <= 0 {
+		b := make([]byte, 4)
+		n.FillBytes(b)
+		return net.IPv4(b[0], b[1], b[2], b[3]).To16()
+	}
+	ip := make(net.IP, net.IPv6len)
+	n.FillBytes(ip)
+	return ip
+}
@@ -0,0 +1,45 @@
+package geoip_test
+
+import (
+	"strings"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/geoip"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDB(t *testing.T) {
+	Convey("GeoIP", t, func(c C) {
+		Convey("Decimal Ranges", func(c C) {
+			// 8.0.0.0 - 8.0.0.255 and 5.160.0.0 - 5.160.255.255
+			db, err := geoip.Read(strings.NewReader(
+				`"ip_from","ip_to","country_code","country_name","region_name","city_name"` + "\n" +
+					`"134217728","134217983","US","United States of America","California","Mountain View"` + "\n" +
+					`"94371840","94437375","IR","Iran","Tehran","Tehran"` + "\n" +
+					`"94437376","94437631","-","-","-","-"` + "\n",
+			))
+			c.So(err, ShouldBeNil)
+			c.So(db.Len(), ShouldEqual, 2)
+			c.So(db.Lookup("5.160.12.1"), ShouldEqual, "Tehran, Iran")
+			c.So(db.Lookup("8.0.0.0"), ShouldEqual, "Mountain View, United States of America")
+			c.So(db.Lookup("8.0.1.0"), ShouldBeEmpty)
+			c.So(db.Lookup("5.161.0.1"), ShouldBeEmpty)
+			c.So(db.Lookup("1.1.1.1"), ShouldBeEmpty)
+			c.So(db.Lookup("invalid"), ShouldBeEmpty)
+		})
+		Convey("Address Ranges", func(c C) {
+			db, err := geoip.Read(strings.NewReader(
+				"10.0.0.0,10.255.255.255,ZZ,Private\n" +
+					"2001:db8::,2001:db8::ffff,ZZ,Documentation\n",
+			))
+			c.So(err, ShouldBeNil)
+			c.So(db.Lookup("10.1.2.3"), ShouldEqual, "Private")
+			c.So(db.Lookup("2001:db8::12"), ShouldEqual, "Documentation")
+			c.So(db.Lookup("2001:db8::1:0"), ShouldBeEmpty)
+		})
+		Convey("Invalid File", func(c C) {
+			_, err := geoip.Read(strings.NewReader("1,2,US\nx,y,US\n"))
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
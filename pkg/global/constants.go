@@ -41,6 +41,7 @@ const (
 var (
 	CacheLifetime        = 3600 // Seconds
 	RegisterMode         = RegisterModeAdminOnly
+	TwoFactorPolicy      = TwoFactorPolicyOptional
 	DefaultMaxUploadSize = "100MB"
 
 	DefaultPlaceMaxChildren   = 10
@@ -57,6 +58,34 @@ var (
 
 	DefaultLabelMaxMembers = 50
 
+	// Rate Limits are in requests per minute and zero disables the limit
+	DefaultRateLimit             = 600
+	DefaultRateLimitBurst        = 120
+	DefaultRateLimitAuth         = 20
+	DefaultRateLimitAuthBurst    = 10
+	DefaultRateLimitPostAdd      = 30
+	DefaultRateLimitPostAddBurst = 10
+	DefaultRateLimitSearch       = 120
+	DefaultRateLimitSearchBurst  = 30
+	DefaultRateLimitIPFactor     = 5
+
+	// Lockouts are in seconds and each lockout of the same account or ip doubles the previous one
+	DefaultLockoutThreshold   = 5
+	DefaultLockoutIPThreshold = 20
+	DefaultLockoutDuration    = 60
+	DefaultLockoutMaxDuration = 3600
+
+	// Password Policy, zero disables the rule and the maximum age is in days
+	DefaultPasswordMinLength     = 8
+	DefaultPasswordMinClasses    = 0
+	DefaultPasswordNoAccountInfo = 0
+	DefaultPasswordHistory       = 0
+	DefaultPasswordMaxAge        = 0
+
+	// Session Lifetimes are in minutes and zero never expires the sessions
+	DefaultSessionIdleTimeout = 0
+	DefaultSessionLifetime    = 0
+
 	DefaultCompanyName = "Nested"
 	DefaultCompanyDesc = "Team Communication Platform"
 	DefaultCompanyLogo = ""
@@ -75,16 +104,22 @@ const (
 	CollectionAccountsData           = "accounts.data" // Account's clients data
 	CollectionAccountsDevices        = "accounts.devices"
 	CollectionAccountsTrusted        = "accounts.trusted"
+	CollectionAccountsTwoFactor      = "accounts.two_factor"
+	CollectionAccountsDirectory      = "accounts.directory"  // Accounts which are synced from LDAP
+	CollectionAccountsIdentities     = "accounts.identities" // Accounts which are linked to the SSO providers
 	CollectionAccountsRecipients     = "accounts.recipients" // Account's most related emails
 	CollectionAccountsPlaces         = "accounts.places"     // Account's most related places
 	CollectionAccountsAccounts       = "accounts.accounts"   // Account's most related accounts
 	CollectionAccountsPosts          = "accounts.posts"      // Account's bookmarked posts
 	CollectionAccountsLabels         = "accounts.labels"
+	CollectionAccountsLogins         = "accounts.logins" // Devices and networks which the accounts have logged in from
 	CollectionAccountsSearchHistory  = "accounts.search.history"
+	CollectionCalendarInvites        = "calendar.invites"
 	CollectionContacts               = "contacts"
 	CollectionFiles                  = "files"
 	CollectionHooks                  = "hooks"
 	CollectionNotifications          = "notifications"
+	CollectionNotificationSettings   = "notifications.settings"
 	CollectionLabels                 = "labels"
 	CollectionLabelsRequests         = "labels.requests"
 	CollectionPhones                 = "phones"
@@ -103,6 +138,8 @@ const (
 	CollectionPostsWatchers          = "posts.watchers"
 	CollectionPostsFiles             = "posts.files"
 	CollectionReportsCounters        = "reports.counters"
+	CollectionScimTokens             = "scim.tokens" // Bearer tokens of the SCIM clients
+	CollectionScimGroups             = "scim.groups" // SCIM groups which are mapped to labels or places
 	CollectionSessions               = "sessions"
 	CollectionSysReservedWords       = "nsys.reserved_words"
 	CollectionSearchIndexPlaces      = "search.index.place"
@@ -112,6 +149,7 @@ const (
 	CollectionTokensApps             = "tokens.apps"
 	CollectionTokensFiles            = "tokens.files"
 	CollectionTokensLogins           = "tokens.logins"
+	CollectionTokensPersonal         = "tokens.personal" // Personal access tokens, only their hashes are kept
 	CollectionVerifications          = "verifications"
 	CollectionLogs                   = "logs"
 	CollectionTimeBuckets            = "time_buckets"
@@ -123,6 +161,13 @@ const (
 	RegisterModeAdminOnly int = 0x02
 )
 
+// TWO FACTOR POLICY
+const (
+	TwoFactorPolicyOptional int = 0x01
+	TwoFactorPolicyAdmins   int = 0x02
+	TwoFactorPolicyEveryone int = 0x03
+)
+
 // SYSTEM COUNTERS
 const (
 	SystemCountersEnabledAccounts  = "enabled_accounts"
@@ -148,6 +193,7 @@ const (
 	SystemConstantsPlaceMaxLevel          = "place_max_level"
 	SystemConstantsLabelMaxMembers        = "label_max_members"
 	SystemConstantsRegisterMode           = "register_mode"
+	SystemConstantsTwoFactorPolicy        = "two_factor_policy"
 	SystemConstantsUploadMaxSize          = "upload_max_size"
 	SystemConstantsCompanyName            = "company_name"
 	SystemConstantsCompanyDesc            = "company_desc"
@@ -155,6 +201,26 @@ const (
 	SystemConstantsSystemLang             = "system_lang"
 	SystemConstantsMagicNumber            = "magic_number"
 	SystemConstantsLicenseKey             = "license_key"
+	SystemConstantsRateLimit              = "rate_limit"
+	SystemConstantsRateLimitBurst         = "rate_limit_burst"
+	SystemConstantsRateLimitAuth          = "rate_limit_auth"
+	SystemConstantsRateLimitAuthBurst     = "rate_limit_auth_burst"
+	SystemConstantsRateLimitPostAdd       = "rate_limit_post_add"
+	SystemConstantsRateLimitPostAddBurst  = "rate_limit_post_add_burst"
+	SystemConstantsRateLimitSearch        = "rate_limit_search"
+	SystemConstantsRateLimitSearchBurst   = "rate_limit_search_burst"
+	SystemConstantsRateLimitIPFactor      = "rate_limit_ip_factor"
+	SystemConstantsLockoutThreshold       = "lockout_threshold"
+	SystemConstantsLockoutIPThreshold     = "lockout_ip_threshold"
+	SystemConstantsLockoutDuration        = "lockout_duration"
+	SystemConstantsLockoutMaxDuration     = "lockout_max_duration"
+	SystemConstantsPasswordMinLength      = "password_min_length"
+	SystemConstantsPasswordMinClasses     = "password_min_classes"
+	SystemConstantsPasswordNoAccountInfo  = "password_no_account_info"
+	SystemConstantsPasswordHistory        = "password_history"
+	SystemConstantsPasswordMaxAge         = "password_max_age"
+	SystemConstantsSessionIdleTimeout     = "session_idle_timeout"
+	SystemConstantsSessionLifetime        = "session_lifetime"
 
 	SystemConstantsCacheLifetimeUL          int = 86400 // seconds
 	SystemConstantsCacheLifetimeLL          int = 60
@@ -178,4 +244,26 @@ const (
 	SystemConstantsPlaceMaxLevelUL          int = 5
 	SystemConstantsLabelMaxMembersUL        int = 50
 	SystemConstantsLabelMaxMembersLL        int = 1
+	SystemConstantsRateLimitLL              int = 0
+	SystemConstantsRateLimitUL              int = 100000 // requests per minute
+	SystemConstantsRateLimitBurstLL         int = 1
+	SystemConstantsRateLimitBurstUL         int = 10000
+	SystemConstantsRateLimitIPFactorLL      int = 1
+	SystemConstantsRateLimitIPFactorUL      int = 100
+	SystemConstantsLockoutThresholdLL       int = 0
+	SystemConstantsLockoutThresholdUL       int = 1000
+	SystemConstantsLockoutDurationLL        int = 1
+	SystemConstantsLockoutDurationUL        int = 86400 // seconds
+	SystemConstantsPasswordMinLengthLL      int = 1
+	SystemConstantsPasswordMinLengthUL      int = 128
+	SystemConstantsPasswordMinClassesLL     int = 0
+	SystemConstantsPasswordMinClassesUL     int = 4
+	SystemConstantsPasswordNoAccountInfoLL  int = 0
+	SystemConstantsPasswordNoAccountInfoUL  int = 1
+	SystemConstantsPasswordHistoryLL        int = 0
+	SystemConstantsPasswordHistoryUL        int = 24
+	SystemConstantsPasswordMaxAgeLL         int = 0
+	SystemConstantsPasswordMaxAgeUL         int = 3650 // days
+	SystemConstantsSessionLifetimeLL        int = 0
+	SystemConstantsSessionLifetimeUL        int = 5256000 // minutes
 )
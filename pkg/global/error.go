@@ -26,6 +26,7 @@ const (
 	ErrTimeout        ErrorCode = 0x07
 	ErrSession        ErrorCode = 0x08
 	ErrNotImplemented ErrorCode = 0x09
+	ErrRateLimit      ErrorCode = 0x0A
 )
 
 type Payload interface{}
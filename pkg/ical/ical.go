@@ -0,0 +1,336 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iTIP methods (RFC 5546) which we handle
+const (
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+	MethodReply   = "REPLY"
+)
+
+// Participation status of the attendees
+const (
+	PartStatNeedsAction = "NEEDS-ACTION"
+	PartStatAccepted    = "ACCEPTED"
+	PartStatDeclined    = "DECLINED"
+	PartStatTentative   = "TENTATIVE"
+)
+
+const prodID = "-//Ronak Software Group//Nested//EN"
+
+type Calendar struct {
+	Method string
+	Events []Event
+}
+
+type Person struct {
+	Email string
+	Name  string
+}
+
+type Attendee struct {
+	Person
+	PartStat string
+	Role     string
+	RSVP     bool
+}
+
+type Event struct {
+	UID         string
+	Sequence    int
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Organizer   Person
+	Attendees   []Attendee
+}
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads an iCalendar (RFC 5545) object. Only the VEVENT components and the properties
+// which are needed for handling invitations are extracted.
+func Parse(r io.Reader) (*Calendar, error) {
+	props, err := readProperties(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		cal     = &Calendar{}
+		ev      *Event
+		depth   int
+		started bool
+	)
+	for _, p := range props {
+		switch p.name {
+		case "BEGIN":
+			switch strings.ToUpper(p.value) {
+			case "VCALENDAR":
+				started = true
+			case "VEVENT":
+				ev = &Event{}
+			default:
+				if ev != nil {
+					depth++
+				}
+			}
+			continue
+		case "END":
+			switch strings.ToUpper(p.value) {
+			case "VEVENT":
+				if ev != nil {
+					cal.Events = append(cal.Events, *ev)
+				}
+				ev = nil
+			case "VCALENDAR":
+			default:
+				if depth > 0 {
+					depth--
+				}
+			}
+			continue
+		}
+		if !started {
+			continue
+		}
+		if ev == nil {
+			if p.name == "METHOD" {
+				cal.Method = strings.ToUpper(p.value)
+			}
+			continue
+		}
+		// Skip the properties of the sub components (i.e. VALARM)
+		if depth > 0 {
+			continue
+		}
+		switch p.name {
+		case "UID":
+			ev.UID = p.value
+		case "SEQUENCE":
+			ev.Sequence, _ = strconv.Atoi(p.value)
+		case "SUMMARY":
+			ev.Summary = unescape(p.value)
+		case "DESCRIPTION":
+			ev.Description = unescape(p.value)
+		case "LOCATION":
+			ev.Location = unescape(p.value)
+		case "STATUS":
+			ev.Status = strings.ToUpper(p.value)
+		case "DTSTART":
+			ev.Start, ev.AllDay = parseTime(p)
+		case "DTEND":
+			ev.End, _ = parseTime(p)
+		case "ORGANIZER":
+			ev.Organizer = Person{Email: mailto(p.value), Name: p.params["CN"]}
+		case "ATTENDEE":
+			a := Attendee{
+				Person:   Person{Email: mailto(p.value), Name: p.params["CN"]},
+				PartStat: strings.ToUpper(p.params["PARTSTAT"]),
+				Role:     strings.ToUpper(p.params["ROLE"]),
+				RSVP:     strings.EqualFold(p.params["RSVP"], "TRUE"),
+			}
+			if a.PartStat == "" {
+				a.PartStat = PartStatNeedsAction
+			}
+			ev.Attendees = append(ev.Attendees, a)
+		}
+	}
+	if !started {
+		return nil, fmt.Errorf("no VCALENDAR object found")
+	}
+	return cal, nil
+}
+
+// Reply creates an iTIP REPLY for the event on behalf of the attendee
+func Reply(ev Event, attendee Attendee) []byte {
+	w := &writer{}
+	w.line("BEGIN", nil, "VCALENDAR")
+	w.line("VERSION", nil, "2.0")
+	w.line("PRODID", nil, prodID)
+	w.line("METHOD", nil, MethodReply)
+	w.line("BEGIN", nil, "VEVENT")
+	w.line("UID", nil, ev.UID)
+	w.line("SEQUENCE", nil, strconv.Itoa(ev.Sequence))
+	w.line("DTSTAMP", nil, time.Now().UTC().Format("20060102T150405Z"))
+	if !ev.Start.IsZero() {
+		if ev.AllDay {
+			w.line("DTSTART", []string{"VALUE=DATE"}, ev.Start.Format("20060102"))
+		} else {
+			w.line("DTSTART", nil, ev.Start.UTC().Format("20060102T150405Z"))
+		}
+	}
+	if len(ev.Summary) > 0 {
+		w.line("SUMMARY", nil, escape(ev.Summary))
+	}
+	w.line("ORGANIZER", personParams(ev.Organizer), "mailto:"+ev.Organizer.Email)
+	w.line("ATTENDEE", append(personParams(attendee.Person), "PARTSTAT="+attendee.PartStat), "mailto:"+attendee.Email)
+	w.line("END", nil, "VEVENT")
+	w.line("END", nil, "VCALENDAR")
+	return w.buf.Bytes()
+}
+
+func personParams(p Person) []string {
+	if len(p.Name) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("CN=\"%s\"", strings.ReplaceAll(p.Name, "\"", ""))}
+}
+
+type writer struct {
+	buf bytes.Buffer
+}
+
+// line writes a content line and folds it at 75 octets
+func (w *writer) line(name string, params []string, value string) {
+	l := name
+	for _, p := range params {
+		l += ";" + p
+	}
+	l += ":" + value
+	// the continuation lines start with a space which is counted too
+	limit := 75
+	for len(l) > limit {
+		cut := limit
+		// do not split utf-8 sequences
+		for cut > 0 && l[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.buf.WriteString(l[:cut])
+		w.buf.WriteString("\r\n ")
+		l = l[cut:]
+		limit = 74
+	}
+	w.buf.WriteString(l)
+	w.buf.WriteString("\r\n")
+}
+
+func readProperties(r io.Reader) ([]property, error) {
+	var (
+		lines []string
+		props []property
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if len(l) > 0 && (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		if len(l) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	for _, l := range lines {
+		if p, ok := parseProperty(l); ok {
+			props = append(props, p)
+		}
+	}
+	return props, nil
+}
+
+func parseProperty(l string) (property, bool) {
+	p := property{params: map[string]string{}}
+	// find the colon which separates the value, colons inside quoted parameters are ignored
+	quoted := false
+	idx := -1
+	for i := 0; i < len(l); i++ {
+		if l[i] == '"' {
+			quoted = !quoted
+		} else if l[i] == ':' && !quoted {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return p, false
+	}
+	p.value = l[idx+1:]
+	parts := splitParams(l[:idx])
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], "\"")
+	}
+	return p, true
+}
+
+func splitParams(s string) []string {
+	var (
+		parts  []string
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parseTime(p property) (time.Time, bool) {
+	v := p.value
+	if strings.EqualFold(p.params["VALUE"], "DATE") || len(v) == 8 {
+		t, _ := time.Parse("20060102", v)
+		return t, true
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, _ := time.Parse("20060102T150405Z", v)
+		return t, false
+	}
+	loc := time.UTC
+	if tzID := p.params["TZID"]; len(tzID) > 0 {
+		if l, err := time.LoadLocation(tzID); err == nil {
+			loc = l
+		}
+	}
+	t, _ := time.ParseInLocation("20060102T150405", v, loc)
+	return t, false
+}
+
+func mailto(v string) string {
+	if len(v) > 7 && strings.EqualFold(v[:7], "mailto:") {
+		v = v[7:]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
+
+func unescape(v string) string {
+	r := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return r.Replace(v)
+}
+
+func escape(v string) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+	return r.Replace(v)
+}
@@ -0,0 +1,131 @@
+package ical_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/ical"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func parse(lines ...string) (*ical.Calendar, error) {
+	return ical.Parse(strings.NewReader(strings.Join(lines, "\r\n")))
+}
+
+func TestParse(t *testing.T) {
+	Convey("Parse", t, func(c C) {
+		Convey("Unfolding", func(c C) {
+			cal, err := parse(
+				"BEGIN:VCALENDAR",
+				"METHOD:REQUEST",
+				"BEGIN:VEVENT",
+				"UID:abc-123",
+				"SUMMARY:Weekly sync with the",
+				"  whole team",
+				"DESCRIPTION:First line\\nSecond\\, line",
+				"ATTENDEE;CN=\"Doe, John\";PARTSTAT=ACCEPTED;RSVP=TRUE:mailto:John@Example.",
+				"\tcom",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			)
+			c.So(err, ShouldBeNil)
+			c.So(cal.Events, ShouldHaveLength, 1)
+			ev := cal.Events[0]
+			c.So(ev.Summary, ShouldEqual, "Weekly sync with the whole team")
+			c.So(ev.Description, ShouldEqual, "First line\nSecond, line")
+			c.So(ev.Attendees, ShouldHaveLength, 1)
+			c.So(ev.Attendees[0].Email, ShouldEqual, "john@example.com")
+			c.So(ev.Attendees[0].Name, ShouldEqual, "Doe, John")
+			c.So(ev.Attendees[0].PartStat, ShouldEqual, ical.PartStatAccepted)
+			c.So(ev.Attendees[0].RSVP, ShouldBeTrue)
+		})
+		Convey("Dates", func(c C) {
+			cal, err := parse(
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"UID:tz",
+				"DTSTART;TZID=Europe/Berlin:20210804T100000",
+				"DTEND:20210804T090000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:all-day",
+				"DTSTART;VALUE=DATE:20210805",
+				"DTEND;VALUE=DATE:20210806",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:floating",
+				"DTSTART;TZID=Invalid/Zone:20210804T100000",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			)
+			c.So(err, ShouldBeNil)
+			c.So(cal.Events, ShouldHaveLength, 3)
+			tz, allDay, floating := cal.Events[0], cal.Events[1], cal.Events[2]
+			c.So(tz.AllDay, ShouldBeFalse)
+			c.So(tz.Start.UTC(), ShouldEqual, time.Date(2021, 8, 4, 8, 0, 0, 0, time.UTC))
+			c.So(tz.End.UTC(), ShouldEqual, time.Date(2021, 8, 4, 9, 0, 0, 0, time.UTC))
+			c.So(allDay.AllDay, ShouldBeTrue)
+			c.So(allDay.Start, ShouldEqual, time.Date(2021, 8, 5, 0, 0, 0, 0, time.UTC))
+			c.So(allDay.End, ShouldEqual, time.Date(2021, 8, 6, 0, 0, 0, 0, time.UTC))
+			c.So(floating.Start, ShouldEqual, time.Date(2021, 8, 4, 10, 0, 0, 0, time.UTC))
+		})
+		Convey("Method", func(c C) {
+			cal, err := parse(
+				"BEGIN:VCALENDAR",
+				"METHOD:cancel",
+				"BEGIN:VEVENT",
+				"UID:m1",
+				"SEQUENCE:2",
+				"ORGANIZER;CN=Jane:MAILTO:jane@example.com",
+				"BEGIN:VALARM",
+				"DESCRIPTION:Reminder",
+				"END:VALARM",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			)
+			c.So(err, ShouldBeNil)
+			c.So(cal.Method, ShouldEqual, ical.MethodCancel)
+			c.So(cal.Events[0].Sequence, ShouldEqual, 2)
+			c.So(cal.Events[0].Organizer, ShouldResemble, ical.Person{Email: "jane@example.com", Name: "Jane"})
+			// the properties of VALARM are not the properties of the event
+			c.So(cal.Events[0].Description, ShouldBeEmpty)
+
+			// METHOD inside the event is not the method of the calendar
+			cal, err = parse(
+				"BEGIN:VCALENDAR",
+				"BEGIN:VEVENT",
+				"UID:m2",
+				"METHOD:REPLY",
+				"END:VEVENT",
+				"END:VCALENDAR",
+			)
+			c.So(err, ShouldBeNil)
+			c.So(cal.Method, ShouldBeEmpty)
+
+			_, err = parse("BEGIN:VEVENT", "UID:m3", "END:VEVENT")
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Reply", func(c C) {
+			ev := ical.Event{
+				UID:       "r1",
+				Sequence:  1,
+				Summary:   strings.Repeat("Long summary, ", 10),
+				Start:     time.Date(2021, 8, 5, 0, 0, 0, 0, time.UTC),
+				AllDay:    true,
+				Organizer: ical.Person{Email: "jane@example.com"},
+			}
+			b := ical.Reply(ev, ical.Attendee{Person: ical.Person{Email: "john@example.com"}, PartStat: ical.PartStatDeclined})
+			for _, l := range strings.Split(string(b), "\r\n") {
+				c.So(len(l), ShouldBeLessThanOrEqualTo, 75)
+			}
+			cal, err := ical.Parse(strings.NewReader(string(b)))
+			c.So(err, ShouldBeNil)
+			c.So(cal.Method, ShouldEqual, ical.MethodReply)
+			c.So(cal.Events[0].Summary, ShouldEqual, ev.Summary)
+			c.So(cal.Events[0].AllDay, ShouldBeTrue)
+			c.So(cal.Events[0].Start, ShouldEqual, ev.Start)
+			c.So(cal.Events[0].Attendees[0].PartStat, ShouldEqual, ical.PartStatDeclined)
+		})
+	})
+}
@@ -0,0 +1,234 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER Classes
+const (
+	ClassUniversal   byte = 0x00
+	ClassApplication byte = 0x40
+	ClassContext     byte = 0x80
+)
+
+// Universal Tags
+const (
+	TagBoolean     = 0x01
+	TagInteger     = 0x02
+	TagOctetString = 0x04
+	TagNull        = 0x05
+	TagEnumerated  = 0x0a
+	TagSequence    = 0x10
+	TagSet         = 0x11
+)
+
+// maxPacketSize protects the reader against the malformed lengths
+const maxPacketSize = 16 << 20
+
+// Packet is a BER encoded element, Children are set for the constructed elements and Value for
+// the primitive ones. Only the tags which fit in one byte are supported, which is enough for LDAP.
+type Packet struct {
+	Class       byte
+	Constructed bool
+	Tag         int
+	Value       []byte
+	Children    []*Packet
+}
+
+func NewSequence(class byte, tag int, children ...*Packet) *Packet {
+	return &Packet{Class: class, Constructed: true, Tag: tag, Children: children}
+}
+
+func NewString(class byte, tag int, s string) *Packet {
+	return &Packet{Class: class, Tag: tag, Value: []byte(s)}
+}
+
+func NewInteger(class byte, tag int, v int64) *Packet {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if (v == 0 && b[0]&0x80 == 0) || (v == -1 && b[0]&0x80 != 0) {
+			break
+		}
+	}
+	return &Packet{Class: class, Tag: tag, Value: b}
+}
+
+func NewBoolean(class byte, tag int, v bool) *Packet {
+	if v {
+		return &Packet{Class: class, Tag: tag, Value: []byte{0xff}}
+	}
+	return &Packet{Class: class, Tag: tag, Value: []byte{0x00}}
+}
+
+// Append adds the children to the constructed packet
+func (p *Packet) Append(children ...*Packet) *Packet {
+	p.Children = append(p.Children, children...)
+	return p
+}
+
+// Int returns the value of the integer or enumerated packet
+func (p *Packet) Int() int64 {
+	var v int64
+	for i, b := range p.Value {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+// Bool returns the value of the boolean packet
+func (p *Packet) Bool() bool {
+	return len(p.Value) > 0 && p.Value[0] != 0
+}
+
+// Str returns the value of the primitive packet as string
+func (p *Packet) Str() string {
+	return string(p.Value)
+}
+
+// Child returns the idx-th child or an empty packet if it does not exist
+func (p *Packet) Child(idx int) *Packet {
+	if idx < 0 || idx >= len(p.Children) {
+		return &Packet{}
+	}
+	return p.Children[idx]
+}
+
+// Is returns TRUE if the class and the tag of the packet match
+func (p *Packet) Is(class byte, tag int) bool {
+	return p.Class == class && p.Tag == tag
+}
+
+// Bytes encodes the packet
+func (p *Packet) Bytes() []byte {
+	content := p.Value
+	if p.Constructed {
+		content = content[:0:0]
+		for _, c := range p.Children {
+			content = append(content, c.Bytes()...)
+		}
+	}
+	id := p.Class | byte(p.Tag&0x1f)
+	if p.Constructed {
+		id |= 0x20
+	}
+	b := append([]byte{id}, encodeLength(len(content))...)
+	return append(b, content...)
+}
+
+func encodeLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for n > 0 {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// ReadPacket reads one packet from r
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	id, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if id&0x1f == 0x1f {
+		return nil, errors.New("ber: multi-byte tags are not supported")
+	}
+	l, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := int(l)
+	if l&0x80 != 0 {
+		n := int(l & 0x7f)
+		if n == 0 || n > 4 {
+			return nil, fmt.Errorf("ber: unsupported length of %d bytes", n)
+		}
+		length = 0
+		for i := 0; i < n; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("ber: packet is too large (%d bytes)", length)
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return decode(id, content)
+}
+
+// Parse decodes the packet in b
+func Parse(b []byte) (*Packet, error) {
+	p, n, err := parse(b)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, errors.New("ber: trailing data")
+	}
+	return p, nil
+}
+
+func parse(b []byte) (*Packet, int, error) {
+	if len(b) < 2 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	id := b[0]
+	if id&0x1f == 0x1f {
+		return nil, 0, errors.New("ber: multi-byte tags are not supported")
+	}
+	offset, length := 2, int(b[1])
+	if b[1]&0x80 != 0 {
+		n := int(b[1] & 0x7f)
+		if n == 0 || n > 4 || len(b) < 2+n {
+			return nil, 0, errors.New("ber: invalid length")
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		offset += n
+	}
+	if length < 0 || len(b) < offset+length {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	p, err := decode(id, b[offset:offset+length])
+	return p, offset + length, err
+}
+
+func decode(id byte, content []byte) (*Packet, error) {
+	p := &Packet{
+		Class:       id & 0xc0,
+		Constructed: id&0x20 != 0,
+		Tag:         int(id & 0x1f),
+	}
+	if !p.Constructed {
+		p.Value = content
+		return p, nil
+	}
+	for len(content) > 0 {
+		c, n, err := parse(content)
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, c)
+		content = content[n:]
+	}
+	return p, nil
+}
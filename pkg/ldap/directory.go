@@ -0,0 +1,170 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DirectoryConfig describes how the users are found in the directory. UserFilter must have
+// one %s which is replaced by the escaped uid, i.e. (uid=%s) or (sAMAccountName=%s) for AD.
+type DirectoryConfig struct {
+	URL           string
+	BindDN        string
+	BindPassword  string
+	BaseDN        string
+	UserFilter    string
+	SyncFilter    string
+	AttrUID       string
+	AttrFirstName string
+	AttrLastName  string
+	AttrEmail     string
+	AttrGroups    string
+	Timeout       time.Duration
+}
+
+// User is an account of the directory, Groups are the common names of the groups of the user
+type User struct {
+	DN        string
+	UID       string
+	FirstName string
+	LastName  string
+	Email     string
+	Groups    []string
+}
+
+// Directory authenticates and lists the users of an ldap server
+type Directory struct {
+	cfg DirectoryConfig
+}
+
+func NewDirectory(cfg DirectoryConfig) *Directory {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if len(cfg.UserFilter) == 0 {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if len(cfg.SyncFilter) == 0 {
+		cfg.SyncFilter = "(objectClass=person)"
+	}
+	if len(cfg.AttrUID) == 0 {
+		cfg.AttrUID = "uid"
+	}
+	if len(cfg.AttrFirstName) == 0 {
+		cfg.AttrFirstName = "givenName"
+	}
+	if len(cfg.AttrLastName) == 0 {
+		cfg.AttrLastName = "sn"
+	}
+	if len(cfg.AttrEmail) == 0 {
+		cfg.AttrEmail = "mail"
+	}
+	if len(cfg.AttrGroups) == 0 {
+		cfg.AttrGroups = "memberOf"
+	}
+	return &Directory{cfg: cfg}
+}
+
+// Authenticate finds the user by the service account and then binds as the user to check the
+// password. It returns an error which IsInvalidCredentials if the user or the password is wrong.
+func (d *Directory) Authenticate(uid, password string) (*User, error) {
+	c, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	entries, err := c.Search(SearchRequest{
+		BaseDN:     d.cfg.BaseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     fmt.Sprintf(d.cfg.UserFilter, EscapeFilter(uid)),
+		Attributes: d.attributes(),
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) != 1 {
+		return nil, &Error{Code: ResultInvalidCredentials, Message: "user not found"}
+	}
+	if err := c.Bind(entries[0].DN, password); err != nil {
+		return nil, err
+	}
+	u := d.user(entries[0])
+	return &u, nil
+}
+
+// Users returns all the users which match the sync filter
+func (d *Directory) Users() ([]User, error) {
+	c, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	entries, err := c.Search(SearchRequest{
+		BaseDN:     d.cfg.BaseDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     d.cfg.SyncFilter,
+		Attributes: d.attributes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	users := make([]User, 0, len(entries))
+	for _, e := range entries {
+		if u := d.user(e); len(u.UID) > 0 {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+func (d *Directory) connect() (*Conn, error) {
+	c, err := Dial(d.cfg.URL, d.cfg.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	if len(d.cfg.BindDN) > 0 {
+		if err := c.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (d *Directory) attributes() []string {
+	return []string{d.cfg.AttrUID, d.cfg.AttrFirstName, d.cfg.AttrLastName, d.cfg.AttrEmail, d.cfg.AttrGroups}
+}
+
+func (d *Directory) user(e *Entry) User {
+	u := User{
+		DN:        e.DN,
+		UID:       strings.ToLower(e.Get(d.cfg.AttrUID)),
+		FirstName: e.Get(d.cfg.AttrFirstName),
+		LastName:  e.Get(d.cfg.AttrLastName),
+		Email:     strings.ToLower(e.Get(d.cfg.AttrEmail)),
+	}
+	for _, groupDN := range e.GetAll(d.cfg.AttrGroups) {
+		if cn := CommonName(groupDN); len(cn) > 0 {
+			u.Groups = append(u.Groups, cn)
+		}
+	}
+	return u
+}
+
+// CommonName returns the value of the first CN of the dn, i.e. 'devs' for cn=devs,ou=groups,dc=nested,dc=me
+// Plain group names, i.e. the values of memberUid, are returned as they are.
+func CommonName(dn string) string {
+	if !strings.Contains(dn, "=") {
+		return strings.TrimSpace(dn)
+	}
+	rdn := strings.SplitN(dn, ",", 2)[0]
+	kv := strings.SplitN(rdn, "=", 2)
+	if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "cn") {
+		return ""
+	}
+	return strings.TrimSpace(kv[1])
+}
@@ -0,0 +1,182 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter Choices
+const (
+	FilterAnd            = 0
+	FilterOr             = 1
+	FilterNot            = 2
+	FilterEqualityMatch  = 3
+	FilterSubstrings     = 4
+	FilterGreaterOrEqual = 5
+	FilterLessOrEqual    = 6
+	FilterPresent        = 7
+	FilterApproxMatch    = 8
+)
+
+// Substring Choices
+const (
+	SubstringInitial = 0
+	SubstringAny     = 1
+	SubstringFinal   = 2
+)
+
+// EscapeFilter escapes the special characters of the value, the user inputs must be escaped
+// before they are put in a filter.
+func EscapeFilter(s string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '*', '(', ')', '\\', 0:
+			sb.WriteString(fmt.Sprintf("\\%02x", c))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// CompileFilter compiles the string representation of the filter (RFC 4515), i.e.
+// (&(objectClass=person)(|(uid=ehsan)(mail=ehsan@*)))
+func CompileFilter(s string) (*Packet, error) {
+	p, rest, err := compileFilter(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("ldap: unexpected '%s' in filter", rest)
+	}
+	return p, nil
+}
+
+func compileFilter(s string) (*Packet, string, error) {
+	if len(s) < 3 || s[0] != '(' {
+		return nil, "", fmt.Errorf("ldap: invalid filter: %s", s)
+	}
+	s = s[1:]
+	switch s[0] {
+	case '&', '|':
+		tag := FilterAnd
+		if s[0] == '|' {
+			tag = FilterOr
+		}
+		p := NewSequence(ClassContext, tag)
+		s = s[1:]
+		for len(s) > 0 && s[0] == '(' {
+			c, rest, err := compileFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.Append(c)
+			s = rest
+		}
+		if len(s) == 0 || s[0] != ')' {
+			return nil, "", fmt.Errorf("ldap: unterminated filter")
+		}
+		return p, s[1:], nil
+	case '!':
+		c, rest, err := compileFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(rest) == 0 || rest[0] != ')' {
+			return nil, "", fmt.Errorf("ldap: unterminated filter")
+		}
+		return NewSequence(ClassContext, FilterNot, c), rest[1:], nil
+	default:
+		// the values must escape ')' hence the first one closes the item
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return nil, "", fmt.Errorf("ldap: unterminated filter")
+		}
+		p, err := compileItem(s[:end])
+		return p, s[end+1:], err
+	}
+}
+
+func compileItem(item string) (*Packet, error) {
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("ldap: invalid filter item: %s", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	tag := FilterEqualityMatch
+	switch attr[len(attr)-1] {
+	case '~':
+		tag = FilterApproxMatch
+	case '>':
+		tag = FilterGreaterOrEqual
+	case '<':
+		tag = FilterLessOrEqual
+	}
+	if tag != FilterEqualityMatch {
+		attr = attr[:len(attr)-1]
+	}
+	if len(attr) == 0 {
+		return nil, fmt.Errorf("ldap: invalid filter item: %s", item)
+	}
+	if tag == FilterEqualityMatch && value == "*" {
+		return NewString(ClassContext, FilterPresent, attr), nil
+	}
+	if tag == FilterEqualityMatch && strings.Contains(value, "*") {
+		parts := strings.Split(value, "*")
+		subs := NewSequence(ClassUniversal, TagSequence)
+		for i, part := range parts {
+			if len(part) == 0 {
+				continue
+			}
+			v, err := unescapeFilterValue(part)
+			if err != nil {
+				return nil, err
+			}
+			choice := SubstringAny
+			switch i {
+			case 0:
+				choice = SubstringInitial
+			case len(parts) - 1:
+				choice = SubstringFinal
+			}
+			subs.Append(NewString(ClassContext, choice, v))
+		}
+		return NewSequence(ClassContext, FilterSubstrings,
+			NewString(ClassUniversal, TagOctetString, attr),
+			subs,
+		), nil
+	}
+	v, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewSequence(ClassContext, tag,
+		NewString(ClassUniversal, TagOctetString, attr),
+		NewString(ClassUniversal, TagOctetString, v),
+	), nil
+}
+
+func unescapeFilterValue(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", fmt.Errorf("ldap: invalid escape in filter: %s", s)
+		}
+		b, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("ldap: invalid escape in filter: %s", s)
+		}
+		sb.Write(b)
+		i += 2
+	}
+	return sb.String(), nil
+}
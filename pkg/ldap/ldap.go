@@ -0,0 +1,263 @@
+package ldap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol Operations (RFC 4511)
+const (
+	AppBindRequest           = 0
+	AppBindResponse          = 1
+	AppUnbindRequest         = 2
+	AppSearchRequest         = 3
+	AppSearchResultEntry     = 4
+	AppSearchResultDone      = 5
+	AppSearchResultReference = 19
+)
+
+// Search Scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// Result Codes
+const (
+	ResultSuccess            = 0
+	ResultProtocolError      = 2
+	ResultSizeLimitExceeded  = 4
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+	ResultUnwillingToPerform = 53
+)
+
+// Error is the result of a failed operation
+type Error struct {
+	Code    int64
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// IsInvalidCredentials returns TRUE if the bind has failed because of the wrong dn or password
+func IsInvalidCredentials(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == ResultInvalidCredentials
+}
+
+// Conn is a connection to the ldap server. The operations are synchronous.
+type Conn struct {
+	mtx     sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// Dial connects to the server, rawURL is in the format of ldap://host:port or ldaps://host:port
+func Dial(rawURL string, timeout time.Duration) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	d := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = d.Dial("tcp", host)
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(d, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme: %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.msgID++
+	_ = c.write(&Packet{Class: ClassApplication, Tag: AppUnbindRequest})
+	return c.conn.Close()
+}
+
+// Bind authenticates the connection by the simple method. The empty passwords are rejected, since
+// the servers treat them as unauthenticated binds which always succeed.
+func (c *Conn) Bind(dn, password string) error {
+	if len(password) == 0 {
+		return &Error{Code: ResultInvalidCredentials, Message: "empty password"}
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	res, err := c.roundTrip(
+		NewSequence(ClassApplication, AppBindRequest,
+			NewInteger(ClassUniversal, TagInteger, 3),
+			NewString(ClassUniversal, TagOctetString, dn),
+			NewString(ClassContext, 0, password),
+		),
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	return resultError(res)
+}
+
+// SearchRequest is the parameters of Search
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string
+	Attributes []string
+	SizeLimit  int
+}
+
+// Entry is a search result, the names of the attributes are in lower case
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Get returns the first value of the attribute
+func (e *Entry) Get(name string) string {
+	if v := e.Attributes[strings.ToLower(name)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// GetAll returns the values of the attribute
+func (e *Entry) GetAll(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+// Search returns the entries which match the request
+func (c *Conn) Search(req SearchRequest) ([]*Entry, error) {
+	filter, err := CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := NewSequence(ClassUniversal, TagSequence)
+	for _, a := range req.Attributes {
+		attrs.Append(NewString(ClassUniversal, TagOctetString, a))
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var entries []*Entry
+	res, err := c.roundTrip(
+		NewSequence(ClassApplication, AppSearchRequest,
+			NewString(ClassUniversal, TagOctetString, req.BaseDN),
+			NewInteger(ClassUniversal, TagEnumerated, int64(req.Scope)),
+			NewInteger(ClassUniversal, TagEnumerated, 0), // never deref aliases
+			NewInteger(ClassUniversal, TagInteger, int64(req.SizeLimit)),
+			NewInteger(ClassUniversal, TagInteger, 0),
+			NewBoolean(ClassUniversal, TagBoolean, false),
+			filter,
+			attrs,
+		),
+		func(op *Packet) {
+			if op.Is(ClassApplication, AppSearchResultEntry) {
+				entries = append(entries, parseEntry(op))
+			}
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return entries, resultError(res)
+}
+
+// roundTrip sends the operation and returns the final response of it, the intermediate responses
+// (i.e. search entries) are passed to f.
+func (c *Conn) roundTrip(op *Packet, f func(op *Packet)) (*Packet, error) {
+	c.msgID++
+	msgID := c.msgID
+	if c.timeout > 0 {
+		_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+	if err := c.write(op); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := ReadPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if len(msg.Children) < 2 {
+			return nil, errors.New("ldap: malformed message")
+		}
+		if msg.Children[0].Int() != msgID {
+			continue
+		}
+		res := msg.Children[1]
+		if res.Class != ClassApplication {
+			return nil, errors.New("ldap: malformed response")
+		}
+		switch res.Tag {
+		case AppSearchResultEntry, AppSearchResultReference:
+			if f != nil {
+				f(res)
+			}
+		default:
+			return res, nil
+		}
+	}
+}
+
+func (c *Conn) write(op *Packet) error {
+	msg := NewSequence(ClassUniversal, TagSequence,
+		NewInteger(ClassUniversal, TagInteger, c.msgID),
+		op,
+	)
+	_, err := c.conn.Write(msg.Bytes())
+	return err
+}
+
+func resultError(res *Packet) error {
+	if code := res.Child(0).Int(); code != ResultSuccess {
+		return &Error{Code: code, Message: res.Child(2).Str()}
+	}
+	return nil
+}
+
+func parseEntry(op *Packet) *Entry {
+	e := &Entry{
+		DN:         op.Child(0).Str(),
+		Attributes: map[string][]string{},
+	}
+	for _, attr := range op.Child(1).Children {
+		name := strings.ToLower(attr.Child(0).Str())
+		for _, v := range attr.Child(1).Children {
+			e.Attributes[name] = append(e.Attributes[name], v.Str())
+		}
+	}
+	return e
+}
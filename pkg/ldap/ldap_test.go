@@ -0,0 +1,177 @@
+package ldap_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/ldap"
+	"git.ronaksoft.com/nested/server/pkg/ldap/ldaptest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testBaseDN   = "dc=nested,dc=test"
+	testBindDN   = "cn=admin,dc=nested,dc=test"
+	testBindPass = "admin-pass"
+)
+
+func newTestServer(t *testing.T) *ldaptest.Server {
+	s, err := ldaptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AddEntry(testBindDN, map[string][]string{"objectClass": {"organizationalRole"}}, testBindPass)
+	s.AddEntry("uid=alice,ou=people,dc=nested,dc=test", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"givenName":   {"Alice"},
+		"sn":          {"Smith"},
+		"mail":        {"alice@nested.test"},
+		"memberOf":    {"cn=Developers,ou=groups,dc=nested,dc=test"},
+	}, "alice-pass")
+	s.AddEntry("uid=bob,ou=people,dc=nested,dc=test", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"givenName":   {"Bob"},
+		"sn":          {"Brown"},
+	}, "bob-pass")
+	return s
+}
+
+func TestPacket(t *testing.T) {
+	Convey("Packet", t, func(c C) {
+		p := ldap.NewSequence(ldap.ClassUniversal, ldap.TagSequence,
+			ldap.NewInteger(ldap.ClassUniversal, ldap.TagInteger, 300),
+			ldap.NewInteger(ldap.ClassUniversal, ldap.TagInteger, -2),
+			ldap.NewString(ldap.ClassContext, 7, "nested"),
+			ldap.NewBoolean(ldap.ClassUniversal, ldap.TagBoolean, true),
+		)
+		b := p.Bytes()
+		p2, err := ldap.ReadPacket(bufio.NewReader(bytes.NewReader(b)))
+		c.So(err, ShouldBeNil)
+		c.So(p2.Children, ShouldHaveLength, 4)
+		c.So(p2.Child(0).Int(), ShouldEqual, 300)
+		c.So(p2.Child(1).Int(), ShouldEqual, -2)
+		c.So(p2.Child(2).Is(ldap.ClassContext, 7), ShouldBeTrue)
+		c.So(p2.Child(2).Str(), ShouldEqual, "nested")
+		c.So(p2.Child(3).Bool(), ShouldBeTrue)
+		c.So(p2.Bytes(), ShouldResemble, b)
+	})
+}
+
+func TestCompileFilter(t *testing.T) {
+	Convey("CompileFilter", t, func(c C) {
+		for _, f := range []string{
+			"(uid=alice)",
+			"(&(objectClass=person)(!(uid=bob)))",
+			"(|(mail=*)(cn=a*b*c))",
+			"(uid>=a)",
+			"(cn=\\28escaped\\29)",
+		} {
+			_, err := ldap.CompileFilter(f)
+			c.So(err, ShouldBeNil)
+		}
+		for _, f := range []string{"", "uid=alice", "(uid=alice", "(&(uid=a)", "(cn=\\2)"} {
+			_, err := ldap.CompileFilter(f)
+			c.So(err, ShouldNotBeNil)
+		}
+		c.So(ldap.EscapeFilter("a*(b)\\"), ShouldEqual, "a\\2a\\28b\\29\\5c")
+	})
+}
+
+func TestConn(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	Convey("Conn", t, func(c C) {
+		conn, err := ldap.Dial(s.URL(), time.Second)
+		c.So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("Bind", func(c C) {
+			c.So(conn.Bind(testBindDN, testBindPass), ShouldBeNil)
+			err := conn.Bind(testBindDN, "wrong")
+			c.So(ldap.IsInvalidCredentials(err), ShouldBeTrue)
+			// unauthenticated binds must never be accepted as a successful login
+			c.So(conn.Bind(testBindDN, ""), ShouldNotBeNil)
+		})
+		Convey("Search", func(c C) {
+			c.So(conn.Bind(testBindDN, testBindPass), ShouldBeNil)
+			entries, err := conn.Search(ldap.SearchRequest{
+				BaseDN:     testBaseDN,
+				Scope:      ldap.ScopeWholeSubtree,
+				Filter:     "(&(objectClass=person)(givenName=al*))",
+				Attributes: []string{"uid", "mail"},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(entries, ShouldHaveLength, 1)
+			c.So(entries[0].Get("UID"), ShouldEqual, "alice")
+			c.So(entries[0].Get("mail"), ShouldEqual, "alice@nested.test")
+			c.So(entries[0].Get("sn"), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestDirectory(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	Convey("Directory", t, func(c C) {
+		d := ldap.NewDirectory(ldap.DirectoryConfig{
+			URL:          s.URL(),
+			BindDN:       testBindDN,
+			BindPassword: testBindPass,
+			BaseDN:       testBaseDN,
+			Timeout:      time.Second,
+		})
+		Convey("Authenticate", func(c C) {
+			u, err := d.Authenticate("alice", "alice-pass")
+			c.So(err, ShouldBeNil)
+			c.So(u.FirstName, ShouldEqual, "Alice")
+			c.So(u.Email, ShouldEqual, "alice@nested.test")
+			c.So(u.Groups, ShouldResemble, []string{"Developers"})
+
+			_, err = d.Authenticate("alice", "bob-pass")
+			c.So(ldap.IsInvalidCredentials(err), ShouldBeTrue)
+			_, err = d.Authenticate("nobody", "pass")
+			c.So(ldap.IsInvalidCredentials(err), ShouldBeTrue)
+			_, err = d.Authenticate("*", "alice-pass")
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Authenticate By Email", func(c C) {
+			// the login name is not the uid, so the callers must use the returned uid as the account id
+			d := ldap.NewDirectory(ldap.DirectoryConfig{
+				URL:          s.URL(),
+				BindDN:       testBindDN,
+				BindPassword: testBindPass,
+				BaseDN:       testBaseDN,
+				UserFilter:   "(mail=%s)",
+				Timeout:      time.Second,
+			})
+			u, err := d.Authenticate("alice@nested.test", "alice-pass")
+			c.So(err, ShouldBeNil)
+			c.So(u.UID, ShouldEqual, "alice")
+			c.So(u.UID, ShouldNotEqual, "alice@nested.test")
+
+			_, err = d.Authenticate("alice", "alice-pass")
+			c.So(ldap.IsInvalidCredentials(err), ShouldBeTrue)
+		})
+		Convey("Users", func(c C) {
+			users, err := d.Users()
+			c.So(err, ShouldBeNil)
+			c.So(users, ShouldHaveLength, 2)
+
+			s.RemoveEntry("uid=bob,ou=people,dc=nested,dc=test")
+			users, err = d.Users()
+			c.So(err, ShouldBeNil)
+			c.So(users, ShouldHaveLength, 1)
+			c.So(users[0].UID, ShouldEqual, "alice")
+		})
+		Convey("CommonName", func(c C) {
+			c.So(ldap.CommonName("CN=Domain Users,OU=Groups,DC=corp"), ShouldEqual, "Domain Users")
+			c.So(ldap.CommonName("developers"), ShouldEqual, "developers")
+		})
+	})
+}
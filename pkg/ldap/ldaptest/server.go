@@ -0,0 +1,280 @@
+package ldaptest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+
+	"git.ronaksoft.com/nested/server/pkg/ldap"
+)
+
+// Server is an in-memory ldap server for the tests. It supports simple bind and search, which is
+// enough for the directory of Nested.
+type Server struct {
+	mtx       sync.RWMutex
+	listener  net.Listener
+	entries   map[string]*ldap.Entry
+	passwords map[string]string
+	wg        sync.WaitGroup
+}
+
+// NewServer starts a server on a random port of the loopback interface
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener:  l,
+		entries:   map[string]*ldap.Entry{},
+		passwords: map[string]string{},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// URL returns the address of the server to be passed to ldap.Dial
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// AddEntry adds or replaces the entry, if password is not empty the entry could bind with it
+func (s *Server) AddEntry(dn string, attrs map[string][]string, password string) {
+	e := &ldap.Entry{DN: dn, Attributes: map[string][]string{}}
+	for k, v := range attrs {
+		e.Attributes[strings.ToLower(k)] = v
+	}
+	s.mtx.Lock()
+	s.entries[normalizeDN(dn)] = e
+	if len(password) > 0 {
+		s.passwords[normalizeDN(dn)] = password
+	}
+	s.mtx.Unlock()
+}
+
+// RemoveEntry removes the entry
+func (s *Server) RemoveEntry(dn string) {
+	s.mtx.Lock()
+	delete(s.entries, normalizeDN(dn))
+	delete(s.passwords, normalizeDN(dn))
+	s.mtx.Unlock()
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := ldap.ReadPacket(r)
+		if err != nil || len(msg.Children) < 2 {
+			return
+		}
+		msgID := msg.Children[0].Int()
+		op := msg.Children[1]
+		var responses []*ldap.Packet
+		switch {
+		case op.Is(ldap.ClassApplication, ldap.AppBindRequest):
+			responses = append(responses, s.bind(op))
+		case op.Is(ldap.ClassApplication, ldap.AppSearchRequest):
+			responses = s.search(op)
+		case op.Is(ldap.ClassApplication, ldap.AppUnbindRequest):
+			return
+		default:
+			responses = append(responses, result(ldap.AppSearchResultDone, ldap.ResultProtocolError, "not supported"))
+		}
+		for _, res := range responses {
+			m := ldap.NewSequence(ldap.ClassUniversal, ldap.TagSequence,
+				ldap.NewInteger(ldap.ClassUniversal, ldap.TagInteger, msgID),
+				res,
+			)
+			if _, err := conn.Write(m.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) bind(op *ldap.Packet) *ldap.Packet {
+	dn, password := op.Child(1).Str(), op.Child(2).Str()
+	s.mtx.RLock()
+	p, ok := s.passwords[normalizeDN(dn)]
+	s.mtx.RUnlock()
+	if !ok || p != password || len(password) == 0 {
+		return result(ldap.AppBindResponse, ldap.ResultInvalidCredentials, "invalid credentials")
+	}
+	return result(ldap.AppBindResponse, ldap.ResultSuccess, "")
+}
+
+func (s *Server) search(op *ldap.Packet) []*ldap.Packet {
+	baseDN := normalizeDN(op.Child(0).Str())
+	scope := op.Child(1).Int()
+	sizeLimit := int(op.Child(3).Int())
+	filter := op.Child(6)
+	var attrs []string
+	for _, a := range op.Child(7).Children {
+		attrs = append(attrs, strings.ToLower(a.Str()))
+	}
+
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var responses []*ldap.Packet
+	for dn, e := range s.entries {
+		if !inScope(dn, baseDN, scope) || !match(filter, e) {
+			continue
+		}
+		if sizeLimit > 0 && len(responses) == sizeLimit {
+			return append(responses, result(ldap.AppSearchResultDone, ldap.ResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, entryPacket(e, attrs))
+	}
+	return append(responses, result(ldap.AppSearchResultDone, ldap.ResultSuccess, ""))
+}
+
+func entryPacket(e *ldap.Entry, attrs []string) *ldap.Packet {
+	list := ldap.NewSequence(ldap.ClassUniversal, ldap.TagSequence)
+	for name, values := range e.Attributes {
+		if len(attrs) > 0 && !contains(attrs, name) {
+			continue
+		}
+		vals := ldap.NewSequence(ldap.ClassUniversal, ldap.TagSet)
+		for _, v := range values {
+			vals.Append(ldap.NewString(ldap.ClassUniversal, ldap.TagOctetString, v))
+		}
+		list.Append(ldap.NewSequence(ldap.ClassUniversal, ldap.TagSequence,
+			ldap.NewString(ldap.ClassUniversal, ldap.TagOctetString, name),
+			vals,
+		))
+	}
+	return ldap.NewSequence(ldap.ClassApplication, ldap.AppSearchResultEntry,
+		ldap.NewString(ldap.ClassUniversal, ldap.TagOctetString, e.DN),
+		list,
+	)
+}
+
+func result(tag int, code int64, msg string) *ldap.Packet {
+	return ldap.NewSequence(ldap.ClassApplication, tag,
+		ldap.NewInteger(ldap.ClassUniversal, ldap.TagEnumerated, code),
+		ldap.NewString(ldap.ClassUniversal, ldap.TagOctetString, ""),
+		ldap.NewString(ldap.ClassUniversal, ldap.TagOctetString, msg),
+	)
+}
+
+func inScope(dn, baseDN string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == baseDN
+	case ldap.ScopeSingleLevel:
+		parts := strings.SplitN(dn, ",", 2)
+		return len(parts) == 2 && parts[1] == baseDN
+	default:
+		return baseDN == "" || dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// match evaluates the filter against the entry, the comparisons are case-insensitive
+func match(f *ldap.Packet, e *ldap.Entry) bool {
+	if f.Class != ldap.ClassContext {
+		return false
+	}
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !match(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if match(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !match(f.Child(0), e)
+	case ldap.FilterPresent:
+		return len(e.GetAll(f.Str())) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch, ldap.FilterGreaterOrEqual, ldap.FilterLessOrEqual:
+		want := strings.ToLower(f.Child(1).Str())
+		for _, v := range e.GetAll(f.Child(0).Str()) {
+			v = strings.ToLower(v)
+			switch {
+			case f.Tag == ldap.FilterGreaterOrEqual && v >= want,
+				f.Tag == ldap.FilterLessOrEqual && v <= want,
+				(f.Tag == ldap.FilterEqualityMatch || f.Tag == ldap.FilterApproxMatch) && v == want:
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		for _, v := range e.GetAll(f.Child(0).Str()) {
+			if matchSubstrings(strings.ToLower(v), f.Child(1).Children) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func matchSubstrings(v string, subs []*ldap.Packet) bool {
+	for _, sub := range subs {
+		part := strings.ToLower(sub.Str())
+		switch sub.Tag {
+		case ldap.SubstringInitial:
+			if !strings.HasPrefix(v, part) {
+				return false
+			}
+			v = v[len(part):]
+		case ldap.SubstringFinal:
+			if !strings.HasSuffix(v, part) {
+				return false
+			}
+			v = v[:len(v)-len(part)]
+		default:
+			idx := strings.Index(v, part)
+			if idx < 0 {
+				return false
+			}
+			v = v[idx+len(part):]
+		}
+	}
+	return true
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(parts[i]))
+	}
+	return strings.Join(parts, ",")
+}
+
+func contains(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
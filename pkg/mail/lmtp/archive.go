@@ -0,0 +1,151 @@
+package lmtp
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	ArchiveFormatMbox    = "mbox"
+	ArchiveFormatEML     = "eml"
+	ArchiveFormatMaildir = "maildir"
+)
+
+// DetectArchiveFormat guesses the format of the archive in path. Directories which have 'cur' or 'new'
+// sub directories are Maildir, other directories are considered as a set of EML files. For regular files
+// the ones start with a 'From ' line are mbox and the rest are EML.
+func DetectArchiveFormat(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		for _, sub := range []string{"cur", "new"} {
+			if fi, err := os.Stat(filepath.Join(path, sub)); err == nil && fi.IsDir() {
+				return ArchiveFormatMaildir, nil
+			}
+		}
+		return ArchiveFormatEML, nil
+	}
+	if strings.EqualFold(filepath.Ext(path), ".eml") {
+		return ArchiveFormatEML, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 5)
+	if n, _ := io.ReadFull(f, head); n == 5 && string(head) == "From " {
+		return ArchiveFormatMbox, nil
+	}
+	return ArchiveFormatEML, nil
+}
+
+// walkArchive calls fn for each message found in the archive. Only errors on reading the archive itself
+// are returned, fn must handle the errors of each message.
+func walkArchive(path, format string, fn func(r io.Reader)) error {
+	switch format {
+	case ArchiveFormatMbox:
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return readMbox(f, fn)
+	case ArchiveFormatMaildir:
+		for _, sub := range []string{"cur", "new"} {
+			files, err := ioutil.ReadDir(filepath.Join(path, sub))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+			for _, fi := range files {
+				if fi.IsDir() {
+					continue
+				}
+				if err := readFile(filepath.Join(path, sub, fi.Name()), fn); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case ArchiveFormatEML:
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return readFile(path, fn)
+		}
+		return filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() || !strings.EqualFold(filepath.Ext(p), ".eml") {
+				return nil
+			}
+			return readFile(p, fn)
+		})
+	default:
+		return fmt.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+func readFile(path string, fn func(r io.Reader)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fn(f)
+	return nil
+}
+
+// readMbox splits an mbox stream into messages. Both mboxo and mboxrd escaping of the body lines
+// starting with 'From ' are reverted.
+func readMbox(r io.Reader, fn func(r io.Reader)) error {
+	var (
+		br      = bufio.NewReader(r)
+		buf     = &bytes.Buffer{}
+		started bool
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			switch {
+			case bytes.HasPrefix(line, []byte("From ")):
+				if started {
+					fn(bytes.NewReader(buf.Bytes()))
+					buf.Reset()
+				}
+				started = true
+			case started:
+				if unquoted := bytes.TrimLeft(line, ">"); len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+					line = line[1:]
+				}
+				buf.Write(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if started && buf.Len() > 0 {
+		fn(bytes.NewReader(buf.Bytes()))
+	}
+	return nil
+}
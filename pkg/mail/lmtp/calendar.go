@@ -0,0 +1,157 @@
+package lmtp
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/ical"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/jhillyerd/enmime"
+	"go.uber.org/zap"
+)
+
+// extractCalendar finds the first text/calendar part of the mail which carries one of the iTIP
+// methods we support.
+func (s *Session) extractCalendar(nm *NestedMail, envelope *enmime.Envelope) error {
+	parts := envelope.Root.BreadthMatchAll(func(p *enmime.Part) bool {
+		ct := strings.ToLower(p.ContentType)
+		return ct == "text/calendar" || ct == "application/ics" || strings.HasSuffix(strings.ToLower(p.FileName), ".ics")
+	})
+	for _, p := range parts {
+		cal, err := ical.Parse(bytes.NewReader(p.Content))
+		if err != nil {
+			log.Warn("got error on parsing calendar part", zap.Error(err))
+			continue
+		}
+		if cal.Method == "" {
+			// the method might only be set as a parameter of the Content-Type header
+			if _, params, err := mime.ParseMediaType(p.Header.Get("Content-Type")); err == nil {
+				cal.Method = strings.ToUpper(params["method"])
+			}
+		}
+		switch cal.Method {
+		case ical.MethodRequest, ical.MethodCancel, ical.MethodReply:
+			if len(cal.Events) > 0 {
+				nm.Calendar = cal
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// applyCalendar creates/updates the calendar invite and its task for the post. The mails are
+// only trusted for their own sender: replies set the status of the attendee who has sent them, and
+// the existing invites are only updated or cancelled by their organizer.
+func (s *Session) applyCalendar(nm *NestedMail, post *nested.Post) {
+	if nm.Calendar == nil {
+		return
+	}
+	for _, ev := range nm.Calendar.Events {
+		if len(ev.UID) == 0 {
+			continue
+		}
+		invite := s.model.Calendar.GetByUID(ev.UID)
+		switch nm.Calendar.Method {
+		case ical.MethodRequest:
+			if invite != nil && !isSender(nm, invite.OrganizerEmail) {
+				log.Warn("calendar request is not sent by the organizer",
+					zap.String("UID", ev.UID),
+					zap.String("Sender", nm.SenderID),
+				)
+				continue
+			}
+			s.model.Calendar.Request(s.toCalendarInvite(nm, ev), post.ID)
+		case ical.MethodCancel:
+			if invite == nil || !isSender(nm, invite.OrganizerEmail) {
+				continue
+			}
+			s.model.Calendar.Cancel(ev.UID, ev.Sequence, post.ID)
+		case ical.MethodReply:
+			if invite == nil {
+				continue
+			}
+			for _, a := range ev.Attendees {
+				if isSender(nm, a.Email) {
+					s.model.Calendar.SetAttendeeStatus(invite.ID, a.Email, a.PartStat)
+				}
+			}
+		}
+	}
+}
+
+// isSender returns true if email is the address of the envelope sender or the From header of the mail
+func isSender(nm *NestedMail, email string) bool {
+	if len(email) == 0 {
+		return false
+	}
+	return strings.EqualFold(email, nm.SenderID) || strings.EqualFold(email, nm.FromAddress)
+}
+
+// toCalendarInvite converts the event to an invite, the organizer is only mapped to one of our
+// accounts if the mail has been sent by the organizer.
+func (s *Session) toCalendarInvite(nm *NestedMail, ev ical.Event) nested.CalendarInvite {
+	invite := nested.CalendarInvite{
+		UID:            ev.UID,
+		Sequence:       ev.Sequence,
+		Summary:        ev.Summary,
+		Description:    ev.Description,
+		Location:       ev.Location,
+		AllDay:         ev.AllDay,
+		OrganizerEmail: ev.Organizer.Email,
+		OrganizerName:  ev.Organizer.Name,
+		Attendees:      make([]nested.CalendarAttendee, 0, len(ev.Attendees)),
+	}
+	if isSender(nm, ev.Organizer.Email) {
+		invite.OrganizerID = s.accountIDByEmail(ev.Organizer.Email)
+	}
+	if !ev.Start.IsZero() {
+		invite.Start = uint64(ev.Start.UnixNano() / int64(time.Millisecond))
+	}
+	if !ev.End.IsZero() {
+		invite.End = uint64(ev.End.UnixNano() / int64(time.Millisecond))
+	}
+	for _, a := range ev.Attendees {
+		invite.Attendees = append(invite.Attendees, nested.CalendarAttendee{
+			Email:     a.Email,
+			Name:      a.Name,
+			AccountID: s.accountIDByEmail(a.Email),
+			Role:      a.Role,
+			Status:    a.PartStat,
+		})
+	}
+	return invite
+}
+
+// accountIDByEmail maps the email address to one of our accounts, addresses on our own domains are
+// mapped by their mailbox and the others by the email of the accounts.
+func (s *Session) accountIDByEmail(email string) string {
+	email = strings.ToLower(email)
+	if idx := strings.LastIndex(email, "@"); idx != -1 && isLocalDomain(email[idx+1:]) {
+		if accountID := email[:idx]; s.model.Account.Exists(accountID) {
+			return accountID
+		}
+	}
+	if acc := s.model.Account.GetByEmail(email, nil); acc != nil {
+		return acc.ID
+	}
+	return ""
+}
+
+// isLocalDomain returns true if domain is the sender domain or one of the domains of the server
+func isLocalDomain(domain string) bool {
+	domain = strings.ToLower(domain)
+	if domain == strings.ToLower(config.GetString(config.SenderDomain)) {
+		return true
+	}
+	for _, d := range strings.Split(config.GetString(config.Domains), ",") {
+		if strings.ToLower(strings.TrimSpace(d)) == domain {
+			return true
+		}
+	}
+	return false
+}
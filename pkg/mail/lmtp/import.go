@@ -0,0 +1,230 @@
+package lmtp
+
+import (
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"sync"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/jhillyerd/enmime"
+	"go.uber.org/zap"
+)
+
+const maxImportErrors = 100
+
+type ImportOptions struct {
+	// Format is one of ArchiveFormatMbox, ArchiveFormatEML or ArchiveFormatMaildir, if it is empty
+	// it will be detected from the path
+	Format string
+	// PlaceMap maps email addresses (lower case) to place ids
+	PlaceMap map[string]string
+	// DefaultPlaceIDs are used when none of the recipients of a message could be mapped to a place
+	DefaultPlaceIDs []string
+	// DryRun only parses the messages and reports what would be imported
+	DryRun bool
+}
+
+type ImportResult struct {
+	Total      int      `json:"total"`
+	Imported   int      `json:"imported"`
+	Duplicates int      `json:"duplicates"`
+	Skipped    int      `json:"skipped"`
+	Failed     int      `json:"failed"`
+	DryRun     bool     `json:"dry_run"`
+	Finished   bool     `json:"finished"`
+	FinishedOn uint64   `json:"finished_on,omitempty"`
+	Errors     []string `json:"errors,omitempty"`
+}
+
+// Importer imports mail archives into places. Each message goes through the same pipeline
+// the LMTP server uses for the incoming emails, hence attachments are uploaded into the store
+// and posts carry the original Message-ID, which is used for deduplication.
+type Importer struct {
+	model    *nested.Manager
+	uploader *uploadClient
+	opts     ImportOptions
+
+	// mtx protects seen and result
+	mtx    sync.Mutex
+	seen   map[string]bool
+	result ImportResult
+}
+
+func NewImporter(model *nested.Manager, opts ImportOptions) (*Importer, error) {
+	imp := &Importer{
+		model: model,
+		opts:  opts,
+		seen:  map[string]bool{},
+	}
+	imp.result.DryRun = opts.DryRun
+	if imp.opts.PlaceMap == nil {
+		imp.opts.PlaceMap = map[string]string{}
+	}
+	if !opts.DryRun {
+		uploader, err := newUploadClient(config.GetString(config.MailUploadBaseURL), config.GetString(config.SystemAPIKey), true)
+		if err != nil {
+			return nil, err
+		}
+		imp.uploader = uploader
+	}
+	return imp, nil
+}
+
+// Import reads all the messages of the archive in path and imports them
+func (imp *Importer) Import(path string) (*ImportResult, error) {
+	format := imp.opts.Format
+	if format == "" {
+		f, err := DetectArchiveFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		format = f
+	}
+	err := walkArchive(path, format, func(r io.Reader) {
+		imp.importMessage(r)
+	})
+
+	imp.mtx.Lock()
+	imp.result.Finished = true
+	imp.result.FinishedOn = nested.Timestamp()
+	if err != nil {
+		imp.addError(err.Error())
+	}
+	imp.mtx.Unlock()
+	return imp.Result(), err
+}
+
+// Result returns a snapshot of the import progress
+func (imp *Importer) Result() *ImportResult {
+	imp.mtx.Lock()
+	defer imp.mtx.Unlock()
+	r := imp.result
+	r.Errors = append([]string{}, imp.result.Errors...)
+	return &r
+}
+
+func (imp *Importer) importMessage(r io.Reader) {
+	imp.mtx.Lock()
+	imp.result.Total++
+	idx := imp.result.Total
+	imp.mtx.Unlock()
+
+	envelope, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		imp.fail(idx, err)
+		return
+	}
+
+	messageID := messageIDOf(envelope)
+	if messageID != "" {
+		imp.mtx.Lock()
+		seen := imp.seen[messageID]
+		imp.seen[messageID] = true
+		imp.mtx.Unlock()
+		if seen || imp.model.Post.ExistsByMessageID(messageID) {
+			imp.mtx.Lock()
+			imp.result.Duplicates++
+			imp.mtx.Unlock()
+			return
+		}
+	}
+
+	from := envelope.GetHeader("From")
+	if from == "" {
+		from = envelope.GetHeader("Return-Path")
+	}
+	placeIDs := imp.mapRecipients(envelope)
+	if from == "" || len(placeIDs) == 0 {
+		imp.mtx.Lock()
+		imp.result.Skipped++
+		imp.mtx.Unlock()
+		return
+	}
+
+	if imp.opts.DryRun {
+		log.Info("Import (DryRun)",
+			zap.String("MessageID", messageID),
+			zap.String("From", from),
+			zap.String("Subject", envelope.GetHeader("Subject")),
+			zap.Strings("PlaceIDs", placeIDs),
+		)
+	} else {
+		s := &Session{
+			hostname: "importer",
+			from:     from,
+			rcpts:    placeIDs,
+			model:    imp.model,
+			uploader: imp.uploader,
+			imported: true,
+		}
+		if err := s.deliver(envelope); err != nil {
+			imp.fail(idx, err)
+			return
+		}
+	}
+
+	imp.mtx.Lock()
+	imp.result.Imported++
+	imp.mtx.Unlock()
+}
+
+// mapRecipients returns the place ids of the message recipients. Addresses are looked up in the
+// PlaceMap first, then addresses on our own domains are mapped to the place with the same id.
+func (imp *Importer) mapRecipients(envelope *enmime.Envelope) []string {
+	var (
+		placeIDs []string
+		added    = map[string]bool{}
+	)
+	addPlace := func(placeID string) {
+		if !added[placeID] {
+			added[placeID] = true
+			placeIDs = append(placeIDs, placeID)
+		}
+	}
+	for _, h := range []string{"To", "Cc", "Bcc", "Delivered-To", "X-Original-To"} {
+		// X-Original-To is not an address header of enmime, so the values are parsed directly
+		addrs, _ := enmime.ParseAddressList(envelope.GetHeader(h))
+		for _, addr := range addrs {
+			imp.mapAddress(addr, addPlace)
+		}
+	}
+	if len(placeIDs) == 0 {
+		for _, placeID := range imp.opts.DefaultPlaceIDs {
+			addPlace(placeID)
+		}
+	}
+	return placeIDs
+}
+
+func (imp *Importer) mapAddress(addr *mail.Address, addPlace func(string)) {
+	email := strings.ToLower(addr.Address)
+	if placeID, ok := imp.opts.PlaceMap[email]; ok {
+		addPlace(placeID)
+		return
+	}
+	idx := strings.LastIndex(email, "@")
+	if idx == -1 || !isLocalDomain(email[idx+1:]) {
+		return
+	}
+	if placeID := email[:idx]; imp.model.Place.Exists(placeID) {
+		addPlace(placeID)
+	}
+}
+
+func (imp *Importer) fail(idx int, err error) {
+	log.Warn("got error on importing message", zap.Int("Index", idx), zap.Error(err))
+	imp.mtx.Lock()
+	imp.result.Failed++
+	imp.addError(fmt.Sprintf("message %d: %v", idx, err))
+	imp.mtx.Unlock()
+}
+
+func (imp *Importer) addError(txt string) {
+	if len(imp.result.Errors) < maxImportErrors {
+		imp.result.Errors = append(imp.result.Errors, txt)
+	}
+}
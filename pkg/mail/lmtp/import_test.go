@@ -0,0 +1,110 @@
+package lmtp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestArchive(t *testing.T) {
+	Convey("Archive", t, func(c C) {
+		Convey("Read Mbox", func(c C) {
+			mbox := strings.Join([]string{
+				"From alice@example.com Wed Aug  4 10:00:00 2021",
+				"Subject: first",
+				"",
+				">From the start",
+				">>From is kept quoted once",
+				"> From is not an escape",
+				"From bob@example.com Wed Aug  4 11:00:00 2021",
+				"Subject: second",
+				"",
+				"body",
+				"",
+			}, "\n")
+			var msgs []string
+			err := readMbox(strings.NewReader(mbox), func(r io.Reader) {
+				b, _ := ioutil.ReadAll(r)
+				msgs = append(msgs, string(b))
+			})
+			c.So(err, ShouldBeNil)
+			c.So(msgs, ShouldHaveLength, 2)
+			c.So(msgs[0], ShouldEqual, "Subject: first\n\nFrom the start\n>From is kept quoted once\n> From is not an escape\n")
+			c.So(msgs[1], ShouldEqual, "Subject: second\n\nbody\n")
+
+			msgs = msgs[:0]
+			err = readMbox(strings.NewReader("Subject: no separator\n\nbody\n"), func(r io.Reader) {
+				msgs = append(msgs, "")
+			})
+			c.So(err, ShouldBeNil)
+			c.So(msgs, ShouldBeEmpty)
+		})
+		Convey("Detect Format", func(c C) {
+			dir, err := ioutil.TempDir("", "nested-import")
+			c.So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			mbox := filepath.Join(dir, "archive")
+			c.So(ioutil.WriteFile(mbox, []byte("From alice@example.com Wed Aug  4 10:00:00 2021\n"), 0600), ShouldBeNil)
+			eml := filepath.Join(dir, "message.EML")
+			c.So(ioutil.WriteFile(eml, []byte("From alice@example.com Wed Aug  4 10:00:00 2021\n"), 0600), ShouldBeNil)
+			raw := filepath.Join(dir, "message")
+			c.So(ioutil.WriteFile(raw, []byte("Subject: hi\n\nbody\n"), 0600), ShouldBeNil)
+			maildir := filepath.Join(dir, "maildir")
+			c.So(os.MkdirAll(filepath.Join(maildir, "new"), 0700), ShouldBeNil)
+
+			for path, format := range map[string]string{
+				mbox:    ArchiveFormatMbox,
+				eml:     ArchiveFormatEML,
+				raw:     ArchiveFormatEML,
+				maildir: ArchiveFormatMaildir,
+				dir:     ArchiveFormatEML,
+			} {
+				f, err := DetectArchiveFormat(path)
+				c.So(err, ShouldBeNil)
+				c.So(f, ShouldEqual, format)
+			}
+			_, err = DetectArchiveFormat(filepath.Join(dir, "not-exists"))
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestImporter(t *testing.T) {
+	Convey("Importer", t, func(c C) {
+		Convey("Map Recipients", func(c C) {
+			imp := &Importer{
+				opts: ImportOptions{
+					PlaceMap: map[string]string{
+						"team@example.com":  "team",
+						"sales@example.com": "sales",
+					},
+					DefaultPlaceIDs: []string{"inbox"},
+				},
+			}
+			envelope := func(headers string) *enmime.Envelope {
+				e, err := enmime.ReadEnvelope(strings.NewReader(headers + "Subject: test\r\n\r\nbody\r\n"))
+				c.So(err, ShouldBeNil)
+				return e
+			}
+			c.So(
+				imp.mapRecipients(envelope("To: Team <TEAM@example.com>, someone@example.org\r\nCc: sales@example.com, team@example.com\r\n")),
+				ShouldResemble, []string{"team", "sales"},
+			)
+			c.So(
+				imp.mapRecipients(envelope("To: someone@example.org\r\nX-Original-To: sales@example.com\r\n")),
+				ShouldResemble, []string{"sales"},
+			)
+			c.So(
+				imp.mapRecipients(envelope("To: someone@example.org\r\n")),
+				ShouldResemble, []string{"inbox"},
+			)
+		})
+	})
+}
@@ -1,7 +1,11 @@
 package lmtp
 
 import (
+	"strings"
+
 	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/ical"
+	"github.com/jhillyerd/enmime"
 )
 
 /*
@@ -16,8 +20,10 @@ import (
 type NestedMail struct {
 	SenderID          string
 	SenderName        string
+	FromAddress       string
 	SenderPic         nested.Picture
 	SpamScore         float64
+	Timestamp         uint64
 	ReplyTo           string
 	RawUniversalID    nested.UniversalID
 	NonBlindPlaceIDs  []string
@@ -26,4 +32,11 @@ type NestedMail struct {
 	AttachOwners      []string
 	InlineAttachments map[string]string
 	Attachments       map[string]nested.FileInfo
+	Calendar          *ical.Calendar
+}
+
+// messageIDOf returns the Message-ID of the envelope as it is stored in the posts and looked up for
+// deduplication
+func messageIDOf(envelope *enmime.Envelope) string {
+	return strings.TrimSpace(envelope.GetHeader("Message-ID"))
 }
@@ -12,6 +12,7 @@ import (
     "strconv"
     "strings"
     "sync"
+    "time"
 
     "git.ronaksoft.com/nested/server/nested"
     "git.ronaksoft.com/nested/server/pkg/config"
@@ -40,6 +41,10 @@ type Session struct {
     model      *nested.Manager
     uploader   *uploadClient
     pusher     *pusherClient
+
+    // imported is set by the Importer. Then rcpts are place ids, the Date header is kept as
+    // the post timestamp and no push is sent for the created posts.
+    imported bool
 }
 
 var _ smtp.Session = (*Session)(nil)
@@ -79,17 +84,21 @@ func (s *Session) Rcpt(to string, opts *smtp.RcptOptions) error {
 }
 
 func (s *Session) Data(r io.Reader) (err error) {
-    var (
-        envelope   *enmime.Envelope
-        nestedMail = &NestedMail{
-            Attachments:       map[string]nested.FileInfo{},
-            InlineAttachments: map[string]string{},
-        }
-    )
+    var envelope *enmime.Envelope
     if envelope, err = enmime.ReadEnvelope(r); err != nil {
         log.Warn("got error on read envelope", zap.Error(err))
         return
     }
+    return s.deliver(envelope)
+}
+
+// deliver runs the envelope through the whole pipeline and creates the posts. It is shared
+// between the LMTP server and the archive Importer.
+func (s *Session) deliver(envelope *enmime.Envelope) (err error) {
+    nestedMail := &NestedMail{
+        Attachments:       map[string]nested.FileInfo{},
+        InlineAttachments: map[string]string{},
+    }
     if err = s.extractSender(nestedMail, envelope); err != nil {
         log.Warn("got error on extract sender", zap.Error(err))
         return
@@ -114,14 +123,14 @@ func (s *Session) Data(r io.Reader) (err error) {
         log.Warn("got error on extract inline attachments", zap.Error(err))
         return
     }
-    if err = s.extractInlineAttachments(nestedMail, envelope); err != nil {
-        log.Warn("got error on extract inline attachments", zap.Error(err))
-        return
-    }
     if err = s.extractAttachments(nestedMail, envelope); err != nil {
         log.Warn("got error on extract attachments", zap.Error(err))
         return
     }
+    if err = s.extractCalendar(nestedMail, envelope); err != nil {
+        log.Warn("got error on extract calendar", zap.Error(err))
+        return
+    }
     if err = s.store(nestedMail, envelope); err != nil {
         log.Warn("got error on store", zap.Error(err))
         return
@@ -129,6 +138,7 @@ func (s *Session) Data(r io.Reader) (err error) {
 
     return
 }
+
 func (s *Session) extractSender(nm *NestedMail, mailEnvelope *enmime.Envelope) error {
     from := mailEnvelope.GetHeader("From")
     if addr, err := mail.ParseAddress(s.from); err != nil {
@@ -142,6 +152,7 @@ func (s *Session) extractSender(nm *NestedMail, mailEnvelope *enmime.Envelope) e
     if addr, err := mail.ParseAddress(from); err != nil {
         log.Error("got error on parsing FROM header", zap.Error(err), zap.String("FROM", from))
     } else {
+        nm.FromAddress = addr.Address
         if addr.Address == nm.SenderID && nm.SenderName == "" {
             nm.SenderName = addr.Name
         }
@@ -167,9 +178,22 @@ func (s *Session) extractHeader(nm *NestedMail, envelope *enmime.Envelope) error
         log.Debug("Score Extracted", zap.Any("Items", items), zap.Any("Score", nm.SpamScore), zap.Any("Level", spamLevel))
     }
 
+    if s.imported {
+        if t, err := mail.ParseDate(envelope.GetHeader("Date")); err == nil {
+            nm.Timestamp = uint64(t.UnixNano() / int64(time.Millisecond))
+        }
+    }
+
     return nil
 }
 func (s *Session) extractRecipients(nm *NestedMail, envelope *enmime.Envelope) error {
+    if s.imported {
+        // Recipients have already been mapped to places by the Importer
+        nm.NonBlindPlaceIDs = append(nm.NonBlindPlaceIDs, s.rcpts...)
+        nm.NonBlindTargets = append(nm.NonBlindTargets, s.rcpts...)
+        nm.AttachOwners = append(nm.AttachOwners, nm.NonBlindPlaceIDs...)
+        return nil
+    }
     recipientGroup := NewRecipientGroup(envelope)
 
     for _, rcpt := range s.rcpts {
@@ -358,7 +382,7 @@ func (s *Session) store(nm *NestedMail, mailEnvelope *enmime.Envelope) error {
     var (
         bodyHtml  = mailEnvelope.HTML
         bodyPlain = mailEnvelope.Text
-        messageID = mailEnvelope.GetHeader("Message-ID")
+        messageID = messageIDOf(mailEnvelope)
         inReplyTo = mailEnvelope.GetHeader("In-Reply-To")
         subject   = mailEnvelope.GetHeader("Subject")
     )
@@ -383,6 +407,7 @@ func (s *Session) store(nm *NestedMail, mailEnvelope *enmime.Envelope) error {
             PlaceIDs:   []string{},
             Recipients: []string{},
             SpamScore:  nm.SpamScore,
+            Timestamp:  nm.Timestamp,
         }
         postAttachmentIDs := make([]nested.UniversalID, 0, len(nm.Attachments))
         postAttachmentSizes := make([]int64, 0, len(nm.Attachments))
@@ -430,8 +455,8 @@ func (s *Session) store(nm *NestedMail, mailEnvelope *enmime.Envelope) error {
         if post == nil {
             return fmt.Errorf("could not create post")
         }
-
-        if !post.Spam {
+        if !post.Spam && !s.imported {
+            s.applyCalendar(nm, post)
             for _, pid := range post.PlaceIDs {
                 s.pusher.PlaceActivity(pid, nested.PlaceActivityActionPostAdd)
             }
@@ -0,0 +1,427 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Package oidc implements the relying party of the OpenID Connect authorization code flow with PKCE.
+// ID tokens must be signed by RS256.
+
+const (
+	// clockSkew is the tolerance of the expiry and the issue time of the tokens
+	clockSkew = 2 * time.Minute
+	// maxResponseSize limits the responses of the issuer
+	maxResponseSize = 1 << 20
+)
+
+var (
+	ErrInvalidToken = errors.New("oidc: invalid id token")
+	ErrExpiredToken = errors.New("oidc: id token is expired")
+	ErrInvalidNonce = errors.New("oidc: invalid nonce")
+)
+
+var b64 = base64.RawURLEncoding
+
+// ClaimMap names the claims which are used for the accounts, the defaults are the standard claims
+type ClaimMap struct {
+	UID           string `json:"uid"`
+	Email         string `json:"email"`
+	EmailVerified string `json:"email_verified"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+}
+
+// Config is the configuration of an identity provider
+type Config struct {
+	Name         string   `json:"name"`
+	Title        string   `json:"title"`
+	Issuer       string   `json:"issuer"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	Claims       ClaimMap `json:"claims"`
+}
+
+// Identity is the user which the identity provider has authenticated
+type Identity struct {
+	Subject       string
+	UID           string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Claims        map[string]interface{}
+}
+
+// Token is the response of the token endpoint
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Provider is an identity provider, its endpoints are discovered on the first use
+type Provider struct {
+	HTTPClient *http.Client
+	cfg        Config
+
+	mtx         sync.Mutex
+	discovery   *discovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+}
+
+// KeysRefreshInterval is the minimum interval between fetching the keys again for the unknown kids,
+// the tokens of the unknown kids are rejected in between
+const KeysRefreshInterval = time.Minute
+
+// NewProvider returns the provider of the config, empty claim names are set to the standard claims
+func NewProvider(cfg Config) *Provider {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if len(cfg.Claims.UID) == 0 {
+		cfg.Claims.UID = "preferred_username"
+	}
+	if len(cfg.Claims.Email) == 0 {
+		cfg.Claims.Email = "email"
+	}
+	if len(cfg.Claims.EmailVerified) == 0 {
+		cfg.Claims.EmailVerified = "email_verified"
+	}
+	if len(cfg.Claims.FirstName) == 0 {
+		cfg.Claims.FirstName = "given_name"
+	}
+	if len(cfg.Claims.LastName) == 0 {
+		cfg.Claims.LastName = "family_name"
+	}
+	return &Provider{
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		cfg:        cfg,
+	}
+}
+
+// ParseConfigs parses the json array of the provider configs
+func ParseConfigs(s string) ([]Config, error) {
+	cfgs := make([]Config, 0)
+	if len(strings.TrimSpace(s)) == 0 {
+		return cfgs, nil
+	}
+	if err := json.Unmarshal([]byte(s), &cfgs); err != nil {
+		return nil, err
+	}
+	for _, cfg := range cfgs {
+		if len(cfg.Name) == 0 || len(cfg.Issuer) == 0 || len(cfg.ClientID) == 0 {
+			return nil, fmt.Errorf("oidc: name, issuer and client_id of the providers are required")
+		}
+	}
+	return cfgs, nil
+}
+
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) Title() string {
+	if len(p.cfg.Title) == 0 {
+		return p.cfg.Name
+	}
+	return p.cfg.Title
+}
+
+// AuthCodeURL returns the url of the login page of the identity provider. The verifier of the
+// codeChallenge must be passed to Exchange.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	d, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint
+func (p *Provider) Exchange(code, codeVerifier string) (*Token, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: token endpoint returned %d: %s", res.StatusCode, body)
+	}
+	t := new(Token)
+	if err := json.Unmarshal(body, t); err != nil {
+		return nil, err
+	}
+	if len(t.IDToken) == 0 {
+		return nil, fmt.Errorf("oidc: token response has no id_token")
+	}
+	return t, nil
+}
+
+// Verify checks the signature and the claims of the id token and returns the identity of the user
+func (p *Provider) Verify(rawIDToken, nonce string) (*Identity, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("oidc: unsupported signing algorithm: %s", header.Alg)
+	}
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], sig); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != d.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if !audienceContains(claims["aud"], p.cfg.ClientID) {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, ErrExpiredToken
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(clockSkew)) {
+		return nil, ErrInvalidToken
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, ErrInvalidNonce
+	}
+	sub, _ := claims["sub"].(string)
+	if len(sub) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	id := &Identity{
+		Subject:   sub,
+		UID:       stringClaim(claims, p.cfg.Claims.UID),
+		Email:     strings.ToLower(stringClaim(claims, p.cfg.Claims.Email)),
+		FirstName: stringClaim(claims, p.cfg.Claims.FirstName),
+		LastName:  stringClaim(claims, p.cfg.Claims.LastName),
+		Claims:    claims,
+	}
+	switch v := claims[p.cfg.Claims.EmailVerified].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+	return id, nil
+}
+
+// discover reads the configuration of the issuer, it is cached after the first success
+func (p *Provider) discover() (*discovery, error) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	d := new(discovery)
+	if err := p.getJSON(p.cfg.Issuer+"/.well-known/openid-configuration", d); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: issuer mismatch: %s", d.Issuer)
+	}
+	if len(d.AuthorizationEndpoint) == 0 || len(d.TokenEndpoint) == 0 || len(d.JwksURI) == 0 {
+		return nil, fmt.Errorf("oidc: incomplete discovery document")
+	}
+	p.discovery = d
+	return d, nil
+}
+
+// key returns the signing key of the kid, the keys are fetched again if the kid is unknown hence
+// the rotated keys are picked up. They are fetched at most once per KeysRefreshInterval.
+func (p *Provider) key(kid string) (*rsa.PublicKey, error) {
+	p.mtx.Lock()
+	k, ok := p.keys[kid]
+	if !ok && time.Since(p.keysFetched) < KeysRefreshInterval {
+		p.mtx.Unlock()
+		return nil, fmt.Errorf("oidc: unknown signing key: %s", kid)
+	}
+	if !ok {
+		// the failed fetches count too, so the unknown kids could not flood the issuer
+		p.keysFetched = time.Now()
+	}
+	p.mtx.Unlock()
+	if ok {
+		return k, nil
+	}
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := p.getJSON(d.JwksURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		n, err1 := b64.DecodeString(jwk.N)
+		e, err2 := b64.DecodeString(jwk.E)
+		if err1 != nil || err2 != nil || len(e) > 4 {
+			continue
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	p.mtx.Lock()
+	p.keys = keys
+	p.mtx.Unlock()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("oidc: unknown signing key: %s", kid)
+}
+
+func (p *Provider) getJSON(u string, v interface{}) error {
+	res, err := p.HTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %d", u, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
+
+// NewCodeVerifier returns a random PKCE verifier and its S256 challenge
+func NewCodeVerifier() (string, string) {
+	verifier := RandomString(32)
+	h := sha256.Sum256([]byte(verifier))
+	return verifier, b64.EncodeToString(h[:])
+}
+
+// RandomString returns n random bytes in url safe base64, it is used for the states and the nonces
+func RandomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b64.EncodeToString(b)
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := b64.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, _ := a.(string); s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,153 @@
+package oidc_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/oidc"
+	"git.ronaksoft.com/nested/server/pkg/oidc/oidctest"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testClientID     = "nested"
+	testClientSecret = "nested-secret"
+	testRedirectURL  = "http://nested.test/oidc/test/callback"
+)
+
+// login follows the authorization endpoint of the issuer and returns the code and the state of
+// the redirect
+func login(c C, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	res, err := client.Get(authURL)
+	c.So(err, ShouldBeNil)
+	defer res.Body.Close()
+	c.So(res.StatusCode, ShouldEqual, http.StatusFound)
+	u, err := url.Parse(res.Header.Get("Location"))
+	c.So(err, ShouldBeNil)
+	c.So(strings.HasPrefix(u.String(), testRedirectURL), ShouldBeTrue)
+	return u.Query().Get("code"), u.Query().Get("state")
+}
+
+func TestProvider(t *testing.T) {
+	iss, err := oidctest.NewIssuer(testClientID, testClientSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iss.Close()
+
+	Convey("Provider", t, func(c C) {
+		p := oidc.NewProvider(oidc.Config{
+			Name:         "test",
+			Issuer:       iss.URL(),
+			ClientID:     testClientID,
+			ClientSecret: testClientSecret,
+			RedirectURL:  testRedirectURL,
+		})
+		iss.SetUser(map[string]interface{}{
+			"sub":                "user-1",
+			"preferred_username": "alice",
+			"email":              "Alice@Nested.Test",
+			"email_verified":     true,
+			"given_name":         "Alice",
+			"family_name":        "Smith",
+		})
+
+		Convey("Authorization Code Flow", func(c C) {
+			state, nonce := oidc.RandomString(16), oidc.RandomString(16)
+			verifier, challenge := oidc.NewCodeVerifier()
+			authURL, err := p.AuthCodeURL(state, nonce, challenge)
+			c.So(err, ShouldBeNil)
+
+			code, returnedState := login(c, authURL)
+			c.So(returnedState, ShouldEqual, state)
+
+			token, err := p.Exchange(code, verifier)
+			c.So(err, ShouldBeNil)
+			id, err := p.Verify(token.IDToken, nonce)
+			c.So(err, ShouldBeNil)
+			c.So(id.Subject, ShouldEqual, "user-1")
+			c.So(id.UID, ShouldEqual, "alice")
+			c.So(id.Email, ShouldEqual, "alice@nested.test")
+			c.So(id.EmailVerified, ShouldBeTrue)
+			c.So(id.FirstName, ShouldEqual, "Alice")
+			c.So(id.LastName, ShouldEqual, "Smith")
+
+			// codes are redeemed only once
+			_, err = p.Exchange(code, verifier)
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("PKCE", func(c C) {
+			_, challenge := oidc.NewCodeVerifier()
+			authURL, err := p.AuthCodeURL("state", "nonce", challenge)
+			c.So(err, ShouldBeNil)
+			code, _ := login(c, authURL)
+			otherVerifier, _ := oidc.NewCodeVerifier()
+			_, err = p.Exchange(code, otherVerifier)
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Verify", func(c C) {
+			id, err := p.Verify(iss.Sign(iss.Claims("user-2", "n1")), "n1")
+			c.So(err, ShouldBeNil)
+			c.So(id.Subject, ShouldEqual, "user-2")
+			c.So(id.EmailVerified, ShouldBeFalse)
+
+			_, err = p.Verify(iss.Sign(iss.Claims("user-2", "n1")), "n2")
+			c.So(err, ShouldEqual, oidc.ErrInvalidNonce)
+
+			claims := iss.Claims("user-2", "n1")
+			claims["aud"] = "other-client"
+			_, err = p.Verify(iss.Sign(claims), "n1")
+			c.So(err, ShouldEqual, oidc.ErrInvalidToken)
+
+			claims = iss.Claims("user-2", "n1")
+			claims["iss"] = "https://evil.test"
+			_, err = p.Verify(iss.Sign(claims), "n1")
+			c.So(err, ShouldEqual, oidc.ErrInvalidToken)
+
+			claims = iss.Claims("user-2", "n1")
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			_, err = p.Verify(iss.Sign(claims), "n1")
+			c.So(err, ShouldEqual, oidc.ErrExpiredToken)
+
+			// tampered payload
+			parts := strings.Split(iss.Sign(iss.Claims("user-2", "n1")), ".")
+			other := strings.Split(iss.Sign(iss.Claims("admin", "n1")), ".")
+			_, err = p.Verify(parts[0]+"."+other[1]+"."+parts[2], "n1")
+			c.So(err, ShouldEqual, oidc.ErrInvalidToken)
+		})
+		Convey("Unknown Key", func(c C) {
+			// the keys are fetched for the first unknown kid only, the rest are rejected without
+			// asking the issuer until KeysRefreshInterval passes
+			fetches := iss.KeyFetches()
+			parts := strings.Split(iss.Sign(iss.Claims("user-2", "n1")), ".")
+			header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"unknown"}`))
+			for i := 0; i < 5; i++ {
+				_, err := p.Verify(header+"."+parts[1]+"."+parts[2], "n1")
+				c.So(err, ShouldNotBeNil)
+			}
+			c.So(iss.KeyFetches(), ShouldEqual, fetches+1)
+
+			// the known keys are still accepted
+			_, err := p.Verify(iss.Sign(iss.Claims("user-2", "n1")), "n1")
+			c.So(err, ShouldBeNil)
+			c.So(iss.KeyFetches(), ShouldEqual, fetches+1)
+		})
+		Convey("ParseConfigs", func(c C) {
+			cfgs, err := oidc.ParseConfigs(`[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "id"}]`)
+			c.So(err, ShouldBeNil)
+			c.So(cfgs, ShouldHaveLength, 1)
+			_, err = oidc.ParseConfigs(`[{"name": "google"}]`)
+			c.So(err, ShouldNotBeNil)
+			cfgs, err = oidc.ParseConfigs("")
+			c.So(err, ShouldBeNil)
+			c.So(cfgs, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const keyID = "test-key"
+
+var b64 = base64.RawURLEncoding
+
+type authorization struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	claims        map[string]interface{}
+}
+
+// Issuer is a mock identity provider for the tests. Its authorization endpoint logs in the user
+// which has been set by SetUser without any prompt and redirects back with the code.
+type Issuer struct {
+	ClientID     string
+	ClientSecret string
+
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	mtx     sync.Mutex
+	user    map[string]interface{}
+	codes   map[string]authorization
+	fetches int
+}
+
+// NewIssuer starts the issuer, clientID and clientSecret are the only accepted credentials
+func NewIssuer(clientID, clientSecret string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	iss := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		user:         map[string]interface{}{},
+		codes:        map[string]authorization{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/authorize", iss.authorize)
+	mux.HandleFunc("/token", iss.token)
+	mux.HandleFunc("/jwks", iss.jwks)
+	iss.server = httptest.NewServer(mux)
+	return iss, nil
+}
+
+func (iss *Issuer) URL() string {
+	return iss.server.URL
+}
+
+func (iss *Issuer) Close() {
+	iss.server.Close()
+}
+
+// SetUser sets the claims of the user which logs in, 'sub' is required
+func (iss *Issuer) SetUser(claims map[string]interface{}) {
+	iss.mtx.Lock()
+	iss.user = claims
+	iss.mtx.Unlock()
+}
+
+// Sign returns an id token with the claims signed by the key of the issuer
+func (iss *Issuer) Sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": keyID})
+	payload, _ := json.Marshal(claims)
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signingInput))
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, h[:])
+	return signingInput + "." + b64.EncodeToString(sig)
+}
+
+// Claims returns the standard claims of an id token for the client
+func (iss *Issuer) Claims(sub, nonce string) map[string]interface{} {
+	now := time.Now().Unix()
+	return map[string]interface{}{
+		"iss":   iss.server.URL,
+		"aud":   iss.ClientID,
+		"sub":   sub,
+		"nonce": nonce,
+		"iat":   now,
+		"exp":   now + 300,
+	}
+}
+
+func (iss *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 iss.server.URL,
+		"authorization_endpoint": iss.server.URL + "/authorize",
+		"token_endpoint":         iss.server.URL + "/token",
+		"jwks_uri":               iss.server.URL + "/jwks",
+	})
+}
+
+func (iss *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != iss.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	iss.mtx.Lock()
+	code := b64.EncodeToString(randomBytes(16))
+	iss.codes[code] = authorization{
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		claims:        iss.user,
+	}
+	iss.mtx.Unlock()
+
+	u, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	rq := u.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	u.RawQuery = rq.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (iss *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	if clientID != iss.ClientID || clientSecret != iss.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	_ = r.ParseForm()
+	code := r.PostForm.Get("code")
+	iss.mtx.Lock()
+	a, ok := iss.codes[code]
+	delete(iss.codes, code)
+	iss.mtx.Unlock()
+	h := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != a.redirectURI || b64.EncodeToString(h[:]) != a.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	sub, _ := a.claims["sub"].(string)
+	claims := iss.Claims(sub, a.nonce)
+	for k, v := range a.claims {
+		claims[k] = v
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": b64.EncodeToString(randomBytes(16)),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     iss.Sign(claims),
+	})
+}
+
+// KeyFetches returns the number of the requests to the jwks endpoint
+func (iss *Issuer) KeyFetches() int {
+	iss.mtx.Lock()
+	defer iss.mtx.Unlock()
+	return iss.fetches
+}
+
+func (iss *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	iss.mtx.Lock()
+	iss.fetches++
+	iss.mtx.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   b64.EncodeToString(iss.key.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(iss.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return b
+}
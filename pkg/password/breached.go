@@ -0,0 +1,68 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PrefixLength is the length of the hex prefixes of the SHA-1 hashes which name the range files
+const PrefixLength = 5
+
+// BreachedList is a local copy of the breached passwords in the k-anonymity format of the Pwned
+// Passwords service. The directory has a file for each prefix of the SHA-1 hashes, named by the
+// prefix (i.e. 21BD1 or 21BD1.txt), and each line of the file is the suffix of a hash and its count
+// (i.e. 2DC183F740EE76F27B78EB39C8AD972A757:52579). Only the file of the prefix of the password is
+// read on each check.
+type BreachedList struct {
+	dir string
+}
+
+// NewBreachedList returns the list of the directory
+func NewBreachedList(dir string) (*BreachedList, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &BreachedList{dir: dir}, nil
+}
+
+// Contains returns true if the password is in the breached list
+func (l *BreachedList) Contains(pass string) (bool, error) {
+	h := sha1.Sum([]byte(pass))
+	hash := strings.ToUpper(hex.EncodeToString(h[:]))
+	prefix, suffix := hash[:PrefixLength], hash[PrefixLength:]
+
+	f, err := os.Open(filepath.Join(l.dir, prefix))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		idx := strings.IndexByte(line, ':')
+		if idx == -1 {
+			idx = len(line)
+		}
+		if !strings.EqualFold(line[:idx], suffix) {
+			continue
+		}
+		// padding lines of the service have zero counts
+		return strings.TrimSpace(line[idx:]) != ":0", nil
+	}
+	return false, s.Err()
+}
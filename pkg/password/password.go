@@ -0,0 +1,105 @@
+package password
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// Rules of the policy, the violated rules are returned by Check
+const (
+	RuleMinLength   = "min_length"
+	RuleClasses     = "classes"
+	RuleAccountInfo = "account_info"
+	RuleReused      = "reused"
+	RuleBreached    = "breached"
+	RuleDigest      = "digest"
+)
+
+// MinInfoLength is the minimum length of the parts of the account info which are searched in the password,
+// the shorter parts are ignored otherwise most passwords contain them
+const MinInfoLength = 3
+
+// Policy is the requirements of the new passwords
+type Policy struct {
+	MinLength int
+	// MinClasses is the number of the character classes (lower, upper, digit and symbol) which the
+	// password must contain
+	MinClasses int
+	// NoAccountInfo disallows the passwords which contain the username or the name of the account
+	NoAccountInfo bool
+}
+
+// Check returns the rules of the policy which the password violates, info are the username and the
+// names of the account. The policy could only be checked on the plain passwords, so the passwords
+// which look like the digests of the hashing clients only violate RuleDigest.
+func (p Policy) Check(pass string, info ...string) []string {
+	rules := make([]string, 0, 3)
+	if IsDigest(pass) {
+		return append(rules, RuleDigest)
+	}
+	if len([]rune(pass)) < p.MinLength {
+		rules = append(rules, RuleMinLength)
+	}
+	if Classes(pass) < p.MinClasses {
+		rules = append(rules, RuleClasses)
+	}
+	if p.NoAccountInfo && ContainsInfo(pass, info...) {
+		rules = append(rules, RuleAccountInfo)
+	}
+	return rules
+}
+
+// IsDigest returns true if the password looks like the md5 hex digest of a password, which Nested
+// clients send instead of the password itself
+func IsDigest(pass string) bool {
+	if len(pass) != 32 {
+		return false
+	}
+	for _, r := range pass {
+		if !unicode.Is(unicode.ASCII_Hex_Digit, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Digest returns the md5 hex digest of the plain password, which is what Nested clients log in by
+func Digest(pass string) string {
+	h := md5.Sum([]byte(pass))
+	return hex.EncodeToString(h[:])
+}
+
+// Classes returns the number of the character classes which are used in the password
+func Classes(pass string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range pass {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// ContainsInfo returns true if the password contains any of the info case-insensitively, the names
+// are also checked word by word
+func ContainsInfo(pass string, info ...string) bool {
+	pass = strings.ToLower(pass)
+	for _, i := range info {
+		for _, part := range append(strings.Fields(i), strings.ReplaceAll(i, " ", "")) {
+			part = strings.ToLower(part)
+			if len([]rune(part)) >= MinInfoLength && strings.Contains(pass, part) {
+				return true
+			}
+		}
+	}
+	return false
+}
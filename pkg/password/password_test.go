@@ -0,0 +1,74 @@
+package password_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/password"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolicy(t *testing.T) {
+	Convey("Policy", t, func(c C) {
+		Convey("Classes", func(c C) {
+			c.So(password.Classes("abc"), ShouldEqual, 1)
+			c.So(password.Classes("abcD1"), ShouldEqual, 3)
+			c.So(password.Classes("aB1!"), ShouldEqual, 4)
+		})
+		Convey("Check", func(c C) {
+			p := password.Policy{MinLength: 8, MinClasses: 3, NoAccountInfo: true}
+			c.So(p.Check("Str0ng-Pass", "ehsan", "Ehsan Moosa"), ShouldBeEmpty)
+			c.So(p.Check("Ab1"), ShouldResemble, []string{password.RuleMinLength})
+			c.So(p.Check("abcdefgh"), ShouldResemble, []string{password.RuleClasses})
+			c.So(p.Check("My-Ehsan-2021", "ehsan"), ShouldResemble, []string{password.RuleAccountInfo})
+			c.So(p.Check("moosa-2021-X", "e2", "Ehsan Moosa"), ShouldResemble, []string{password.RuleAccountInfo})
+			c.So(p.Check("Xe2-2021-pass", "e2"), ShouldBeEmpty)
+			c.So(password.Policy{}.Check(""), ShouldBeEmpty)
+		})
+		Convey("Digest", func(c C) {
+			p := password.Policy{MinLength: 40, MinClasses: 4, NoAccountInfo: true}
+			c.So(password.IsDigest("5f4dcc3b5aa765d61d8327deb882cf99"), ShouldBeTrue)
+			c.So(password.IsDigest("5F4DCC3B5AA765D61D8327DEB882CF99"), ShouldBeTrue)
+			c.So(password.IsDigest("5f4dcc3b5aa765d61d8327deb882cf9"), ShouldBeFalse)
+			c.So(password.IsDigest("5f4dcc3b5aa765d61d8327deb882cf9g"), ShouldBeFalse)
+			// the policy could not be checked on the digests, so they are never accepted
+			c.So(p.Check("5f4dcc3b5aa765d61d8327deb882cf99", "5f4dcc"), ShouldResemble, []string{password.RuleDigest})
+			c.So(password.Policy{}.Check("0123456789ABCDEF0123456789abcdef"), ShouldResemble, []string{password.RuleDigest})
+			c.So(p.Check("abcdefgh"), ShouldResemble, []string{password.RuleMinLength, password.RuleClasses})
+			c.So(password.Digest("password"), ShouldEqual, "5f4dcc3b5aa765d61d8327deb882cf99")
+		})
+	})
+}
+
+func TestBreachedList(t *testing.T) {
+	Convey("BreachedList", t, func(c C) {
+		dir := t.TempDir()
+		// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+		err := os.WriteFile(filepath.Join(dir, "5BAA6"), []byte(
+			"003D68EB55068C33ACE09247EE4C639306B:3\r\n"+
+				"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n",
+		), 0644)
+		c.So(err, ShouldBeNil)
+		// SHA-1 of "123456" is 7C4A8D09CA3762AF61E59520943DC26494F8941B
+		err = os.WriteFile(filepath.Join(dir, "7C4A8.txt"), []byte(
+			"D09CA3762AF61E59520943DC26494F8941B:0\n",
+		), 0644)
+		c.So(err, ShouldBeNil)
+
+		l, err := password.NewBreachedList(dir)
+		c.So(err, ShouldBeNil)
+		ok, err := l.Contains("password")
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeTrue)
+		ok, err = l.Contains("123456")
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeFalse)
+		ok, err = l.Contains("Str0ng-Pass")
+		c.So(err, ShouldBeNil)
+		c.So(ok, ShouldBeFalse)
+
+		_, err = password.NewBreachedList(filepath.Join(dir, "5BAA6"))
+		c.So(err, ShouldNotBeNil)
+	})
+}
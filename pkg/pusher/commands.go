@@ -43,4 +43,7 @@ type cmdPushInternal struct {
 type cmdPushExternal struct {
 	Targets []string          `json:"targets"`
 	Data    map[string]string `json:"data"`
+	// NotificationType is set if the push is a notification, then the notification settings of
+	// the targets are checked for each channel
+	NotificationType int `json:"notification_type,omitempty"`
 }
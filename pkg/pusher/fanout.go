@@ -0,0 +1,202 @@
+package pusher
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Each instance (bundle) subscribes to its own channel in redis. Pushes for the websockets which are
+// connected to the other bundles are published into their channels, and the owner delivers them.
+// Every instance also keeps an 'alive' key with a short ttl, if nobody listens to the channel of a
+// bundle and its alive key has been expired, that bundle is stale and its websockets will be removed.
+// Only the bundles which have ever sent a heartbeat (i.e. they are in the heartbeat set) could be
+// stale, the instances of the older versions do not send them (i.e. during a rolling deploy).
+const (
+	bundleChannelPrefix  = "push:bundle:"
+	bundleAliveKeyPrefix = "push:alive:"
+	bundleHeartbeatSet   = "push:heartbeats"
+	bundleAliveTTL       = 30 // Seconds
+	bundleHeartbeat      = 10 * time.Second
+	staleBundleCheck     = 6 // Heartbeats
+	subscribeRetryDelay  = time.Second
+)
+
+func bundleChannel(bundleID string) string {
+	return fmt.Sprintf("%s%s", bundleChannelPrefix, bundleID)
+}
+
+func bundleAliveKey(bundleID string) string {
+	return fmt.Sprintf("%s%s", bundleAliveKeyPrefix, bundleID)
+}
+
+// runSubscriber receives the pushes which have been published for this bundle and writes them
+// to the local connections. It subscribes again if the redis connection drops, until the pusher
+// is closed.
+func (p *Pusher) runSubscriber() {
+	defer p.wg.Done()
+	for {
+		psc := redis.PubSubConn{Conn: p.cache.Pool.Get()}
+		p.pscMtx.Lock()
+		if p.closed() {
+			p.pscMtx.Unlock()
+			_ = psc.Close()
+			return
+		}
+		p.psc = &psc
+		p.pscMtx.Unlock()
+		if err := psc.Subscribe(bundleChannel(p.bundleID)); err != nil {
+			log.Warn("got error on subscribing bundle channel", zap.Error(err), zap.String("BundleID", p.bundleID))
+		} else {
+		ReceiveLoop:
+			for {
+				switch v := psc.Receive().(type) {
+				case redis.Message:
+					p.deliverPublished(v.Data)
+				case error:
+					if !p.closed() {
+						log.Warn("got error on receiving from bundle channel", zap.Error(v), zap.String("BundleID", p.bundleID))
+					}
+					break ReceiveLoop
+				}
+			}
+		}
+		p.pscMtx.Lock()
+		p.psc = nil
+		p.pscMtx.Unlock()
+		_ = psc.Close()
+		select {
+		case <-p.done:
+			return
+		case <-time.After(subscribeRetryDelay):
+		}
+	}
+}
+
+// runHeartbeat keeps the alive key of this bundle and periodically removes the websockets of
+// the stale bundles, until the pusher is closed
+func (p *Pusher) runHeartbeat() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(bundleHeartbeat)
+	defer ticker.Stop()
+	for beat := 0; ; beat++ {
+		c := p.cache.Pool.Get()
+		_ = c.Send("MULTI")
+		_ = c.Send("SETEX", bundleAliveKey(p.bundleID), bundleAliveTTL, time.Now().Unix())
+		_ = c.Send("SADD", bundleHeartbeatSet, p.bundleID)
+		if _, err := c.Do("EXEC"); err != nil {
+			log.Warn("got error on bundle heartbeat", zap.Error(err), zap.String("BundleID", p.bundleID))
+		}
+		_ = c.Close()
+		p.refreshPresence()
+		if beat%staleBundleCheck == 0 {
+			p.removeStaleBundles()
+		}
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the heartbeat and the subscriber of the bundle and removes its websockets, since
+// nobody delivers their pushes anymore
+func (p *Pusher) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		p.pscMtx.Lock()
+		if p.psc != nil {
+			_ = p.psc.Close()
+		}
+		p.pscMtx.Unlock()
+		p.wg.Wait()
+
+		c := p.cache.Pool.Get()
+		_ = c.Send("MULTI")
+		_ = c.Send("DEL", bundleAliveKey(p.bundleID))
+		_ = c.Send("SREM", bundleHeartbeatSet, p.bundleID)
+		if _, err := c.Do("EXEC"); err != nil {
+			log.Warn("got error on removing bundle heartbeat", zap.Error(err), zap.String("BundleID", p.bundleID))
+		}
+		_ = c.Close()
+		p.ws.RemoveByBundleID(p.bundleID)
+	})
+}
+
+func (p *Pusher) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Pusher) removeStaleBundles() {
+	for _, bundleID := range p.model.GetBundles() {
+		if bundleID != p.bundleID && p.isBundleStale(bundleID) {
+			p.removeBundle(bundleID)
+		}
+	}
+}
+
+// isBundleStale returns true if the bundle has sent heartbeats but its alive key has been expired
+func (p *Pusher) isBundleStale(bundleID string) bool {
+	c := p.cache.Pool.Get()
+	defer c.Close()
+	_ = c.Send("SISMEMBER", bundleHeartbeatSet, bundleID)
+	_ = c.Send("EXISTS", bundleAliveKey(bundleID))
+	_ = c.Flush()
+	heartbeats, _ := redis.Bool(c.Receive())
+	alive, err := redis.Bool(c.Receive())
+	return err == nil && heartbeats && !alive
+}
+
+func (p *Pusher) removeBundle(bundleID string) {
+	log.Info("removing websockets of stale bundle", zap.String("BundleID", bundleID))
+	p.ws.RemoveByBundleID(bundleID)
+	c := p.cache.Pool.Get()
+	_, _ = c.Do("SREM", bundleHeartbeatSet, bundleID)
+	_ = c.Close()
+}
+
+func (p *Pusher) deliverPublished(data []byte) {
+	var pushes []WebsocketPush
+	if err := json.Unmarshal(data, &pushes); err != nil {
+		log.Warn("got error on decoding published pushes", zap.Error(err))
+		return
+	}
+	for _, push := range pushes {
+		if push.BundleID != p.bundleID {
+			continue
+		}
+		if !p.pushCB(push) {
+			_ = p.UnregisterWebsocket(push.WebsocketID, push.BundleID)
+		}
+	}
+}
+
+// publish sends the pushes to the instance which owns bundleID. If the bundle is stale, its
+// websockets will be removed from the registry.
+func (p *Pusher) publish(bundleID string, pushes []WebsocketPush) {
+	data, err := json.Marshal(pushes)
+	if err != nil {
+		log.Warn("got error on encoding pushes", zap.Error(err))
+		return
+	}
+	c := p.cache.Pool.Get()
+	receivers, err := redis.Int(c.Do("PUBLISH", bundleChannel(bundleID), data))
+	_ = c.Close()
+	if err != nil {
+		log.Warn("got error on publishing pushes", zap.Error(err), zap.String("BundleID", bundleID))
+		return
+	}
+	if receivers == 0 && p.isBundleStale(bundleID) {
+		p.removeBundle(bundleID)
+	}
+}
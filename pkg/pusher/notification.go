@@ -1,10 +1,7 @@
 package pusher
 
 import (
-	"context"
-	"firebase.google.com/go/v4/messaging"
 	"git.ronaksoft.com/nested/server/nested"
-	"git.ronaksoft.com/nested/server/pkg/session"
 )
 
 /*
@@ -29,6 +26,7 @@ func init() {
 		nested.NotificationTypeDemoted:              "Demoted",
 		nested.NotificationTypePlaceSettingsChanged: "Place Settings Updated",
 		nested.NotificationTypeNewSession:           "New Session",
+		nested.NotificationTypeLoginLocked:          "Account Locked",
 		nested.NotificationTypeLabelRequestApproved: "Request Approved",
 		nested.NotificationTypeLabelRequestRejected: "Request Rejected",
 		nested.NotificationTypeLabelRequestCreated:  "New Request",
@@ -52,38 +50,3 @@ func init() {
 	}
 
 }
-
-func (p *Pusher) sendFCM(d session.Device, req cmdPushExternal) {
-	if p.fcm == nil {
-		return
-	}
-
-	message := messaging.Message{
-		Data:  req.Data,
-		Token: d.Token,
-		Android: &messaging.AndroidConfig{
-			Priority: "high",
-			Data:     req.Data,
-		},
-		APNS: &messaging.APNSConfig{
-			Payload: &messaging.APNSPayload{
-				Aps: &messaging.Aps{
-					Alert: &messaging.ApsAlert{
-						Title: req.Data["title"],
-						Body:  req.Data["msg"],
-					},
-					Badge:      &d.Badge,
-					CustomData: make(map[string]interface{}),
-				},
-			},
-		},
-	}
-	for k, v := range req.Data {
-		message.APNS.Payload.Aps.CustomData[k] = v
-	}
-
-	ctx := context.Background()
-	if _, err := p.fcm.Send(ctx, &message); err != nil {
-		p.dev.Remove(d.ID)
-	}
-}
@@ -0,0 +1,304 @@
+package pusher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"github.com/globalsign/mgo/bson"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Presence Statuses
+const (
+	PresenceOnline       = "online"
+	PresenceAway         = "away"
+	PresenceDoNotDisturb = "dnd"
+	PresenceOffline      = "offline"
+)
+
+// An account is online while its alive key exists. Every instance refreshes the alive keys of the
+// accounts which are connected to it on each heartbeat, so if an instance crashes the presence of
+// its accounts expires by itself. The status which the user has chosen (online, away or dnd) is
+// kept separately and is only visible while the account is online.
+const (
+	presenceAliveKeyPrefix  = "presence:alive:"
+	presenceStatusKeyPrefix = "presence:status:"
+	presenceSeenKeyPrefix   = "presence:seen:"
+	presenceAliveTTL        = 30 // Seconds
+	typingKeyPrefix         = "typing:"
+	typingTTL               = 5 // Seconds
+)
+
+type Presence struct {
+	AccountID string `json:"account_id"`
+	Status    string `json:"status"`
+	LastSeen  uint64 `json:"last_seen,omitempty"`
+}
+
+func presenceAliveKey(accountID string) string {
+	return fmt.Sprintf("%s%s", presenceAliveKeyPrefix, accountID)
+}
+
+func presenceStatusKey(accountID string) string {
+	return fmt.Sprintf("%s%s", presenceStatusKeyPrefix, accountID)
+}
+
+func presenceSeenKey(accountID string) string {
+	return fmt.Sprintf("%s%s", presenceSeenKeyPrefix, accountID)
+}
+
+func typingKey(postID bson.ObjectId, accountID string) string {
+	return fmt.Sprintf("%s%s:%s", typingKeyPrefix, postID.Hex(), accountID)
+}
+
+// IsValidPresenceStatus returns true if the status could be chosen by the users
+func IsValidPresenceStatus(status string) bool {
+	switch status {
+	case PresenceOnline, PresenceAway, PresenceDoNotDisturb:
+		return true
+	}
+	return false
+}
+
+// setOnline marks the account as online and broadcasts its presence if it has just come online
+func (p *Pusher) setOnline(accountID string) {
+	c := p.cache.Pool.Get()
+	reply, err := c.Do("SET", presenceAliveKey(accountID), p.bundleID, "EX", presenceAliveTTL, "NX")
+	if err == nil && reply == nil {
+		// It has been online already, so only the ttl is refreshed
+		_, err = c.Do("EXPIRE", presenceAliveKey(accountID), presenceAliveTTL)
+	}
+	_, _ = c.Do("SET", presenceSeenKey(accountID), nested.Timestamp())
+	_ = c.Close()
+	if err != nil {
+		log.Warn("got error on setting presence", zap.Error(err), zap.String("AccountID", accountID))
+		return
+	}
+	if reply != nil {
+		p.broadcastPresence(accountID)
+	}
+}
+
+// setOffline marks the account as offline if it has no other websocket
+func (p *Pusher) setOffline(accountID string) {
+	if len(p.ws.GetWebsocketsByAccountID(accountID, "")) > 0 {
+		return
+	}
+	c := p.cache.Pool.Get()
+	c.Send("MULTI")
+	c.Send("DEL", presenceAliveKey(accountID))
+	c.Send("SET", presenceSeenKey(accountID), nested.Timestamp())
+	_, err := c.Do("EXEC")
+	_ = c.Close()
+	if err != nil {
+		log.Warn("got error on removing presence", zap.Error(err), zap.String("AccountID", accountID))
+		return
+	}
+	p.broadcastPresence(accountID)
+}
+
+// refreshPresence extends the alive keys of the accounts which are connected to this bundle
+func (p *Pusher) refreshPresence() {
+	accountIDs := p.ws.GetAccountsByBundleID(p.bundleID)
+	if len(accountIDs) == 0 {
+		return
+	}
+	now := nested.Timestamp()
+	c := p.cache.Pool.Get()
+	defer c.Close()
+	for _, accountID := range accountIDs {
+		c.Send("SET", presenceAliveKey(accountID), p.bundleID, "EX", presenceAliveTTL)
+		c.Send("SET", presenceSeenKey(accountID), now)
+	}
+	if err := c.Flush(); err != nil {
+		log.Warn("got error on refreshing presence", zap.Error(err), zap.String("BundleID", p.bundleID))
+		return
+	}
+	for range accountIDs {
+		_, _ = c.Receive()
+		_, _ = c.Receive()
+	}
+}
+
+// SetPresenceStatus sets the status which the account is seen by while it is online
+func (p *Pusher) SetPresenceStatus(accountID, status string) error {
+	if !IsValidPresenceStatus(status) {
+		return fmt.Errorf("invalid presence status: %s", status)
+	}
+	c := p.cache.Pool.Get()
+	_, err := c.Do("SET", presenceStatusKey(accountID), status)
+	_ = c.Close()
+	if err != nil {
+		return err
+	}
+	p.broadcastPresence(accountID)
+	return nil
+}
+
+// GetPresence returns the presence of the accounts. The requester only sees the presence of its
+// contacts and the accounts which share a place with it, the other accounts and the ones which have
+// hidden their presence are always offline.
+func (p *Pusher) GetPresence(requesterID string, accountIDs []string) []Presence {
+	res := make([]Presence, 0, len(accountIDs))
+	if len(accountIDs) == 0 {
+		return res
+	}
+	c := p.cache.Pool.Get()
+	defer c.Close()
+	for _, accountID := range accountIDs {
+		c.Send("EXISTS", presenceAliveKey(accountID))
+		c.Send("GET", presenceStatusKey(accountID))
+		c.Send("GET", presenceSeenKey(accountID))
+	}
+	if err := c.Flush(); err != nil {
+		log.Warn("got error on getting presence", zap.Error(err))
+		return res
+	}
+	visible := p.visiblePresences(requesterID, accountIDs)
+	for _, accountID := range accountIDs {
+		alive, _ := redis.Bool(c.Receive())
+		status, _ := redis.String(c.Receive())
+		lastSeen, _ := redis.Uint64(c.Receive())
+		if !visible[accountID] {
+			res = append(res, Presence{AccountID: accountID, Status: PresenceOffline})
+			continue
+		}
+		res = append(res, presenceOf(accountID, alive, status, lastSeen))
+	}
+	return res
+}
+
+func presenceOf(accountID string, alive bool, status string, lastSeen uint64) Presence {
+	pr := Presence{AccountID: accountID, Status: PresenceOffline, LastSeen: lastSeen}
+	if alive {
+		pr.Status = status
+		if !IsValidPresenceStatus(pr.Status) {
+			pr.Status = PresenceOnline
+		}
+	}
+	return pr
+}
+
+// visiblePresences returns the accounts which the requester could see the presence of, i.e. the
+// requester itself, and its contacts and the members of its places which have not hidden their presence
+func (p *Pusher) visiblePresences(requesterID string, accountIDs []string) tools.MB {
+	visible := tools.MB{requesterID: true}
+	requester := p.model.Account.GetByID(requesterID, nil)
+	if requester == nil {
+		return visible
+	}
+	contacts := tools.MB{}
+	for _, contactID := range p.model.Contact.GetContacts(requesterID).Contacts {
+		contacts[contactID] = true
+	}
+	places := tools.MB{}
+	for _, placeID := range requester.AccessPlaceIDs {
+		places[placeID] = true
+	}
+	for _, account := range p.model.Account.GetAccountsByIDs(accountIDs) {
+		if account.Privacy.HidePresence {
+			continue
+		}
+		if contacts[account.ID] {
+			visible[account.ID] = true
+			continue
+		}
+		for _, placeID := range account.AccessPlaceIDs {
+			if places[placeID] {
+				visible[account.ID] = true
+				break
+			}
+		}
+	}
+	return visible
+}
+
+// broadcastPresence pushes the presence of the account to its contacts which are online
+func (p *Pusher) broadcastPresence(accountID string) {
+	account := p.model.Account.GetByID(accountID, nil)
+	if account == nil || account.Privacy.HidePresence {
+		return
+	}
+	targets := p.model.Contact.GetContacts(accountID).Contacts
+	if len(targets) == 0 {
+		return
+	}
+	c := p.cache.Pool.Get()
+	c.Send("EXISTS", presenceAliveKey(accountID))
+	c.Send("GET", presenceStatusKey(accountID))
+	c.Send("GET", presenceSeenKey(accountID))
+	c.Flush()
+	alive, _ := redis.Bool(c.Receive())
+	status, _ := redis.String(c.Receive())
+	lastSeen, _ := redis.Uint64(c.Receive())
+	_ = c.Close()
+
+	p.pushPresence(targets, presenceOf(accountID, alive, status, lastSeen))
+}
+
+// PresenceHidden must be called when the account hides or shows its presence. Its contacts see it
+// offline once it hides the presence, and get its actual presence when it shows it again.
+func (p *Pusher) PresenceHidden(accountID string, hidden bool) {
+	if !hidden {
+		p.broadcastPresence(accountID)
+		return
+	}
+	targets := p.model.Contact.GetContacts(accountID).Contacts
+	if len(targets) == 0 {
+		return
+	}
+	p.pushPresence(targets, Presence{AccountID: accountID, Status: PresenceOffline})
+}
+
+func (p *Pusher) pushPresence(targets []string, pr Presence) {
+	msg, _ := json.Marshal(tools.M{
+		"type": "p",
+		"cmd":  "presence",
+		"data": pr,
+	})
+	_ = p.internalPush(targets, string(msg), false)
+}
+
+// Typing broadcasts that the account is typing a comment on the post to the members of its places.
+// Clients send it repeatedly while the user is typing, but it is broadcast at most once per
+// typingTTL for each account and post.
+func (p *Pusher) Typing(accountID string, post *nested.Post) {
+	c := p.cache.Pool.Get()
+	reply, err := c.Do("SET", typingKey(post.ID, accountID), 1, "EX", typingTTL, "NX")
+	_ = c.Close()
+	if err != nil || reply == nil {
+		return
+	}
+	account := p.model.Account.GetByID(accountID, nil)
+	if account == nil || account.Privacy.HidePresence {
+		return
+	}
+	targets := make([]string, 0)
+	added := tools.MB{accountID: true}
+	for _, placeID := range post.PlaceIDs {
+		place := p.model.Place.GetByID(placeID, nil)
+		if place == nil {
+			continue
+		}
+		for _, memberID := range place.GetMemberIDs() {
+			if !added[memberID] {
+				added[memberID] = true
+				targets = append(targets, memberID)
+			}
+		}
+	}
+	msg, _ := json.Marshal(tools.M{
+		"type": "p",
+		"cmd":  "typing",
+		"data": tools.M{
+			"post_id":    post.ID.Hex(),
+			"account_id": accountID,
+			"ttl":        typingTTL,
+		},
+	})
+	_ = p.internalPush(targets, string(msg), false)
+}
@@ -0,0 +1,303 @@
+package pusher
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"firebase.google.com/go/v4/messaging"
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"git.ronaksoft.com/nested/server/pkg/session"
+	"git.ronaksoft.com/nested/server/pkg/webpush"
+	"go.uber.org/zap"
+)
+
+const (
+	ProviderFCM     = "fcm"
+	ProviderAPNs    = "apns"
+	ProviderWebPush = "webpush"
+)
+
+// Subjects of the silent pushes, they are delivered even in the quiet hours and do not alert the user
+const (
+	PushSubjectClear = "clear"
+	PushSubjectBadge = "badge"
+)
+
+// ErrInvalidToken must be returned by the providers when the push service rejects the token of the
+// device permanently, the device will be removed.
+var ErrInvalidToken = errors.New("push: invalid device token")
+
+// PushProvider delivers the external pushes to the devices through a push service
+type PushProvider interface {
+	Name() string
+	// Accepts returns true if the provider could deliver pushes to the device (i.e. its token
+	// has been issued by the push service of the provider).
+	Accepts(d session.Device) bool
+	Send(ctx context.Context, d session.Device, data map[string]string) error
+}
+
+// PushMetrics are the counters of each provider
+type PushMetrics struct {
+	Sent          uint64 `json:"sent"`
+	Failed        uint64 `json:"failed"`
+	InvalidTokens uint64 `json:"invalid_tokens"`
+}
+
+type pushCounters struct {
+	sent    uint64
+	failed  uint64
+	invalid uint64
+}
+
+// SetProviders sets the providers of the devices with the os, in the order of their priority
+func (p *Pusher) SetProviders(os string, providers ...PushProvider) {
+	p.providersMtx.Lock()
+	p.providers[os] = providers
+	p.providersMtx.Unlock()
+}
+
+// providersOf returns the providers of the device os which accept the device, in the order of
+// their priority
+func (p *Pusher) providersOf(d session.Device) []PushProvider {
+	p.providersMtx.RLock()
+	defer p.providersMtx.RUnlock()
+	var r []PushProvider
+	for _, pp := range p.providers[d.OS] {
+		if pp.Accepts(d) {
+			r = append(r, pp)
+		}
+	}
+	return r
+}
+
+// sendToDevice sends the push through the first provider which accepts the device. If the provider
+// rejects the token the next one is tried, the device is removed only if all of them reject it.
+func (p *Pusher) sendToDevice(d session.Device, data map[string]string) {
+	pps := p.providersOf(d)
+	for _, pp := range pps {
+		c := p.counters(pp.Name())
+		switch err := pp.Send(context.Background(), d, data); err {
+		case nil:
+			atomic.AddUint64(&c.sent, 1)
+			return
+		case ErrInvalidToken:
+			atomic.AddUint64(&c.invalid, 1)
+		default:
+			atomic.AddUint64(&c.failed, 1)
+			log.Warn("got error on sending push",
+				zap.String("Provider", pp.Name()),
+				zap.String("DeviceID", d.ID),
+				zap.Error(err),
+			)
+			return
+		}
+	}
+	if len(pps) > 0 {
+		p.dev.Remove(d.ID)
+	}
+}
+
+func (p *Pusher) counters(name string) *pushCounters {
+	c, _ := p.metrics.LoadOrStore(name, &pushCounters{})
+	return c.(*pushCounters)
+}
+
+// PushMetrics returns the counters of the providers by their names
+func (p *Pusher) PushMetrics() map[string]PushMetrics {
+	m := make(map[string]PushMetrics)
+	p.metrics.Range(func(key, value interface{}) bool {
+		c := value.(*pushCounters)
+		m[key.(string)] = PushMetrics{
+			Sent:          atomic.LoadUint64(&c.sent),
+			Failed:        atomic.LoadUint64(&c.failed),
+			InvalidTokens: atomic.LoadUint64(&c.invalid),
+		}
+		return true
+	})
+	return m
+}
+
+// pushChannel returns the notification channel which the pushes of the device are delivered through
+func pushChannel(d session.Device) string {
+	switch d.OS {
+	case global.PlatformChrome, global.PlatformFirefox, global.PlatformSafari:
+		return nested.NotificationChannelWebPush
+	default:
+		return nested.NotificationChannelMobilePush
+	}
+}
+
+// isSilentPush returns true if the push only syncs the state of the device (i.e. badge and the
+// notifications which have been read on the other devices)
+func isSilentPush(data map[string]string) bool {
+	switch data["subject"] {
+	case PushSubjectClear, PushSubjectBadge:
+		return true
+	}
+	return false
+}
+
+// isWebPushToken returns true if the token is the json of a browser PushSubscription
+func isWebPushToken(token string) bool {
+	return strings.HasPrefix(strings.TrimSpace(token), "{")
+}
+
+// isAPNsToken returns true if the token has been issued by APNs (32 bytes in hex), the iOS devices
+// which have registered by FCM have FCM tokens instead.
+func isAPNsToken(token string) bool {
+	if len(token) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// fcmProvider delivers pushes through Firebase Cloud Messaging
+type fcmProvider struct {
+	c *messaging.Client
+}
+
+func (fp *fcmProvider) Name() string {
+	return ProviderFCM
+}
+
+func (fp *fcmProvider) Accepts(d session.Device) bool {
+	return !isWebPushToken(d.Token)
+}
+
+func (fp *fcmProvider) Send(ctx context.Context, d session.Device, data map[string]string) error {
+	badge := d.Badge
+	message := messaging.Message{
+		Data:  data,
+		Token: d.Token,
+		Android: &messaging.AndroidConfig{
+			Priority: "high",
+			Data:     data,
+		},
+		APNS: &messaging.APNSConfig{
+			Payload: &messaging.APNSPayload{
+				Aps: &messaging.Aps{
+					Alert: &messaging.ApsAlert{
+						Title: data["title"],
+						Body:  data["msg"],
+					},
+					Badge:      &badge,
+					CustomData: make(map[string]interface{}),
+				},
+			},
+		},
+	}
+	for k, v := range data {
+		message.APNS.Payload.Aps.CustomData[k] = v
+	}
+	if isSilentPush(data) {
+		message.APNS.Headers = map[string]string{"apns-push-type": "background", "apns-priority": "5"}
+		message.APNS.Payload.Aps.Alert = nil
+		message.APNS.Payload.Aps.ContentAvailable = true
+	}
+	if _, err := fp.c.Send(ctx, &message); err != nil {
+		if messaging.IsRegistrationTokenNotRegistered(err) || messaging.IsSenderIDMismatch(err) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return nil
+}
+
+// webPushProvider delivers pushes to the browsers which have registered their PushSubscription
+type webPushProvider struct {
+	c *webpush.Client
+}
+
+func (wp *webPushProvider) Name() string {
+	return ProviderWebPush
+}
+
+func (wp *webPushProvider) Accepts(d session.Device) bool {
+	return isWebPushToken(d.Token)
+}
+
+func (wp *webPushProvider) Send(_ context.Context, d session.Device, data map[string]string) error {
+	sub, err := webpush.ParseSubscription(d.Token)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	switch err := wp.c.Send(sub, payload, webpush.DefaultTTL); err {
+	case nil:
+		return nil
+	case webpush.ErrSubscriptionGone:
+		return ErrInvalidToken
+	default:
+		return err
+	}
+}
+
+// RecordedPush is a push which has been sent through the RecordingProvider
+type RecordedPush struct {
+	DeviceID string
+	Token    string
+	Data     map[string]string
+}
+
+// RecordingProvider keeps the pushes in memory instead of sending them, it is used in tests and
+// local setups. The tokens which have been marked by Invalidate are rejected with ErrInvalidToken.
+type RecordingProvider struct {
+	name    string
+	mtx     sync.Mutex
+	pushes  []RecordedPush
+	invalid map[string]bool
+}
+
+func NewRecordingProvider(name string) *RecordingProvider {
+	return &RecordingProvider{
+		name:    name,
+		invalid: map[string]bool{},
+	}
+}
+
+func (rp *RecordingProvider) Name() string {
+	return rp.name
+}
+
+func (rp *RecordingProvider) Accepts(_ session.Device) bool {
+	return true
+}
+
+func (rp *RecordingProvider) Send(_ context.Context, d session.Device, data map[string]string) error {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	if rp.invalid[d.Token] {
+		return ErrInvalidToken
+	}
+	m := make(map[string]string, len(data))
+	for k, v := range data {
+		m[k] = v
+	}
+	rp.pushes = append(rp.pushes, RecordedPush{DeviceID: d.ID, Token: d.Token, Data: m})
+	return nil
+}
+
+// Invalidate makes the provider reject the token
+func (rp *RecordingProvider) Invalidate(token string) {
+	rp.mtx.Lock()
+	rp.invalid[token] = true
+	rp.mtx.Unlock()
+}
+
+// Pushes returns the recorded pushes
+func (rp *RecordingProvider) Pushes() []RecordedPush {
+	rp.mtx.Lock()
+	defer rp.mtx.Unlock()
+	return append([]RecordedPush{}, rp.pushes...)
+}
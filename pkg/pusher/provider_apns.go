@@ -0,0 +1,181 @@
+package pusher
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/session"
+)
+
+const (
+	APNsProductionURL = "https://api.push.apple.com"
+	APNsSandboxURL    = "https://api.sandbox.push.apple.com"
+	// Apple rejects the provider tokens which are older than one hour and also the ones which
+	// are refreshed more than once in 20 minutes.
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+type APNsConfig struct {
+	// Key is the content of the .p8 file (PKCS#8 PEM) which has been issued by Apple
+	Key    []byte
+	KeyID  string
+	TeamID string
+	// Topic is the bundle id of the app
+	Topic   string
+	BaseURL string
+	// HTTPClient must support HTTP/2, if it is nil a client with the default transport is used
+	HTTPClient *http.Client
+}
+
+// apnsProvider delivers pushes directly to APNs over HTTP/2 using token based authentication
+type apnsProvider struct {
+	cfg APNsConfig
+	key *ecdsa.PrivateKey
+
+	mtx      sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+func NewAPNsProvider(cfg APNsConfig) (PushProvider, error) {
+	block, _ := pem.Decode(cfg.Key)
+	if block == nil {
+		return nil, errors.New("apns: invalid key")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apns: key is not an ecdsa key")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = APNsProductionURL
+	}
+	if cfg.HTTPClient == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.ForceAttemptHTTP2 = true
+		cfg.HTTPClient = &http.Client{Transport: t, Timeout: 10 * time.Second}
+	}
+	return &apnsProvider{cfg: cfg, key: key}, nil
+}
+
+func (ap *apnsProvider) Name() string {
+	return ProviderAPNs
+}
+
+func (ap *apnsProvider) Accepts(d session.Device) bool {
+	return d.OS == global.PlatformIOS && isAPNsToken(d.Token)
+}
+
+func (ap *apnsProvider) Send(ctx context.Context, d session.Device, data map[string]string) error {
+	body, err := json.Marshal(apnsPayload(d, data))
+	if err != nil {
+		return err
+	}
+	token, err := ap.providerToken(false)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/3/device/%s", ap.cfg.BaseURL, url.PathEscape(d.Token)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("authorization", "bearer "+token)
+	req.Header.Set("apns-topic", ap.cfg.Topic)
+	if isSilentPush(data) {
+		req.Header.Set("apns-push-type", "background")
+		req.Header.Set("apns-priority", "5")
+	} else {
+		req.Header.Set("apns-push-type", "alert")
+		req.Header.Set("apns-priority", "10")
+	}
+	if id := data["notification_id"]; id != "" {
+		req.Header.Set("apns-collapse-id", id)
+	}
+
+	res, err := ap.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	reason := struct {
+		Reason string `json:"reason"`
+	}{}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&reason)
+	switch {
+	case res.StatusCode == http.StatusGone,
+		reason.Reason == "BadDeviceToken", reason.Reason == "DeviceTokenNotForTopic", reason.Reason == "Unregistered":
+		return ErrInvalidToken
+	case reason.Reason == "ExpiredProviderToken":
+		_, _ = ap.providerToken(true)
+	}
+	return fmt.Errorf("apns: %d %s", res.StatusCode, reason.Reason)
+}
+
+// providerToken returns the cached JWT or signs a new one if it is too old
+func (ap *apnsProvider) providerToken(renew bool) (string, error) {
+	ap.mtx.Lock()
+	defer ap.mtx.Unlock()
+	if !renew && ap.token != "" && time.Since(ap.issuedAt) < apnsTokenLifetime {
+		return ap.token, nil
+	}
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": ap.cfg.KeyID})
+	now := time.Now()
+	claims, _ := json.Marshal(map[string]interface{}{"iss": ap.cfg.TeamID, "iat": now.Unix()})
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	h := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, ap.key, h[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	ap.token = unsigned + "." + enc.EncodeToString(sig)
+	ap.issuedAt = now
+	return ap.token, nil
+}
+
+func apnsPayload(d session.Device, data map[string]string) map[string]interface{} {
+	aps := map[string]interface{}{
+		"badge": d.Badge,
+	}
+	if isSilentPush(data) {
+		aps["content-available"] = 1
+	} else {
+		aps["alert"] = map[string]string{
+			"title": data["title"],
+			"body":  data["msg"],
+		}
+		if sound := data["sound"]; sound != "" {
+			aps["sound"] = sound
+		}
+	}
+	payload := map[string]interface{}{}
+	for k, v := range data {
+		payload[k] = v
+	}
+	payload["aps"] = aps
+	return payload
+}
@@ -0,0 +1,204 @@
+package pusher_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/pusher"
+	"git.ronaksoft.com/nested/server/pkg/session"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	goodToken = strings.Repeat("a1", 32)
+	badToken  = strings.Repeat("b2", 32)
+	goneToken = strings.Repeat("c3", 32)
+)
+
+// apnsStub mimics APNs, it only accepts HTTP/2 requests which are signed by the key
+type apnsStub struct {
+	key      *ecdsa.PublicKey
+	payloads []map[string]interface{}
+}
+
+func (s *apnsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reject := func(status int, reason string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]string{"reason": reason})
+	}
+	if r.ProtoMajor != 2 {
+		reject(http.StatusBadRequest, "BadProtocol")
+		return
+	}
+	if !s.verify(strings.TrimPrefix(r.Header.Get("authorization"), "bearer ")) {
+		reject(http.StatusForbidden, "InvalidProviderToken")
+		return
+	}
+	if r.Header.Get("apns-topic") != "me.nested.ios" {
+		reject(http.StatusBadRequest, "BadTopic")
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+	case badToken:
+		reject(http.StatusBadRequest, "BadDeviceToken")
+		return
+	case goneToken:
+		reject(http.StatusGone, "Unregistered")
+		return
+	}
+	m := map[string]interface{}{}
+	_ = json.NewDecoder(r.Body).Decode(&m)
+	s.payloads = append(s.payloads, m)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *apnsStub) verify(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	header := map[string]string{}
+	hb, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if json.Unmarshal(hb, &header) != nil || header["kid"] != "KEY123" || header["alg"] != "ES256" {
+		return false
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if len(sig) != 64 {
+		return false
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	return ecdsa.Verify(s.key, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+}
+
+func TestAPNsProvider(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	stub := &apnsStub{key: &key.PublicKey}
+	srv := httptest.NewUnstartedServer(stub)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	apns, err := pusher.NewAPNsProvider(pusher.APNsConfig{
+		Key:        pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		KeyID:      "KEY123",
+		TeamID:     "TEAM123",
+		Topic:      "me.nested.ios",
+		BaseURL:    srv.URL,
+		HTTPClient: srv.Client(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("APNsProvider", t, func(c C) {
+		device := session.Device{ID: "d1", Token: goodToken, OS: global.PlatformIOS, Badge: 3}
+		Convey("Accepts", func(c C) {
+			c.So(apns.Accepts(device), ShouldBeTrue)
+			c.So(apns.Accepts(session.Device{OS: global.PlatformAndroid, Token: goodToken}), ShouldBeFalse)
+			// iOS devices which have registered by FCM
+			c.So(apns.Accepts(session.Device{OS: global.PlatformIOS, Token: "fcm-token:APA91b" + goodToken}), ShouldBeFalse)
+			c.So(apns.Accepts(session.Device{OS: global.PlatformIOS, Token: strings.Repeat("zz", 32)}), ShouldBeFalse)
+		})
+		Convey("Send", func(c C) {
+			err := apns.Send(context.Background(), device, map[string]string{"title": "Nested", "msg": "Hello", "post_id": "p1"})
+			c.So(err, ShouldBeNil)
+			c.So(stub.payloads, ShouldNotBeEmpty)
+			m := stub.payloads[len(stub.payloads)-1]
+			c.So(m["post_id"], ShouldEqual, "p1")
+			aps := m["aps"].(map[string]interface{})
+			c.So(aps["badge"], ShouldEqual, float64(3))
+			c.So(aps["alert"].(map[string]interface{})["body"], ShouldEqual, "Hello")
+		})
+		Convey("Silent", func(c C) {
+			err := apns.Send(context.Background(), device, map[string]string{"subject": pusher.PushSubjectBadge})
+			c.So(err, ShouldBeNil)
+			aps := stub.payloads[len(stub.payloads)-1]["aps"].(map[string]interface{})
+			c.So(aps["content-available"], ShouldEqual, float64(1))
+			c.So(aps["badge"], ShouldEqual, float64(3))
+			c.So(aps, ShouldNotContainKey, "alert")
+		})
+		Convey("Invalid Token", func(c C) {
+			for _, token := range []string{badToken, goneToken} {
+				device.Token = token
+				c.So(apns.Send(context.Background(), device, map[string]string{}), ShouldEqual, pusher.ErrInvalidToken)
+			}
+		})
+	})
+}
+
+func TestPusher_ExternalPush(t *testing.T) {
+	for _, addr := range []string{"localhost:27001", testRedisDSN} {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err != nil {
+			t.Skipf("%s is not available: %v", addr, err)
+		} else {
+			_ = conn.Close()
+		}
+	}
+	model, err := nested.NewManager("TestServer", testMongoDSN, testRedisDSN, -1)
+	if err != nil {
+		t.Skipf("could not initialize the model: %v", err)
+	}
+	p := pusher.New(model, testBundleID, "nested.test")
+	android := pusher.NewRecordingProvider("android")
+	ios := pusher.NewRecordingProvider("ios")
+	iosFallback := pusher.NewRecordingProvider("ios-fallback")
+	p.SetProviders(global.PlatformAndroid, android)
+	p.SetProviders(global.PlatformIOS, ios, iosFallback)
+
+	Convey("Pusher/ExternalPush", t, func(c C) {
+		accountID := strings.ToLower(nested.RandomID(10))
+		androidToken, iosToken := nested.RandomID(32), nested.RandomID(32)
+		c.So(p.RegisterDevice(nested.RandomID(10), androidToken, global.PlatformAndroid, accountID), ShouldBeNil)
+		c.So(p.RegisterDevice(nested.RandomID(10), iosToken, global.PlatformIOS, accountID), ShouldBeNil)
+		ios.Invalidate(iosToken)
+
+		// the next provider is tried if the token is rejected
+		p.ExternalPushClearAll(accountID)
+		c.So(waitFor(func() bool { return len(iosFallback.Pushes()) == 1 }), ShouldBeTrue)
+		c.So(p.PushMetrics()["ios"].InvalidTokens, ShouldEqual, 1)
+		c.So(waitFor(func() bool { return len(android.Pushes()) == 1 }), ShouldBeTrue)
+
+		// the device is removed only if all the providers reject it
+		iosFallback.Invalidate(iosToken)
+		p.ExternalPushClearAll(accountID)
+		c.So(waitFor(func() bool { return p.PushMetrics()["ios-fallback"].InvalidTokens == 1 }), ShouldBeTrue)
+		c.So(waitFor(func() bool { return len(android.Pushes()) == 2 }), ShouldBeTrue)
+		c.So(android.Pushes()[0].Token, ShouldEqual, androidToken)
+		c.So(android.Pushes()[0].Data["subject"], ShouldEqual, pusher.PushSubjectClear)
+		c.So(android.Pushes()[0].Data["badge"], ShouldEqual, "0")
+
+		// the invalid device has been removed, so the provider is not asked again
+		p.ExternalPushClearAll(accountID)
+		c.So(waitFor(func() bool { return len(android.Pushes()) == 3 }), ShouldBeTrue)
+		c.So(p.PushMetrics()["ios"].InvalidTokens, ShouldEqual, 2)
+		c.So(ios.Pushes(), ShouldBeEmpty)
+		c.So(iosFallback.Pushes(), ShouldHaveLength, 1)
+	})
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 50; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return false
+}
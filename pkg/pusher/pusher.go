@@ -2,23 +2,26 @@ package pusher
 
 import (
 	"context"
-	"encoding/json"
 	firebase "firebase.google.com/go/v4"
-	"firebase.google.com/go/v4/messaging"
 	"fmt"
 	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/cache"
 	"git.ronaksoft.com/nested/server/pkg/config"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/log"
 	"git.ronaksoft.com/nested/server/pkg/session"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"git.ronaksoft.com/nested/server/pkg/webpush"
 	"github.com/globalsign/mgo/bson"
+	"github.com/gomodule/redigo/redis"
 	"github.com/kataras/iris/v12/websocket"
 	"go.uber.org/zap"
 	"google.golang.org/api/option"
+	"io/ioutil"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -44,40 +47,112 @@ type Pusher struct {
 	ws        *session.WebsocketManager
 	dev       *session.DeviceManager
 	model     *nested.Manager
-	fcm       *messaging.Client
+	cache     *cache.Manager
+	webPush   *webpush.Client
 	wsConnMtx sync.RWMutex
 	wsConns   map[string]*websocket.Conn
+
+	providersMtx sync.RWMutex
+	providers    map[string][]PushProvider
+	metrics      sync.Map
+
+	pscMtx    sync.Mutex
+	psc       *redis.PubSubConn
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
 }
 
 func New(model *nested.Manager, bundleID, domain string) *Pusher {
 	p := &Pusher{
-		domain:   domain,
-		bundleID: bundleID,
-		ws:       session.NewWebsocketManager(model.Cache()),
-		dev:      session.NewDeviceManager(model.DB()),
-		model:    model,
-		wsConns:  make(map[string]*websocket.Conn, 128),
-	}
-
-	// Initialize FCM Client
-	fcmCredPath := config.GetString(config.FirebaseCredPath)
-	if fcmCredPath != "" {
-		if c, err := firebase.NewApp(
-			context.Background(),
-			nil,
-			option.WithCredentialsFile("/ronak/certs/firebase-cred.json"),
-		); err != nil {
+		domain:    domain,
+		bundleID:  bundleID,
+		ws:        session.NewWebsocketManager(model.Cache()),
+		dev:       session.NewDeviceManager(model.DB()),
+		model:     model,
+		cache:     model.Cache(),
+		wsConns:   make(map[string]*websocket.Conn, 128),
+		providers: make(map[string][]PushProvider),
+		done:      make(chan struct{}),
+	}
+	p.initProviders()
+
+	p.ws.RemoveByBundleID(p.bundleID)
+
+	// Receive the pushes of this bundle from the other instances
+	p.wg.Add(2)
+	go p.runHeartbeat()
+	go p.runSubscriber()
+	return p
+}
+
+// initProviders creates the push providers which have been configured. iOS devices which have
+// registered an APNs token are served by APNs directly if it is configured, browsers which have
+// registered a PushSubscription by Web Push and the rest by FCM.
+func (p *Pusher) initProviders() {
+	var fcm, apns, wp PushProvider
+	if fcmCredPath := config.GetString(config.FirebaseCredPath); fcmCredPath != "" {
+		app, err := firebase.NewApp(context.Background(), nil, option.WithCredentialsFile(fcmCredPath))
+		if err != nil {
 			log.Fatal("could not create FCM app", zap.String("CredPath", fcmCredPath), zap.Error(err))
-		} else {
-			p.fcm, err = c.Messaging(context.Background())
-			if err != nil {
-				log.Fatal("could not create FCM messaging client", zap.Error(err))
+		}
+		c, err := app.Messaging(context.Background())
+		if err != nil {
+			log.Fatal("could not create FCM messaging client", zap.Error(err))
+		}
+		fcm = &fcmProvider{c: c}
+	}
+	if keyPath := config.GetString(config.APNsKeyPath); keyPath != "" {
+		key, err := ioutil.ReadFile(keyPath)
+		if err != nil {
+			log.Fatal("could not read APNs key", zap.String("KeyPath", keyPath), zap.Error(err))
+		}
+		cfg := APNsConfig{
+			Key:     key,
+			KeyID:   config.GetString(config.APNsKeyID),
+			TeamID:  config.GetString(config.APNsTeamID),
+			Topic:   config.GetString(config.APNsTopic),
+			BaseURL: APNsProductionURL,
+		}
+		if config.GetBool(config.APNsSandbox) {
+			cfg.BaseURL = APNsSandboxURL
+		}
+		if apns, err = NewAPNsProvider(cfg); err != nil {
+			log.Fatal("could not create APNs provider", zap.Error(err))
+		}
+	}
+	if vapidKey := config.GetString(config.WebPushPrivateKey); vapidKey != "" {
+		c, err := webpush.NewClient(vapidKey, config.GetString(config.WebPushSubject))
+		if err != nil {
+			log.Fatal("could not create web push client", zap.Error(err))
+		}
+		p.webPush = c
+		wp = &webPushProvider{c: c}
+	}
+
+	providers := func(pps ...PushProvider) []PushProvider {
+		var r []PushProvider
+		for _, pp := range pps {
+			if pp != nil {
+				r = append(r, pp)
 			}
 		}
+		return r
+	}
+	p.SetProviders(global.PlatformAndroid, providers(fcm)...)
+	p.SetProviders(global.PlatformIOS, providers(apns, fcm)...)
+	for _, os := range []string{global.PlatformChrome, global.PlatformFirefox, global.PlatformSafari} {
+		p.SetProviders(os, providers(wp, fcm)...)
 	}
+}
 
-	p.ws.RemoveByBundleID(p.bundleID)
-	return p
+// WebPushPublicKey returns the VAPID public key which browsers need to subscribe, it is empty if
+// web push is not configured.
+func (p *Pusher) WebPushPublicKey() string {
+	if p.webPush == nil {
+		return ""
+	}
+	return p.webPush.PublicKey()
 }
 
 func (p *Pusher) GetOnlineAccounts(bundleID string) []string {
@@ -119,6 +194,22 @@ func (p *Pusher) UnregisterDevice(id, token, uid string) error {
 	return nil
 }
 
+// AddWebsocket keeps the live connection of this instance, the internal pushes will be delivered
+// through it once the client registers the websocket by session/recall.
+func (p *Pusher) AddWebsocket(c *websocket.Conn) {
+	p.wsConnMtx.Lock()
+	p.wsConns[c.ID()] = c
+	p.wsConnMtx.Unlock()
+}
+
+// RemoveWebsocket drops the live connection and unregisters its websocket
+func (p *Pusher) RemoveWebsocket(c *websocket.Conn) {
+	p.wsConnMtx.Lock()
+	delete(p.wsConns, c.ID())
+	p.wsConnMtx.Unlock()
+	_ = p.UnregisterWebsocket(c.ID(), p.bundleID)
+}
+
 func (p *Pusher) RegisterWebsocket(userID, deviceID, bundleID, websocketID string) error {
 	req := cmdRegisterWebsocket{
 		DeviceID:    deviceID,
@@ -126,11 +217,18 @@ func (p *Pusher) RegisterWebsocket(userID, deviceID, bundleID, websocketID strin
 		BundleID:    bundleID,
 		WebsocketID: websocketID,
 	}
+
+	// The connection might have been closed before the client recalls its session
+	if req.BundleID == p.bundleID && p.getWebsocket(req.WebsocketID) == nil {
+		return fmt.Errorf("websocket is not connected: %s", req.WebsocketID)
+	}
+
 	// register websocket
 	p.ws.Register(req.WebsocketID, req.BundleID, req.DeviceID, req.UserID)
 
 	// Set device as connected and update the badges
 	p.dev.SetAsConnected(req.DeviceID, req.UserID)
+	p.setOnline(req.UserID)
 	return nil
 }
 
@@ -142,25 +240,39 @@ func (p *Pusher) UnregisterWebsocket(websocketID, bundleID string) error {
 
 	// Remove websocket object and set device as disconnected
 	ws := p.ws.Remove(req.WebsocketID, req.BundleID)
-	if ws != nil {
+	if ws != nil && ws.DeviceID != "" {
 		p.dev.SetAsDisconnected(ws.DeviceID)
 	}
+	if ws != nil {
+		p.setOffline(ws.UID)
+	}
 	return nil
 }
 
-func (p *Pusher) pushCB(push WebsocketPush) bool {
+func (p *Pusher) getWebsocket(websocketID string) *websocket.Conn {
 	p.wsConnMtx.RLock()
-	c := p.wsConns[push.WebsocketID]
+	c := p.wsConns[websocketID]
 	p.wsConnMtx.RUnlock()
+	return c
+}
+
+func (p *Pusher) pushCB(push WebsocketPush) bool {
+	c := p.getWebsocket(push.WebsocketID)
 	if c == nil {
 		return false
 	}
-	c.Write(websocket.Message{
+	if !c.Write(websocket.Message{
 		IsNative: true,
 		Body:     []byte(push.Payload),
-	})
+	}) {
+		p.wsConnMtx.Lock()
+		delete(p.wsConns, push.WebsocketID)
+		p.wsConnMtx.Unlock()
+		return false
+	}
 	return true
 }
+
 func (p *Pusher) internalPush(targets []string, msg string, localOnly bool) error {
 	req := cmdPushInternal{
 		Targets:   targets,
@@ -173,36 +285,42 @@ func (p *Pusher) internalPush(targets []string, msg string, localOnly bool) erro
 		zap.String("MSG", msg),
 	)
 
-	if req.LocalOnly {
-		for _, uid := range req.Targets {
-			websockets := p.ws.GetWebsocketsByAccountID(uid, p.bundleID)
-			for _, ws := range websockets {
-
-				if !p.pushCB(
-					WebsocketPush{
-						WebsocketID: ws.WebsocketID,
-						Payload:     req.Message,
-						BundleID:    ws.BundleID},
-				) {
-					p.ws.Remove(ws.WebsocketID, p.bundleID)
-				}
+	payloads := make(map[string]string, len(req.Targets))
+	for _, uid := range req.Targets {
+		payloads[uid] = req.Message
+	}
+	return p.internalPushPayloads(payloads, req.LocalOnly)
+}
+
+// internalPushPayloads pushes the payload of each account to its websockets. Websockets of this
+// bundle are written directly, the others are published to their own bundle in one batch.
+func (p *Pusher) internalPushPayloads(payloads map[string]string, localOnly bool) error {
+	bundleID := ""
+	if localOnly {
+		bundleID = p.bundleID
+	}
+	remotePushes := make(map[string][]WebsocketPush)
+	for uid, payload := range payloads {
+		websockets := p.ws.GetWebsocketsByAccountID(uid, bundleID)
+		for _, ws := range websockets {
+			push := WebsocketPush{
+				WebsocketID: ws.WebsocketID,
+				Payload:     payload,
+				BundleID:    ws.BundleID,
 			}
-		}
-	} else {
-		for _, uid := range req.Targets {
-			websockets := p.ws.GetWebsocketsByAccountID(uid, "")
-			for _, ws := range websockets {
-				if !p.pushCB(
-					WebsocketPush{
-						WebsocketID: ws.WebsocketID,
-						Payload:     req.Message,
-						BundleID:    ws.BundleID},
-				) {
-					p.ws.Remove(ws.WebsocketID, p.bundleID)
-				}
+			if ws.BundleID != p.bundleID {
+				remotePushes[ws.BundleID] = append(remotePushes[ws.BundleID], push)
+				continue
+			}
+			if !p.pushCB(push) {
+				// The connection is gone, so this websocket is stale
+				_ = p.UnregisterWebsocket(ws.WebsocketID, ws.BundleID)
 			}
 		}
 	}
+	for bundleID, pushes := range remotePushes {
+		p.publish(bundleID, pushes)
+	}
 	return nil
 }
 
@@ -225,11 +343,7 @@ func (p *Pusher) InternalPlaceActivitySyncPush(targets []string, placeID string,
 				"action":   action,
 			},
 		}
-		if jmsg, err := json.Marshal(msg); err != nil {
-			log.Sugar().Warn("NotificationClient::InternalPlaceActivitySyncPush::Error::", err.Error())
-		} else {
-			p.internalPush(targets[iStart:iEnd], string(jmsg), false)
-		}
+		p.syncPush(targets[iStart:iEnd], msg)
 		iStart += iLength
 		iEnd = iStart + iLength
 		if iStart >= len(targets) {
@@ -261,11 +375,7 @@ func (p *Pusher) InternalPostActivitySyncPush(targets []string, postID bson.Obje
 				"places":  placeIDs,
 			},
 		}
-		if jmsg, err := json.Marshal(msg); err != nil {
-			log.Sugar().Warn("NotificationClient::InternalPlaceActivitySyncPush::Error::", err.Error())
-		} else {
-			p.internalPush(targets[iStart:iEnd], string(jmsg), false)
-		}
+		p.syncPush(targets[iStart:iEnd], msg)
 		iStart += iLength
 		iEnd = iStart + iLength
 		if iStart >= len(targets) {
@@ -296,11 +406,7 @@ func (p *Pusher) InternalTaskActivitySyncPush(targets []string, taskID bson.Obje
 				"action":  action,
 			},
 		}
-		if jmsg, err := json.Marshal(msg); err != nil {
-			log.Sugar().Warn("NotificationClient::InternalTaskActivitySyncPush::Error::", err.Error())
-		} else {
-			p.internalPush(targets[iStart:iEnd], string(jmsg), false)
-		}
+		p.syncPush(targets[iStart:iEnd], msg)
 		iStart += iLength
 		iEnd = iStart + iLength
 		if iStart >= len(targets) {
@@ -330,11 +436,7 @@ func (p *Pusher) InternalNotificationSyncPush(targets []string, notificationType
 				"type": notificationType,
 			},
 		}
-		if jmsg, err := json.Marshal(msg); err != nil {
-			log.Sugar().Warn("NotificationClient::InternalNotificationSyncPush::Error::", err.Error())
-		} else {
-			p.internalPush(targets[iStart:iEnd], string(jmsg), false)
-		}
+		p.syncPush(targets[iStart:iEnd], msg)
 		iStart += iLength
 		iEnd = iStart + iLength
 		if iStart >= len(targets) {
@@ -348,10 +450,16 @@ func (p *Pusher) InternalNotificationSyncPush(targets []string, notificationType
 }
 
 func (p *Pusher) externalPush(targets []string, data map[string]string) {
-	req := cmdPushExternal{
+	p.sendExternal(cmdPushExternal{
 		Targets: targets,
 		Data:    data,
-	}
+	})
+}
+
+// sendExternal sends the push to the devices of the targets. Pushes are muted in the quiet hours of
+// the targets, except the silent ones. Each push carries the badge of the target which is the number
+// of its unread notifications.
+func (p *Pusher) sendExternal(req cmdPushExternal) {
 	req.Data["domain"] = p.domain
 
 	log.Debug("Push External",
@@ -361,18 +469,34 @@ func (p *Pusher) externalPush(targets []string, data map[string]string) {
 
 	for _, uid := range req.Targets {
 		go func(uid string) {
-			p.dev.IncrementBadge(uid)
+			badge := p.model.Notification.CountUnread(uid)
+			p.dev.SetBadge(uid, badge)
+			settings := p.model.Notification.GetSettings(uid)
+			if !isSilentPush(req.Data) && settings.QuietHours.Active(time.Now()) {
+				return
+			}
+			data := make(map[string]string, len(req.Data)+1)
+			for k, v := range req.Data {
+				data[k] = v
+			}
+			data["badge"] = strconv.Itoa(badge)
 			devices := p.dev.GetByAccountID(uid)
 			for _, d := range devices {
-				p.sendFCM(d, req)
+				if req.NotificationType != 0 && !settings.Allowed(req.NotificationType, pushChannel(d)) {
+					continue
+				}
+				d.Badge = badge
+				p.sendToDevice(d, data)
 			}
 		}(uid)
 
 	}
-	return
 }
 
 func (p *Pusher) ExternalPushNotification(n *nested.Notification) {
+	if n == nil {
+		return
+	}
 	actor := p.model.Account.GetByID(n.ActorID, nil)
 
 	pushData := tools.MS{
@@ -385,6 +509,10 @@ func (p *Pusher) ExternalPushNotification(n *nested.Notification) {
 		"title":           _NotificationTitles[n.Type],
 		"notification_id": n.ID,
 	}
+	// notifications which are not listed in-app have no id for the clients to open
+	if len(n.ID) == 0 || n.Hidden {
+		delete(pushData, "notification_id")
+	}
 	switch n.Type {
 	case nested.NotificationTypeMention:
 		comment := p.model.Post.GetCommentByID(n.CommentID)
@@ -449,7 +577,15 @@ func (p *Pusher) ExternalPushNotification(n *nested.Notification) {
 		pushData["msg"] = txt
 		pushData["sound"] = "nc.aiff"
 	case nested.NotificationTypeNewSession:
-		txt := fmt.Sprintf("You are logged in from device: %s", n.ClientID)
+		device := n.Data.Text
+		if len(device) == 0 {
+			device = n.ClientID
+		}
+		txt := fmt.Sprintf("You are logged in from a new device: %s", device)
+		pushData["msg"] = txt
+		pushData["sound"] = "nc.aiff"
+	case nested.NotificationTypeLoginLocked:
+		txt := fmt.Sprintf("Your account is locked for a while after too many failed logins from: %s", n.Data.Text)
 		pushData["msg"] = txt
 		pushData["sound"] = "nc.aiff"
 	case nested.NotificationTypeLabelRequestApproved:
@@ -500,7 +636,11 @@ func (p *Pusher) ExternalPushNotification(n *nested.Notification) {
 	default:
 		return
 	}
-	p.externalPush([]string{n.AccountID}, pushData)
+	p.sendExternal(cmdPushExternal{
+		Targets:          []string{n.AccountID},
+		Data:             pushData,
+		NotificationType: n.Type,
+	})
 	return
 }
 
@@ -609,7 +749,7 @@ func (p *Pusher) ExternalPushPlaceActivityPostAttached(post *nested.Post, placeI
 func (p *Pusher) ExternalPushClear(n *nested.Notification) {
 	pushData := tools.MS{
 		"notification_id": n.ID,
-		"subject":         "clear",
+		"subject":         PushSubjectClear,
 	}
 	p.externalPush([]string{n.AccountID}, pushData)
 }
@@ -617,17 +757,46 @@ func (p *Pusher) ExternalPushClear(n *nested.Notification) {
 func (p *Pusher) ExternalPushClearAll(accountID string) {
 	pushData := tools.MS{
 		"notification_id": "all",
-		"subject":         "clear",
+		"subject":         PushSubjectClear,
 	}
 	p.externalPush([]string{accountID}, pushData)
 }
 
-func (p *Pusher) NewSession(actorID, clientID string) {
-	n := p.model.Notification.NewSession(actorID, clientID)
+// ExternalPushPostRead tells the other devices of the account that the post has been read, so they
+// clear the post and its notifications. Nothing is sent if no notification has been read, since the
+// devices have nothing to clear and their badge has not been changed.
+func (p *Pusher) ExternalPushPostRead(accountID string, postID bson.ObjectId, notificationIDs []string) {
+	if len(notificationIDs) == 0 {
+		return
+	}
+	pushData := tools.MS{
+		"post_id":         postID.Hex(),
+		"notification_id": strings.Join(notificationIDs, ","),
+		"subject":         PushSubjectClear,
+	}
+	p.externalPush([]string{accountID}, pushData)
+}
+
+// ExternalPushBadge sends a silent push to update the badge of the devices of the account
+func (p *Pusher) ExternalPushBadge(accountID string) {
+	pushData := tools.MS{
+		"subject": PushSubjectBadge,
+	}
+	p.externalPush([]string{accountID}, pushData)
+}
+
+func (p *Pusher) NewSession(actorID, clientID string, sessionKey bson.ObjectId, device string) {
+	n := p.model.Notification.NewSession(actorID, clientID, sessionKey, device)
 	p.ExternalPushNotification(n)
 	p.InternalNotificationSyncPush([]string{actorID}, nested.NotificationTypeNewSession)
 }
 
+func (p *Pusher) LoginLocked(accountID, clientIP string) {
+	n := p.model.Notification.LoginLocked(accountID, clientIP)
+	p.ExternalPushNotification(n)
+	p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeLoginLocked)
+}
+
 func (p *Pusher) PlaceJoined(place *nested.Place, actorID, memberID string) {
 	// Create notification
 	notif := p.model.Notification.JoinedPlace(actorID, memberID, place.ID)
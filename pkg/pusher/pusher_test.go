@@ -0,0 +1,246 @@
+package pusher_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/pusher"
+	"github.com/globalsign/mgo/bson"
+	gorilla "github.com/gorilla/websocket"
+	"github.com/kataras/iris/v12/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testMongoDSN  = "mongodb://localhost:27001/nested"
+	testRedisDSN  = "localhost:6379"
+	testBundleID  = "TEST.001"
+	testBundleID2 = "TEST.002"
+)
+
+type testServer struct {
+	http    *httptest.Server
+	chConns chan string
+}
+
+func newTestServer(p *pusher.Pusher) *testServer {
+	ts := &testServer{
+		chConns: make(chan string, 10),
+	}
+	ws := websocket.New(websocket.DefaultGorillaUpgrader, websocket.Events{
+		websocket.OnNativeMessage: func(_ *websocket.NSConn, _ websocket.Message) error { return nil },
+	})
+	ws.OnConnect = func(c *websocket.Conn) error {
+		p.AddWebsocket(c)
+		ts.chConns <- c.ID()
+		return nil
+	}
+	ws.OnDisconnect = func(c *websocket.Conn) {
+		p.RemoveWebsocket(c)
+	}
+	ts.http = httptest.NewServer(ws)
+	return ts
+}
+
+// connect dials the server and returns the client connection with the server side id of it
+func (ts *testServer) connect(c C) (*gorilla.Conn, string) {
+	conn, _, err := gorilla.DefaultDialer.Dial(strings.Replace(ts.http.URL, "http://", "ws://", 1), nil)
+	c.So(err, ShouldBeNil)
+	select {
+	case id := <-ts.chConns:
+		return conn, id
+	case <-time.After(5 * time.Second):
+		c.So("connection timeout", ShouldBeEmpty)
+	}
+	return nil, ""
+}
+
+func readPush(c C, conn *gorilla.Conn) map[string]interface{} {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, b, err := conn.ReadMessage()
+	c.So(err, ShouldBeNil)
+	m := map[string]interface{}{}
+	c.So(json.Unmarshal(b, &m), ShouldBeNil)
+	return m
+}
+
+func TestPusher_InternalSyncPush(t *testing.T) {
+	for _, addr := range []string{"localhost:27001", testRedisDSN} {
+		if conn, err := net.DialTimeout("tcp", addr, time.Second); err != nil {
+			t.Skipf("%s is not available: %v", addr, err)
+		} else {
+			_ = conn.Close()
+		}
+	}
+	model, err := nested.NewManager("TestServer", testMongoDSN, testRedisDSN, -1)
+	if err != nil {
+		t.Skipf("could not initialize the model: %v", err)
+	}
+	p := pusher.New(model, testBundleID, "nested.test")
+	ts := newTestServer(p)
+	defer ts.http.Close()
+	p2 := pusher.New(model, testBundleID2, "nested.test")
+	ts2 := newTestServer(p2)
+	defer ts2.http.Close()
+
+	// let the pushers subscribe to their bundle channels
+	time.Sleep(500 * time.Millisecond)
+
+	Convey("Pusher/InternalSyncPush", t, func(c C) {
+		accountID := strings.ToLower(nested.RandomID(10))
+		conn, wsID := ts.connect(c)
+		c.So(p.RegisterWebsocket(accountID, "", testBundleID, wsID), ShouldBeNil)
+		c.So(p.GetOnlineAccounts(testBundleID), ShouldContain, accountID)
+
+		Convey("Post", func(c C) {
+			postID := bson.NewObjectId()
+			p.InternalPostActivitySyncPush([]string{accountID}, postID, global.PostActivityActionCommentAdd, []string{"place"})
+			m := readPush(c, conn)
+			c.So(m["cmd"], ShouldEqual, "sync-p")
+			c.So(m["data"].(map[string]interface{})["post_id"], ShouldEqual, postID.Hex())
+		})
+		Convey("Task", func(c C) {
+			taskID := bson.NewObjectId()
+			p.InternalTaskActivitySyncPush([]string{accountID}, taskID, global.TaskActivityComment)
+			m := readPush(c, conn)
+			c.So(m["cmd"], ShouldEqual, "sync-t")
+			c.So(m["data"].(map[string]interface{})["task_id"], ShouldEqual, taskID.Hex())
+		})
+		Convey("Notification", func(c C) {
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			m := readPush(c, conn)
+			c.So(m["cmd"], ShouldEqual, "sync-n")
+			c.So(m["data"].(map[string]interface{})["type"], ShouldEqual, float64(nested.NotificationTypeMention))
+		})
+		Convey("Sequence", func(c C) {
+			since := p.GetSyncSeq(accountID)
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeComment)
+			c.So(readPush(c, conn)["seq"], ShouldEqual, float64(since+1))
+			c.So(readPush(c, conn)["seq"], ShouldEqual, float64(since+2))
+
+			events, seq, resync, err := p.GetUpdates(accountID, since)
+			c.So(err, ShouldBeNil)
+			c.So(resync, ShouldBeFalse)
+			c.So(seq, ShouldEqual, since+2)
+			c.So(events, ShouldHaveLength, 2)
+			c.So(events[0]["seq"], ShouldEqual, since+1)
+			c.So(events[1]["cmd"], ShouldEqual, "sync-n")
+
+			// the events before the log are gone
+			for i := 0; i < pusher.SyncLogSize; i++ {
+				p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			}
+			_, _, resync, err = p.GetUpdates(accountID, since)
+			c.So(err, ShouldBeNil)
+			c.So(resync, ShouldBeTrue)
+		})
+		Convey("Untracked", func(c C) {
+			// the events are not logged until the clients of the account ask for its sequence
+			untrackedID := strings.ToLower(nested.RandomID(10))
+			p.InternalNotificationSyncPush([]string{untrackedID}, nested.NotificationTypeMention)
+			_, seq, _, err := p.GetUpdates(untrackedID, 0)
+			c.So(err, ShouldBeNil)
+			c.So(seq, ShouldEqual, 0)
+			c.So(p.GetSyncSeq(untrackedID), ShouldEqual, 0)
+			p.InternalNotificationSyncPush([]string{untrackedID}, nested.NotificationTypeMention)
+			events, seq, _, err := p.GetUpdates(untrackedID, 0)
+			c.So(err, ShouldBeNil)
+			c.So(seq, ShouldEqual, 1)
+			c.So(events, ShouldHaveLength, 1)
+		})
+		Convey("Presence", func(c C) {
+			pr := p.GetPresence(accountID, []string{accountID, "nobody"})
+			c.So(pr, ShouldHaveLength, 2)
+			c.So(pr[0].Status, ShouldEqual, pusher.PresenceOnline)
+			c.So(pr[1].Status, ShouldEqual, pusher.PresenceOffline)
+
+			c.So(p.SetPresenceStatus(accountID, pusher.PresenceDoNotDisturb), ShouldBeNil)
+			c.So(p.SetPresenceStatus(accountID, "busy"), ShouldNotBeNil)
+			c.So(p.GetPresence(accountID, []string{accountID})[0].Status, ShouldEqual, pusher.PresenceDoNotDisturb)
+
+			// accounts which are neither contacts nor share a place are always offline
+			strangerID := strings.ToLower(nested.RandomID(10))
+			conn2, wsID2 := ts.connect(c)
+			defer conn2.Close()
+			c.So(p.RegisterWebsocket(strangerID, "", testBundleID, wsID2), ShouldBeNil)
+			pr = p.GetPresence(accountID, []string{strangerID})
+			c.So(pr[0].Status, ShouldEqual, pusher.PresenceOffline)
+			c.So(pr[0].LastSeen, ShouldBeZeroValue)
+			c.So(p.GetPresence(strangerID, []string{strangerID})[0].Status, ShouldEqual, pusher.PresenceOnline)
+			_ = p.UnregisterWebsocket(wsID2, testBundleID)
+
+			_ = p.UnregisterWebsocket(wsID, testBundleID)
+			pr = p.GetPresence(accountID, []string{accountID})
+			c.So(pr[0].Status, ShouldEqual, pusher.PresenceOffline)
+			c.So(pr[0].LastSeen, ShouldBeGreaterThan, 0)
+		})
+		Convey("Remote Bundle", func(c C) {
+			conn2, wsID2 := ts2.connect(c)
+			defer conn2.Close()
+			c.So(p2.RegisterWebsocket(accountID, "", testBundleID2, wsID2), ShouldBeNil)
+
+			// the local websocket is written directly and the remote one through its own bundle
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			c.So(readPush(c, conn)["cmd"], ShouldEqual, "sync-n")
+			c.So(readPush(c, conn2)["cmd"], ShouldEqual, "sync-n")
+		})
+		Convey("Stale Bundle", func(c C) {
+			staleBundleID := "TEST.STALE"
+			c.So(p.RegisterWebsocket(accountID, "", staleBundleID, nested.RandomID(10)), ShouldBeNil)
+			c.So(p.GetOnlineAccounts(staleBundleID), ShouldContain, accountID)
+
+			// the bundles which have never sent a heartbeat are not stale (i.e. older versions)
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			c.So(readPush(c, conn)["cmd"], ShouldEqual, "sync-n")
+			c.So(p.GetOnlineAccounts(staleBundleID), ShouldContain, accountID)
+
+			rc := model.Cache().Pool.Get()
+			_, err := rc.Do("SADD", "push:heartbeats", staleBundleID)
+			_ = rc.Close()
+			c.So(err, ShouldBeNil)
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeMention)
+			c.So(readPush(c, conn)["cmd"], ShouldEqual, "sync-n")
+			c.So(p.GetOnlineAccounts(staleBundleID), ShouldNotContain, accountID)
+		})
+		Convey("Reconnect", func(c C) {
+			_ = conn.Close()
+			c.So(func() bool {
+				for i := 0; i < 50; i++ {
+					if !hasAccount(p.GetOnlineAccounts(testBundleID), accountID) {
+						return true
+					}
+					time.Sleep(100 * time.Millisecond)
+				}
+				return false
+			}(), ShouldBeTrue)
+
+			conn2, wsID2 := ts.connect(c)
+			defer conn2.Close()
+			c.So(wsID2, ShouldNotEqual, wsID)
+			c.So(p.RegisterWebsocket(accountID, "", testBundleID, wsID2), ShouldBeNil)
+			p.InternalNotificationSyncPush([]string{accountID}, nested.NotificationTypeComment)
+			m := readPush(c, conn2)
+			c.So(m["cmd"], ShouldEqual, "sync-n")
+		})
+
+		Reset(func() {
+			_ = conn.Close()
+		})
+	})
+}
+
+func hasAccount(accountIDs []string, accountID string) bool {
+	for _, id := range accountIDs {
+		if id == accountID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package pusher
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"git.ronaksoft.com/nested/server/pkg/log"
+	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Every sync event of an account gets a monotonically increasing sequence number and is kept in a
+// bounded log, so clients which have been offline could replay the events they missed. If the gap
+// is larger than the log, clients must do a full resync.
+const (
+	syncSeqKeyPrefix = "sync:seq:"
+	syncLogKeyPrefix = "sync:log:"
+	SyncLogSize      = 500
+	syncLogTTL       = 7 * 24 * 3600 // Seconds
+)
+
+// syncAppendScript increments the sequence of the account and pushes the event into the head of
+// its log atomically. Log entries are kept as '<seq>|<event>'. The events of the accounts which
+// are not tracked (i.e. their clients have never asked for their sequence) are not logged and 0 is
+// returned for them.
+var syncAppendScript = redis.NewScript(2, `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local seq = redis.call('INCR', KEYS[1])
+redis.call('LPUSH', KEYS[2], seq .. '|' .. ARGV[1])
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[2]) - 1)
+redis.call('EXPIRE', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+return seq
+`)
+
+func syncSeqKey(accountID string) string {
+	return fmt.Sprintf("%s%s", syncSeqKeyPrefix, accountID)
+}
+
+func syncLogKey(accountID string) string {
+	return fmt.Sprintf("%s%s", syncLogKeyPrefix, accountID)
+}
+
+// syncPush assigns a sequence number to the event for each of the targets, appends it to their
+// logs and pushes it to their websockets. The logs are appended in one round trip and the events
+// are pushed in one batch.
+func (p *Pusher) syncPush(targets []string, msg tools.M) {
+	event, err := json.Marshal(msg)
+	if err != nil {
+		log.Warn("got error on encoding sync event", zap.Error(err))
+		return
+	}
+	c := p.cache.Pool.Get()
+	defer c.Close()
+	for _, accountID := range targets {
+		_ = syncAppendScript.Send(c, syncSeqKey(accountID), syncLogKey(accountID), event, SyncLogSize, syncLogTTL)
+	}
+	if err := c.Flush(); err != nil {
+		log.Warn("got error on appending sync events", zap.Error(err))
+	}
+	payloads := make(map[string]string, len(targets))
+	for _, accountID := range targets {
+		seq, err := redis.Int64(c.Receive())
+		if err != nil {
+			log.Warn("got error on appending sync event", zap.Error(err), zap.String("AccountID", accountID))
+		}
+		if seq == 0 {
+			payloads[accountID] = string(event)
+			continue
+		}
+		msg["seq"] = seq
+		jmsg, _ := json.Marshal(msg)
+		payloads[accountID] = string(jmsg)
+	}
+	delete(msg, "seq")
+	_ = p.internalPushPayloads(payloads, false)
+}
+
+// GetSyncSeq returns the last sequence number which has been assigned to the events of accountID.
+// The events of the account are logged from now on, if they have not been yet.
+func (p *Pusher) GetSyncSeq(accountID string) int64 {
+	c := p.cache.Pool.Get()
+	defer c.Close()
+	_, _ = c.Do("SET", syncSeqKey(accountID), 0, "EX", syncLogTTL, "NX")
+	seq, _ := redis.Int64(c.Do("GET", syncSeqKey(accountID)))
+	return seq
+}
+
+// GetUpdates returns the events of accountID which their sequence is greater than since, ordered
+// by their sequence, and the last sequence of the account. If some of the events after since are
+// not in the log anymore, resync will be true and no events will be returned.
+func (p *Pusher) GetUpdates(accountID string, since int64) (events []tools.M, lastSeq int64, resync bool, err error) {
+	c := p.cache.Pool.Get()
+	defer c.Close()
+
+	_ = c.Send("MULTI")
+	_ = c.Send("GET", syncSeqKey(accountID))
+	_ = c.Send("LRANGE", syncLogKey(accountID), 0, SyncLogSize-1)
+	res, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	lastSeq, _ = redis.Int64(res[0], nil)
+	entries, _ := redis.Strings(res[1], nil)
+
+	events = make([]tools.M, 0, len(entries))
+	switch {
+	case since == lastSeq:
+		return events, lastSeq, false, nil
+	case since > lastSeq:
+		// The sequence has been reset (i.e. the log has been expired)
+		return events, lastSeq, true, nil
+	}
+
+	oldest := lastSeq + 1
+	// Entries are stored newest first
+	for idx := len(entries) - 1; idx >= 0; idx-- {
+		parts := strings.SplitN(entries[idx], "|", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		seq, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if seq < oldest {
+			oldest = seq
+		}
+		if seq <= since {
+			continue
+		}
+		event := tools.M{}
+		if err := json.Unmarshal([]byte(parts[1]), &event); err != nil {
+			continue
+		}
+		event["seq"] = seq
+		events = append(events, event)
+	}
+	if oldest > since+1 {
+		return events[:0], lastSeq, true, nil
+	}
+	return events, lastSeq, false, nil
+}
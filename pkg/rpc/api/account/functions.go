@@ -3,8 +3,12 @@ package nestedServiceAccount
 import (
 	"fmt"
 	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/password"
+	"git.ronaksoft.com/nested/server/pkg/pusher"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
+	"git.ronaksoft.com/nested/server/pkg/rpc/api"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"git.ronaksoft.com/nested/server/pkg/webpush"
 	"regexp"
 	"strings"
 	"time"
@@ -83,7 +87,7 @@ func (s *AccountService) changePhone(requester *nested.Account, request *rpc.Req
 	}
 	if v, ok := request.Data["pass"].(string); ok {
 		password = v
-		if !s.Model().Account.Verify(requester.ID, password) {
+		if !s.Worker().VerifyPassword(requester.ID, password, request.ClientIP) {
 			response.Error(global.ErrInvalid, []string{"pass"})
 			return
 		}
@@ -133,7 +137,11 @@ func (s *AccountService) getAccountInfo(requester *nested.Account, request *rpc.
 		account = requester
 		details = true
 	}
-	response.OkWithData(s.Worker().Map().Account(*account, details))
+	r := s.Worker().Map().Account(*account, details)
+	if requester.Authority.Admin {
+		r["lockout"] = s.Model().Lockout.Get(nested.LockoutAccount, account.ID)
+	}
+	response.OkWithData(r)
 	return
 }
 
@@ -355,7 +363,7 @@ func (s *AccountService) getAccountFavoritePlaces(requester *nested.Account, req
 
 // @Command: account/set_password
 // @Input:	old_pass	string	*
-// @Input:	new_pass	string	*
+// @Input:	new_pass	string	*	(plain password, the md5 digest of it is stored)
 func (s *AccountService) setAccountPassword(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var oldPass, newPass, accountID string
 	var account *nested.Account
@@ -390,18 +398,29 @@ func (s *AccountService) setAccountPassword(requester *nested.Account, request *
 		}
 	}
 
-	if s.Model().Account.Verify(accountID, oldPass) {
-		s.Model().Account.SetPassword(accountID, newPass)
-	} else {
+	// passwords of the directory accounts are managed by the directory
+	if s.Worker().IsDirectoryAccount(accountID) {
+		response.Error(global.ErrAccess, []string{"directory_account"})
+		return
+	}
+	if !s.Worker().VerifyPassword(accountID, oldPass, request.ClientIP) {
 		response.Error(global.ErrInvalid, []string{})
 		return
 	}
+	if account == nil {
+		account = requester
+	}
+	if rules := s.Worker().CheckAccountPassword(account, newPass); len(rules) > 0 {
+		response.Error(global.ErrInvalid, append([]string{"new_pass"}, rules...))
+		return
+	}
+	s.Model().Account.SetPassword(accountID, password.Digest(newPass))
 	response.Ok()
 }
 
 // @Command: account/set_password_by_token
 // @Input:	token			string		*
-// @Input:	new_pass		string		*
+// @Input:	new_pass		string		*	(plain password, the md5 digest of it is stored)
 func (s *AccountService) setAccountPasswordByLoginToken(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var account *nested.Account
 	var token, newPass string
@@ -422,7 +441,11 @@ func (s *AccountService) setAccountPasswordByLoginToken(requester *nested.Accoun
 		response.Error(global.ErrIncomplete, []string{"new_pass"})
 		return
 	}
-	if s.Model().Account.SetPassword(account.ID, newPass) {
+	if rules := s.Worker().CheckAccountPassword(account, newPass); len(rules) > 0 {
+		response.Error(global.ErrInvalid, append([]string{"new_pass"}, rules...))
+		return
+	}
+	if s.Model().Account.SetPassword(account.ID, password.Digest(newPass)) {
 		// remove the login token from db, prevent from using it in future
 		s.Model().Token.RevokeLoginToken(token)
 		response.Ok()
@@ -486,6 +509,7 @@ func (s *AccountService) removeFromTrustList(requester *nested.Account, request
 // @Input:	_dt		string 		*	(device token)
 // @Input:	_did	    string 		*	(device id)
 // @Input:	_os		string 		*	(android | ios | chrome | firefox | safari | opera | edge)
+// @CommandInfo:	Browsers could send their PushSubscription (json) as _dt to receive Web Push notifications
 func (s *AccountService) registerDevice(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var deviceID, deviceToken, deviceOS string
 	if v, ok := request.Data["_dt"].(string); ok {
@@ -497,6 +521,15 @@ func (s *AccountService) registerDevice(requester *nested.Account, request *rpc.
 	if v, ok := request.Data["_os"].(string); ok {
 		deviceOS = v
 	}
+	switch deviceOS {
+	case global.PlatformChrome, global.PlatformFirefox, global.PlatformSafari:
+		if strings.HasPrefix(strings.TrimSpace(deviceToken), "{") {
+			if _, err := webpush.ParseSubscription(deviceToken); err != nil {
+				response.Error(global.ErrInvalid, []string{"_dt"})
+				return
+			}
+		}
+	}
 
 	s.Worker().Pusher().RegisterDevice(deviceID, deviceToken, deviceOS, requester.ID)
 	response.Ok()
@@ -524,6 +557,7 @@ func (s *AccountService) unregisterDevice(requester *nested.Account, request *rp
 // @Input:	dob			string			+	(YYYY-MM-DD)
 // @Input:	email		string			+
 // @Input:	searchable	bool			+
+// @Input:	hide_presence	bool		+
 func (s *AccountService) updateAccount(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	aur := nested.AccountUpdateRequest{}
 	placeUpdateRequest := tools.M{}
@@ -583,6 +617,12 @@ func (s *AccountService) updateAccount(requester *nested.Account, request *rpc.R
 		}
 		s.Model().Account.SetPrivacy(requester.ID, "searchable", searchable)
 	}
+	if hidePresence, ok := request.Data["hide_presence"].(bool); ok {
+		s.Model().Account.SetPrivacy(requester.ID, "hide_presence", hidePresence)
+		if hidePresence != requester.Privacy.HidePresence {
+			go s.Worker().Pusher().PresenceHidden(requester.ID, hidePresence)
+		}
+	}
 	s.Model().Account.Update(requester.ID, aur)
 	s.Model().Place.Update(requester.ID, placeUpdateRequest)
 
@@ -594,6 +634,43 @@ func (s *AccountService) updateAccount(requester *nested.Account, request *rpc.R
 	return
 }
 
+// @Command: account/get_presence
+// @Input:	account_id		string		*	(comma separated)
+// @CommandInfo:	returns the presence (online | away | dnd | offline) and the last seen time of the accounts,
+// @CommandInfo:	the accounts which are neither contacts nor members of a place of the requester are always offline
+func (s *AccountService) getPresence(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var accountIDs []string
+	if v, ok := request.Data["account_id"].(string); ok {
+		for _, accountID := range strings.SplitN(v, ",", global.DefaultMaxResultLimit) {
+			if accountID = strings.TrimSpace(accountID); len(accountID) > 0 {
+				accountIDs = append(accountIDs, accountID)
+			}
+		}
+	}
+	if len(accountIDs) == 0 {
+		response.Error(global.ErrIncomplete, []string{"account_id"})
+		return
+	}
+	response.OkWithData(tools.M{
+		"presences": s.Worker().Pusher().GetPresence(requester.ID, accountIDs),
+	})
+}
+
+// @Command: account/set_presence
+// @Input:	status		string		*	(online | away | dnd)
+func (s *AccountService) setPresence(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	status, _ := request.Data["status"].(string)
+	if !pusher.IsValidPresenceStatus(status) {
+		response.Error(global.ErrInvalid, []string{"status"})
+		return
+	}
+	if err := s.Worker().Pusher().SetPresenceStatus(requester.ID, status); err != nil {
+		response.Error(global.ErrUnknown, []string{err.Error()})
+		return
+	}
+	response.Ok()
+}
+
 // @Command: account/update_email
 // @Input:	host			string			+
 // @Input:	port			int				+
@@ -694,3 +771,206 @@ func (s *AccountService) removeEmail(requester *nested.Account, request *rpc.Req
 		response.Error(global.ErrUnknown, []string{})
 	}
 }
+
+// @Command: account/totp_status
+// @CommandInfo:	returns the state of the two factor authentication of the account
+func (s *AccountService) getTOTPStatus(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	r := tools.M{
+		"enabled":  false,
+		"required": api.TwoFactorRequired(requester),
+	}
+	if tf := s.Model().TwoFactor.Get(requester.ID); tf != nil && tf.Enabled {
+		r["enabled"] = true
+		r["enabled_on"] = tf.EnabledOn
+		r["recovery_codes_left"] = len(tf.RecoveryCodes)
+	}
+	response.OkWithData(r)
+}
+
+// @Command: account/totp_enroll
+// @Input:	pass			string		*
+// @CommandInfo:	returns a new secret and its provisioning uri, the secret is not active until it is confirmed
+func (s *AccountService) enrollTOTP(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var pass string
+	if v, ok := request.Data["pass"].(string); ok {
+		pass = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"pass"})
+		return
+	}
+	if requester.Flags.TwoFactor {
+		response.Error(global.ErrDuplicate, []string{"two_factor"})
+		return
+	}
+	if !s.Worker().VerifyPassword(requester.ID, pass, request.ClientIP) {
+		response.Error(global.ErrInvalid, []string{"pass"})
+		return
+	}
+	secret, uri, err := s.Worker().EnrollTwoFactor(requester)
+	switch err {
+	case nil:
+	case api.ErrNoSecretsKey:
+		response.Error(global.ErrUnavailable, []string{"secrets_key"})
+		return
+	default:
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.OkWithData(tools.M{
+		"secret":           secret,
+		"provisioning_uri": uri,
+	})
+}
+
+// @Command: account/totp_confirm
+// @Input:	code			string		*
+// @CommandInfo:	enables the enrolled secret and returns the one-time recovery codes
+func (s *AccountService) confirmTOTP(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var code string
+	if v, ok := request.Data["code"].(string); ok {
+		code = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"code"})
+		return
+	}
+	codes, ok := s.Worker().ConfirmTwoFactor(requester.ID, code)
+	if !ok {
+		response.Error(global.ErrInvalid, []string{"code"})
+		return
+	}
+	response.OkWithData(tools.M{"recovery_codes": codes})
+}
+
+// @Command: account/totp_disable
+// @Input:	pass			string		*
+// @Input:	code			string		*	(totp or recovery code)
+func (s *AccountService) disableTOTP(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var pass, code string
+	if v, ok := request.Data["pass"].(string); ok {
+		pass = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"pass"})
+		return
+	}
+	if v, ok := request.Data["code"].(string); ok {
+		code = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"code"})
+		return
+	}
+	if api.TwoFactorRequired(requester) {
+		response.Error(global.ErrAccess, []string{"two_factor_required"})
+		return
+	}
+	if !s.Worker().VerifyPassword(requester.ID, pass, request.ClientIP) {
+		response.Error(global.ErrInvalid, []string{"pass"})
+		return
+	}
+	if ok, _ := s.Worker().CheckTwoFactor(requester.ID, code, request.ClientIP); !ok {
+		response.Error(global.ErrInvalid, []string{"code"})
+		return
+	}
+	if !s.Model().TwoFactor.Disable(requester.ID) {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.Ok()
+}
+
+// @Command: account/totp_recovery_codes
+// @Input:	code			string		*
+// @CommandInfo:	replaces the recovery codes with the new ones
+func (s *AccountService) regenerateTOTPRecoveryCodes(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var code string
+	if v, ok := request.Data["code"].(string); ok {
+		code = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"code"})
+		return
+	}
+	if ok, _ := s.Worker().CheckTwoFactor(requester.ID, code, request.ClientIP); !ok {
+		response.Error(global.ErrInvalid, []string{"code"})
+		return
+	}
+	codes := s.Worker().RegenerateRecoveryCodes(requester.ID)
+	if codes == nil {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.OkWithData(tools.M{"recovery_codes": codes})
+}
+
+// @Command: account/create_access_token
+// @Input:	name			string		*
+// @Input:	scopes			string		*	(space separated, i.e. 'posts:read tasks:read')
+// @Input:	expire_in		int			+	(days, the token never expires if it is not set)
+// @CommandInfo:	creates a personal access token for the scripts and the CI jobs, the token is sent by the
+// @CommandInfo:	'Authorization: Bearer' header of the http gateway and is returned only once
+func (s *AccountService) createAccessToken(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var name string
+	var scopes []string
+	var expireOn uint64
+	if v, ok := request.Data["name"].(string); ok && len(strings.TrimSpace(v)) > 0 && len(v) <= 64 {
+		name = strings.TrimSpace(v)
+	} else {
+		response.Error(global.ErrInvalid, []string{"name"})
+		return
+	}
+	if v, ok := request.Data["scopes"].(string); ok {
+		if scopes, ok = api.ParseScopes(v); !ok || len(scopes) == 0 {
+			response.Error(global.ErrInvalid, []string{"scopes"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"scopes"})
+		return
+	}
+	if v, ok := request.Data["expire_in"].(float64); ok && v != 0 {
+		if v < 1 || v > nested.PersonalTokenMaxDays {
+			response.Error(global.ErrInvalid, []string{"expire_in"})
+			return
+		}
+		expireOn = nested.Timestamp() + uint64(time.Duration(v)*24*time.Hour/time.Millisecond)
+	}
+	if s.Model().PersonalToken.Count(requester.ID) >= nested.PersonalTokensLimit {
+		response.Error(global.ErrLimit, []string{"access_tokens"})
+		return
+	}
+	token, t := s.Model().PersonalToken.Create(requester.ID, name, scopes, expireOn)
+	if t == nil {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	r := s.Worker().Map().PersonalToken(*t)
+	r["token"] = token
+	response.OkWithData(r)
+}
+
+// @Command: account/get_access_tokens
+// @Pagination
+// @CommandInfo:	returns the personal access tokens of the account without their secrets
+func (s *AccountService) getAccessTokens(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	tokens := s.Model().PersonalToken.GetByAccountID(requester.ID, s.Worker().Argument().GetPagination(request))
+	r := make([]tools.M, 0, len(tokens))
+	for _, t := range tokens {
+		r = append(r, s.Worker().Map().PersonalToken(t))
+	}
+	response.OkWithData(tools.M{"tokens": r})
+}
+
+// @Command: account/revoke_access_token
+// @Input:	_id			string		*	(id of the token)
+func (s *AccountService) revokeAccessToken(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var tokenID string
+	if v, ok := request.Data["_id"].(string); ok && len(v) > 0 {
+		tokenID = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"_id"})
+		return
+	}
+	if !s.Model().PersonalToken.Revoke(requester.ID, tokenID) {
+		response.Error(global.ErrInvalid, []string{"_id"})
+		return
+	}
+	response.Ok()
+}
@@ -14,6 +14,7 @@ const (
 	CmdChangePhone        = "account/change_phone"
 	CmdGet                = "account/get"
 	CmdGetByToken         = "account/get_by_token"
+	CmdGetPresence        = "account/get_presence"
 	CmdGetMany            = "account/get_many"
 	CmdGetAllPlaces       = "account/get_all_places"
 	CmdGetFavoritePlaces  = "account/get_favorite_places"
@@ -25,6 +26,7 @@ const (
 	CmdRegisterDevice     = "account/register_device"
 	CmdRemovePicture      = "account/remove_picture"
 	CmdSetPicture         = "account/set_picture"
+	CmdSetPresence        = "account/set_presence"
 	CmdSetPassword        = "account/set_password"
 	CmdSetPasswordByToken = "account/set_password_by_token"
 	CmdTrustEmail         = "account/trust_email"
@@ -33,6 +35,14 @@ const (
 	CmdUpdate             = "account/update"
 	CmdUpdateEmail        = "account/update_email"
 	CmdRemoveEmail        = "account/remove_email"
+	CmdTOTPStatus         = "account/totp_status"
+	CmdTOTPEnroll         = "account/totp_enroll"
+	CmdTOTPConfirm        = "account/totp_confirm"
+	CmdTOTPDisable        = "account/totp_disable"
+	CmdTOTPRecoveryCodes  = "account/totp_recovery_codes"
+	CmdCreateAccessToken  = "account/create_access_token"
+	CmdGetAccessTokens    = "account/get_access_tokens"
+	CmdRevokeAccessToken  = "account/revoke_access_token"
 )
 
 type AccountService struct {
@@ -44,18 +54,20 @@ func NewAccountService(worker *api.Worker) api.Service {
 	s := new(AccountService)
 	s.worker = worker
 	s.serviceCommands = api.ServiceCommands{
-		CmdUpdateEmail:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.updateEmail},
-		CmdRemoveEmail:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeEmail},
-		CmdGetAllPlaces:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountAllPlaces},
-		CmdGetFavoritePlaces:  {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountFavoritePlaces},
-		CmdGetPosts:           {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountFavoritePosts},
-		CmdGetSpamPosts:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountGetSpamPosts},
-		CmdGetFavoritePosts:   {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountFavoritePosts},
-		CmdGetSentPosts:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountSentPosts},
-		CmdGetPinnedPosts:     {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getAccountPinnedPosts},
+		CmdUpdateEmail:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeAccountWrite, Execute: s.updateEmail},
+		CmdRemoveEmail:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeAccountWrite, Execute: s.removeEmail},
+		CmdGetAllPlaces:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getAccountAllPlaces},
+		CmdGetFavoritePlaces:  {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getAccountFavoritePlaces},
+		CmdGetPosts:           {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getAccountFavoritePosts},
+		CmdGetSpamPosts:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getAccountGetSpamPosts},
+		CmdGetFavoritePosts:   {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getAccountFavoritePosts},
+		CmdGetSentPosts:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getAccountSentPosts},
+		CmdGetPinnedPosts:     {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getAccountPinnedPosts},
 		CmdChangePhone:        {MinAuthLevel: api.AuthLevelUser, Execute: s.changePhone},
 		CmdGet:                {MinAuthLevel: api.AuthLevelUser, Execute: s.getAccountInfo},
 		CmdGetMany:            {MinAuthLevel: api.AuthLevelUser, Execute: s.getManyAccountsInfo},
+		CmdGetPresence:        {MinAuthLevel: api.AuthLevelUser, Execute: s.getPresence},
+		CmdSetPresence:        {MinAuthLevel: api.AuthLevelUser, Execute: s.setPresence},
 		CmdSetPicture:         {MinAuthLevel: api.AuthLevelUser, Execute: s.setAccountPicture},
 		CmdTrustEmail:         {MinAuthLevel: api.AuthLevelUser, Execute: s.addToTrustList},
 		CmdRemovePicture:      {MinAuthLevel: api.AuthLevelUser, Execute: s.removeAccountPicture},
@@ -63,6 +75,14 @@ func NewAccountService(worker *api.Worker) api.Service {
 		CmdUnregisterDevice:   {MinAuthLevel: api.AuthLevelUser, Execute: s.unregisterDevice},
 		CmdUnTrustEmail:       {MinAuthLevel: api.AuthLevelUser, Execute: s.removeFromTrustList},
 		CmdUpdate:             {MinAuthLevel: api.AuthLevelUser, Execute: s.updateAccount},
+		CmdTOTPStatus:         {MinAuthLevel: api.AuthLevelUser, Execute: s.getTOTPStatus},
+		CmdTOTPEnroll:         {MinAuthLevel: api.AuthLevelUser, Execute: s.enrollTOTP},
+		CmdTOTPConfirm:        {MinAuthLevel: api.AuthLevelUser, Execute: s.confirmTOTP},
+		CmdTOTPDisable:        {MinAuthLevel: api.AuthLevelUser, Execute: s.disableTOTP},
+		CmdTOTPRecoveryCodes:  {MinAuthLevel: api.AuthLevelUser, Execute: s.regenerateTOTPRecoveryCodes},
+		CmdCreateAccessToken:  {MinAuthLevel: api.AuthLevelUser, Execute: s.createAccessToken},
+		CmdGetAccessTokens:    {MinAuthLevel: api.AuthLevelUser, Execute: s.getAccessTokens},
+		CmdRevokeAccessToken:  {MinAuthLevel: api.AuthLevelUser, Execute: s.revokeAccessToken},
 		CmdAvailable:          {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.accountIDAvailable},
 		CmdGetByToken:         {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.getAccountInfoByToken},
 		CmdSetPassword:        {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.setAccountPassword},
@@ -79,7 +99,7 @@ func (s *AccountService) GetServicePrefix() string {
 func (s *AccountService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
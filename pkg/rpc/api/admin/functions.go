@@ -7,16 +7,19 @@ import (
 	"fmt"
 	"git.ronaksoft.com/nested/server/pkg/config"
 	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/password"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
 	"html/template"
 	"log"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/mail/lmtp"
 	"git.ronaksoft.com/nested/server/pkg/rpc/api"
 )
 
@@ -1072,7 +1075,7 @@ func (s *AdminService) setPlaceProfilePicture(_ *nested.Account, request *rpc.Re
 
 // @Command:	admin/account_register
 // @Input:	uid			string	*
-// @Input:	pass		string	*
+// @Input:	pass		string	*	(plain password, the md5 digest of it is stored)
 // @Input:	fname		string	*
 // @Input:	lname		string	*
 // @Input:	gender		string	+	(m | f | o | x)
@@ -1172,6 +1175,16 @@ func (s *AdminService) createAccount(requester *nested.Account, request *rpc.Req
 		return
 	}
 
+	if !passAutoGenerated {
+		if rules := s.Worker().CheckPassword("", pass, uid, fname, lname); len(rules) > 0 {
+			response.Error(global.ErrInvalid, append([]string{"pass"}, rules...))
+			return
+		}
+	}
+
+	if !passAutoGenerated {
+		pass = password.Digest(pass)
+	}
 	if !s.Worker().Model().Account.CreateUser(uid, pass, phone, country, fname, lname, email, dob, gender) {
 		response.Error(global.ErrUnknown, []string{""})
 		return
@@ -1253,12 +1266,6 @@ func (s *AdminService) createAccount(requester *nested.Account, request *rpc.Req
 	// prepare welcome message and invitations
 	go s.prepareWelcome(uid)
 
-	// ADP Sms Panel Initialization
-	adp := NewADP(
-		config.GetString(config.ADPUsername),
-		config.GetString(config.ADPPassword),
-		config.GetString(config.ADPMessageUrl),
-	)
 	// Force user to change his/her password at next login
 	s.Worker().Model().Account.ForcePasswordChange(uid, true)
 
@@ -1269,7 +1276,7 @@ func (s *AdminService) createAccount(requester *nested.Account, request *rpc.Req
 		// Send SMS
 		go func() {
 			if len(baseURL) > 0 {
-				if _, err := adp.SendSms(
+				if err := s.Worker().SendSMS(
 					phone,
 					fmt.Sprintf("Welcome to Nested, login to your account click on: %s/t/?%s",
 						config.GetString(config.WebAppBaseURL),
@@ -1291,7 +1298,7 @@ func (s *AdminService) createAccount(requester *nested.Account, request *rpc.Req
 
 			// Send SMS
 			go func() {
-				adp.SendSms(
+				_ = s.Worker().SendSMS(
 					phone,
 					fmt.Sprintf("Welcome to Nested, login to your account click on: %s/t/?%s",
 						// uid,
@@ -1392,9 +1399,62 @@ func (s *AdminService) enableAccount(_ *nested.Account, request *rpc.Request, re
 	return
 }
 
+// @Command:	admin/account_reset_two_factor
+// @Input:	account_id		string	*
+// @CommandInfo:	removes the two factor authentication of the account, i.e. when the user has lost the device
+// @CommandInfo:	and all the recovery codes
+func (s *AdminService) resetAccountTwoFactor(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var account *nested.Account
+	if accountID, ok := request.Data["account_id"].(string); ok {
+		account = s.Worker().Model().Account.GetByID(accountID, nil)
+		if account == nil {
+			response.Error(global.ErrInvalid, []string{"account_id"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"account_id"})
+		return
+	}
+	if !s.Worker().Model().TwoFactor.Disable(account.ID) {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.Ok()
+}
+
+// @Command:	admin/account_unlock
+// @Input:	account_id		string	*
+// @Input:	ip				string	+
+// @CommandInfo:	removes the lockout and the failed logins of the account, if ip is given the lockout of the
+// @CommandInfo:	client ip is removed too
+func (s *AdminService) unlockAccount(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var account *nested.Account
+	if accountID, ok := request.Data["account_id"].(string); ok {
+		account = s.Worker().Model().Account.GetByID(accountID, nil)
+		if account == nil {
+			response.Error(global.ErrInvalid, []string{"account_id"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"account_id"})
+		return
+	}
+	if !s.Worker().Model().Lockout.Reset(nested.LockoutAccount, account.ID) {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	if ip, ok := request.Data["ip"].(string); ok && len(ip) > 0 {
+		if !s.Worker().Model().Lockout.Reset(nested.LockoutIP, ip) {
+			response.Error(global.ErrUnknown, []string{"internal_error"})
+			return
+		}
+	}
+	response.Ok()
+}
+
 // @Command:	admin/account_set_pass
 // @Input:	account_id		string	*
-// @Input:	new_pass			string	*
+// @Input:	new_pass			string	*	(plain password, the md5 digest of it is stored)
 func (s *AdminService) setAccountPassword(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var newPass string
 	var account *nested.Account
@@ -1413,9 +1473,14 @@ func (s *AdminService) setAccountPassword(_ *nested.Account, request *rpc.Reques
 		newPass = str
 	} else {
 		response.Error(global.ErrInvalid, []string{"new_pass"})
+		return
+	}
+	if rules := s.Worker().CheckAccountPassword(account, newPass); len(rules) > 0 {
+		response.Error(global.ErrInvalid, append([]string{"new_pass"}, rules...))
+		return
 	}
 
-	if s.Worker().Model().Account.SetPassword(account.ID, newPass) {
+	if s.Worker().Model().Account.SetPassword(account.ID, password.Digest(newPass)) {
 		response.Ok()
 	} else {
 		response.Error(global.ErrUnknown, []string{})
@@ -1915,3 +1980,195 @@ func (s *AdminService) defaultPlacesSetUsers(requester *nested.Account, request
 		response.Ok()
 	}
 }
+
+// @Command: admin/import_mail
+// @Input:	path			string	*	(path of mbox file, eml file or directory, or maildir relative to MAIL_IMPORT_ROOT)
+// @Input:	format			string	+	(mbox | eml | maildir)
+// @Input:	place_id		string	+	(comma separated, used when no recipient could be mapped)
+// @Input:	place_map		string	+	(comma separated email=place_id pairs)
+// @Input:	dry_run			bool	+
+// @CommandInfo:	Runs the import in background and returns the job_id which could be used by admin/import_mail_status
+func (s *AdminService) importMail(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	opts := lmtp.ImportOptions{
+		PlaceMap: map[string]string{},
+	}
+	root := config.GetString(config.MailImportRoot)
+	if len(root) == 0 {
+		response.Error(global.ErrUnavailable, []string{"import_root"})
+		return
+	}
+	var path string
+	if v, ok := request.Data["path"].(string); ok && len(v) > 0 {
+		if p, ok := importPath(root, v); ok {
+			path = p
+		} else {
+			response.Error(global.ErrInvalid, []string{"path"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"path"})
+		return
+	}
+	if v, ok := request.Data["format"].(string); ok && len(v) > 0 {
+		switch v {
+		case lmtp.ArchiveFormatMbox, lmtp.ArchiveFormatEML, lmtp.ArchiveFormatMaildir:
+			opts.Format = v
+		default:
+			response.Error(global.ErrInvalid, []string{"format"})
+			return
+		}
+	}
+	if v, ok := request.Data["place_id"].(string); ok && len(v) > 0 {
+		for _, placeID := range strings.SplitN(v, ",", global.DefaultPostMaxTargets) {
+			if !s.Worker().Model().Place.Exists(placeID) {
+				response.Error(global.ErrInvalid, []string{"place_id"})
+				return
+			}
+			opts.DefaultPlaceIDs = append(opts.DefaultPlaceIDs, placeID)
+		}
+	}
+	if v, ok := request.Data["place_map"].(string); ok && len(v) > 0 {
+		for _, pair := range strings.Split(v, ",") {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 || !s.Worker().Model().Place.Exists(parts[1]) {
+				response.Error(global.ErrInvalid, []string{"place_map"})
+				return
+			}
+			opts.PlaceMap[strings.ToLower(strings.TrimSpace(parts[0]))] = parts[1]
+		}
+	}
+	if v, ok := request.Data["dry_run"].(bool); ok {
+		opts.DryRun = v
+	}
+	if _, err := lmtp.DetectArchiveFormat(path); err != nil {
+		response.Error(global.ErrInvalid, []string{"path"})
+		return
+	}
+
+	importer, err := lmtp.NewImporter(s.Worker().Model(), opts)
+	if err != nil {
+		response.Error(global.ErrUnknown, []string{err.Error()})
+		return
+	}
+	jobID := nested.RandomID(24)
+	s.importsMtx.Lock()
+	s.evictImports()
+	s.imports[jobID] = importer
+	s.importsMtx.Unlock()
+
+	go func() {
+		if _, err := importer.Import(path); err != nil {
+			log.Println("Admin::ImportMail::Error::", requester.ID, path, err.Error())
+		}
+	}()
+	response.OkWithData(tools.M{"job_id": jobID})
+}
+
+// importPath resolves path inside root, it returns false if the resolved path (after following the
+// symlinks) is outside of root.
+func importPath(root, path string) (string, bool) {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", false
+	}
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+path)))
+	if err != nil {
+		return "", false
+	}
+	if p != root && !strings.HasPrefix(p, root+string(filepath.Separator)) {
+		return "", false
+	}
+	return p, true
+}
+
+// evictImports removes the imports which have been finished more than importRetention ago, the
+// caller must hold importsMtx.
+func (s *AdminService) evictImports() {
+	now := nested.Timestamp()
+	for jobID, importer := range s.imports {
+		if r := importer.Result(); r.Finished && now-r.FinishedOn > uint64(importRetention/time.Millisecond) {
+			delete(s.imports, jobID)
+		}
+	}
+}
+
+// @Command: admin/import_mail_status
+// @Input:	job_id			string	*
+func (s *AdminService) getImportMailStatus(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var jobID string
+	if v, ok := request.Data["job_id"].(string); ok && len(v) > 0 {
+		jobID = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"job_id"})
+		return
+	}
+	s.importsMtx.Lock()
+	importer, ok := s.imports[jobID]
+	s.importsMtx.Unlock()
+	if !ok {
+		response.Error(global.ErrUnavailable, []string{"job_id"})
+		return
+	}
+	response.OkWithData(tools.M{"result": importer.Result()})
+}
+
+// @Command:	admin/scim_token_create
+// @CommandInfo:	creates a bearer token for the SCIM endpoint (/scim/v2) which acts on behalf of the requester,
+// @CommandInfo:	the token is returned only once
+func (s *AdminService) createScimToken(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	token := s.Worker().Model().Scim.CreateToken(requester.ID)
+	if len(token) == 0 {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.OkWithData(tools.M{"token": token})
+}
+
+// @Command:	admin/scim_token_revoke
+// @CommandInfo:	revokes all the SCIM tokens of the requester
+func (s *AdminService) revokeScimTokens(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	if !s.Worker().Model().Scim.RevokeTokens(requester.ID) {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.Ok()
+}
+
+// @Command:	admin/access_token_list
+// @Input:	account_id		string	+	(returns the tokens of all the accounts if it is not set)
+// @Pagination
+// @CommandInfo:	returns the personal access tokens of the accounts without their secrets
+func (s *AdminService) listAccessTokens(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var tokens []nested.PersonalToken
+	pg := s.Worker().Argument().GetPagination(request)
+	if accountID, ok := request.Data["account_id"].(string); ok && len(accountID) > 0 {
+		tokens = s.Worker().Model().PersonalToken.GetByAccountID(accountID, pg)
+	} else {
+		tokens = s.Worker().Model().PersonalToken.GetAll(pg)
+	}
+	r := make([]tools.M, 0, len(tokens))
+	for _, t := range tokens {
+		r = append(r, s.Worker().Map().PersonalToken(t))
+	}
+	response.OkWithData(tools.M{"tokens": r})
+}
+
+// @Command:	admin/access_token_revoke
+// @Input:	_id			string	*	(id of the token)
+func (s *AdminService) revokeAccessToken(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var t *nested.PersonalToken
+	if tokenID, ok := request.Data["_id"].(string); ok && len(tokenID) > 0 {
+		if t = s.Worker().Model().PersonalToken.GetByID(tokenID); t == nil {
+			response.Error(global.ErrInvalid, []string{"_id"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"_id"})
+		return
+	}
+	if !s.Worker().Model().PersonalToken.Revoke(t.AccountID, t.ID) {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.Ok()
+}
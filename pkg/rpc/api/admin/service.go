@@ -1,7 +1,11 @@
 package nestedServiceAdmin
 
 import (
+	"sync"
+	"time"
+
 	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/mail/lmtp"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
 	"git.ronaksoft.com/nested/server/pkg/rpc/api"
 )
@@ -10,6 +14,9 @@ const (
 	ServicePrefix string = "admin"
 )
 
+// importRetention is how long the result of a finished import is kept for admin/import_mail_status
+const importRetention = 24 * time.Hour
+
 const (
 	CmdCreatePost              string = "admin/create_post"
 	CmdAddComment              string = "admin/add_comment"
@@ -34,6 +41,8 @@ const (
 	CmdAccountSetPass          string = "admin/account_set_pass"
 	CmdAccountDisable          string = "admin/account_disable"
 	CmdAccountEnable           string = "admin/account_enable"
+	CmdAccountResetTwoFactor   string = "admin/account_reset_two_factor"
+	CmdAccountUnlock           string = "admin/account_unlock"
 	CmdAccountList             string = "admin/account_list"
 	CmdAccountListPlaces       string = "admin/account_list_places"
 	CmdAccountUpdate           string = "admin/account_update"
@@ -44,16 +53,25 @@ const (
 	CmdSetMessageTemplate      string = "admin/set_message_template"
 	CmdGetMessageTemplates     string = "admin/get_message_templates"
 	CmdRemoveMessageTemplate   string = "admin/remove_message_template"
+	CmdImportMail              string = "admin/import_mail"
+	CmdImportMailStatus        string = "admin/import_mail_status"
+	CmdScimTokenCreate         string = "admin/scim_token_create"
+	CmdScimTokenRevoke         string = "admin/scim_token_revoke"
+	CmdAccessTokenList         string = "admin/access_token_list"
+	CmdAccessTokenRevoke       string = "admin/access_token_revoke"
 )
 
 type AdminService struct {
 	worker          *api.Worker
 	serviceCommands api.ServiceCommands
+	importsMtx      sync.Mutex
+	imports         map[string]*lmtp.Importer
 }
 
 func NewAdminService(worker *api.Worker) api.Service {
 	s := new(AdminService)
 	s.worker = worker
+	s.imports = make(map[string]*lmtp.Importer)
 
 	s.serviceCommands = api.ServiceCommands{
 		CmdCreatePost:              {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.createPost},
@@ -64,6 +82,8 @@ func NewAdminService(worker *api.Worker) api.Service {
 		CmdAccountSetPass:          {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.setAccountPassword},
 		CmdAccountDisable:          {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.disableAccount},
 		CmdAccountEnable:           {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.enableAccount},
+		CmdAccountResetTwoFactor:   {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.resetAccountTwoFactor},
+		CmdAccountUnlock:           {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.unlockAccount},
 		CmdAccountList:             {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.listAccounts},
 		CmdAccountListPlaces:       {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.listPlacesOfAccount},
 		CmdAccountUpdate:           {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.updateAccount},
@@ -89,6 +109,12 @@ func NewAdminService(worker *api.Worker) api.Service {
 		CmdSetMessageTemplate:      {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.setMessageTemplate},
 		CmdGetMessageTemplates:     {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.getMessageTemplates},
 		CmdRemoveMessageTemplate:   {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.removeMessageTemplates},
+		CmdImportMail:              {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.importMail},
+		CmdImportMailStatus:        {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.getImportMailStatus},
+		CmdScimTokenCreate:         {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.createScimToken},
+		CmdScimTokenRevoke:         {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.revokeScimTokens},
+		CmdAccessTokenList:         {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.listAccessTokens},
+		CmdAccessTokenRevoke:       {MinAuthLevel: api.AuthLevelAdminUser, Execute: s.revokeAccessToken},
 	}
 	return s
 }
@@ -100,7 +126,7 @@ func (s *AdminService) GetServicePrefix() string {
 func (s *AdminService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
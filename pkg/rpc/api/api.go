@@ -23,7 +23,21 @@ type (
 
 type ServiceCommand struct {
 	MinAuthLevel AuthLevel
-	Execute      func(requester *nested.Account, request *rpc.Request, response *rpc.Response)
+	// Scope must be granted to the app tokens to run the command
+	Scope   string
+	Execute func(requester *nested.Account, request *rpc.Request, response *rpc.Response)
+}
+
+// Authorized returns TRUE if the command could be run by authLevel. The app tokens are
+// also limited to the scopes which have been granted by the user.
+func (sc ServiceCommand) Authorized(authLevel AuthLevel, request *rpc.Request) bool {
+	if authLevel < sc.MinAuthLevel {
+		return false
+	}
+	if sc.MinAuthLevel <= AuthLevelUnauthorized || authLevel > AuthLevelAppL3 {
+		return true
+	}
+	return len(sc.Scope) > 0 && HasScope(request.AppScopes, sc.Scope)
 }
 
 type Service interface {
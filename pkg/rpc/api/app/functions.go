@@ -1,9 +1,15 @@
 package nestedServiceApp
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
+	"git.ronaksoft.com/nested/server/pkg/rpc/api"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"net/url"
+	"sort"
 	"strings"
 
 	"git.ronaksoft.com/nested/server/nested"
@@ -100,6 +106,7 @@ func (s *AppService) getManyApps(requester *nested.Account, request *rpc.Request
 // @Input:  developer       string      *
 // @Input:  icon_large_url  string      +
 // @Input:  icon_small_url  string      +
+// @Input:  callback_url    string      +   (redirect uri of the authorization code flow)
 func (s *AppService) register(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var appID, appName, homepage, developer, iconLargeUrl, iconSmallUrl, callbackUrl string
 	if v, ok := request.Data["app_id"].(string); ok {
@@ -191,3 +198,203 @@ func (s *AppService) setFavStatus(requester *nested.Account, request *rpc.Reques
 		response.Error(global.ErrUnknown, []string{"internal_error"})
 	}
 }
+
+// @Command: app/authorize_info
+// @Input:  app_id          string  *
+// @Input:  redirect_uri    string  *
+// @Input:  scope           string  *   (space separated)
+// @CommandInfo:    returns the information which must be shown to the user in the consent screen
+func (s *AppService) authorizeInfo(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	app, scopes, ok := s.readAuthorizeRequest(request, response)
+	if !ok {
+		return
+	}
+	r := make([]tools.M, 0, len(scopes))
+	for _, scope := range scopes {
+		r = append(r, tools.M{
+			"scope":       scope,
+			"description": api.ScopeDescriptions[scope],
+		})
+	}
+	response.OkWithData(tools.M{
+		"app":       s.Worker().Map().App(*app),
+		"scopes":    r,
+		"has_token": s.Worker().Model().Token.AppTokenExists(requester.ID, app.ID),
+	})
+}
+
+// @Command: app/authorize
+// @Input:  app_id                  string  *
+// @Input:  redirect_uri            string  *
+// @Input:  scope                   string  *   (space separated)
+// @Input:  code_challenge          string  *
+// @Input:  code_challenge_method   string  +   (S256)
+// @Input:  state                   string  +
+// @CommandInfo:    is called when user accepts the consent, it returns the url which user must be redirected to
+func (s *AppService) authorize(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var codeChallenge, codeChallengeMethod, state string
+	app, scopes, ok := s.readAuthorizeRequest(request, response)
+	if !ok {
+		return
+	}
+	if v, ok := request.Data["code_challenge"].(string); ok {
+		codeChallenge = strings.TrimSpace(v)
+	}
+	if v, ok := request.Data["code_challenge_method"].(string); ok {
+		codeChallengeMethod = v
+	} else {
+		codeChallengeMethod = CodeChallengeMethodS256
+	}
+	if v, ok := request.Data["state"].(string); ok {
+		state = v
+	}
+	// RFC 7636: the challenge is the base64url of a 32 bytes hash at least
+	if len(codeChallenge) < 43 || len(codeChallenge) > 128 {
+		response.Error(global.ErrInvalid, []string{"code_challenge"})
+		return
+	}
+	if codeChallengeMethod != CodeChallengeMethodS256 {
+		response.Error(global.ErrInvalid, []string{"code_challenge_method"})
+		return
+	}
+
+	code := s.Worker().Model().Token.CreateAuthorizationCode(nested.AuthorizationCode{
+		AppID:               app.ID,
+		AccountID:           requester.ID,
+		RedirectURI:         app.CallbackURL,
+		Scopes:              scopes,
+		CodeChallenge:       codeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+	})
+	if len(code) == 0 {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	redirectURL, _ := url.Parse(app.CallbackURL)
+	q := redirectURL.Query()
+	q.Set("code", code)
+	if len(state) > 0 {
+		q.Set("state", state)
+	}
+	redirectURL.RawQuery = q.Encode()
+	response.OkWithData(tools.M{
+		"code":         code,
+		"redirect_uri": redirectURL.String(),
+	})
+}
+
+// @Command: app/token
+// @Input:  app_id          string  *
+// @Input:  grant_type      string  *   (authorization_code | refresh_token)
+// @Input:  code            string  +   (authorization_code)
+// @Input:  redirect_uri    string  +   (authorization_code)
+// @Input:  code_verifier   string  +   (authorization_code)
+// @Input:  refresh_token   string  +   (refresh_token)
+// @CommandInfo:    exchanges the authorization code or the refresh token with a new access token
+func (s *AppService) token(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var appID, grantType string
+	if v, ok := request.Data["app_id"].(string); ok {
+		appID = strings.TrimSpace(v)
+	}
+	if v, ok := request.Data["grant_type"].(string); ok {
+		grantType = v
+	}
+
+	var appToken *nested.AppToken
+	switch grantType {
+	case GrantTypeAuthorizationCode:
+		var code, redirectURI, codeVerifier string
+		if v, ok := request.Data["code"].(string); ok {
+			code = v
+		}
+		if v, ok := request.Data["redirect_uri"].(string); ok {
+			redirectURI = v
+		}
+		if v, ok := request.Data["code_verifier"].(string); ok {
+			codeVerifier = v
+		}
+		if len(code) == 0 || len(codeVerifier) == 0 {
+			response.Error(global.ErrIncomplete, []string{"code", "code_verifier"})
+			return
+		}
+		ac := s.Worker().Model().Token.ConsumeAuthorizationCode(code)
+		if ac == nil || ac.AppID != appID || ac.RedirectURI != redirectURI {
+			response.Error(global.ErrInvalid, []string{"code"})
+			return
+		}
+		if !verifyCodeChallenge(ac.CodeChallenge, ac.CodeChallengeMethod, codeVerifier) {
+			response.Error(global.ErrInvalid, []string{"code_verifier"})
+			return
+		}
+		appToken = s.Worker().Model().Token.CreateScopedAppToken(ac.AccountID, ac.AppID, ac.Scopes)
+	case GrantTypeRefreshToken:
+		var refreshToken string
+		if v, ok := request.Data["refresh_token"].(string); ok {
+			refreshToken = v
+		}
+		if len(refreshToken) == 0 {
+			response.Error(global.ErrIncomplete, []string{"refresh_token"})
+			return
+		}
+		appToken = s.Worker().Model().Token.RefreshAppToken(appID, refreshToken)
+		if appToken == nil {
+			response.Error(global.ErrInvalid, []string{"refresh_token"})
+			return
+		}
+	default:
+		response.Error(global.ErrInvalid, []string{"grant_type"})
+		return
+	}
+	if appToken == nil {
+		response.Error(global.ErrUnknown, []string{"internal_error"})
+		return
+	}
+	response.OkWithData(tools.M{
+		"access_token":  appToken.ID,
+		"token_type":    "bearer",
+		"expires_in":    int(nested.AppTokenLifetime.Seconds()),
+		"refresh_token": appToken.RefreshToken,
+		"scope":         strings.Join(appToken.Scopes, " "),
+	})
+}
+
+// readAuthorizeRequest validates the app, its redirect uri and the requested scopes
+func (s *AppService) readAuthorizeRequest(request *rpc.Request, response *rpc.Response) (*nested.App, []string, bool) {
+	var appID, redirectURI, scope string
+	if v, ok := request.Data["app_id"].(string); ok {
+		appID = strings.TrimSpace(v)
+	}
+	if v, ok := request.Data["redirect_uri"].(string); ok {
+		redirectURI = v
+	}
+	if v, ok := request.Data["scope"].(string); ok {
+		scope = v
+	}
+	app := s.Worker().Model().App.GetByID(appID)
+	if app == nil {
+		response.Error(global.ErrInvalid, []string{"app_id"})
+		return nil, nil, false
+	}
+	// The apps must register their callback url and the redirect uri must match it exactly
+	if len(app.CallbackURL) == 0 || redirectURI != app.CallbackURL {
+		response.Error(global.ErrInvalid, []string{"redirect_uri"})
+		return nil, nil, false
+	}
+	scopes, ok := api.ParseScopes(scope)
+	if !ok || len(scopes) == 0 {
+		response.Error(global.ErrInvalid, []string{"scope"})
+		return nil, nil, false
+	}
+	sort.Strings(scopes)
+	return app, scopes, true
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the challenge
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if method != CodeChallengeMethodS256 || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	h := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(h[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
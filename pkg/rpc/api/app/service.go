@@ -10,15 +10,25 @@ const (
 	ServicePrefix = "app"
 )
 const (
-	CmdExists       = "app/exists"
-	CmdRegisterApp  = "app/register"
-	CmdRemoveApp    = "app/remove"
-	CmdGetMany      = "app/get_many"
-	CmdCreateToken  = "app/create_token"
-	CmdRevokeToken  = "app/revoke_token"
-	CmdGetTokens    = "app/get_tokens"
-	CmdHasToken     = "app/has_token"
-	CmdSetFavStatus = "app/set_fav_status"
+	CmdExists        = "app/exists"
+	CmdRegisterApp   = "app/register"
+	CmdRemoveApp     = "app/remove"
+	CmdGetMany       = "app/get_many"
+	CmdCreateToken   = "app/create_token"
+	CmdRevokeToken   = "app/revoke_token"
+	CmdGetTokens     = "app/get_tokens"
+	CmdHasToken      = "app/has_token"
+	CmdSetFavStatus  = "app/set_fav_status"
+	CmdAuthorizeInfo = "app/authorize_info"
+	CmdAuthorize     = "app/authorize"
+	CmdToken         = "app/token"
+)
+
+// OAuth2 Grant Types
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	CodeChallengeMethodS256    = "S256"
 )
 
 type AppService struct {
@@ -31,15 +41,18 @@ func NewAppService(worker *api.Worker) api.Service {
 	s.worker = worker
 
 	s.serviceCommands = api.ServiceCommands{
-		CmdCreateToken:  {MinAuthLevel: api.AuthLevelUser, Execute: s.generateAppToken},
-		CmdSetFavStatus: {MinAuthLevel: api.AuthLevelUser, Execute: s.setFavStatus},
-		CmdRevokeToken:  {MinAuthLevel: api.AuthLevelUser, Execute: s.revokeAppToken},
-		CmdGetTokens:    {MinAuthLevel: api.AuthLevelUser, Execute: s.getTokensByAccountID},
-		CmdRemoveApp:    {MinAuthLevel: api.AuthLevelAppL3, Execute: s.remove},
-		CmdGetMany:      {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getManyApps},
-		CmdExists:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.exists},
-		CmdRegisterApp:  {MinAuthLevel: api.AuthLevelAppL3, Execute: s.register},
-		CmdHasToken:     {MinAuthLevel: api.AuthLevelAppL1, Execute: s.hasToken},
+		CmdCreateToken:   {MinAuthLevel: api.AuthLevelUser, Execute: s.generateAppToken},
+		CmdSetFavStatus:  {MinAuthLevel: api.AuthLevelUser, Execute: s.setFavStatus},
+		CmdRevokeToken:   {MinAuthLevel: api.AuthLevelUser, Execute: s.revokeAppToken},
+		CmdGetTokens:     {MinAuthLevel: api.AuthLevelUser, Execute: s.getTokensByAccountID},
+		CmdRemoveApp:     {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeApps, Execute: s.remove},
+		CmdGetMany:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeApps, Execute: s.getManyApps},
+		CmdExists:        {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeApps, Execute: s.exists},
+		CmdRegisterApp:   {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeApps, Execute: s.register},
+		CmdHasToken:      {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeApps, Execute: s.hasToken},
+		CmdAuthorizeInfo: {MinAuthLevel: api.AuthLevelUser, Execute: s.authorizeInfo},
+		CmdAuthorize:     {MinAuthLevel: api.AuthLevelUser, Execute: s.authorize},
+		CmdToken:         {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.token},
 	}
 	return s
 }
@@ -51,7 +64,7 @@ func (s *AppService) GetServicePrefix() string {
 func (s *AppService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
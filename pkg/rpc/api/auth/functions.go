@@ -3,8 +3,8 @@ package nestedServiceAuth
 import (
 	"bytes"
 	"fmt"
-	"git.ronaksoft.com/nested/server/pkg/config"
 	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/password"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
 	"html/template"
@@ -42,13 +42,9 @@ func (s *AuthService) getPhoneVerificationCode(requester *nested.Account, reques
 		}
 	}
 	verification := s.Worker().Model().Verification.CreateByPhone(phone)
-
-	adp := NewADP(
-		config.GetString(config.ADPUsername),
-		config.GetString(config.ADPPassword),
-		config.GetString(config.ADPMessageUrl),
-	)
-	adp.SendSms(verification.Phone, "Nested verification code is: "+verification.ShortCode)
+	if verification.Phone != nested.TestPhoneNumber {
+		_ = s.Worker().SendVerificationCode(verification)
+	}
 	response.OkWithData(tools.M{
 		"vid":   verification.ID,
 		"phone": fmt.Sprintf("%s******%s", string(phone[:3]), string(phone[len(phone)-2:])),
@@ -129,13 +125,45 @@ func (s *AuthService) sendCodeByText(requester *nested.Account, request *rpc.Req
 	}
 	s.Worker().Model().Verification.IncrementSmsCounter(verification.ID)
 
-	if strings.HasPrefix(verification.Phone, "98") {
-		adp := NewADP(
-			config.GetString(config.ADPUsername),
-			config.GetString(config.ADPPassword),
-			config.GetString(config.ADPMessageUrl),
-		)
-		adp.SendSms(verification.Phone, "Nested verification code is: "+verification.ShortCode)
+	if err := s.Worker().SendVerificationCode(verification); err != nil {
+		response.Error(global.ErrUnavailable, []string{"sms"})
+		return
+	}
+	response.Ok()
+	return
+}
+
+// @Command:	auth/send_call
+// @CommandInfo:	calls the phone of the verification and reads the code, if any of the sms providers supports calls
+// @Input:	vid		string	*
+func (s *AuthService) sendCodeByCall(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var verification *nested.Verification
+	if v, ok := request.Data["vid"].(string); ok {
+		verification = s.Worker().Model().Verification.GetByID(v)
+		if verification == nil {
+			response.Error(global.ErrInvalid, []string{"vid"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"vid"})
+		return
+	}
+	if verification.Phone == nested.TestPhoneNumber {
+		return
+	}
+	if len(verification.Phone) == 0 {
+		response.Error(global.ErrInvalid, []string{"vid"})
+		return
+	}
+	if verification.Counters.Call > 2 {
+		response.Error(global.ErrLimit, []string{"no_more_call"})
+		return
+	}
+	s.Worker().Model().Verification.IncrementCallCounter(verification.ID)
+
+	if err := s.Worker().CallVerificationCode(verification); err != nil {
+		response.Error(global.ErrUnavailable, []string{"call"})
+		return
 	}
 	response.Ok()
 	return
@@ -143,7 +171,7 @@ func (s *AuthService) sendCodeByText(requester *nested.Account, request *rpc.Req
 
 // @Command:	auth/recover_pass
 // @Input:	vid			string	*
-// @Input:	new_pass	string	*
+// @Input:	new_pass	string	*	(plain password, the md5 digest of it is stored)
 func (s *AuthService) recoverPassword(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var verification *nested.Verification
 	var newPass string
@@ -160,7 +188,6 @@ func (s *AuthService) recoverPassword(requester *nested.Account, request *rpc.Re
 		}
 	}
 	if v, ok := request.Data["new_pass"].(string); ok {
-		// FIXME:: check password meet requirements
 		newPass = v
 	} else {
 		response.Error(global.ErrInvalid, []string{"new_pass"})
@@ -172,7 +199,11 @@ func (s *AuthService) recoverPassword(requester *nested.Account, request *rpc.Re
 	}
 	account := s.Worker().Model().Account.GetByPhone(verification.Phone, nil)
 	if account != nil {
-		s.Worker().Model().Account.SetPassword(account.ID, newPass)
+		if rules := s.Worker().CheckAccountPassword(account, newPass); len(rules) > 0 {
+			response.Error(global.ErrInvalid, append([]string{"new_pass"}, rules...))
+			return
+		}
+		s.Worker().Model().Account.SetPassword(account.ID, password.Digest(newPass))
 		response.Ok()
 	} else {
 		response.Error(global.ErrUnknown, []string{})
@@ -237,7 +268,7 @@ func (s *AuthService) phoneAvailable(requester *nested.Account, request *rpc.Req
 
 // @Command:	auth/register_user
 // @Input:	uid			string	*
-// @Input:	pass		string	*
+// @Input:	pass		string	*	(plain password, the md5 digest of it is stored)
 // @Input:	fname		string	*
 // @Input:	lname		string	*
 // @Input:	gender		string	+
@@ -343,13 +374,17 @@ func (s *AuthService) registerUserAccount(requester *nested.Account, request *rp
 		response.Error(global.ErrInvalid, []string{"fname", "lname"})
 		return
 	}
+	if rules := s.Worker().CheckPassword("", pass, uid, fname, lname); len(rules) > 0 {
+		response.Error(global.ErrInvalid, append([]string{"pass"}, rules...))
+		return
+	}
 
 	if verification.Phone == nested.TestPhoneNumber {
 		response.OkWithData(tools.M{"info": "This user does not actually created. You are using test phone"})
 		return
 	}
 
-	if !s.Worker().Model().Account.CreateUser(uid, pass, verification.Phone, country, fname, lname, email, dob, gender) {
+	if !s.Worker().Model().Account.CreateUser(uid, password.Digest(pass), verification.Phone, country, fname, lname, email, dob, gender) {
 		response.Error(global.ErrUnknown, []string{""})
 		return
 	}
@@ -14,6 +14,7 @@ const (
 	CmdGetEmailVerificationCode = "auth/get_email_verification"
 	CmdVerifyCode               = "auth/verify_code"
 	CmdSendCodeSms              = "auth/send_text"
+	CmdSendCodeCall             = "auth/send_call"
 	CmdRegisterUser             = "auth/register_user"
 	CmdRecoverPassword          = "auth/recover_pass"
 	CmdRecoverUsername          = "auth/recover_username"
@@ -34,6 +35,7 @@ func NewAuthService(worker *api.Worker) api.Service {
 		CmdGetEmailVerificationCode: {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.getEmailVerificationCode},
 		CmdVerifyCode:               {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.verifyCode},
 		CmdSendCodeSms:              {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.sendCodeByText},
+		CmdSendCodeCall:             {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.sendCodeByCall},
 		CmdRecoverPassword:          {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.recoverPassword},
 		CmdRecoverUsername:          {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.recoverUsername},
 		CmdPhoneAvailable:           {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.phoneAvailable},
@@ -50,7 +52,7 @@ func (s *AuthService) GetServicePrefix() string {
 func (s *AuthService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"sync"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/rpc"
+	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+)
+
+const (
+	CmdBatch = "batch"
+	// MaxBatchSize is the maximum number of the commands in a batch
+	MaxBatchSize = 25
+	// maxBatchParallel is the maximum number of the commands of a batch which run concurrently
+	maxBatchParallel = 5
+)
+
+// executeBatch runs the sub-requests of the batch with the authentication of the batch itself
+// and returns their responses in the same order. Each sub-request is a map of 'cmd', '_reqid'
+// and 'data'. Sub-requests fail or succeed independently.
+//
+// @Command:	batch
+// @Input:	requests	array	*	([{"_reqid": "1", "cmd": "account/get", "data": {}}, ...])
+// @Input:	parallel	bool	+
+func (sw *Worker) executeBatch(authLevel AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	items, ok := request.Data["requests"].([]interface{})
+	if !ok || len(items) == 0 {
+		response.Error(global.ErrIncomplete, []string{"requests"})
+		return
+	}
+	if len(items) > MaxBatchSize {
+		response.Error(global.ErrLimit, []string{"requests", fmt.Sprintf("%d", MaxBatchSize)})
+		return
+	}
+	parallel, _ := request.Data["parallel"].(bool)
+
+	responses := make([]*rpc.Response, len(items))
+	run := func(idx int) {
+		subRequest := sw.batchItem(request, idx, items[idx])
+		subResponse := &rpc.Response{
+			RequestID: subRequest.RequestID,
+			Format:    request.Format,
+		}
+		subResponse.NotImplemented()
+		switch subRequest.Command {
+		case "":
+			subResponse.Error(global.ErrInvalid, []string{"cmd"})
+		case CmdBatch:
+			subResponse.Error(global.ErrInvalid, []string{"nested_batch"})
+		default:
+			sw.executeCommand(authLevel, requester, subRequest, subResponse)
+		}
+		subResponse.RequestID = subRequest.RequestID
+		responses[idx] = subResponse
+	}
+
+	if parallel {
+		waitGroup := sync.WaitGroup{}
+		slots := make(chan struct{}, maxBatchParallel)
+		for idx := range items {
+			waitGroup.Add(1)
+			slots <- struct{}{}
+			go func(idx int) {
+				defer waitGroup.Done()
+				defer func() { <-slots }()
+				run(idx)
+			}(idx)
+		}
+		waitGroup.Wait()
+	} else {
+		for idx := range items {
+			run(idx)
+		}
+	}
+	response.OkWithData(tools.M{"responses": responses})
+}
+
+// batchItem builds the sub-request, it inherits the authentication and the client info of the batch
+func (sw *Worker) batchItem(batch *rpc.Request, idx int, item interface{}) *rpc.Request {
+	r := &rpc.Request{
+		Format:        batch.Format,
+		Type:          batch.Type,
+		RequestID:     fmt.Sprintf("%d", idx),
+		SessionKey:    batch.SessionKey,
+		SessionSec:    batch.SessionSec,
+		AppID:         batch.AppID,
+		AppToken:      batch.AppToken,
+		AppScopes:     batch.AppScopes,
+		ClientID:      batch.ClientID,
+		ClientVersion: batch.ClientVersion,
+		ClientIP:      batch.ClientIP,
+		UserAgent:     batch.UserAgent,
+		WebsocketID:   batch.WebsocketID,
+		Data:          tools.M{},
+	}
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return r
+	}
+	if v, ok := m["_reqid"].(string); ok && len(v) > 0 {
+		r.RequestID = v
+	}
+	r.Command, _ = m["cmd"].(string)
+	if data, ok := m["data"].(map[string]interface{}); ok {
+		r.Data = data
+	}
+	return r
+}
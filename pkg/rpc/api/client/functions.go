@@ -6,6 +6,7 @@ import (
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"strconv"
 	"strings"
 
 	"git.ronaksoft.com/nested/server/nested"
@@ -29,6 +30,7 @@ func (s *ClientService) getServerDetails(requester *nested.Account, request *rpc
 	r := tools.M{
 		"cyrus_id":         config.GetString(config.BundleID),
 		"server_timestamp": nested.Timestamp(),
+		"vapid_public_key": s.Worker().Pusher().WebPushPublicKey(),
 	}
 	response.OkWithData(r)
 
@@ -135,3 +137,40 @@ func (s *ClientService) removeKey(requester *nested.Account, request *rpc.Reques
 	s.Worker().Model().Account.RemoveKey(requester.ID, keyName)
 	response.Ok()
 }
+
+// @Command:	client/get_updates
+// @Input:	since		int		*
+// @CommandInfo:	returns the sync events which have been sent to the requester after the 'since' sequence.
+// @CommandInfo:	if some of them are not available anymore 'resync' is true and client must do a full resync.
+// @CommandInfo:	the events are logged once the 'sync_seq' of the account has been returned by session/recall
+func (s *ClientService) getUpdates(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var since int64
+	switch v := request.Data["since"].(type) {
+	case float64:
+		since = int64(v)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			response.Error(global.ErrInvalid, []string{"since"})
+			return
+		}
+		since = n
+	default:
+		response.Error(global.ErrIncomplete, []string{"since"})
+		return
+	}
+	if since < 0 {
+		response.Error(global.ErrInvalid, []string{"since"})
+		return
+	}
+	events, seq, resync, err := s.Worker().Pusher().GetUpdates(requester.ID, since)
+	if err != nil {
+		response.Error(global.ErrUnavailable, []string{})
+		return
+	}
+	response.OkWithData(tools.M{
+		"events": events,
+		"seq":    seq,
+		"resync": resync,
+	})
+}
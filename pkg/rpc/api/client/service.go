@@ -16,6 +16,7 @@ const (
 	CmdReadKey          = "client/read_key"
 	CmdRemoveKey        = "client/remove_key"
 	CmdGetAllKeys       = "client/get_all_keys"
+	CmdGetUpdates       = "client/get_updates"
 )
 
 type ClientService struct {
@@ -34,6 +35,7 @@ func NewClientService(worker *api.Worker) api.Service {
 		CmdRemoveKey:        {MinAuthLevel: api.AuthLevelUser, Execute: s.removeKey},
 		CmdGetAllKeys:       {MinAuthLevel: api.AuthLevelUser, Execute: s.getAllKeys},
 		CmdGetServerDetails: {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.getServerDetails},
+		CmdGetUpdates:       {MinAuthLevel: api.AuthLevelUser, Execute: s.getUpdates},
 	}
 
 	return s
@@ -46,7 +48,7 @@ func (s *ClientService) GetServicePrefix() string {
 func (s *ClientService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
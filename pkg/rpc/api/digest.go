@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/jaytaylor/html2text"
+	"go.uber.org/zap"
+	"gopkg.in/mail.v2"
+)
+
+const (
+	digestMaxItems = 20
+	// Tasks which their due date is in this window are listed as 'due soon'
+	digestDueSoonWindow = 48 * time.Hour
+)
+
+// Deep links of the web app
+const (
+	webAppPostURL          = "%s/#/message/%s"
+	webAppTaskURL          = "%s/#/task/edit/%s"
+	webAppPlaceURL         = "%s/#/places/%s/messages"
+	webAppNotificationsURL = "%s/#/notifications"
+)
+
+type Digest struct {
+	Name             string
+	Period           string
+	NotificationsURL string
+	Mentions         []DigestItem
+	Tasks            []DigestItem
+	Places           []DigestPlace
+}
+
+type DigestItem struct {
+	Title string
+	Text  string
+	URL   string
+}
+
+type DigestPlace struct {
+	Name    string
+	Unreads int
+	URL     string
+}
+
+func (d *Digest) Empty() bool {
+	return len(d.Mentions) == 0 && len(d.Tasks) == 0 && len(d.Places) == 0
+}
+
+var digestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Helvetica, Arial, sans-serif; color: #323d47; background: #f5f6f7; padding: 24px;">
+<div style="max-width: 600px; margin: auto; background: #fff; padding: 24px; border-radius: 4px;">
+	<h2 style="margin-top: 0;">Hi {{.Name}},</h2>
+	<p>Here is what you have missed in the last {{.Period}} on Nested.</p>
+	{{if .Mentions}}
+	<h3>Mentions</h3>
+	<ul>
+		{{range .Mentions}}<li><a href="{{.URL}}"><b>{{.Title}}</b></a><br/>{{.Text}}</li>{{end}}
+	</ul>
+	{{end}}
+	{{if .Tasks}}
+	<h3>Tasks</h3>
+	<ul>
+		{{range .Tasks}}<li><a href="{{.URL}}"><b>{{.Title}}</b></a> {{.Text}}</li>{{end}}
+	</ul>
+	{{end}}
+	{{if .Places}}
+	<h3>Unread Posts</h3>
+	<ul>
+		{{range .Places}}<li><a href="{{.URL}}">{{.Name}}</a>: {{.Unreads}}</li>{{end}}
+	</ul>
+	{{end}}
+	<p><a href="{{.NotificationsURL}}">Open Nested</a></p>
+	<p style="font-size: 12px; color: #8d959d;">You could change the email digest in the notification settings.</p>
+</div>
+</body>
+</html>`))
+
+// JobEmailDigest sends the daily/weekly email digests of the accounts which their schedule has come
+func JobEmailDigest(b *BackgroundJob) {
+	now := time.Now()
+	for _, settings := range b.Model().Notification.GetDigestSubscribers() {
+		scheduled := uint64(settings.Digest.Scheduled(now, settings.QuietHours.Timezone).UnixNano() / int64(time.Millisecond))
+		if scheduled <= settings.Digest.LastSent {
+			continue
+		}
+		if !b.Model().Notification.ClaimDigest(settings.AccountID, scheduled) {
+			continue
+		}
+		since := settings.Digest.LastSent
+		if min := uint64(now.Add(-settings.Digest.Period()).UnixNano() / int64(time.Millisecond)); since < min {
+			since = min
+		}
+		d := b.worker.Mailer().createDigest(&settings, since)
+		if d == nil || d.Empty() {
+			continue
+		}
+		b.worker.Mailer().SendDigest(settings.AccountID, d)
+	}
+}
+
+// createDigest collects the unread mentions, the tasks which have been assigned to the account or are
+// due soon and the unread posts of the bookmarked places
+func (m *Mailer) createDigest(settings *nested.NotificationSettings, since uint64) *Digest {
+	account := m.worker.Model().Account.GetByID(settings.AccountID, nil)
+	if account == nil || account.Disabled || len(account.Email) == 0 {
+		return nil
+	}
+	baseURL := config.GetString(config.WebAppBaseURL)
+	d := &Digest{
+		Name:             account.FirstName,
+		Period:           "day",
+		NotificationsURL: fmt.Sprintf(webAppNotificationsURL, baseURL),
+	}
+	if settings.Digest.Frequency == nested.DigestWeekly {
+		d.Period = "week"
+	}
+
+	// Mentions
+	if settings.Allowed(nested.NotificationTypeMention, nested.NotificationChannelEmailDigest) {
+		mentions := m.worker.Model().Notification.GetUnreadByTypes(
+			account.ID,
+			[]int{nested.NotificationTypeMention, nested.NotificationTypeTaskMention},
+			since, digestMaxItems,
+		)
+		for _, n := range mentions {
+			actorName := n.ActorID
+			if actor := m.worker.Model().Account.GetByID(n.ActorID, nil); actor != nil {
+				actorName = fmt.Sprintf("%s %s", actor.FirstName, actor.LastName)
+			}
+			item := DigestItem{Text: fmt.Sprintf("%s mentioned you", actorName)}
+			switch n.Type {
+			case nested.NotificationTypeTaskMention:
+				item.Title = n.Data.TaskTitle
+				item.URL = fmt.Sprintf(webAppTaskURL, baseURL, n.TaskID.Hex())
+			default:
+				if post := m.worker.Model().Post.GetPostByID(n.PostID); post != nil {
+					item.Title = post.Subject
+				}
+				item.URL = fmt.Sprintf(webAppPostURL, baseURL, n.PostID.Hex())
+			}
+			if len(item.Title) == 0 {
+				item.Title = "(no subject)"
+			}
+			d.Mentions = append(d.Mentions, item)
+		}
+	}
+
+	// Tasks
+	assigned := settings.Allowed(nested.NotificationTypeTaskAssigned, nested.NotificationChannelEmailDigest)
+	dueSoon := settings.Allowed(nested.NotificationTypeTaskOverDue, nested.NotificationChannelEmailDigest)
+	if assigned || dueSoon {
+		dueLimit := uint64(time.Now().Add(digestDueSoonWindow).UnixNano() / int64(time.Millisecond))
+		tasks := m.worker.Model().Task.GetUpcomingTasks(account.ID, nested.NewPagination(0, 100, 0, 0))
+		for _, task := range tasks {
+			var text string
+			switch {
+			case dueSoon && task.DueDate > 0 && task.DueDate <= dueLimit:
+				text = fmt.Sprintf("is due %s", time.Unix(0, int64(task.DueDate)*int64(time.Millisecond)).Format("Mon, 02 Jan 15:04 MST"))
+			case assigned && task.Timestamp > since:
+				text = "has been assigned to you"
+			default:
+				continue
+			}
+			d.Tasks = append(d.Tasks, DigestItem{
+				Title: task.Title,
+				Text:  text,
+				URL:   fmt.Sprintf(webAppTaskURL, baseURL, task.ID.Hex()),
+			})
+			if len(d.Tasks) >= digestMaxItems {
+				break
+			}
+		}
+	}
+
+	// Unread posts of the bookmarked places
+	for _, placeID := range account.BookmarkedPlaceIDs {
+		unreads := m.worker.Model().Place.CountUnreadPosts([]string{placeID}, account.ID)
+		if unreads == 0 {
+			continue
+		}
+		name := placeID
+		if place := m.worker.Model().Place.GetByID(placeID, nil); place != nil {
+			name = place.Name
+		}
+		d.Places = append(d.Places, DigestPlace{
+			Name:    name,
+			Unreads: unreads,
+			URL:     fmt.Sprintf(webAppPlaceURL, baseURL, placeID),
+		})
+	}
+	return d
+}
+
+// SendDigest sends the digest to the email address of the account
+func (m *Mailer) SendDigest(accountID string, d *Digest) {
+	account := m.worker.Model().Account.GetByID(accountID, nil)
+	if account == nil || len(account.Email) == 0 {
+		return
+	}
+	body := new(bytes.Buffer)
+	if err := digestTemplate.Execute(body, d); err != nil {
+		log.Warn("got error on executing digest template", zap.Error(err))
+		return
+	}
+	bodyText, err := html2text.FromString(body.String())
+	if err != nil {
+		log.Warn("got error on converting digest to text", zap.Error(err))
+		return
+	}
+
+	msg := mail.NewMessage(
+		mail.SetEncoding(mail.Base64),
+		mail.SetCharset("UTF-8"),
+	)
+	msg.SetHeader("Message-ID", fmt.Sprintf("<%s@%s>", nested.RandomID(32), m.domain))
+	msg.SetHeader("From", msg.FormatAddress(fmt.Sprintf("no-reply@%s", m.domain), "Nested"))
+	msg.SetHeader("To", msg.FormatAddress(account.Email, fmt.Sprintf("%s %s", account.FirstName, account.LastName)))
+	msg.SetHeader("Date", msg.FormatDate(time.Now()))
+	msg.SetHeader("Subject", fmt.Sprintf("Your Nested %s digest", d.Period))
+	msg.SetHeader("Auto-Submitted", "auto-generated")
+	msg.SetBody("text/plain", bodyText)
+	msg.AddAlternative("text/html", body.String())
+
+	m.SendRequest(MailRequest{Message: msg})
+}
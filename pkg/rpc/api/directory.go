@@ -0,0 +1,249 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/ldap"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Authentication Backends
+const (
+	AuthBackendLocal = "local"
+	AuthBackendLDAP  = "ldap"
+)
+
+// Group Map Targets
+const (
+	GroupMapPlace = "place"
+	GroupMapLabel = "label"
+)
+
+// directorySyncLock makes sure only one instance of the api syncs the directory at a time
+const directorySyncLock = "directory-sync:lock"
+
+// GroupMapping adds the members of the directory group to the place or the label
+type GroupMapping struct {
+	Group    string
+	Target   string
+	TargetID string
+}
+
+// ParseGroupMap parses the mappings in the format of 'group:place:placeID;group:label:labelID'
+func ParseGroupMap(s string) []GroupMapping {
+	mappings := make([]GroupMapping, 0)
+	for _, item := range strings.Split(s, ";") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 3 {
+			continue
+		}
+		m := GroupMapping{
+			Group:    strings.TrimSpace(parts[0]),
+			Target:   strings.ToLower(strings.TrimSpace(parts[1])),
+			TargetID: strings.TrimSpace(parts[2]),
+		}
+		switch m.Target {
+		case GroupMapPlace, GroupMapLabel:
+		default:
+			continue
+		}
+		if len(m.Group) == 0 || len(m.TargetID) == 0 {
+			continue
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings
+}
+
+// newDirectory returns the ldap directory of the config or nil if it has not been configured
+func newDirectory() *ldap.Directory {
+	if len(config.GetString(config.LdapURL)) == 0 {
+		return nil
+	}
+	return ldap.NewDirectory(ldap.DirectoryConfig{
+		URL:           config.GetString(config.LdapURL),
+		BindDN:        config.GetString(config.LdapBindDN),
+		BindPassword:  config.GetString(config.LdapBindPassword),
+		BaseDN:        config.GetString(config.LdapBaseDN),
+		UserFilter:    config.GetString(config.LdapUserFilter),
+		SyncFilter:    config.GetString(config.LdapSyncFilter),
+		AttrUID:       config.GetString(config.LdapAttrUID),
+		AttrFirstName: config.GetString(config.LdapAttrFirstName),
+		AttrLastName:  config.GetString(config.LdapAttrLastName),
+		AttrEmail:     config.GetString(config.LdapAttrEmail),
+		AttrGroups:    config.GetString(config.LdapAttrGroups),
+	})
+}
+
+// authBackends returns the enabled backends in their order
+func (sw *Worker) authBackends() []string {
+	backends := make([]string, 0, 2)
+	for _, b := range strings.Split(config.GetString(config.AuthBackend), ",") {
+		switch b = strings.ToLower(strings.TrimSpace(b)); b {
+		case AuthBackendLDAP:
+			if sw.directory != nil {
+				backends = append(backends, b)
+			}
+		case AuthBackendLocal:
+			backends = append(backends, b)
+		}
+	}
+	if len(backends) == 0 {
+		backends = append(backends, AuthBackendLocal)
+	}
+	return backends
+}
+
+// Authenticate checks the password of the account with the authentication backends and returns the
+// account if it matches. The users of the directory which do not have an account yet are created
+// on their first login. The accounts of the directory never log in by their local passwords.
+func (sw *Worker) Authenticate(uid, pass string) *nested.Account {
+	for _, backend := range sw.authBackends() {
+		switch backend {
+		case AuthBackendLDAP:
+			u, err := sw.directory.Authenticate(uid, pass)
+			if err != nil {
+				if !ldap.IsInvalidCredentials(err) {
+					log.Warn("got error on authenticating by ldap", zap.Error(err), zap.String("UID", uid))
+				}
+				continue
+			}
+			if account := sw.syncDirectoryAccount(*u); account != nil {
+				return account
+			}
+		case AuthBackendLocal:
+			if sw.Model().Directory.Get(uid) != nil {
+				continue
+			}
+			if sw.Model().Account.Verify(uid, pass) {
+				return sw.Model().Account.GetByID(uid, nil)
+			}
+		}
+	}
+	return nil
+}
+
+// IsDirectoryAccount returns TRUE if the account is managed by the directory, hence its password
+// could not be changed in Nested
+func (sw *Worker) IsDirectoryAccount(accountID string) bool {
+	return sw.directory != nil && sw.Model().Directory.Get(accountID) != nil
+}
+
+// syncDirectoryAccount creates the account of the user if it does not exist and updates its profile
+// and its groups otherwise. It returns nil if the account could not be created.
+func (sw *Worker) syncDirectoryAccount(u ldap.User) *nested.Account {
+	account := sw.Model().Account.GetByID(u.UID, nil)
+	if account == nil {
+		if sw.Model().Place.Exists(u.UID) || !sw.createExternalAccount(u.UID, u.FirstName, u.LastName, u.Email) {
+			return nil
+		}
+	} else {
+		// accounts which have been created locally are not taken over by the directory
+		da := sw.Model().Directory.Get(u.UID)
+		if da == nil {
+			return nil
+		}
+		aur := nested.AccountUpdateRequest{}
+		if u.FirstName != account.FirstName {
+			aur.FirstName = u.FirstName
+		}
+		if u.LastName != account.LastName {
+			aur.LastName = u.LastName
+		}
+		if u.Email != account.Email && !sw.Model().Account.EmailExists(u.Email) {
+			aur.Email = u.Email
+		}
+		if aur != (nested.AccountUpdateRequest{}) {
+			sw.Model().Account.Update(u.UID, aur)
+		}
+		// only the accounts which have been disabled by the sync are enabled again
+		if da.Disabled && account.Disabled {
+			if !sw.licenseAllowsUser() || !sw.Model().Account.Enable(u.UID) {
+				return nil
+			}
+		}
+	}
+	sw.Model().Directory.Save(u.UID, u.DN)
+	sw.applyGroupMap(u)
+	return sw.Model().Account.GetByID(u.UID, nil)
+}
+
+// applyGroupMap adds the account to the places and the labels of its groups. Memberships are only
+// added, they are never removed by the directory.
+func (sw *Worker) applyGroupMap(u ldap.User) {
+	for _, m := range ParseGroupMap(config.GetString(config.LdapGroupMap)) {
+		if !hasGroup(u.Groups, m.Group) {
+			continue
+		}
+		switch m.Target {
+		case GroupMapPlace:
+			sw.joinPlace(m.TargetID, u.UID)
+		case GroupMapLabel:
+			label := sw.Model().Label.GetByID(m.TargetID)
+			if label == nil || hasGroup(label.Members, u.UID) {
+				continue
+			}
+			sw.Model().Label.AddMembers(label.ID, []string{u.UID})
+		}
+	}
+}
+
+// JobDirectorySync creates and updates the accounts of the users of the directory and disables the
+// accounts which are not in the directory anymore. If the directory could not be read or returns
+// no user at all, no account is disabled.
+func JobDirectorySync(b *BackgroundJob) {
+	sw := b.worker
+	if sw.directory == nil {
+		return
+	}
+	c := b.Model().Cache().Pool.Get()
+	defer c.Close()
+	if _, err := redis.String(c.Do("SET", directorySyncLock, config.GetString(config.BundleID), "NX", "EX", 600)); err != nil {
+		return
+	}
+	defer func() { _, _ = c.Do("DEL", directorySyncLock) }()
+
+	startTime := time.Now()
+	users, err := sw.directory.Users()
+	if err != nil {
+		log.Warn("got error on reading the directory", zap.Error(err))
+		return
+	}
+	if len(users) == 0 {
+		log.Warn("directory returned no users, sync is skipped")
+		return
+	}
+	uids := make(map[string]struct{}, len(users))
+	for _, u := range users {
+		uids[u.UID] = struct{}{}
+		sw.syncDirectoryAccount(u)
+	}
+	disabled := 0
+	for _, da := range b.Model().Directory.GetAll() {
+		if _, ok := uids[da.ID]; ok || da.Disabled {
+			continue
+		}
+		b.Model().Account.Disable(da.ID)
+		b.Model().Directory.SetDisabled(da.ID)
+		disabled++
+	}
+	log.Info("directory synced",
+		zap.Int("Users", len(users)),
+		zap.Int("Disabled", disabled),
+		zap.Duration("Duration", time.Now().Sub(startTime)),
+	)
+}
+
+func hasGroup(groups []string, group string) bool {
+	for _, g := range groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
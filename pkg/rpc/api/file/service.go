@@ -27,11 +27,11 @@ func NewFileService(worker *api.Worker) api.Service {
 	s.worker = worker
 
 	s.serviceCommands = api.ServiceCommands{
-		FileCmdGetDownloadToken: {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getDownloadToken},
-		FileCmdGetUploadToken:   {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getUploadToken},
-		FileCmdGetFile:          {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getFileByID},
+		FileCmdGetDownloadToken: {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeFileRead, Execute: s.getDownloadToken},
+		FileCmdGetUploadToken:   {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeFileWrite, Execute: s.getUploadToken},
+		FileCmdGetFile:          {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeFileRead, Execute: s.getFileByID},
 		FileCmdGetByToken:       {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.getFileByToken},
-		FileCmdGetRecentFiles:   {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getRecentFiles},
+		FileCmdGetRecentFiles:   {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeFileRead, Execute: s.getRecentFiles},
 	}
 
 	return s
@@ -44,7 +44,7 @@ func (s *FileService) GetServicePrefix() string {
 func (s *FileService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+)
+
+// Login authenticates the account like Authenticate but it respects the lockouts of the account and
+// the client ip. If the account or the client ip is locked the remaining time of the lockout is
+// returned and the password is not checked at all. A zero threshold disables its lockout.
+// The failures of the account are not reset until its second factor, if it has one, is checked by
+// CheckTwoFactor.
+func (sw *Worker) Login(uid, pass, addr string) (*nested.Account, time.Duration) {
+	ip := clientIP(addr)
+	if wait := sw.lockoutRemaining(uid, ip); wait > 0 {
+		return nil, wait
+	}
+
+	account := sw.Authenticate(uid, pass)
+	if account == nil {
+		sw.loginFailed(uid, ip)
+		return nil, 0
+	}
+	if !account.Flags.TwoFactor {
+		sw.Model().Lockout.Reset(nested.LockoutAccount, account.ID)
+		if account.ID != uid {
+			sw.Model().Lockout.Reset(nested.LockoutAccount, uid)
+		}
+	}
+	return account, 0
+}
+
+// VerifyPassword checks the password of the account, the failures are counted against the account
+// and the client ip as the failed logins are.
+func (sw *Worker) VerifyPassword(accountID, pass, addr string) bool {
+	ip := clientIP(addr)
+	if sw.lockoutRemaining(accountID, ip) > 0 {
+		return false
+	}
+	account := sw.Authenticate(accountID, pass)
+	if account == nil || account.ID != accountID {
+		sw.loginFailed(accountID, ip)
+		return false
+	}
+	if !account.Flags.TwoFactor {
+		sw.Model().Lockout.Reset(nested.LockoutAccount, accountID)
+	}
+	return true
+}
+
+// CheckTwoFactor checks the code like VerifyTwoFactor but the wrong codes are counted against the
+// account and the client ip as the failed logins are. If the account or the client ip is locked
+// the remaining time of the lockout is returned and the code is not checked at all.
+func (sw *Worker) CheckTwoFactor(accountID, code, addr string) (bool, time.Duration) {
+	ip := clientIP(addr)
+	if wait := sw.lockoutRemaining(accountID, ip); wait > 0 {
+		return false, wait
+	}
+	if !sw.VerifyTwoFactor(accountID, code) {
+		sw.loginFailed(accountID, ip)
+		return false, 0
+	}
+	sw.Model().Lockout.Reset(nested.LockoutAccount, accountID)
+	return true, 0
+}
+
+// lockoutRemaining returns the longest remaining lockout of the account and the client ip
+func (sw *Worker) lockoutRemaining(accountID, ip string) time.Duration {
+	var wait time.Duration
+	if global.DefaultLockoutThreshold > 0 {
+		wait = sw.Model().Lockout.Get(nested.LockoutAccount, accountID).Remaining()
+	}
+	if len(ip) > 0 && global.DefaultLockoutIPThreshold > 0 {
+		if w := sw.Model().Lockout.Get(nested.LockoutIP, ip).Remaining(); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// loginFailed counts the failed login of the account and the client ip, the owner of the account
+// is notified when the account gets locked
+func (sw *Worker) loginFailed(accountID, ip string) {
+	duration := time.Duration(global.DefaultLockoutDuration) * time.Second
+	maxDuration := time.Duration(global.DefaultLockoutMaxDuration) * time.Second
+	if maxDuration < duration {
+		maxDuration = duration
+	}
+	if len(ip) > 0 && global.DefaultLockoutIPThreshold > 0 {
+		sw.Model().Lockout.Fail(nested.LockoutIP, ip, global.DefaultLockoutIPThreshold, duration, maxDuration)
+	}
+	if global.DefaultLockoutThreshold > 0 {
+		l := sw.Model().Lockout.Fail(nested.LockoutAccount, accountID, global.DefaultLockoutThreshold, duration, maxDuration)
+		if l.Failures == 0 && l.Locked() && sw.Model().Account.Exists(accountID) {
+			sw.Pusher().LoginLocked(accountID, ip)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"git.ronaksoft.com/nested/server/nested"
 	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/ical"
 	"git.ronaksoft.com/nested/server/pkg/log"
 	"github.com/dustin/go-humanize"
 	"github.com/globalsign/mgo/bson"
@@ -24,6 +25,8 @@ type MailRequest struct {
 	Username string
 	Password string
 	PostID   bson.ObjectId
+	// Message if set will be sent as is, otherwise the message is created from the post
+	Message *mail.Message
 }
 
 type MailTemplate struct {
@@ -101,7 +104,11 @@ func (m *Mailer) Run() {
 			ServerName:         config.GetString(config.SenderDomain),
 		}
 
-		if msg := m.createMessage(req.PostID); msg != nil {
+		msg := req.Message
+		if msg == nil {
+			msg = m.createMessage(req.PostID)
+		}
+		if msg != nil {
 			if err := d.DialAndSend(msg); err != nil {
 				log.Warn("failed to send email",
 					zap.Error(err),
@@ -215,6 +222,54 @@ func (m *Mailer) createMessage(postID bson.ObjectId) *mail.Message {
 	return msg
 }
 
+// SendCalendarReply sends the iTIP REPLY of the attendee to the organizer of the invite
+func (m *Mailer) SendCalendarReply(invite *nested.CalendarInvite, attendee nested.CalendarAttendee) {
+	ev := ical.Event{
+		UID:       invite.UID,
+		Sequence:  invite.Sequence,
+		Summary:   invite.Summary,
+		AllDay:    invite.AllDay,
+		Organizer: ical.Person{Email: invite.OrganizerEmail, Name: invite.OrganizerName},
+	}
+	if invite.Start > 0 {
+		ev.Start = time.Unix(0, int64(invite.Start)*int64(time.Millisecond))
+	}
+	replier := ical.Attendee{
+		Person:   ical.Person{Email: attendee.Email, Name: attendee.Name},
+		PartStat: attendee.Status,
+	}
+
+	var verb string
+	switch attendee.Status {
+	case nested.CalendarStatusAccepted:
+		verb = "Accepted"
+	case nested.CalendarStatusDeclined:
+		verb = "Declined"
+	case nested.CalendarStatusTentative:
+		verb = "Tentatively Accepted"
+	default:
+		verb = "Updated"
+	}
+
+	msg := mail.NewMessage(
+		mail.SetEncoding(mail.Base64),
+		mail.SetCharset("UTF-8"),
+	)
+	msg.SetHeader("Message-ID", fmt.Sprintf("<%s@%s>", nested.RandomID(32), m.domain))
+	msg.SetHeader("From", msg.FormatAddress(attendee.Email, attendee.Name))
+	msg.SetHeader("To", msg.FormatAddress(invite.OrganizerEmail, invite.OrganizerName))
+	msg.SetHeader("Date", msg.FormatDate(time.Now()))
+	msg.SetHeader("Subject", fmt.Sprintf("%s: %s", verb, invite.Summary))
+	name := attendee.Name
+	if len(name) == 0 {
+		name = attendee.Email
+	}
+	msg.SetBody("text/plain", fmt.Sprintf("%s has %s the invitation: %s", name, strings.ToLower(verb), invite.Summary))
+	msg.AddAlternative("text/calendar; method=REPLY", string(ical.Reply(ev, replier)))
+
+	m.SendRequest(MailRequest{Message: msg})
+}
+
 func (m *Mailer) fileGroup(info *nested.FileInfo) string {
 	switch info.Type {
 	case nested.FileTypeAudio, nested.FileTypeVideo:
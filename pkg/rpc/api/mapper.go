@@ -269,6 +269,10 @@ func (m *Mapper) Notification(requester *nested.Account, n nested.Notification)
 		}
 	case nested.NotificationTypeNewSession:
 		r["client_id"] = n.ClientID
+		r["session_id"] = n.Data.SessionID
+		r["device"] = n.Data.Text
+	case nested.NotificationTypeLoginLocked:
+		r["client_ip"] = n.Data.Text
 	case nested.NotificationTypeTaskRejected, nested.NotificationTypeTaskAccepted,
 		nested.NotificationTypeTaskCompleted, nested.NotificationTypeTaskAddToCandidates,
 		nested.NotificationTypeTaskAddToWatchers, nested.NotificationTypeTaskUpdated,
@@ -291,6 +295,27 @@ func (m *Mapper) Notification(requester *nested.Account, n nested.Notification)
 	return r
 }
 
+// PersonalToken maps the token without its secret, which is only returned when it is created
+func (m *Mapper) PersonalToken(t nested.PersonalToken) tools.M {
+	r := tools.M{
+		"_id":        t.ID,
+		"account_id": t.AccountID,
+		"name":       t.Name,
+		"hint":       t.Hint,
+		"scopes":     t.Scopes,
+		"created_on": t.CreatedOn,
+		"expired":    !t.Active(),
+	}
+	if t.ExpireOn > 0 {
+		r["expire_on"] = t.ExpireOn
+	}
+	if t.LastUsedOn > 0 {
+		r["last_used_on"] = t.LastUsedOn
+		r["last_used_ip"] = t.LastUsedIP
+	}
+	return r
+}
+
 func (m *Mapper) Place(requester *nested.Account, place nested.Place, access tools.MB) tools.M {
 	if access == nil {
 		return tools.M{
@@ -818,7 +843,11 @@ func (m *Mapper) App(app nested.App) tools.M {
 
 func (m *Mapper) AppToken(appToken nested.AppToken) tools.M {
 	r := tools.M{
-		"_id": appToken.ID,
+		"_id":    appToken.ID,
+		"scopes": GrantedScopes(appToken),
+	}
+	if appToken.ExpireOn > 0 {
+		r["expire_on"] = appToken.ExpireOn
 	}
 	if account := m.worker.Model().Account.GetByID(appToken.AccountID, nil); account != nil {
 		r["account"] = m.Account(*account, false)
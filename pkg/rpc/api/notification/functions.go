@@ -1,6 +1,7 @@
 package nestedServiceNotification
 
 import (
+	"encoding/json"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
@@ -113,12 +114,10 @@ func (s *NotificationService) markNotificationAsReadByPost(requester *nested.Acc
 		return
 	}
 	notificationIDs := s.Worker().Model().Notification.MarkAsReadByPostID(post.ID, requester.ID)
-	for _, notificationID := range notificationIDs {
-		notification := s.Worker().Model().Notification.GetByID(notificationID)
-		if notification != nil && notification.AccountID == requester.ID {
-			s.Worker().Model().Notification.MarkAsRead(notificationID, requester.ID)
-			go s.Worker().Pusher().ClearNotification(requester, notification)
-		}
+
+	// Clear the post and its notifications on the other devices of the requester
+	if len(notificationIDs) > 0 {
+		go s.Worker().Pusher().ExternalPushPostRead(requester.ID, post.ID, notificationIDs)
 	}
 	response.Ok()
 }
@@ -134,6 +133,7 @@ func (s *NotificationService) removeNotification(requester *nested.Account, requ
 				s.Worker().Model().Notification.Remove(nid)
 			}
 		}
+		go s.Worker().Pusher().ExternalPushBadge(requester.ID)
 		response.Ok()
 	} else {
 		response.Error(global.ErrInvalid, []string{"notification_id"})
@@ -160,3 +160,97 @@ func (s *NotificationService) getNotificationCounter(requester *nested.Account,
 	}
 	return
 }
+
+// @Command:	notification/get_settings
+// @CommandInfo:	Returns the notification preferences of the requester per category and channel, and the quiet hours
+func (s *NotificationService) getNotificationSettings(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	response.OkWithData(tools.M{
+		"settings":   s.Worker().Model().Notification.GetSettings(requester.ID),
+		"categories": nested.NotificationCategories,
+		"channels":   nested.NotificationChannels,
+	})
+}
+
+// @Command:	notification/set_settings
+// @Input:	categories		string	+	(json) i.e. {"mention": {"mobile_push": false, "email_digest": true}}
+// @Input:	quiet_hours		bool	+
+// @Input:	quiet_start		string	+	(HH:MM)
+// @Input:	quiet_end		string	+	(HH:MM)
+// @Input:	timezone		string	+	(IANA name) i.e. Asia/Tehran
+// @Input:	digest			bool	+	(email digest)
+// @Input:	digest_frequency	string	+	(daily | weekly)
+// @Input:	digest_hour		int		+	(0 - 23)
+// @Input:	digest_weekday	int		+	(0: Sunday - 6: Saturday)
+func (s *NotificationService) setNotificationSettings(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	settings := s.Worker().Model().Notification.GetSettings(requester.ID)
+	if v, ok := request.Data["categories"].(string); ok {
+		categories := map[string]map[string]bool{}
+		if err := json.Unmarshal([]byte(v), &categories); err != nil {
+			response.Error(global.ErrInvalid, []string{"categories"})
+			return
+		}
+		for category, channels := range categories {
+			if !inArray(nested.NotificationCategories, category) {
+				response.Error(global.ErrInvalid, []string{"categories", category})
+				return
+			}
+			for channel, enabled := range channels {
+				if !inArray(nested.NotificationChannels, channel) {
+					response.Error(global.ErrInvalid, []string{"categories", channel})
+					return
+				}
+				settings.Set(category, channel, enabled)
+			}
+		}
+	}
+	if v, ok := request.Data["quiet_hours"].(bool); ok {
+		settings.QuietHours.Enabled = v
+	}
+	if v, ok := request.Data["quiet_start"].(string); ok {
+		settings.QuietHours.Start = v
+	}
+	if v, ok := request.Data["quiet_end"].(string); ok {
+		settings.QuietHours.End = v
+	}
+	if v, ok := request.Data["timezone"].(string); ok {
+		settings.QuietHours.Timezone = v
+	}
+	if err := settings.QuietHours.Validate(); err != nil {
+		response.Error(global.ErrInvalid, []string{"quiet_hours"})
+		return
+	}
+	if v, ok := request.Data["digest"].(bool); ok {
+		if v && !settings.Digest.Enabled {
+			// The first digest will be sent on the next schedule
+			settings.Digest.LastSent = nested.Timestamp()
+		}
+		settings.Digest.Enabled = v
+	}
+	if v, ok := request.Data["digest_frequency"].(string); ok {
+		settings.Digest.Frequency = v
+	}
+	if v, ok := request.Data["digest_hour"].(float64); ok {
+		settings.Digest.Hour = int(v)
+	}
+	if v, ok := request.Data["digest_weekday"].(float64); ok {
+		settings.Digest.Weekday = int(v)
+	}
+	if err := settings.Digest.Validate(); err != nil {
+		response.Error(global.ErrInvalid, []string{"digest"})
+		return
+	}
+	if !s.Worker().Model().Notification.SaveSettings(requester.ID, settings) {
+		response.Error(global.ErrUnknown, []string{})
+		return
+	}
+	response.OkWithData(tools.M{"settings": settings})
+}
+
+func inArray(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -17,6 +17,8 @@ const (
 	CmdRemove           = "notification/remove"
 	CmdResetCounter     = "notification/reset_counter"
 	CmdGetCounter       = "notification/get_counter"
+	CmdGetSettings      = "notification/get_settings"
+	CmdSetSettings      = "notification/set_settings"
 )
 
 type NotificationService struct {
@@ -36,6 +38,8 @@ func NewNotificationService(worker *api.Worker) api.Service {
 		CmdRemove:           {MinAuthLevel: api.AuthLevelUser, Execute: s.removeNotification},
 		CmdResetCounter:     {MinAuthLevel: api.AuthLevelUser, Execute: s.resetNotificationCounter},
 		CmdGetCounter:       {MinAuthLevel: api.AuthLevelUser, Execute: s.getNotificationCounter},
+		CmdGetSettings:      {MinAuthLevel: api.AuthLevelUser, Execute: s.getNotificationSettings},
+		CmdSetSettings:      {MinAuthLevel: api.AuthLevelUser, Execute: s.setNotificationSettings},
 	}
 
 	return s
@@ -48,7 +52,7 @@ func (s *NotificationService) GetServicePrefix() string {
 func (s *NotificationService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
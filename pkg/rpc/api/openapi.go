@@ -0,0 +1,12 @@
+package api
+
+import (
+	_ "embed"
+)
+
+// OpenAPISpec is the OpenAPI 3 document of the HTTP gateway (/api/v1/{service}/{command}). It is
+// generated by cmd/cli-api/tools/doc-gen from the annotations of the services, run the tool in
+// this directory after changing any of them.
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"git.ronaksoft.com/nested/server/pkg/password"
+	"go.uber.org/zap"
+)
+
+// newBreachedList returns the breached passwords of the config or nil if it has not been configured
+func newBreachedList() *password.BreachedList {
+	dir := config.GetString(config.BreachedPasswords)
+	if len(dir) == 0 {
+		return nil
+	}
+	l, err := password.NewBreachedList(dir)
+	if err != nil {
+		log.Warn("got error on loading the breached passwords", zap.Error(err))
+		return nil
+	}
+	return l
+}
+
+// CheckPassword returns the rules of the password policy which the new plain password violates, the
+// result is empty if the password is acceptable. accountID is empty for the new accounts and info
+// are the username and the names of the account. The digests which the hashing clients send could
+// not be checked and are rejected, the accepted passwords are stored by their digests (password.Digest)
+// since the clients log in by them.
+func (sw *Worker) CheckPassword(accountID, pass string, info ...string) []string {
+	p := password.Policy{
+		MinLength:     global.DefaultPasswordMinLength,
+		MinClasses:    global.DefaultPasswordMinClasses,
+		NoAccountInfo: global.DefaultPasswordNoAccountInfo == 1,
+	}
+	rules := p.Check(pass, info...)
+	if password.IsDigest(pass) {
+		return rules
+	}
+	if len(accountID) > 0 && sw.Model().Account.PasswordUsed(accountID, password.Digest(pass), global.DefaultPasswordHistory) {
+		rules = append(rules, password.RuleReused)
+	}
+	if sw.breached != nil {
+		if breached, err := sw.breached.Contains(pass); err != nil {
+			log.Warn("got error on checking the breached passwords", zap.Error(err))
+		} else if breached {
+			rules = append(rules, password.RuleBreached)
+		}
+	}
+	return rules
+}
+
+// CheckAccountPassword checks the new password of the existing account
+func (sw *Worker) CheckAccountPassword(account *nested.Account, pass string) []string {
+	return sw.CheckPassword(account.ID, pass, account.ID, account.FirstName, account.LastName)
+}
+
+// JobPasswordExpiry forces the accounts to change their passwords when they are older than the
+// maximum age. The accounts of the directory are excluded since their passwords are not managed here.
+func JobPasswordExpiry(b *BackgroundJob) {
+	if global.DefaultPasswordMaxAge <= 0 {
+		return
+	}
+	excludedIDs := make([]string, 0)
+	for _, da := range b.Model().Directory.GetAll() {
+		excludedIDs = append(excludedIDs, da.ID)
+	}
+	maxAge := time.Duration(global.DefaultPasswordMaxAge) * 24 * time.Hour
+	before := nested.Timestamp() - uint64(maxAge.Milliseconds())
+	if n := b.Model().Account.ExpirePasswords(before, excludedIDs); n > 0 {
+		log.Info("passwords expired", zap.Int("Accounts", n))
+	}
+}
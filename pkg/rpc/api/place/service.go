@@ -69,23 +69,23 @@ func NewPlaceService(worker *api.Worker) api.Service {
 		CmdAvailable:           {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.placeIDAvailable},
 		CmdCountUnreadPosts:    {MinAuthLevel: api.AuthLevelUser, Execute: s.countPlaceUnreadPosts},
 		CmdDemoteMember:        {MinAuthLevel: api.AuthLevelUser, Execute: s.demoteMember},
-		CmdGet:                 {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlaceInfo},
-		CmdGetAccess:           {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlaceAccess},
-		CmdGetActivities:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlaceActivities},
+		CmdGet:                 {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getPlaceInfo},
+		CmdGetAccess:           {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getPlaceAccess},
+		CmdGetActivities:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getPlaceActivities},
 		CmdGetBlockedAddresses: {MinAuthLevel: api.AuthLevelUser, Execute: s.getBlockedAddresses},
 		CmdGetCreators:         {MinAuthLevel: api.AuthLevelUser, Execute: s.getPlaceCreators},
-		CmdGetFiles:            {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlaceFiles},
+		CmdGetFiles:            {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopeFileRead, Execute: s.getPlaceFiles},
 		CmdGetKeyHolders:       {MinAuthLevel: api.AuthLevelUser, Execute: s.getPlaceKeyholders},
-		CmdGetMany:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getManyPlacesInfo},
+		CmdGetMany:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getManyPlacesInfo},
 		CmdGetMembers:          {MinAuthLevel: api.AuthLevelUser, Execute: s.getPlaceMembers},
-		CmdGetMutualPlaces:     {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getMutualPlaces},
+		CmdGetMutualPlaces:     {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getMutualPlaces},
 		CmdGetNotification:     {MinAuthLevel: api.AuthLevelUser, Execute: s.getPlaceNotification},
-		CmdGetPosts:            {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlacePosts},
-		CmdGetSubPlaces:        {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getSubPlaces},
+		CmdGetPosts:            {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getPlacePosts},
+		CmdGetSubPlaces:        {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceRead, Execute: s.getSubPlaces},
 		CmdInviteMember:        {MinAuthLevel: api.AuthLevelUser, Execute: s.invitePlaceMember},
 		CmdLeave:               {MinAuthLevel: api.AuthLevelUser, Execute: s.leavePlace},
-		CmdMarkAllRead:         {MinAuthLevel: api.AuthLevelAppL3, Execute: s.markAllPostsAsRead},
-		CmdPinPost:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.pinPost},
+		CmdMarkAllRead:         {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.markAllPostsAsRead},
+		CmdPinPost:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceWrite, Execute: s.pinPost},
 		CmdPromoteMember:       {MinAuthLevel: api.AuthLevelUser, Execute: s.promoteMember},
 		CmdRemove:              {MinAuthLevel: api.AuthLevelUser, Execute: s.remove},
 		CmdRemoveAllPosts:      {MinAuthLevel: api.AuthLevelUser, Execute: s.removeAllPosts},
@@ -93,11 +93,11 @@ func NewPlaceService(worker *api.Worker) api.Service {
 		CmdRemoveFromBlacklist: {MinAuthLevel: api.AuthLevelUser, Execute: s.removeFromBlacklist},
 		CmdRemoveMember:        {MinAuthLevel: api.AuthLevelUser, Execute: s.removeMember},
 		CmdRemovePicture:       {MinAuthLevel: api.AuthLevelUser, Execute: s.removePicture},
-		CmdSetNotification:     {MinAuthLevel: api.AuthLevelAppL3, Execute: s.setPlaceNotification},
-		CmdSetPicture:          {MinAuthLevel: api.AuthLevelAppL3, Execute: s.setPicture},
-		CmdUnpinPost:           {MinAuthLevel: api.AuthLevelAppL3, Execute: s.unpinPost},
+		CmdSetNotification:     {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceWrite, Execute: s.setPlaceNotification},
+		CmdSetPicture:          {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceWrite, Execute: s.setPicture},
+		CmdUnpinPost:           {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePlaceWrite, Execute: s.unpinPost},
 		CmdUpdate:              {MinAuthLevel: api.AuthLevelUser, Execute: s.update},
-		GetUnreadPosts:         {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPlaceUnreadPosts},
+		GetUnreadPosts:         {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getPlaceUnreadPosts},
 	}
 
 	return s
@@ -110,7 +110,7 @@ func (s *PlaceService) GetServicePrefix() string {
 func (s *PlaceService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
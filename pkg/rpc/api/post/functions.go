@@ -703,12 +703,10 @@ func (s *PostService) markPostAsRead(requester *nested.Account, request *rpc.Req
 	}
 	post.MarkAsRead(requester.ID)
 	notificationIDs := s.Worker().Model().Notification.MarkAsReadByPostID(post.ID, requester.ID)
-	for _, notificationID := range notificationIDs {
-		notification := s.Worker().Model().Notification.GetByID(notificationID)
-		if notification != nil && notification.AccountID == requester.ID {
-			s.Worker().Model().Notification.MarkAsRead(notificationID, requester.ID)
-			go s.Worker().Pusher().ClearNotification(requester, notification)
-		}
+
+	// Clear the post and its notifications on the other devices of the requester
+	if len(notificationIDs) > 0 {
+		go s.Worker().Pusher().ExternalPushPostRead(requester.ID, post.ID, notificationIDs)
 	}
 	response.Ok()
 }
@@ -977,3 +975,99 @@ func (s *PostService) whoHaveReadThisPost(requester *nested.Account, request *rp
 		"post_reads": r,
 	})
 }
+
+// @Command:	post/get_invite
+// @Input:	post_id			string	*
+// @CommandInfo:	Returns the calendar invite (meeting request) which has been received by the email of the post
+func (s *PostService) getCalendarInvite(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var post *nested.Post
+	if post = s.Worker().Argument().GetPost(request, response); post == nil {
+		return
+	}
+	if !post.HasAccess(requester.ID) {
+		response.Error(global.ErrAccess, []string{})
+		return
+	}
+	invite := s.Worker().Model().Calendar.GetByPostID(post.ID)
+	if invite == nil {
+		response.Error(global.ErrUnavailable, []string{"post_id"})
+		return
+	}
+	r := tools.M{"invite": invite}
+	if attendee := invite.GetAttendeeByAccountID(requester.ID); attendee != nil {
+		r["my_status"] = attendee.Status
+	}
+	response.OkWithData(r)
+}
+
+// @Command:	post/rsvp
+// @Input:	post_id			string	*
+// @Input:	status			string	*	(accept | decline | tentative)
+// @CommandInfo:	Sets the requester's response to the calendar invite of the post, if the organizer is not one of
+// @CommandInfo:	our accounts the reply will be sent to the organizer by email
+func (s *PostService) respondCalendarInvite(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var post *nested.Post
+	var status string
+	if post = s.Worker().Argument().GetPost(request, response); post == nil {
+		return
+	}
+	if v, ok := request.Data["status"].(string); ok {
+		switch v {
+		case "accept":
+			status = nested.CalendarStatusAccepted
+		case "decline":
+			status = nested.CalendarStatusDeclined
+		case "tentative":
+			status = nested.CalendarStatusTentative
+		default:
+			response.Error(global.ErrInvalid, []string{"status"})
+			return
+		}
+	} else {
+		response.Error(global.ErrIncomplete, []string{"status"})
+		return
+	}
+	if !post.HasAccess(requester.ID) {
+		response.Error(global.ErrAccess, []string{})
+		return
+	}
+	invite := s.Worker().Model().Calendar.GetByPostID(post.ID)
+	if invite == nil {
+		response.Error(global.ErrUnavailable, []string{"post_id"})
+		return
+	}
+	if invite.Cancelled {
+		response.Error(global.ErrInvalid, []string{"post_id"})
+		return
+	}
+	attendee := invite.GetAttendeeByAccountID(requester.ID)
+	if attendee == nil {
+		response.Error(global.ErrAccess, []string{"attendee"})
+		return
+	}
+	if !s.Worker().Model().Calendar.SetAttendeeStatus(invite.ID, attendee.Email, status) {
+		response.Error(global.ErrUnknown, []string{})
+		return
+	}
+	attendee.Status = status
+	if len(invite.OrganizerID) == 0 && len(invite.OrganizerEmail) > 0 {
+		s.Worker().Mailer().SendCalendarReply(invite, *attendee)
+	}
+	response.Ok()
+}
+
+// @Command:	post/typing
+// @Input:	post_id			string	*
+// @CommandInfo:	tells the members of the post's places that the requester is typing a comment
+func (s *PostService) typing(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var post *nested.Post
+	if post = s.Worker().Argument().GetPost(request, response); post == nil {
+		return
+	}
+	if !post.HasAccess(requester.ID) {
+		response.Error(global.ErrAccess, []string{"post_id"})
+		return
+	}
+	go s.Worker().Pusher().Typing(requester.ID, post)
+	response.Ok()
+}
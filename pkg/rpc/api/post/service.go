@@ -38,6 +38,9 @@ const (
 	CmdAddToBookmarks      = "post/add_to_bookmarks"
 	CmdRemoveFromBookmarks = "post/remove_from_bookmarks"
 	CmdEdit                = "post/edit"
+	CmdGetInvite           = "post/get_invite"
+	CmdRSVP                = "post/rsvp"
+	CmdTyping              = "post/typing"
 )
 
 type PostService struct {
@@ -50,21 +53,21 @@ func NewPostService(worker *api.Worker) api.Service {
 	s.worker = worker
 
 	s.serviceCommands = api.ServiceCommands{
-		CmdAdd:                 {MinAuthLevel: api.AuthLevelAppL3, Execute: s.createPost},
-		CmdAddComment:          {MinAuthLevel: api.AuthLevelAppL3, Execute: s.addComment},
-		CmdAddLabel:            {MinAuthLevel: api.AuthLevelAppL3, Execute: s.addLabelToPost},
-		CmdGet:                 {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPost},
-		CmdGetSpam:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getSpamPost},
-		CmdNotSpam:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.notSpam},
-		CmdGetMany:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getManyPosts},
-		CmdGetCommentsByPost:   {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getCommentsByPost},
-		CmdGetComment:          {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getCommentByID},
-		CmdGetManyComments:     {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getManyCommentsByIDs},
-		CmdGetActivities:       {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPostActivities},
+		CmdAdd:                 {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.createPost},
+		CmdAddComment:          {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.addComment},
+		CmdAddLabel:            {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.addLabelToPost},
+		CmdGet:                 {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getPost},
+		CmdGetSpam:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getSpamPost},
+		CmdNotSpam:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.notSpam},
+		CmdGetMany:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getManyPosts},
+		CmdGetCommentsByPost:   {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getCommentsByPost},
+		CmdGetComment:          {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getCommentByID},
+		CmdGetManyComments:     {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getManyCommentsByIDs},
+		CmdGetActivities:       {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getPostActivities},
 		CmdAttachPlace:         {MinAuthLevel: api.AuthLevelUser, Execute: s.attachPlace},
 		CmdGetCounters:         {MinAuthLevel: api.AuthLevelUser, Execute: s.getPostCounters},
-		CmdGetChain:            {MinAuthLevel: api.AuthLevelAppL3, Execute: s.getPostChain},
-		CmdRetract:             {MinAuthLevel: api.AuthLevelAppL3, Execute: s.retractPost},
+		CmdGetChain:            {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getPostChain},
+		CmdRetract:             {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostWrite, Execute: s.retractPost},
 		CmdWipe:                {MinAuthLevel: api.AuthLevelUser, Execute: s.retractPost},
 		CmdRemove:              {MinAuthLevel: api.AuthLevelUser, Execute: s.removePost},
 		CmdRemoveComment:       {MinAuthLevel: api.AuthLevelUser, Execute: s.removeComment},
@@ -77,6 +80,9 @@ func NewPostService(worker *api.Worker) api.Service {
 		CmdAddToBookmarks:      {MinAuthLevel: api.AuthLevelUser, Execute: s.addToBookmarks},
 		CmdRemoveFromBookmarks: {MinAuthLevel: api.AuthLevelUser, Execute: s.removeFromBookmarks},
 		CmdEdit:                {MinAuthLevel: api.AuthLevelUser, Execute: s.editPost},
+		CmdGetInvite:           {MinAuthLevel: api.AuthLevelAppL3, Scope: api.ScopePostRead, Execute: s.getCalendarInvite},
+		CmdRSVP:                {MinAuthLevel: api.AuthLevelUser, Execute: s.respondCalendarInvite},
+		CmdTyping:              {MinAuthLevel: api.AuthLevelUser, Execute: s.typing},
 	}
 
 	return s
@@ -89,7 +95,7 @@ func (s *PostService) GetServicePrefix() string {
 func (s *PostService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"go.uber.org/zap"
+)
+
+// createExternalAccount creates the account of a user of the directory or an identity provider and
+// its personal place like admin/account_register does. The local password is random and never used.
+func (sw *Worker) createExternalAccount(uid, fname, lname, email string) bool {
+	if matched, _ := regexp.MatchString(global.DefaultRegexAccountID, uid); !matched {
+		log.Warn("external user has an invalid uid", zap.String("UID", uid))
+		return false
+	}
+	if !sw.licenseAllowsUser() {
+		log.Warn("license users limit reached, external user is not created", zap.String("UID", uid))
+		return false
+	}
+	if fname == "" && lname == "" {
+		fname = uid
+	}
+	if email != "" && sw.Model().Account.EmailExists(email) {
+		email = ""
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return false
+	}
+	if !sw.Model().Account.CreateUser(uid, hex.EncodeToString(b), "", "", fname, lname, email, "", "") {
+		return false
+	}
+
+	// create personal place for the new account
+	pcr := nested.PlaceCreateRequest{
+		ID:            uid,
+		GrandParentID: uid,
+		AccountID:     uid,
+		Name:          fmt.Sprintf("%s %s", fname, lname),
+		Description:   fmt.Sprintf("Personal place for %s", uid),
+	}
+	pcr.Policy.AddMember = nested.PlacePolicyNoOne
+	pcr.Policy.AddPlace = nested.PlacePolicyCreators
+	pcr.Policy.AddPost = nested.PlacePolicyEveryone
+	pcr.Privacy.Locked = true
+	pcr.Privacy.Receptive = nested.PlaceReceptiveExternal
+	pcr.Privacy.Search = true
+	sw.Model().Place.CreatePersonalPlace(pcr)
+	sw.Model().Place.AddKeyHolder(pcr.ID, pcr.AccountID)
+	sw.Model().Place.Promote(pcr.ID, pcr.AccountID)
+	sw.Model().Account.AddPlaceToBookmarks(pcr.AccountID, pcr.ID)
+	sw.Model().Account.SetPlaceNotification(pcr.AccountID, pcr.ID, true)
+	sw.Model().Search.AddPlaceToSearchIndex(uid, pcr.Name, pcr.Picture)
+
+	for _, placeID := range sw.Model().Place.GetDefaultPlaces() {
+		sw.joinPlace(placeID, uid)
+	}
+	return true
+}
+
+// joinPlace adds the account to the place and to its grand place as a key holder
+func (sw *Worker) joinPlace(placeID, accountID string) {
+	place := sw.Model().Place.GetByID(placeID, nil)
+	if place == nil || place.IsMember(accountID) {
+		return
+	}
+	grandPlace := place.GetGrandParent()
+	if grandPlace == nil {
+		return
+	}
+	if !grandPlace.IsMember(accountID) {
+		sw.Model().Place.AddKeyHolder(grandPlace.ID, accountID)
+		sw.Model().Account.SetPlaceNotification(accountID, grandPlace.ID, true)
+		sw.Model().Account.AddPlaceToBookmarks(accountID, grandPlace.ID)
+		sw.Pusher().InternalPlaceActivitySyncPush(grandPlace.GetMemberIDs(), grandPlace.ID, nested.PlaceActivityActionMemberJoin)
+	}
+	if place.IsGrandPlace() {
+		return
+	}
+	sw.Model().Place.AddKeyHolder(place.ID, accountID)
+	sw.Model().Account.SetPlaceNotification(accountID, place.ID, true)
+	sw.Model().Account.AddPlaceToBookmarks(accountID, place.ID)
+	sw.Pusher().InternalPlaceActivitySyncPush(place.GetMemberIDs(), place.ID, nested.PlaceActivityActionMemberJoin)
+}
+
+// leavePlace removes the account from the place like place/remove_member does, the account is removed
+// from the sub-places of the place too if the place is a grand place
+func (sw *Worker) leavePlace(placeID, accountID, actorID string) {
+	place := sw.Model().Place.GetByID(placeID, nil)
+	if place == nil || !place.IsMember(accountID) {
+		return
+	}
+	if place.IsGrandPlace() {
+		for _, pid := range sw.Model().Account.GetAccessPlaceIDs(accountID) {
+			if !sw.Model().Place.IsSubPlace(place.ID, pid) {
+				continue
+			}
+			subPlace := sw.Model().Place.GetByID(pid, nil)
+			switch {
+			case subPlace == nil:
+			case subPlace.IsCreator(accountID):
+				sw.Model().Place.RemoveCreator(pid, accountID, actorID)
+			default:
+				sw.Model().Place.RemoveKeyHolder(pid, accountID, actorID)
+			}
+		}
+	}
+	switch {
+	case place.IsCreator(accountID):
+		sw.Model().Place.RemoveCreator(place.ID, accountID, actorID)
+	case place.IsKeyholder(accountID):
+		sw.Model().Place.RemoveKeyHolder(place.ID, accountID, actorID)
+	}
+}
+
+func (sw *Worker) licenseAllowsUser() bool {
+	counters := sw.Model().System.GetCounters()
+	maxActiveUsers := sw.Model().License.Get().MaxActiveUsers
+	return maxActiveUsers == 0 || counters[global.SystemCountersEnabledAccounts] < maxActiveUsers
+}
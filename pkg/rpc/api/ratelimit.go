@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"git.ronaksoft.com/nested/server/pkg/rpc"
+	"github.com/gomodule/redigo/redis"
+	"go.uber.org/zap"
+)
+
+// Command Groups, each group has its own budget
+const (
+	RateLimitGroupDefault = "default"
+	RateLimitGroupAuth    = "auth"
+	RateLimitGroupPostAdd = "post_add"
+	RateLimitGroupSearch  = "search"
+)
+
+const rateLimitKeyPrefix = "rl:"
+
+// rateLimitScript takes a token from all the token buckets of KEYS, or from none of them if any
+// bucket is empty. Each bucket is kept in a redis hash and is refilled by ARGV[2i] tokens per
+// millisecond up to ARGV[2i+1] (burst), ARGV[1] is the current time in milliseconds. It returns
+// the milliseconds which the caller must wait before its next request, zero means the request is
+// allowed.
+var rateLimitScript = redis.NewScript(-1, `
+local now = tonumber(ARGV[1])
+local tokens, wait = {}, 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i])
+	local burst = tonumber(ARGV[2 * i + 1])
+	local b = redis.call('HMGET', key, 'tokens', 'ts')
+	local t = tonumber(b[1]) or burst
+	local ts = tonumber(b[2]) or now
+	if now > ts then
+		t = math.min(burst, t + (now - ts) * rate)
+	end
+	if t < 1 then
+		wait = math.max(wait, math.ceil((1 - t) / rate))
+	end
+	tokens[i] = t
+end
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i])
+	local burst = tonumber(ARGV[2 * i + 1])
+	if wait == 0 then
+		tokens[i] = tokens[i] - 1
+	end
+	redis.call('HSET', key, 'tokens', tostring(tokens[i]), 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(burst / rate) + 1000)
+end
+return wait
+`)
+
+// RateLimitGroup returns the group of the command
+func RateLimitGroup(cmd string) string {
+	switch {
+	case strings.HasPrefix(cmd, "auth/"), cmd == "session/register", cmd == "session/sso_login",
+		cmd == "account/set_password":
+		return RateLimitGroupAuth
+	case cmd == "post/add":
+		return RateLimitGroupPostAdd
+	case strings.HasPrefix(cmd, "search/"):
+		return RateLimitGroupSearch
+	default:
+		return RateLimitGroupDefault
+	}
+}
+
+// rateLimitBudget returns the requests per minute and the burst of the group
+func rateLimitBudget(group string) (int, int) {
+	switch group {
+	case RateLimitGroupAuth:
+		return global.DefaultRateLimitAuth, global.DefaultRateLimitAuthBurst
+	case RateLimitGroupPostAdd:
+		return global.DefaultRateLimitPostAdd, global.DefaultRateLimitPostAddBurst
+	case RateLimitGroupSearch:
+		return global.DefaultRateLimitSearch, global.DefaultRateLimitSearchBurst
+	default:
+		return global.DefaultRateLimit, global.DefaultRateLimitBurst
+	}
+}
+
+// checkRateLimit takes a token from the buckets of the requester account, the app token and the
+// client ip. It returns the time which the client must wait if any of the buckets is empty, in which
+// case no token is taken from the other buckets. If the limits could not be checked the request is
+// allowed.
+func (sw *Worker) checkRateLimit(requester *nested.Account, request *rpc.Request) time.Duration {
+	group := RateLimitGroup(request.Command)
+	perMinute, burst := rateLimitBudget(group)
+	if perMinute <= 0 {
+		return 0
+	}
+
+	type bucket struct {
+		key       string
+		perMinute int
+		burst     int
+	}
+	buckets := make([]bucket, 0, 3)
+	if requester != nil {
+		buckets = append(buckets, bucket{fmt.Sprintf("%s%s:account:%s", rateLimitKeyPrefix, group, requester.ID), perMinute, burst})
+	}
+	if len(request.AppToken) > 0 {
+		buckets = append(buckets, bucket{fmt.Sprintf("%s%s:app:%s", rateLimitKeyPrefix, group, request.AppToken), perMinute, burst})
+	}
+	if ip := clientIP(request.ClientIP); len(ip) > 0 {
+		f := global.DefaultRateLimitIPFactor
+		buckets = append(buckets, bucket{fmt.Sprintf("%s%s:ip:%s", rateLimitKeyPrefix, group, ip), perMinute * f, burst * f})
+	}
+
+	if len(buckets) == 0 {
+		return 0
+	}
+
+	c := sw.Model().Cache().Pool.Get()
+	defer c.Close()
+	args := make([]interface{}, 0, 2+3*len(buckets))
+	args = append(args, len(buckets))
+	for _, b := range buckets {
+		args = append(args, b.key)
+	}
+	args = append(args, time.Now().UnixNano()/int64(time.Millisecond))
+	for _, b := range buckets {
+		args = append(args, float64(b.perMinute)/60000, b.burst)
+	}
+	wait, err := redis.Int64(rateLimitScript.Do(c, args...))
+	if err != nil {
+		log.Warn("got error on checking rate limit", zap.Error(err), zap.String("Group", group))
+		return 0
+	}
+	return time.Duration(wait) * time.Millisecond
+}
+
+// clientIP removes the port from the remote address of the client
+func clientIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,427 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/password"
+	"git.ronaksoft.com/nested/server/pkg/scim"
+	"github.com/globalsign/mgo/bson"
+)
+
+// ScimPath is the prefix of the endpoints of SCIM, i.e. /scim/v2/Users
+const ScimPath = "/scim/v2"
+
+// ScimHandler returns the SCIM server which provisions the accounts and maps the groups of the
+// identity provider to labels and places. The clients authenticate by the tokens of the admins.
+func (sw *Worker) ScimHandler() http.Handler {
+	return scim.NewServer(ScimPath, &scimBackend{sw: sw}, sw.scimAuthenticate)
+}
+
+// scimAuthenticate returns the owner of the token, the owner must be still an enabled admin
+func (sw *Worker) scimAuthenticate(token string) (string, bool) {
+	if len(token) == 0 {
+		return "", false
+	}
+	accountID := sw.Model().Scim.GetTokenOwner(token)
+	if len(accountID) == 0 {
+		return "", false
+	}
+	account := sw.Model().Account.GetByID(accountID, nil)
+	if account == nil || account.Disabled || !account.Authority.Admin {
+		return "", false
+	}
+	return account.ID, true
+}
+
+// scimBackend keeps the users as the accounts and the groups as the labels or the places
+type scimBackend struct {
+	sw *Worker
+}
+
+func scimTime(ts uint64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(0, int64(ts)*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+}
+
+func scimUser(account *nested.Account) *scim.User {
+	active := !account.Disabled
+	u := &scim.User{
+		ID:       account.ID,
+		UserName: account.ID,
+		Name: scim.Name{
+			Formatted:  account.FullName,
+			GivenName:  account.FirstName,
+			FamilyName: account.LastName,
+		},
+		DisplayName: account.FullName,
+		Active:      &active,
+		Meta:        &scim.Meta{Created: scimTime(account.JoinedOn)},
+	}
+	if len(account.Email) > 0 {
+		u.Emails = []scim.Email{{Value: account.Email, Type: "work", Primary: true}}
+	}
+	return u
+}
+
+func (b *scimBackend) account(id string) (*nested.Account, error) {
+	account := b.sw.Model().Account.GetByID(id, nil)
+	if account == nil || account.Type != nested.ACCOUNT_TYPE_USER {
+		return nil, scim.ErrNotFound(id)
+	}
+	return account, nil
+}
+
+func (b *scimBackend) GetUser(id string) (*scim.User, error) {
+	account, err := b.account(id)
+	if err != nil {
+		return nil, err
+	}
+	return scimUser(account), nil
+}
+
+func (b *scimBackend) ListUsers(filter scim.Filter, offset, count int) ([]scim.User, int, error) {
+	users := make([]scim.User, 0, count)
+	var account *nested.Account
+	switch filter.Attribute {
+	case "":
+		accounts, total := b.sw.Model().Scim.Users(offset, count)
+		for i := range accounts {
+			users = append(users, *scimUser(&accounts[i]))
+		}
+		return users, total, nil
+	case "id", "username":
+		account = b.sw.Model().Account.GetByID(strings.ToLower(filter.Value), nil)
+	case "emails", "emails.value":
+		account = b.sw.Model().Account.GetByEmail(strings.ToLower(filter.Value), nil)
+	default:
+		return nil, 0, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidFilter, fmt.Sprintf("unsupported attribute: %s", filter.Attribute))
+	}
+	if account == nil || account.Type != nested.ACCOUNT_TYPE_USER {
+		return users, 0, nil
+	}
+	if offset == 0 && count > 0 {
+		users = append(users, *scimUser(account))
+	}
+	return users, 1, nil
+}
+
+func (b *scimBackend) CreateUser(actorID string, u scim.User) (*scim.User, error) {
+	uid := strings.ToLower(strings.TrimSpace(u.UserName))
+	if matched, _ := regexp.MatchString(global.DefaultRegexAccountID, uid); !matched {
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "invalid userName")
+	}
+	if len(u.Password) > 0 {
+		if rules := b.sw.CheckPassword("", u.Password, uid, u.Name.GivenName, u.Name.FamilyName); len(rules) > 0 {
+			return nil, scimPasswordError(rules)
+		}
+	}
+	if b.sw.Model().Account.Exists(uid) || b.sw.Model().Place.Exists(uid) {
+		return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "userName already exists")
+	}
+	email := u.PrimaryEmail()
+	if len(email) > 0 && b.sw.Model().Account.EmailExists(email) {
+		return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "email already exists")
+	}
+	if !b.sw.licenseAllowsUser() {
+		return nil, scim.NewError(http.StatusForbidden, "", "license users limit reached")
+	}
+	if !b.sw.createExternalAccount(uid, u.Name.GivenName, u.Name.FamilyName, email) {
+		return nil, fmt.Errorf("account could not be created")
+	}
+	if len(u.Password) > 0 {
+		b.sw.Model().Account.SetPassword(uid, password.Digest(u.Password))
+	}
+	if !u.IsActive() {
+		b.sw.Model().Account.Disable(uid)
+	}
+	return b.GetUser(uid)
+}
+
+func (b *scimBackend) ReplaceUser(actorID, id string, u scim.User) (*scim.User, error) {
+	account, err := b.account(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.UserName) > 0 && strings.ToLower(u.UserName) != account.ID {
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeMutability, "userName cannot be changed")
+	}
+	email := u.PrimaryEmail()
+	if len(email) > 0 && email != account.Email {
+		if b.sw.Model().Account.EmailExists(email) {
+			return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "email already exists")
+		}
+	}
+	// the unchanged passwords are not set again, hence they are not rejected as reused
+	setPassword := len(u.Password) > 0 && !b.sw.IsDirectoryAccount(account.ID) &&
+		!b.sw.Model().Account.Verify(account.ID, password.Digest(u.Password))
+	if setPassword {
+		if rules := b.sw.CheckPassword(account.ID, u.Password, account.ID, u.Name.GivenName, u.Name.FamilyName); len(rules) > 0 {
+			return nil, scimPasswordError(rules)
+		}
+	}
+	b.sw.Model().Account.Update(account.ID, nested.AccountUpdateRequest{
+		FirstName: u.Name.GivenName,
+		LastName:  u.Name.FamilyName,
+		Email:     email,
+	})
+	if setPassword {
+		b.sw.Model().Account.SetPassword(account.ID, password.Digest(u.Password))
+	}
+	switch {
+	case u.IsActive() && account.Disabled:
+		if !b.sw.licenseAllowsUser() {
+			return nil, scim.NewError(http.StatusForbidden, "", "license users limit reached")
+		}
+		b.sw.Model().Account.Enable(account.ID)
+	case !u.IsActive() && !account.Disabled:
+		b.sw.Model().Account.Disable(account.ID)
+	}
+	return b.GetUser(account.ID)
+}
+
+func scimPasswordError(rules []string) error {
+	return scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue,
+		fmt.Sprintf("password violates the policy: %s", strings.Join(rules, ", ")),
+	)
+}
+
+// DeleteUser disables the account, the accounts are never removed
+func (b *scimBackend) DeleteUser(actorID, id string) error {
+	account, err := b.account(id)
+	if err != nil {
+		return err
+	}
+	if !account.Disabled {
+		b.sw.Model().Account.Disable(account.ID)
+	}
+	return nil
+}
+
+func (b *scimBackend) scimGroup(g *nested.ScimGroup) *scim.Group {
+	group := &scim.Group{
+		ID:          g.ID,
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Members:     make([]scim.Member, 0, len(g.Members)),
+		Nested: &scim.GroupExtension{
+			Type:     g.Type,
+			TargetID: g.TargetID,
+		},
+		Meta: &scim.Meta{
+			Created:      scimTime(g.CreatedOn),
+			LastModified: scimTime(g.LastUpdate),
+		},
+	}
+	for _, account := range b.sw.Model().Account.GetAccountsByIDs(g.Members) {
+		group.Members = append(group.Members, scim.Member{Value: account.ID, Display: account.FullName})
+	}
+	return group
+}
+
+func (b *scimBackend) GetGroup(id string) (*scim.Group, error) {
+	g := b.sw.Model().Scim.GetGroup(id)
+	if g == nil {
+		return nil, scim.ErrNotFound(id)
+	}
+	return b.scimGroup(g), nil
+}
+
+func (b *scimBackend) ListGroups(filter scim.Filter, offset, count int) ([]scim.Group, int, error) {
+	q := bson.M{}
+	switch filter.Attribute {
+	case "":
+	case "id":
+		q["_id"] = filter.Value
+	case "displayname":
+		q["display_name"] = filter.Value
+	case "externalid":
+		q["external_id"] = filter.Value
+	default:
+		return nil, 0, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidFilter, fmt.Sprintf("unsupported attribute: %s", filter.Attribute))
+	}
+	groups := make([]scim.Group, 0, count)
+	if count == 0 {
+		_, total := b.sw.Model().Scim.GetGroups(q, 0, 1)
+		return groups, total, nil
+	}
+	gs, total := b.sw.Model().Scim.GetGroups(q, offset, count)
+	for i := range gs {
+		groups = append(groups, *b.scimGroup(&gs[i]))
+	}
+	return groups, total, nil
+}
+
+// CreateGroup maps the group to a label or a place. A new public label is created for the group
+// unless the id of an existing label or place is set in the extension of the group.
+func (b *scimBackend) CreateGroup(actorID string, g scim.Group) (*scim.Group, error) {
+	g.DisplayName = strings.TrimSpace(g.DisplayName)
+	if len(g.DisplayName) == 0 {
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "displayName is required")
+	}
+	group := &nested.ScimGroup{
+		DisplayName: g.DisplayName,
+		ExternalID:  g.ExternalID,
+		Type:        nested.ScimGroupTypeLabel,
+	}
+	if g.Nested != nil {
+		if len(g.Nested.Type) > 0 {
+			group.Type = g.Nested.Type
+		}
+		group.TargetID = g.Nested.TargetID
+	}
+	memberIDs, err := b.memberIDs(g.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	switch group.Type {
+	case nested.ScimGroupTypeLabel:
+		if len(group.TargetID) == 0 {
+			if len(group.DisplayName) > global.DefaultMaxLabelTitle {
+				return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "displayName is too long")
+			}
+			if b.sw.Model().Label.TitleExists(group.DisplayName) {
+				return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "label already exists")
+			}
+			group.TargetID = bson.NewObjectId().Hex()
+			group.Owned = true
+			if !b.sw.Model().Label.CreatePublic(group.TargetID, group.DisplayName, nested.LabelColourCodeA, actorID) {
+				return nil, fmt.Errorf("label could not be created")
+			}
+		} else if b.sw.Model().Label.GetByID(group.TargetID) == nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "label does not exist")
+		}
+	case nested.ScimGroupTypePlace:
+		place := b.sw.Model().Place.GetByID(group.TargetID, nil)
+		if place == nil || place.IsPersonal() {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "place does not exist")
+		}
+	default:
+		return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "invalid group type")
+	}
+	if !group.Owned && b.sw.Model().Scim.TargetMapped(group.Type, group.TargetID) {
+		return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "target is mapped to another group")
+	}
+	if !b.sw.Model().Scim.CreateGroup(group) {
+		if group.Owned {
+			b.sw.Model().Label.Remove(group.TargetID)
+		}
+		return nil, fmt.Errorf("group could not be created")
+	}
+	b.setMembers(actorID, group, memberIDs)
+	return b.scimGroup(group), nil
+}
+
+func (b *scimBackend) ReplaceGroup(actorID, id string, g scim.Group) (*scim.Group, error) {
+	group := b.sw.Model().Scim.GetGroup(id)
+	if group == nil {
+		return nil, scim.ErrNotFound(id)
+	}
+	if g.Nested != nil {
+		if (len(g.Nested.Type) > 0 && g.Nested.Type != group.Type) ||
+			(len(g.Nested.TargetID) > 0 && g.Nested.TargetID != group.TargetID) {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeMutability, "target of the group cannot be changed")
+		}
+	}
+	memberIDs, err := b.memberIDs(g.Members)
+	if err != nil {
+		return nil, err
+	}
+	displayName := strings.TrimSpace(g.DisplayName)
+	if len(displayName) > 0 && displayName != group.DisplayName {
+		if group.Owned {
+			if len(displayName) > global.DefaultMaxLabelTitle {
+				return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, "displayName is too long")
+			}
+			if b.sw.Model().Label.TitleExists(displayName) {
+				return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "label already exists")
+			}
+			b.sw.Model().Label.Update(group.TargetID, "", displayName)
+		}
+		group.DisplayName = displayName
+	}
+	group.ExternalID = g.ExternalID
+	b.setMembers(actorID, group, memberIDs)
+	return b.scimGroup(group), nil
+}
+
+// DeleteGroup removes the members of the group from its label or place. The label is removed too
+// if it has been created for the group.
+func (b *scimBackend) DeleteGroup(actorID, id string) error {
+	group := b.sw.Model().Scim.GetGroup(id)
+	if group == nil {
+		return scim.ErrNotFound(id)
+	}
+	if group.Owned {
+		b.sw.Model().Label.Remove(group.TargetID)
+	} else {
+		b.setMembers(actorID, group, nil)
+	}
+	if !b.sw.Model().Scim.RemoveGroup(group.ID) {
+		return fmt.Errorf("group could not be removed")
+	}
+	return nil
+}
+
+// memberIDs returns the ids of the members, all of them must be user accounts
+func (b *scimBackend) memberIDs(members []scim.Member) ([]string, error) {
+	ids := make([]string, 0, len(members))
+	exists := make(map[string]bool, len(members))
+	for _, m := range members {
+		if exists[m.Value] {
+			continue
+		}
+		if _, err := b.account(m.Value); err != nil {
+			return nil, scim.NewError(http.StatusBadRequest, scim.ErrTypeInvalidValue, fmt.Sprintf("member %s does not exist", m.Value))
+		}
+		exists[m.Value] = true
+		ids = append(ids, m.Value)
+	}
+	return ids, nil
+}
+
+// setMembers adds the new members to the label or the place of the group and removes the members
+// which are not in the group anymore
+func (b *scimBackend) setMembers(actorID string, group *nested.ScimGroup, memberIDs []string) {
+	current := make(map[string]bool, len(group.Members))
+	for _, id := range group.Members {
+		current[id] = true
+	}
+	next := make(map[string]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		next[id] = true
+		if current[id] {
+			continue
+		}
+		switch group.Type {
+		case nested.ScimGroupTypeLabel:
+			label := b.sw.Model().Label.GetByID(group.TargetID)
+			if label != nil && !hasGroup(label.Members, id) {
+				b.sw.Model().Label.AddMembers(label.ID, []string{id})
+			}
+		case nested.ScimGroupTypePlace:
+			b.sw.joinPlace(group.TargetID, id)
+		}
+	}
+	for _, id := range group.Members {
+		if next[id] {
+			continue
+		}
+		switch group.Type {
+		case nested.ScimGroupTypeLabel:
+			b.sw.Model().Label.RemoveMember(group.TargetID, id)
+		case nested.ScimGroupTypePlace:
+			b.sw.leavePlace(group.TargetID, id, actorID)
+		}
+	}
+	group.Members = memberIDs
+	b.sw.Model().Scim.UpdateGroup(group)
+}
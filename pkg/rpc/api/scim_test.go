@@ -0,0 +1,42 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/password"
+	"git.ronaksoft.com/nested/server/pkg/scim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScimPassword(t *testing.T) {
+	Convey("SCIM Password", t, func(c C) {
+		// the passwords are checked before the database is touched, so the worker needs no model
+		b := &scimBackend{sw: &Worker{}}
+		Convey("Digest", func(c C) {
+			// the md5 of "a" would bypass the policy, so the digests are rejected
+			_, err := b.CreateUser("admin", scim.User{
+				UserName: "jdoe",
+				Name:     scim.Name{GivenName: "John", FamilyName: "Doe"},
+				Password: "0cc175b9c0f1b6a831c399e269772661",
+			})
+			c.So(err, ShouldNotBeNil)
+			serr, ok := err.(*scim.Error)
+			c.So(ok, ShouldBeTrue)
+			c.So(serr.Status, ShouldEqual, "400")
+			c.So(serr.ScimType, ShouldEqual, scim.ErrTypeInvalidValue)
+			c.So(serr.Detail, ShouldContainSubstring, password.RuleDigest)
+		})
+		Convey("Policy", func(c C) {
+			_, err := b.CreateUser("admin", scim.User{UserName: "jdoe", Password: "a"})
+			c.So(err, ShouldNotBeNil)
+			c.So(err.(*scim.Error).Detail, ShouldContainSubstring, password.RuleMinLength)
+		})
+		Convey("UserName", func(c C) {
+			_, err := b.CreateUser("admin", scim.User{UserName: "a b", Password: "0cc175b9c0f1b6a831c399e269772661"})
+			c.So(err, ShouldNotBeNil)
+			c.So(strings.Contains(err.Error(), "userName"), ShouldBeTrue)
+			c.So(err.(*scim.Error).Status, ShouldEqual, "400")
+		})
+	})
+}
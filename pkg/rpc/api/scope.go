@@ -0,0 +1,73 @@
+package api
+
+import (
+	"strings"
+
+	"git.ronaksoft.com/nested/server/nested"
+)
+
+// Scopes which the user could grant to an app. Each app level ServiceCommand belongs to one of them.
+const (
+	ScopeAccountWrite = "account:write"
+	ScopePostRead     = "posts:read"
+	ScopePostWrite    = "posts:write"
+	ScopePlaceRead    = "places:read"
+	ScopePlaceWrite   = "places:write"
+	ScopeTaskRead     = "tasks:read"
+	ScopeTaskWrite    = "tasks:write"
+	ScopeFileRead     = "files:read"
+	ScopeFileWrite    = "files:write"
+	ScopeSearch       = "search"
+	ScopeApps         = "apps"
+)
+
+// ScopeDescriptions are shown to the user in the consent screen
+var ScopeDescriptions = map[string]string{
+	ScopeAccountWrite: "Change your email addresses",
+	ScopePostRead:     "Read your posts and comments",
+	ScopePostWrite:    "Send posts and comments on your behalf",
+	ScopePlaceRead:    "Read your places and their members",
+	ScopePlaceWrite:   "Change the settings of your places",
+	ScopeTaskRead:     "Read your tasks",
+	ScopeTaskWrite:    "Create and update tasks on your behalf",
+	ScopeFileRead:     "Download your files",
+	ScopeFileWrite:    "Upload files on your behalf",
+	ScopeSearch:       "Search accounts and places",
+	ScopeApps:         "Manage the registered apps",
+}
+
+// ParseScopes parses the space (or comma) separated scopes, it returns false if any of them is unknown
+func ParseScopes(s string) ([]string, bool) {
+	scopes := make([]string, 0, len(ScopeDescriptions))
+	for _, scope := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if _, ok := ScopeDescriptions[scope]; !ok {
+			return nil, false
+		}
+		if !HasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, true
+}
+
+// HasScope returns TRUE if scope is in the scopes
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedScopes returns the scopes of the app token, the legacy tokens have all the scopes
+func GrantedScopes(appToken nested.AppToken) []string {
+	if appToken.Scopes != nil {
+		return appToken.Scopes
+	}
+	scopes := make([]string, 0, len(ScopeDescriptions))
+	for scope := range ScopeDescriptions {
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
@@ -37,7 +37,7 @@ func NewSearchService(worker *api.Worker) api.Service {
 	s.worker = worker
 
 	s.serviceCommands = api.ServiceCommands{
-		CmdAccounts:               {MinAuthLevel: api.AuthLevelAppL1, Execute: s.accounts},
+		CmdAccounts:               {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeSearch, Execute: s.accounts},
 		CmdAccountsForAdmin:       {MinAuthLevel: api.AuthLevelUser, Execute: s.accountsForAdmin},
 		CmdAccountsForSearch:      {MinAuthLevel: api.AuthLevelUser, Execute: s.accountsForSearch},
 		CmdAccountsForAdd:         {MinAuthLevel: api.AuthLevelUser, Execute: s.accountsForAdd},
@@ -45,8 +45,8 @@ func NewSearchService(worker *api.Worker) api.Service {
 		CmdAccountsForMention:     {MinAuthLevel: api.AuthLevelUser, Execute: s.accountsForMention},
 		CmdAccountsForTaskMention: {MinAuthLevel: api.AuthLevelUser, Execute: s.accountsForTaskMention},
 		CmdLabels:                 {MinAuthLevel: api.AuthLevelUser, Execute: s.labels},
-		CmdPlacesForCompose:       {MinAuthLevel: api.AuthLevelAppL1, Execute: s.placesForCompose},
-		CmdPlacesForSearch:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.placesForSearch},
+		CmdPlacesForCompose:       {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeSearch, Execute: s.placesForCompose},
+		CmdPlacesForSearch:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeSearch, Execute: s.placesForSearch},
 		CmdPosts:                  {MinAuthLevel: api.AuthLevelUser, Execute: s.posts},
 		CmdPostsConversation:      {MinAuthLevel: api.AuthLevelUser, Execute: s.conversation},
 		CmdSuggestions:            {MinAuthLevel: api.AuthLevelUser, Execute: s.suggestions},
@@ -64,7 +64,7 @@ func (s *SearchService) GetServicePrefix() string {
 func (s *SearchService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
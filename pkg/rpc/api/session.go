@@ -0,0 +1,293 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/geoip"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"github.com/globalsign/mgo/bson"
+	"github.com/jaytaylor/html2text"
+	"go.uber.org/zap"
+	"gopkg.in/mail.v2"
+)
+
+// SessionRevokePath is the path of the links which revoke the new sessions without logging in
+const SessionRevokePath = "/session/revoke/%s"
+
+// SessionInfo is the information of the client which opens the session
+type SessionInfo struct {
+	ClientIP      string
+	UserAgent     string
+	ClientID      string
+	ClientVersion int
+	DeviceID      string
+	DeviceToken   string
+	DeviceOS      string
+	DeviceName    string
+	WebsocketID   string
+}
+
+// newGeoIP returns the geoip database of the config or nil if it has not been configured
+func newGeoIP() *geoip.DB {
+	path := config.GetString(config.GeoIPDatabase)
+	if len(path) == 0 {
+		return nil
+	}
+	db, err := geoip.Load(path)
+	if err != nil {
+		log.Warn("got error on loading the geoip database", zap.Error(err))
+		return nil
+	}
+	return db
+}
+
+// CreateSession opens a new session for the account which has been authenticated already. It
+// returns the session key and the session secret. The owner of the account is alerted if the
+// session is opened from a new device or network.
+func (sw *Worker) CreateSession(accountID string, info SessionInfo) (bson.ObjectId, string, error) {
+	// increase the number of logins for the user account
+	sw.Model().Account.IncreaseLogins(accountID)
+
+	ip := clientIP(info.ClientIP)
+	if len(info.DeviceName) == 0 {
+		info.DeviceName = deviceName(info.UserAgent, info.DeviceOS)
+	}
+	location := sw.location(ip)
+	sk, err := sw.Model().Session.Create(nested.MS{
+		"ip":          info.ClientIP,
+		"ua":          info.UserAgent,
+		"device_name": info.DeviceName,
+		"location":    location,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	ss := nested.RandomID(64)
+	session := sw.Model().Session.GetByID(sk)
+	session.DeviceID = info.DeviceID
+	session.DeviceOS = info.DeviceOS
+	session.SessionSecret = ss
+	session.AccountID = accountID
+	session.DeviceToken = info.DeviceToken
+	session.ClientID = info.ClientID
+	session.ClientVersion = info.ClientVersion
+	session.Login()
+
+	// Register device in Pusher
+	if info.DeviceID != "" && info.DeviceToken != "" && info.DeviceOS != "" {
+		_ = sw.Pusher().RegisterDevice(info.DeviceID, info.DeviceToken, info.DeviceOS, accountID)
+	}
+
+	// Register websocket in Pusher
+	if len(info.WebsocketID) > 0 {
+		_ = sw.Pusher().RegisterWebsocket(accountID, info.DeviceID, config.GetString(config.BundleID), info.WebsocketID)
+	}
+
+	// Notification Handling
+	device := info.DeviceID
+	if len(device) == 0 {
+		device = info.DeviceName
+	}
+	if sw.Model().Session.RememberLogin(accountID, device, network(ip)) {
+		sw.alertNewSession(accountID, sk, info, location)
+	}
+	return sk, ss, nil
+}
+
+// RevokeSession expires the session of the revoke token, it returns false if the token is not valid
+func (sw *Worker) RevokeSession(token string) bool {
+	sk := sw.Model().Session.ConsumeRevokeToken(token)
+	if !sk.Valid() {
+		return false
+	}
+	session := sw.Model().Session.GetByID(sk)
+	if session == nil {
+		return false
+	}
+	sw.Model().Session.Expire(sk)
+	if session.DeviceID != "" {
+		sw.Pusher().UnregisterDevice(session.DeviceID, session.DeviceToken, session.AccountID)
+	}
+	log.Info("session revoked by its alert", zap.String("AccountID", session.AccountID), zap.String("SessionID", sk.Hex()))
+	return true
+}
+
+// alertNewSession notifies the owner of the account in the app and by email
+func (sw *Worker) alertNewSession(accountID string, sk bson.ObjectId, info SessionInfo, location string) {
+	device := info.DeviceName
+	if len(location) > 0 {
+		device = fmt.Sprintf("%s, %s", device, location)
+	}
+	device = fmt.Sprintf("%s (%s)", device, clientIP(info.ClientIP))
+	sw.Pusher().NewSession(accountID, info.ClientID, sk, device)
+
+	a := SessionAlert{
+		DeviceName: info.DeviceName,
+		Location:   location,
+		IP:         clientIP(info.ClientIP),
+		Time:       time.Now().UTC().Format(time.RFC1123),
+	}
+	if baseURL := strings.TrimRight(config.GetString(config.APIBaseURL), "/"); len(baseURL) > 0 {
+		if token := sw.Model().Session.CreateRevokeToken(sk); len(token) > 0 {
+			a.RevokeURL = baseURL + fmt.Sprintf(SessionRevokePath, token)
+		}
+	}
+	sw.Mailer().SendSessionAlert(accountID, a)
+}
+
+// location returns the approximate location of the ip or an empty string
+func (sw *Worker) location(ip string) string {
+	if sw.geo == nil {
+		return ""
+	}
+	return sw.geo.Lookup(ip)
+}
+
+// JobSessionCleanup removes the sessions which have been expired or timed out, and the expired
+// personal access tokens
+func JobSessionCleanup(b *BackgroundJob) {
+	if n := b.Model().Session.RemoveExpired(); n > 0 {
+		log.Info("sessions removed", zap.Int("Sessions", n))
+	}
+	if n := b.Model().PersonalToken.RemoveExpired(); n > 0 {
+		log.Info("personal access tokens removed", zap.Int("Tokens", n))
+	}
+}
+
+// network returns the network of the ip, /24 for IPv4 and /48 for IPv6, which the logins from the
+// same place are usually in
+func network(ip string) string {
+	addr := net.ParseIP(ip)
+	switch {
+	case addr == nil:
+		return ip
+	case addr.To4() != nil:
+		return addr.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	default:
+		return addr.Mask(net.CIDRMask(48, 128)).String() + "/48"
+	}
+}
+
+// deviceName returns a name for the device of the user agent, i.e. 'Chrome on Windows'. The native
+// clients are named by their platform.
+func deviceName(ua, os string) string {
+	var browser, platform string
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/") || strings.Contains(ua, "Opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(ua, "Windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad"):
+		platform = "iOS"
+	case strings.Contains(ua, "Android"):
+		platform = "Android"
+	case strings.Contains(ua, "Macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "Linux"):
+		platform = "Linux"
+	}
+	if len(platform) == 0 {
+		switch os {
+		case "android":
+			platform = "Android"
+		case "ios":
+			platform = "iOS"
+		}
+	}
+	switch {
+	case len(browser) > 0 && len(platform) > 0:
+		return fmt.Sprintf("%s on %s", browser, platform)
+	case len(browser) > 0:
+		return browser
+	case len(platform) > 0:
+		return platform
+	case len(ua) > 64:
+		return ua[:64]
+	case len(ua) > 0:
+		return ua
+	}
+	return "Unknown Device"
+}
+
+// SessionAlert is the email which is sent when a session is opened from a new device or network
+type SessionAlert struct {
+	Name       string
+	DeviceName string
+	Location   string
+	IP         string
+	Time       string
+	RevokeURL  string
+}
+
+var sessionAlertTemplate = template.Must(template.New("session_alert").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: Helvetica, Arial, sans-serif; color: #323d47; background: #f5f6f7; padding: 24px;">
+<div style="max-width: 600px; margin: auto; background: #fff; padding: 24px; border-radius: 4px;">
+	<h2 style="margin-top: 0;">Hi {{.Name}},</h2>
+	<p>Your Nested account has been logged in from a new device.</p>
+	<ul>
+		<li>Device: {{.DeviceName}}</li>
+		{{if .Location}}<li>Location: {{.Location}} (approximate)</li>{{end}}
+		<li>IP: {{.IP}}</li>
+		<li>Time: {{.Time}}</li>
+	</ul>
+	<p>If this was you, you could ignore this email.</p>
+	{{if .RevokeURL}}
+	<p>If this wasn't you, <a href="{{.RevokeURL}}">close this session</a> and change your password.</p>
+	{{else}}
+	<p>If this wasn't you, close this session in the settings of your account and change your password.</p>
+	{{end}}
+</div>
+</body>
+</html>`))
+
+// SendSessionAlert sends the alert of the new session to the email address of the account
+func (m *Mailer) SendSessionAlert(accountID string, a SessionAlert) {
+	account := m.worker.Model().Account.GetByID(accountID, nil)
+	if account == nil || len(account.Email) == 0 {
+		return
+	}
+	a.Name = account.FirstName
+	body := new(bytes.Buffer)
+	if err := sessionAlertTemplate.Execute(body, a); err != nil {
+		log.Warn("got error on executing session alert template", zap.Error(err))
+		return
+	}
+	bodyText, err := html2text.FromString(body.String())
+	if err != nil {
+		log.Warn("got error on converting session alert to text", zap.Error(err))
+		return
+	}
+
+	msg := mail.NewMessage(
+		mail.SetEncoding(mail.Base64),
+		mail.SetCharset("UTF-8"),
+	)
+	msg.SetHeader("Message-ID", fmt.Sprintf("<%s@%s>", nested.RandomID(32), m.domain))
+	msg.SetHeader("From", msg.FormatAddress(fmt.Sprintf("no-reply@%s", m.domain), "Nested"))
+	msg.SetHeader("To", msg.FormatAddress(account.Email, fmt.Sprintf("%s %s", account.FirstName, account.LastName)))
+	msg.SetHeader("Date", msg.FormatDate(time.Now()))
+	msg.SetHeader("Subject", "New login to your Nested account")
+	msg.SetHeader("Auto-Submitted", "auto-generated")
+	msg.SetBody("text/plain", bodyText)
+	msg.AddAlternative("text/html", body.String())
+
+	m.SendRequest(MailRequest{Message: msg})
+}
@@ -1,9 +1,12 @@
 package nestedServiceSession
 
 import (
+	"fmt"
+	"math"
 	"git.ronaksoft.com/nested/server/pkg/config"
 	"git.ronaksoft.com/nested/server/pkg/global"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
+	"git.ronaksoft.com/nested/server/pkg/rpc/api"
 	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
 	"strings"
 
@@ -125,6 +128,7 @@ func (s *SessionService) recall(_ *nested.Account, request *rpc.Request, respons
 		"server_timestamp": nested.Timestamp(),
 		"license_expired":  s.Worker().GetFlags().LicenseExpired,
 		"account":          s.Worker().Map().Account(*account, true),
+		"sync_seq":         s.Worker().Pusher().GetSyncSeq(account.ID),
 	}
 	switch os {
 	case global.PlatformAndroid:
@@ -145,11 +149,15 @@ func (s *SessionService) recall(_ *nested.Account, request *rpc.Request, respons
 }
 
 // @Command:	session/register
+// @CommandInfo:	if the account has two factor authentication, the request fails with 'totp' as incomplete
+// @CommandInfo:	until the code of the authenticator app (or a recovery code) is sent with uid & pass
 // @Input:	uid		string	*
 // @Input:	pass		string	*
+// @Input:	totp		string	+
 // @Input:	_did		string	+
 // @Input:	_dt		string	+
 // @Input:	_os		string	+
+// @Input:	_dn		string	+	(device name, i.e. 'Pixel 5')
 func (s *SessionService) register(requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	var uid, pass, did, dt, os string
 	if v, ok := request.Data["uid"].(string); ok {
@@ -182,57 +190,57 @@ func (s *SessionService) register(requester *nested.Account, request *rpc.Reques
 		}
 	}
 
-	account := s.Worker().Model().Account.GetByID(uid, nil)
+	if account := s.Worker().Model().Account.GetByID(uid, nil); account != nil && account.Disabled {
+		response.Error(global.ErrAccess, []string{"disabled"})
+		return
+	}
+
+	// verify if uid & pass are matched by the authentication backends, the users of the directory
+	// get their accounts on their first login
+	account, wait := s.Worker().Login(uid, pass, request.ClientIP)
+	if wait > 0 {
+		response.RateLimited([]string{"locked"}, int(math.Ceil(wait.Seconds())))
+		return
+	}
 	if account == nil {
 		response.Error(global.ErrInvalid, []string{"uid", "pass"})
 		return
 	}
-
+	// uid is what the user has typed, the directory may map it to another account (e.g. by email),
+	// so the account id is used from here on
 	if account.Disabled {
 		response.Error(global.ErrAccess, []string{"disabled"})
 		return
 	}
 
-	// verify if uid & pass are matched and found in our database
-	if !s.Worker().Model().Account.Verify(uid, pass) {
-		response.Error(global.ErrInvalid, []string{"uid", "pass"})
-		return
+	// the second step of the authentication
+	if account.Flags.TwoFactor {
+		code, _ := request.Data["totp"].(string)
+		if len(code) == 0 {
+			response.Error(global.ErrIncomplete, []string{"totp"})
+			return
+		}
+		ok, wait := s.Worker().CheckTwoFactor(account.ID, code, request.ClientIP)
+		if wait > 0 {
+			response.RateLimited([]string{"locked"}, int(math.Ceil(wait.Seconds())))
+			return
+		}
+		if !ok {
+			response.Error(global.ErrInvalid, []string{"totp"})
+			return
+		}
 	}
 
-	// increase the number of logins for the user account
-	s.Worker().Model().Account.IncreaseLogins(uid)
-
-	// Init the new session
-	info := nested.MS{
-		"ip": request.ClientIP,
-		"ua": request.UserAgent,
-	}
-	sk, err := s.Worker().Model().Session.Create(info)
+	sk, ss, err := s.Worker().CreateSession(account.ID, sessionInfo(request, did, dt, os))
 	if err != nil {
 		response.Error(global.ErrUnknown, []string{"_sk"})
 		return
 	}
-	ss := nested.RandomID(64)
-	session := s.Worker().Model().Session.GetByID(sk)
-	session.DeviceID = did
-	session.DeviceOS = os
-	session.SessionSecret = ss
-	session.AccountID = uid
-	session.DeviceToken = dt
-	session.ClientID = request.ClientID
-	session.ClientVersion = request.ClientVersion
-	session.Login()
-
-	// Register device in Pusher
-	if did != "" && dt != "" && os != "" {
-		_ = s.Worker().Pusher().RegisterDevice(did, dt, os, uid)
-	}
-
-	// Register websocket in Pusher
-	if len(request.WebsocketID) > 0 {
-		_ = s.Worker().Pusher().RegisterWebsocket(uid, did, config.GetString(config.BundleID), request.WebsocketID)
-	}
+	response.OkWithData(s.sessionResponse(account, sk, ss, os))
+}
 
+// sessionResponse is the response of the commands which open a new session
+func (s *SessionService) sessionResponse(account *nested.Account, sk bson.ObjectId, ss, os string) tools.M {
 	r := tools.M{
 		"_sk":              sk,
 		"_ss":              ss,
@@ -240,6 +248,9 @@ func (s *SessionService) register(requester *nested.Account, request *rpc.Reques
 		"license_expired":  s.Worker().GetFlags().LicenseExpired,
 		"account":          s.Worker().Map().Account(*account, true),
 	}
+	if !account.Flags.TwoFactor && api.TwoFactorRequired(account) {
+		r["two_factor_required"] = true
+	}
 	switch os {
 	case global.PlatformAndroid:
 		r["update"] = tools.M{
@@ -256,10 +267,22 @@ func (s *SessionService) register(requester *nested.Account, request *rpc.Reques
 			"description": "",
 		}
 	}
-	// Notification Handling
-	s.Worker().Pusher().NewSession(session.AccountID, request.ClientID)
+	return r
+}
 
-	response.OkWithData(r)
+func sessionInfo(request *rpc.Request, did, dt, os string) api.SessionInfo {
+	dn, _ := request.Data["_dn"].(string)
+	return api.SessionInfo{
+		ClientIP:      request.ClientIP,
+		UserAgent:     request.UserAgent,
+		ClientID:      request.ClientID,
+		ClientVersion: request.ClientVersion,
+		DeviceID:      did,
+		DeviceToken:   dt,
+		DeviceOS:      os,
+		DeviceName:    dn,
+		WebsocketID:   request.WebsocketID,
+	}
 }
 
 // @Command:	session/get_actives
@@ -272,9 +295,12 @@ func (s *SessionService) getAllActives(requester *nested.Account, request *rpc.R
 			"ua":          s.Security.UserAgent,
 			"creation_ip": s.Security.CreatorIP,
 			"last_ip":     s.Security.LastIP,
+			"created_on":  s.CreatedOn,
 			"last_access": s.LastAccess,
 			"_cid":        s.ClientID,
 			"_cver":       s.ClientVersion,
+			"device_name": s.DeviceName,
+			"location":    s.Security.Location,
 		})
 	}
 	response.OkWithData(tools.M{"sessions": r})
@@ -331,3 +357,77 @@ func (s *SessionService) closeAllActives(_ *nested.Account, request *rpc.Request
 	session.CloseOtherActives()
 	response.Ok()
 }
+
+// @Command:	session/sso_providers
+// @CommandInfo:	returns the single sign-on providers, clients open the login_url of the provider in the browser
+func (s *SessionService) getSSOProviders(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	r := make([]tools.M, 0)
+	for _, p := range s.Worker().SSOProviders() {
+		r = append(r, tools.M{
+			"name":      p.Name(),
+			"title":     p.Title(),
+			"login_url": fmt.Sprintf(api.SSOLoginPath, p.Name()),
+		})
+	}
+	response.OkWithData(tools.M{"providers": r})
+}
+
+// @Command:	session/sso_login
+// @CommandInfo:	finishes the single sign-on of the accounts which have two factor authentication, the ticket
+// @CommandInfo:	is given to the web app after the login at the provider and could be used only once
+// @Input:	ticket		string	*
+// @Input:	totp		string	*
+// @Input:	_did		string	+
+// @Input:	_dt		string	+
+// @Input:	_os		string	+
+// @Input:	_dn		string	+	(device name, i.e. 'Pixel 5')
+func (s *SessionService) ssoLogin(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
+	var ticket, code, did, dt, os string
+	if v, ok := request.Data["ticket"].(string); ok && len(v) > 0 {
+		ticket = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"ticket"})
+		return
+	}
+	if v, ok := request.Data["totp"].(string); ok && len(v) > 0 {
+		code = v
+	} else {
+		response.Error(global.ErrIncomplete, []string{"totp"})
+		return
+	}
+	if v, ok := request.Data["_did"].(string); ok {
+		did = v
+	}
+	if v, ok := request.Data["_dt"].(string); ok {
+		dt = v
+	}
+	if v, ok := request.Data["_os"].(string); ok {
+		os = strings.ToLower(v)
+	}
+
+	accountID := s.Worker().Model().Identity.ConsumeTicket(ticket)
+	if len(accountID) == 0 {
+		response.Error(global.ErrInvalid, []string{"ticket"})
+		return
+	}
+	account := s.Worker().Model().Account.GetByID(accountID, nil)
+	if account == nil || account.Disabled {
+		response.Error(global.ErrAccess, []string{"disabled"})
+		return
+	}
+	ok, wait := s.Worker().CheckTwoFactor(accountID, code, request.ClientIP)
+	if wait > 0 {
+		response.RateLimited([]string{"locked"}, int(math.Ceil(wait.Seconds())))
+		return
+	}
+	if !ok {
+		response.Error(global.ErrInvalid, []string{"totp"})
+		return
+	}
+	sk, ss, err := s.Worker().CreateSession(accountID, sessionInfo(request, did, dt, os))
+	if err != nil {
+		response.Error(global.ErrUnknown, []string{"_sk"})
+		return
+	}
+	response.OkWithData(s.sessionResponse(account, sk, ss, os))
+}
@@ -16,6 +16,8 @@ const (
 	CmdRecall          = "session/recall"
 	CmdRegister        = "session/register"
 	CmdGetActives      = "session/get_actives"
+	CmdSSOProviders    = "session/sso_providers"
+	CmdSSOLogin        = "session/sso_login"
 )
 
 type SessionService struct {
@@ -34,6 +36,8 @@ func NewSessionService(worker *api.Worker) api.Service {
 		CmdRecall:          {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.recall},
 		CmdRegister:        {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.register},
 		CmdGetActives:      {MinAuthLevel: api.AuthLevelUser, Execute: s.getAllActives},
+		CmdSSOProviders:    {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.getSSOProviders},
+		CmdSSOLogin:        {MinAuthLevel: api.AuthLevelUnauthorized, Execute: s.ssoLogin},
 	}
 
 	return s
@@ -46,7 +50,7 @@ func (s *SessionService) GetServicePrefix() string {
 func (s *SessionService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"git.ronaksoft.com/nested/server/pkg/sms"
+	"go.uber.org/zap"
+)
+
+// SMSReceiptPath is the path which the providers post the delivery receipts to, i.e. /sms/receipt/twilio
+const SMSReceiptPath = "/sms/receipt/%s"
+
+// newSMSGateway returns the gateway of the sms providers of the config. If the providers are not
+// set, the ADP configs are used for the Iranian phones.
+func newSMSGateway() *sms.Gateway {
+	cfgs, err := sms.ParseConfigs(config.GetString(config.SMSProviders))
+	if err != nil {
+		log.Warn("got error on parsing the sms providers", zap.Error(err))
+		return sms.NewGateway()
+	}
+	if len(cfgs) == 0 && len(config.GetString(config.ADPUsername)) > 0 {
+		cfgs = append(cfgs, sms.Config{
+			Name:     sms.ProviderADP,
+			Type:     sms.ProviderADP,
+			Prefixes: []string{"98"},
+			URL:      config.GetString(config.ADPMessageUrl),
+			Username: config.GetString(config.ADPUsername),
+			Password: config.GetString(config.ADPPassword),
+			Sender:   config.GetString(config.ADPSender),
+		})
+	}
+	baseURL := strings.TrimRight(config.GetString(config.APIBaseURL), "/")
+	providers := make([]sms.SMSProvider, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if len(baseURL) > 0 {
+			cfg.ReceiptURL = baseURL + fmt.Sprintf(SMSReceiptPath, cfg.Name)
+		}
+		p, err := sms.New(cfg)
+		if err != nil {
+			log.Warn("got error on initializing the sms provider", zap.String("Provider", cfg.Name), zap.Error(err))
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return sms.NewGateway(providers...)
+}
+
+// SendSMS sends the text to the phone through the sms providers
+func (sw *Worker) SendSMS(phone, text string) error {
+	_, _, err := sw.sms.SendSMS(phone, text)
+	return err
+}
+
+// SendVerificationCode sends the code of the verification to its phone by sms. The delivery receipt
+// of the message updates the counters of the verification.
+func (sw *Worker) SendVerificationCode(v *nested.Verification) error {
+	provider, messageID, err := sw.sms.SendSMS(v.Phone, fmt.Sprintf("Nested verification code is: %s", v.ShortCode))
+	if err != nil {
+		log.Warn("got error on sending verification code", zap.String("Phone", v.Phone), zap.Error(err))
+		return err
+	}
+	if len(messageID) > 0 {
+		sw.Model().Verification.AddMessage(v.ID, provider, messageID)
+	}
+	return nil
+}
+
+// CallVerificationCode calls the phone of the verification and reads its code
+func (sw *Worker) CallVerificationCode(v *nested.Verification) error {
+	digits := strings.Join(strings.Split(v.ShortCode, ""), ", ")
+	provider, callID, err := sw.sms.Call(v.Phone, fmt.Sprintf("Your Nested verification code is: %s.", digits))
+	if err != nil {
+		log.Warn("got error on calling verification code", zap.String("Phone", v.Phone), zap.Error(err))
+		return err
+	}
+	if len(callID) > 0 {
+		sw.Model().Verification.AddMessage(v.ID, provider, callID)
+	}
+	return nil
+}
+
+// SMSReceipt handles the delivery receipt which the provider has posted
+func (sw *Worker) SMSReceipt(provider string, r *http.Request) error {
+	receipt, err := sw.sms.ParseReceipt(provider, r)
+	if err != nil {
+		return err
+	}
+	switch receipt.Status {
+	case sms.StatusDelivered:
+		sw.Model().Verification.UpdateDelivery(provider, receipt.MessageID, true)
+	case sms.StatusFailed:
+		sw.Model().Verification.UpdateDelivery(provider, receipt.MessageID, false)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"git.ronaksoft.com/nested/server/pkg/oidc"
+	"go.uber.org/zap"
+)
+
+const (
+	// SSOLoginPath is the path of the login endpoint of the providers, i.e. /oidc/google/login
+	SSOLoginPath = "/oidc/%s/login"
+	// SSOStateCookie binds the state to the browser which has started the login, so the callback of
+	// a login could not be opened in another browser (login CSRF)
+	SSOStateCookie = "nested_sso_state"
+)
+
+var (
+	ErrSSOUnknownProvider = errors.New("sso: unknown provider")
+	ErrSSOInvalidState    = errors.New("sso: invalid state")
+	ErrSSONoAccount       = errors.New("sso: account could not be created")
+	ErrSSODisabled        = errors.New("sso: account is disabled")
+	ErrSSOAdminLink       = errors.New("sso: admin accounts are not linked by email")
+)
+
+// invalidUIDChars are the characters of the usernames of the providers which are not allowed in uids
+var invalidUIDChars = regexp.MustCompile("[^a-z0-9-_]+")
+
+// newSSOProviders returns the identity providers of the config
+func newSSOProviders() []*oidc.Provider {
+	cfgs, err := oidc.ParseConfigs(config.GetString(config.OIDCProviders))
+	if err != nil {
+		log.Warn("got error on parsing the oidc providers", zap.Error(err))
+		return nil
+	}
+	providers := make([]*oidc.Provider, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if len(cfg.RedirectURL) == 0 {
+			cfg.RedirectURL = fmt.Sprintf("%s/oidc/%s/callback", strings.TrimRight(config.GetString(config.OIDCBaseURL), "/"), cfg.Name)
+		}
+		providers = append(providers, oidc.NewProvider(cfg))
+	}
+	return providers
+}
+
+// SSOProviders returns the configured identity providers
+func (sw *Worker) SSOProviders() []*oidc.Provider {
+	return sw.ssoProviders
+}
+
+func (sw *Worker) ssoProvider(name string) *oidc.Provider {
+	for _, p := range sw.ssoProviders {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// SSOStateHash returns the value of SSOStateCookie for the state
+func SSOStateHash(state string) string {
+	h := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(h[:])
+}
+
+// StartSSO returns the url of the login page of the provider and the state of the login, the hash of
+// the state must be kept in SSOStateCookie of the browser.
+func (sw *Worker) StartSSO(providerName string) (string, string, error) {
+	p := sw.ssoProvider(providerName)
+	if p == nil {
+		return "", "", ErrSSOUnknownProvider
+	}
+	state := oidc.RandomString(24)
+	verifier, challenge := oidc.NewCodeVerifier()
+	s := nested.SSOState{
+		Provider:     p.Name(),
+		Nonce:        oidc.RandomString(24),
+		CodeVerifier: verifier,
+	}
+	if !sw.Model().Identity.CreateState(state, s) {
+		return "", "", fmt.Errorf("sso: could not keep the state")
+	}
+	authURL, err := p.AuthCodeURL(state, s.Nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, state, nil
+}
+
+// FinishSSO redeems the code of the provider and returns the account of the user. stateHash is the
+// value of SSOStateCookie of the browser which must match the state. Users which are not linked yet
+// are linked to the account of their verified email unless it is an admin, or a new account is
+// created for them from their claims.
+func (sw *Worker) FinishSSO(providerName, state, stateHash, code string) (*nested.Account, error) {
+	if len(state) == 0 || subtle.ConstantTimeCompare([]byte(stateHash), []byte(SSOStateHash(state))) != 1 {
+		return nil, ErrSSOInvalidState
+	}
+	s := sw.Model().Identity.ConsumeState(state)
+	if s == nil || s.Provider != providerName {
+		return nil, ErrSSOInvalidState
+	}
+	p := sw.ssoProvider(providerName)
+	if p == nil {
+		return nil, ErrSSOUnknownProvider
+	}
+	token, err := p.Exchange(code, s.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	id, err := p.Verify(token.IDToken, s.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := sw.identityAccount(p.Name(), id)
+	if err != nil {
+		return nil, err
+	}
+	if account.Disabled {
+		return nil, ErrSSODisabled
+	}
+	return account, nil
+}
+
+func (sw *Worker) identityAccount(provider string, id *oidc.Identity) (*nested.Account, error) {
+	if identity := sw.Model().Identity.Get(provider, id.Subject); identity != nil {
+		if account := sw.Model().Account.GetByID(identity.AccountID, nil); account != nil {
+			return account, nil
+		}
+		return nil, ErrSSONoAccount
+	}
+
+	// link the existing account by the email only if the provider has verified it. The admins are
+	// never linked automatically, otherwise whoever controls their email at the provider owns them.
+	if id.EmailVerified && len(id.Email) > 0 {
+		if account := sw.Model().Account.GetByEmail(id.Email, nil); account != nil {
+			if account.Authority.Admin {
+				return nil, ErrSSOAdminLink
+			}
+			if !sw.Model().Identity.Link(provider, id.Subject, account.ID, id.Email) {
+				return nil, ErrSSONoAccount
+			}
+			return account, nil
+		}
+	}
+
+	uid := sw.availableUID(id)
+	if len(uid) == 0 {
+		return nil, ErrSSONoAccount
+	}
+	email := id.Email
+	if !id.EmailVerified {
+		email = ""
+	}
+	if !sw.createExternalAccount(uid, id.FirstName, id.LastName, email) {
+		return nil, ErrSSONoAccount
+	}
+	if !sw.Model().Identity.Link(provider, id.Subject, uid, id.Email) {
+		return nil, ErrSSONoAccount
+	}
+	if account := sw.Model().Account.GetByID(uid, nil); account != nil {
+		return account, nil
+	}
+	return nil, ErrSSONoAccount
+}
+
+// availableUID returns a free uid based on the username or the email of the identity
+func (sw *Worker) availableUID(id *oidc.Identity) string {
+	base := id.UID
+	if len(base) == 0 {
+		base = strings.Split(id.Email, "@")[0]
+	}
+	base = strings.Trim(invalidUIDChars.ReplaceAllString(strings.ToLower(base), ""), "-_")
+	if len(base) > 24 {
+		base = base[:24]
+	}
+	if len(base) < 3 || base[0] < 'a' || base[0] > 'z' {
+		base = "user" + base
+	}
+	uid := base
+	for i := 0; i < 5; i++ {
+		matched, _ := regexp.MatchString(global.DefaultRegexAccountID, uid)
+		if matched && !sw.Model().Account.Exists(uid) && !sw.Model().Place.Exists(uid) {
+			return uid
+		}
+		uid = fmt.Sprintf("%s%d", base, 1000+rand.Intn(9000))
+	}
+	return ""
+}
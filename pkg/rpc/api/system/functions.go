@@ -52,6 +52,27 @@ func (s *SystemService) getSystemStringConstants(_ *nested.Account, _ *rpc.Reque
 // @Input:  place_max_creators				int		+
 // @Input:  place_max_keyholders				int		+
 // @Input:  register_mode					    int		+	(1: everyone, 2: admin_only)
+// @Input:  two_factor_policy				int		+	(1: optional, 2: required for admins, 3: required for everyone)
+// @Input:  rate_limit						int		+	(requests per minute, 0: unlimited)
+// @Input:  rate_limit_burst					int		+
+// @Input:  rate_limit_auth					int		+
+// @Input:  rate_limit_auth_burst			int		+
+// @Input:  rate_limit_post_add				int		+
+// @Input:  rate_limit_post_add_burst		int		+
+// @Input:  rate_limit_search				int		+
+// @Input:  rate_limit_search_burst			int		+
+// @Input:  rate_limit_ip_factor				int		+	(the limits of each client ip are multiplied by it)
+// @Input:  lockout_threshold				int		+	(failed logins of an account before it is locked, 0: never)
+// @Input:  lockout_ip_threshold				int		+	(failed logins of a client ip before it is locked, 0: never)
+// @Input:  lockout_duration					int		+	(seconds of the first lockout, the next ones are doubled)
+// @Input:  lockout_max_duration				int		+	(seconds)
+// @Input:  password_min_length				int		+
+// @Input:  password_min_classes				int		+	(lower, upper, digit and symbol, 0: no class is required)
+// @Input:  password_no_account_info			int		+	(1: passwords must not contain the username or the name)
+// @Input:  password_history					int		+	(last passwords which cannot be reused, 0: disabled)
+// @Input:  password_max_age					int		+	(days which passwords must be changed after, 0: never)
+// @Input:  session_idle_timeout				int		+	(minutes which idle sessions are closed after, 0: never)
+// @Input:  session_lifetime					int		+	(minutes which sessions are closed after their creation, 0: never)
 func (s *SystemService) setSystemIntegerConstants(_ *nested.Account, request *rpc.Request, response *rpc.Response) {
 	if len(request.Data) > global.DefaultMaxResultLimit {
 		response.Error(global.ErrLimit, []string{"too many parameters"})
@@ -133,6 +154,7 @@ func (s *SystemService) monitorActivity(_ *nested.Account, request *rpc.Request,
 	}
 	response.OkWithData(tools.M{
 		"apis": s.Worker().Model().Report.GetAPICounters(),
+		"push": s.Worker().Pusher().PushMetrics(),
 	})
 }
 
@@ -49,33 +49,33 @@ func NewTaskService(worker *api.Worker) api.Service {
 	s.worker = worker
 
 	s.serviceCommands = api.ServiceCommands{
-		CmdCreate:            {MinAuthLevel: api.AuthLevelAppL1, Execute: s.create},
-		CmdRemove:            {MinAuthLevel: api.AuthLevelAppL1, Execute: s.remove},
-		CmdAddComment:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addComment},
-		CmdAddAttachment:     {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addAttachment},
-		CmdAddLabel:          {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addLabel},
-		CmdAddTodo:           {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addTodo},
-		CmdAddWatcher:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addWatcher},
-		CmdAddCandidate:      {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addCandidate},
-		CmdAddEditor:         {MinAuthLevel: api.AuthLevelAppL1, Execute: s.addEditor},
-		CmdRemoveAttachment:  {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeAttachment},
-		CmdRemoveLabel:       {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeLabel},
-		CmdRemoveTodo:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeTodo},
-		CmdRemoveWatcher:     {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeWatcher},
-		CmdRemoveCandidate:   {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeCandidate},
-		CmdRemoveEditor:      {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeEditor},
-		CmdRemoveComment:     {MinAuthLevel: api.AuthLevelAppL1, Execute: s.removeComment},
-		CmdGetMany:           {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getMany},
-		CmdGetByFilter:       {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getByFilter},
-		CmdGetByCustomFilter: {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getByCustomFilter},
-		CmdGetActivities:     {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getActivities},
-		CmdGetManyActivities: {MinAuthLevel: api.AuthLevelAppL1, Execute: s.getManyActivities},
-		CmdUpdate:            {MinAuthLevel: api.AuthLevelAppL1, Execute: s.update},
-		CmdUpdateTodo:        {MinAuthLevel: api.AuthLevelAppL1, Execute: s.updateTodo},
-		CmdUpdateAssignee:    {MinAuthLevel: api.AuthLevelAppL1, Execute: s.updateAssignee},
-		CmdRespond:           {MinAuthLevel: api.AuthLevelAppL1, Execute: s.respond},
-		CmdSetStatus:         {MinAuthLevel: api.AuthLevelAppL1, Execute: s.setStatus},
-		CmdSetState:          {MinAuthLevel: api.AuthLevelAppL1, Execute: s.setState},
+		CmdCreate:            {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.create},
+		CmdRemove:            {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.remove},
+		CmdAddComment:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addComment},
+		CmdAddAttachment:     {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addAttachment},
+		CmdAddLabel:          {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addLabel},
+		CmdAddTodo:           {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addTodo},
+		CmdAddWatcher:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addWatcher},
+		CmdAddCandidate:      {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addCandidate},
+		CmdAddEditor:         {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.addEditor},
+		CmdRemoveAttachment:  {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeAttachment},
+		CmdRemoveLabel:       {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeLabel},
+		CmdRemoveTodo:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeTodo},
+		CmdRemoveWatcher:     {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeWatcher},
+		CmdRemoveCandidate:   {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeCandidate},
+		CmdRemoveEditor:      {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeEditor},
+		CmdRemoveComment:     {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.removeComment},
+		CmdGetMany:           {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskRead, Execute: s.getMany},
+		CmdGetByFilter:       {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskRead, Execute: s.getByFilter},
+		CmdGetByCustomFilter: {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskRead, Execute: s.getByCustomFilter},
+		CmdGetActivities:     {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskRead, Execute: s.getActivities},
+		CmdGetManyActivities: {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskRead, Execute: s.getManyActivities},
+		CmdUpdate:            {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.update},
+		CmdUpdateTodo:        {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.updateTodo},
+		CmdUpdateAssignee:    {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.updateAssignee},
+		CmdRespond:           {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.respond},
+		CmdSetStatus:         {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.setStatus},
+		CmdSetState:          {MinAuthLevel: api.AuthLevelAppL1, Scope: api.ScopeTaskWrite, Execute: s.setState},
 	}
 	return s
 }
@@ -87,7 +87,7 @@ func (s *TaskService) GetServicePrefix() string {
 func (s *TaskService) ExecuteCommand(authLevel api.AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
 	commandName := request.Command
 	if cmd, ok := s.serviceCommands[commandName]; ok {
-		if authLevel >= cmd.MinAuthLevel {
+		if cmd.Authorized(authLevel, request) {
 			cmd.Execute(requester, request, response)
 		} else {
 			response.NotAuthorized()
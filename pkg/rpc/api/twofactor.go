@@ -0,0 +1,170 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/nested"
+	"git.ronaksoft.com/nested/server/pkg/config"
+	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/log"
+	tools "git.ronaksoft.com/nested/server/pkg/toolbox"
+	"git.ronaksoft.com/nested/server/pkg/totp"
+	"go.uber.org/zap"
+)
+
+const (
+	// TwoFactorRecoveryCodes is the number of the recovery codes which are issued for each account
+	TwoFactorRecoveryCodes = 10
+	// twoFactorSkew is the number of the time steps which are accepted before and after now
+	twoFactorSkew = 1
+)
+
+// ErrNoSecretsKey is returned if two factor is enrolled while SECRETS_KEY is not set, the secrets
+// are not stored by a key which is known to everyone (i.e. the default SYSTEM_API_KEY).
+var ErrNoSecretsKey = errors.New("SECRETS_KEY is not set")
+
+// TwoFactorRequired returns TRUE if the policy of the system requires the account to have 2FA
+func TwoFactorRequired(account *nested.Account) bool {
+	switch global.TwoFactorPolicy {
+	case global.TwoFactorPolicyEveryone:
+		return true
+	case global.TwoFactorPolicyAdmins:
+		return account.Authority.Admin
+	default:
+		return false
+	}
+}
+
+// twoFactorAllowed returns TRUE if the command could be called by the accounts which must enroll
+// two factor authentication but have not done it yet.
+func twoFactorAllowed(cmd string) bool {
+	switch {
+	case strings.HasPrefix(cmd, "session/"), strings.HasPrefix(cmd, "account/totp_"), cmd == "account/get":
+		return true
+	default:
+		return false
+	}
+}
+
+// EnrollTwoFactor generates a new secret for the account and returns it with its provisioning uri.
+// The secret is not active until it is confirmed by ConfirmTwoFactor.
+func (sw *Worker) EnrollTwoFactor(account *nested.Account) (string, string, error) {
+	if len(secretsKey()) == 0 {
+		return "", "", ErrNoSecretsKey
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := tools.Encrypt(secretsKey(), []byte(secret))
+	if err != nil {
+		return "", "", err
+	}
+	if !sw.Model().TwoFactor.Enroll(account.ID, sealed) {
+		return "", "", fmt.Errorf("could not enroll")
+	}
+	return secret, totp.ProvisioningURI(global.DefaultCompanyName, account.ID, secret), nil
+}
+
+// ConfirmTwoFactor enables the enrolled two factor if the code is valid and returns the recovery codes
+func (sw *Worker) ConfirmTwoFactor(accountID, code string) ([]string, bool) {
+	tf := sw.Model().TwoFactor.Get(accountID)
+	if tf == nil || tf.Enabled {
+		return nil, false
+	}
+	step, ok := sw.validateTOTP(tf, code)
+	if !ok {
+		return nil, false
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Warn("got error on generating recovery codes", zap.Error(err), zap.String("AccountID", accountID))
+		return nil, false
+	}
+	if !sw.Model().TwoFactor.Enable(accountID, hashes, step) {
+		return nil, false
+	}
+	return codes, true
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the account with the new ones
+func (sw *Worker) RegenerateRecoveryCodes(accountID string) []string {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Warn("got error on generating recovery codes", zap.Error(err), zap.String("AccountID", accountID))
+		return nil
+	}
+	if !sw.Model().TwoFactor.SetRecoveryCodes(accountID, hashes) {
+		return nil
+	}
+	return codes
+}
+
+// VerifyTwoFactor checks the code of the authenticator app or one of the recovery codes. Each code
+// is accepted only once.
+func (sw *Worker) VerifyTwoFactor(accountID, code string) bool {
+	tf := sw.Model().TwoFactor.Get(accountID)
+	if tf == nil || !tf.Enabled {
+		return false
+	}
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		step, ok := sw.validateTOTP(tf, code)
+		return ok && sw.Model().TwoFactor.UseStep(accountID, step)
+	}
+	return sw.Model().TwoFactor.UseRecoveryCode(accountID, hashRecoveryCode(code))
+}
+
+func (sw *Worker) validateTOTP(tf *nested.TwoFactor, code string) (int64, bool) {
+	secret, err := tools.Decrypt(secretsKey(), tf.Secret)
+	if err != nil {
+		log.Warn("got error on decrypting two factor secret", zap.Error(err), zap.String("AccountID", tf.ID))
+		return 0, false
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now(), twoFactorSkew)
+	if !ok || step <= tf.LastStep {
+		return 0, false
+	}
+	return step, true
+}
+
+// newRecoveryCodes returns the recovery codes and their hashes which are stored in the db. The
+// letters are picked uniformly by rand.Int, since the modulo of the random bytes would favor some.
+func newRecoveryCodes() ([]string, []string, error) {
+	const letters = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, 0, TwoFactorRecoveryCodes)
+	hashes := make([]string, 0, TwoFactorRecoveryCodes)
+	b := make([]byte, 10)
+	max := big.NewInt(int64(len(letters)))
+	for i := 0; i < TwoFactorRecoveryCodes; i++ {
+		for j := range b {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			b[j] = letters[n.Int64()]
+		}
+		code := fmt.Sprintf("%s-%s", b[:5], b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	h := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(h[:])
+}
+
+// secretsKey returns the key which encrypts the secrets in the db
+func secretsKey() string {
+	return config.GetString(config.SecretsKey)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	Convey("Recovery Codes", t, func(c C) {
+		codes, hashes, err := newRecoveryCodes()
+		c.So(err, ShouldBeNil)
+		c.So(codes, ShouldHaveLength, TwoFactorRecoveryCodes)
+		c.So(hashes, ShouldHaveLength, TwoFactorRecoveryCodes)
+		for i, code := range codes {
+			c.So(regexp.MustCompile(`^[a-hjkmnp-z2-9]{5}-[a-hjkmnp-z2-9]{5}$`).MatchString(code), ShouldBeTrue)
+			c.So(hashes[i], ShouldEqual, hashRecoveryCode(code))
+			// the users may type the codes in upper case and without the dash
+			c.So(hashRecoveryCode(" "+strings.ToUpper(code[:5]+code[6:])+" "), ShouldEqual, hashes[i])
+		}
+
+		// every letter of the alphabet is picked
+		counts := map[rune]int{}
+		for i := 0; i < 50; i++ {
+			codes, _, _ := newRecoveryCodes()
+			for _, code := range codes {
+				for _, r := range code {
+					counts[r]++
+				}
+			}
+		}
+		delete(counts, '-')
+		c.So(counts, ShouldHaveLength, 31)
+	})
+}
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"git.ronaksoft.com/nested/server/pkg/geoip"
 	"git.ronaksoft.com/nested/server/pkg/global"
+	"git.ronaksoft.com/nested/server/pkg/ldap"
+	"git.ronaksoft.com/nested/server/pkg/oidc"
+	"git.ronaksoft.com/nested/server/pkg/password"
 	"git.ronaksoft.com/nested/server/pkg/pusher"
 	"git.ronaksoft.com/nested/server/pkg/rpc"
+	"git.ronaksoft.com/nested/server/pkg/sms"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +48,11 @@ type Worker struct {
 	services       map[string]Service
 	pusher         *pusher.Pusher
 	backgroundJobs []*BackgroundJob
+	directory      *ldap.Directory
+	ssoProviders   []*oidc.Provider
+	breached       *password.BreachedList
+	geo            *geoip.DB
+	sms            *sms.Gateway
 	flags          Flags
 
 	// License
@@ -56,6 +67,11 @@ func NewWorker(model *nested.Manager, pusher *pusher.Pusher) *Worker {
 	sw.mapper = NewMapper(sw)
 	sw.argument = NewArgumentHandler(sw)
 	sw.mailer = NewMailer(sw)
+	sw.directory = newDirectory()
+	sw.ssoProviders = newSSOProviders()
+	sw.breached = newBreachedList()
+	sw.geo = newGeoIP()
+	sw.sms = newSMSGateway()
 
 	return sw
 }
@@ -72,7 +88,7 @@ func (sw *Worker) Execute(request *rpc.Request, response *rpc.Response) {
 	}
 
 	// authLevel initialized to UNAUTHORIZED, and if SessionSecret and SessionKey checked
-	// and at the last step AppToken will be checked.
+	// then the personal access token and at the last step AppToken will be checked.
 	authLevel := AuthLevelUnauthorized
 	if len(request.SessionSec) > 0 && request.SessionKey.Valid() {
 		if sw.Model().Session.Verify(request.SessionKey, request.SessionSec) {
@@ -91,14 +107,34 @@ func (sw *Worker) Execute(request *rpc.Request, response *rpc.Response) {
 			response.Error(global.ErrInvalid, []string{"session invalid"})
 			return
 		}
+	} else if len(request.AccessToken) > 0 {
+		// Personal access tokens are limited to their scopes like the apps
+		pt := sw.Model().PersonalToken.GetByToken(request.AccessToken)
+		if pt == nil || !pt.Active() {
+			response.Error(global.ErrInvalid, []string{"token invalid"})
+			return
+		}
+		requester = sw.Model().Account.GetByID(pt.AccountID, nil)
+		if requester == nil || requester.Disabled {
+			response.Error(global.ErrInvalid, []string{"token invalid"})
+			return
+		}
+		authLevel = AuthLevelAppL3
+		request.AppScopes = pt.Scopes
+		if nested.Timestamp()-pt.LastUsedOn > uint64(nested.SessionTouchInterval.Milliseconds()) {
+			sw.Model().PersonalToken.UpdateLastUsed(pt.ID, clientIP(request.ClientIP))
+		}
 	} else if len(request.AppToken) > 0 {
 		appToken := sw.Model().Token.GetAppToken(request.AppToken)
-		if appToken != nil && !appToken.Expired {
+		if appToken != nil && appToken.Active() {
 			app := sw.Model().App.GetByID(appToken.AppID)
 			if app != nil && appToken.AppID == app.ID {
 				requester = sw.Model().Account.GetByID(appToken.AccountID, nil)
-				// TODO (Ehsan):: app levels must be set here
-				authLevel = AuthLevelAppL3
+				if requester != nil {
+					// The app is limited to the scopes which the user has granted
+					authLevel = AuthLevelAppL3
+					request.AppScopes = GrantedScopes(*appToken)
+				}
 			}
 		}
 	}
@@ -108,6 +144,28 @@ func (sw *Worker) Execute(request *rpc.Request, response *rpc.Response) {
 		return
 	}
 
+	if request.Command == CmdBatch {
+		sw.executeBatch(authLevel, requester, request, response)
+		return
+	}
+	sw.executeCommand(authLevel, requester, request, response)
+}
+
+// executeCommand passes the authenticated request to the appropriate service
+func (sw *Worker) executeCommand(authLevel AuthLevel, requester *nested.Account, request *rpc.Request, response *rpc.Response) {
+	// Throttle the clients which have exceeded their budget
+	if wait := sw.checkRateLimit(requester, request); wait > 0 {
+		response.RateLimited([]string{RateLimitGroup(request.Command)}, int(math.Ceil(wait.Seconds())))
+		return
+	}
+
+	// The accounts which must have 2FA could only enroll it until they do
+	if requester != nil && authLevel >= AuthLevelUser && !requester.Flags.TwoFactor &&
+		TwoFactorRequired(requester) && !twoFactorAllowed(request.Command) {
+		response.Error(global.ErrAccess, []string{"two_factor_required"})
+		return
+	}
+
 	// Increment Query Counter
 	sw.Model().Report.CountRequests()
 	sw.Model().Report.CountAPI(request.Command)
@@ -127,8 +185,6 @@ func (sw *Worker) Execute(request *rpc.Request, response *rpc.Response) {
 	// Collect data for system report
 	sw.Model().Report.CountProcessTime(processTime)
 	sw.Model().Report.CountDataIn(request.PacketSize)
-
-	return
 }
 
 func (sw *Worker) RegisterService(serviceInitiators ...ServiceInitiator) {
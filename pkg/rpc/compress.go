@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Supported payload encodings, 'deflate' is the zlib format as it is in HTTP
+const (
+	EncodingIdentity = ""
+	EncodingGzip     = "gzip"
+	EncodingDeflate  = "deflate"
+)
+
+// MaxDecompressedSize protects the server against the compressed payloads which expand too much
+const MaxDecompressedSize = 32 << 20
+
+// NegotiateEncoding returns the preferred encoding which the client accepts. acceptEncoding is in
+// the format of the Accept-Encoding header, i.e. 'gzip, deflate;q=0.5'.
+func NegotiateEncoding(acceptEncoding string) string {
+	best, bestQ := EncodingIdentity, 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		enc := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				_, _ = fmt.Sscanf(f[2:], "%g", &q)
+			}
+		}
+		switch enc {
+		case EncodingGzip, EncodingDeflate:
+		default:
+			continue
+		}
+		// q=0 means the client does not accept the encoding
+		if q <= 0 {
+			continue
+		}
+		// gzip wins the ties
+		if q > bestQ || (q == bestQ && enc == EncodingGzip) {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// Compress encodes data with the encoding
+func Compress(encoding string, data []byte) ([]byte, error) {
+	var (
+		buf = new(bytes.Buffer)
+		w   io.WriteCloser
+		err error
+	)
+	switch encoding {
+	case EncodingGzip:
+		w, err = gzip.NewWriterLevel(buf, gzip.DefaultCompression)
+	case EncodingDeflate:
+		w, err = zlib.NewWriterLevel(buf, flate.DefaultCompression)
+	case EncodingIdentity:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decodes data which has been encoded with the encoding
+func Decompress(encoding string, data []byte) ([]byte, error) {
+	r, err := NewDecompressReader(encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// NewDecompressReader returns a reader which decodes r
+func NewDecompressReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case EncodingGzip, "x-gzip":
+		return gzip.NewReader(r)
+	case EncodingDeflate:
+		return zlib.NewReader(r)
+	case EncodingIdentity, "identity":
+		return ioutil.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// DetectEncoding returns the encoding of the payload by its magic bytes
+func DetectEncoding(data []byte) string {
+	switch {
+	case len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b:
+		return EncodingGzip
+	case len(data) >= 2 && data[0]&0x0f == 8 && (uint16(data[0])<<8|uint16(data[1]))%31 == 0:
+		return EncodingDeflate
+	default:
+		return EncodingIdentity
+	}
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxDecompressedSize {
+		return nil, fmt.Errorf("decompressed payload is larger than %d bytes", MaxDecompressedSize)
+	}
+	return data, nil
+}
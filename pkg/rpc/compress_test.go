@@ -0,0 +1,52 @@
+package rpc_test
+
+import (
+	"bytes"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/rpc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompress(t *testing.T) {
+	Convey("Compress", t, func(c C) {
+		Convey("Negotiate Encoding", func(c C) {
+			for acceptEncoding, encoding := range map[string]string{
+				"":                            rpc.EncodingIdentity,
+				"br, identity":                rpc.EncodingIdentity,
+				"gzip":                        rpc.EncodingGzip,
+				"GZIP , deflate":              rpc.EncodingGzip,
+				"deflate, gzip":               rpc.EncodingGzip,
+				"gzip;q=0.5, deflate":         rpc.EncodingDeflate,
+				"deflate;q=0.8, gzip; q=0.8":  rpc.EncodingGzip,
+				"gzip;q=0, deflate;q=0.1":     rpc.EncodingDeflate,
+				"gzip;q=0":                    rpc.EncodingIdentity,
+				"gzip;q=0.0, deflate;q=0.000": rpc.EncodingIdentity,
+			} {
+				c.So(rpc.NegotiateEncoding(acceptEncoding), ShouldEqual, encoding)
+			}
+		})
+		Convey("Round Trip", func(c C) {
+			data := bytes.Repeat([]byte(`{"status":"ok","data":{}}`), 100)
+			for _, encoding := range []string{rpc.EncodingGzip, rpc.EncodingDeflate, rpc.EncodingIdentity} {
+				b, err := rpc.Compress(encoding, data)
+				c.So(err, ShouldBeNil)
+				c.So(rpc.DetectEncoding(b), ShouldEqual, encoding)
+				if encoding != rpc.EncodingIdentity {
+					c.So(len(b), ShouldBeLessThan, len(data))
+				}
+				d, err := rpc.Decompress(encoding, b)
+				c.So(err, ShouldBeNil)
+				c.So(d, ShouldResemble, data)
+			}
+			_, err := rpc.Compress("br", data)
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Decompress Limit", func(c C) {
+			b, err := rpc.Compress(rpc.EncodingGzip, make([]byte, rpc.MaxDecompressedSize+1))
+			c.So(err, ShouldBeNil)
+			_, err = rpc.Decompress(rpc.EncodingGzip, b)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
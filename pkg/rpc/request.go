@@ -31,5 +31,7 @@ type Request struct {
 	WebsocketID     string        `json:"ws_id"`
 	Data            tools.M       `json:"data"`
 	PacketSize      int           `json:"-"`
+	AppScopes       []string      `json:"-"`
+	AccessToken     string        `json:"-"` // personal access token, i.e. 'Authorization: Bearer' header of the http gateway
 	ResponseChannel chan Response
 }
@@ -33,6 +33,21 @@ func (r *Response) Error(code global.ErrorCode, items []string) {
 	}
 }
 
+// RateLimited tells the client to retry after retryAfter seconds
+func (r *Response) RateLimited(items []string, retryAfter int) {
+	r.Error(global.ErrRateLimit, items)
+	r.Data["retry_after"] = retryAfter
+}
+
+// RetryAfter returns the seconds which the client must wait if it has been rate limited
+func (r *Response) RetryAfter() int {
+	if r.Status != "err" || r.Data == nil {
+		return 0
+	}
+	retryAfter, _ := r.Data["retry_after"].(int)
+	return retryAfter
+}
+
 func (r *Response) NotImplemented() {
 	r.Type = "r"
 	r.Status = "err"
@@ -0,0 +1,36 @@
+package scim
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Filter is the 'attribute eq "value"' filter which the identity providers use to find the
+// resources. Other filters are not supported. Attribute is empty if there is no filter.
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+// ParseFilter parses the filter, the names of the attributes are case-insensitive
+func ParseFilter(s string) (Filter, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return Filter{}, nil
+	}
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) != 3 || !strings.EqualFold(fields[1], "eq") {
+		return Filter{}, NewError(http.StatusBadRequest, ErrTypeInvalidFilter, "only 'eq' filters are supported")
+	}
+	value := strings.TrimSpace(fields[2])
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	} else if value != "true" && value != "false" {
+		return Filter{}, NewError(http.StatusBadRequest, ErrTypeInvalidFilter, "invalid value")
+	}
+	return Filter{
+		Attribute: strings.ToLower(fields[0]),
+		Value:     value,
+	}, nil
+}
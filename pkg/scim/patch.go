@@ -0,0 +1,247 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Patch Operations
+const (
+	PatchAdd     = "add"
+	PatchReplace = "replace"
+	PatchRemove  = "remove"
+)
+
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+var (
+	userAttributes = []string{
+		"externalId", "userName", "name", "displayName", "emails", "active", "password",
+	}
+	groupAttributes = []string{
+		"externalId", "displayName", "members", SchemaGroupNested,
+	}
+)
+
+// PatchUser applies the operations to the user
+func PatchUser(u *User, ops []PatchOperation) error {
+	m, err := patch(u, ops, SchemaUser, userAttributes)
+	if err != nil {
+		return err
+	}
+	// some identity providers send the booleans as strings
+	if s, ok := m["active"].(string); ok {
+		m["active"] = strings.EqualFold(s, "true")
+	}
+	*u = User{}
+	return unmarshalPatched(m, u)
+}
+
+// PatchGroup applies the operations to the group
+func PatchGroup(g *Group, ops []PatchOperation) error {
+	m, err := patch(g, ops, SchemaGroup, groupAttributes)
+	if err != nil {
+		return err
+	}
+	*g = Group{}
+	return unmarshalPatched(m, g)
+}
+
+func unmarshalPatched(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return NewError(http.StatusBadRequest, ErrTypeInvalidValue, err.Error())
+	}
+	return nil
+}
+
+// patch applies the operations on the json representation of the resource
+func patch(v interface{}, ops []PatchOperation, schema string, attributes []string) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		op.Op = strings.ToLower(op.Op)
+		switch op.Op {
+		case PatchAdd, PatchReplace, PatchRemove:
+		default:
+			return nil, NewError(http.StatusBadRequest, ErrTypeInvalidSyntax, fmt.Sprintf("invalid op: %s", op.Op))
+		}
+		if len(op.Path) == 0 {
+			// without path the value is an object of the attributes
+			values, ok := op.Value.(map[string]interface{})
+			if !ok || op.Op == PatchRemove {
+				return nil, NewError(http.StatusBadRequest, ErrTypeInvalidPath, "path is required")
+			}
+			for k, value := range values {
+				if err := applyOperation(m, op.Op, k, value, schema, attributes); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := applyOperation(m, op.Op, op.Path, op.Value, schema, attributes); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func applyOperation(m map[string]interface{}, op, path string, value interface{}, schema string, attributes []string) error {
+	path = strings.TrimPrefix(path, schema+":")
+
+	// value filter of the multi-valued attributes, i.e. members[value eq "2819c223"]
+	var filter *Filter
+	if idx := strings.Index(path, "["); idx > 0 && strings.HasSuffix(path, "]") {
+		f, err := ParseFilter(path[idx+1 : len(path)-1])
+		if err != nil {
+			return err
+		}
+		filter = &f
+		path = path[:idx]
+	}
+
+	// the attributes of the extension, i.e. urn:...:nested:2.0:Group:type
+	var sub string
+	if strings.HasPrefix(path, SchemaGroupNested+":") {
+		sub = strings.TrimPrefix(path, SchemaGroupNested+":")
+		path = SchemaGroupNested
+	} else if idx := strings.Index(path, "."); idx > 0 {
+		sub = path[idx+1:]
+		path = path[:idx]
+	}
+
+	attr := ""
+	for _, a := range attributes {
+		if strings.EqualFold(a, path) {
+			attr = a
+			break
+		}
+	}
+	if len(attr) == 0 {
+		return NewError(http.StatusBadRequest, ErrTypeInvalidPath, fmt.Sprintf("unsupported path: %s", path))
+	}
+
+	if len(sub) > 0 {
+		if filter != nil {
+			return NewError(http.StatusBadRequest, ErrTypeInvalidPath, "unsupported path")
+		}
+		obj, _ := m[attr].(map[string]interface{})
+		if obj == nil {
+			obj = make(map[string]interface{})
+		}
+		if op == PatchRemove {
+			delete(obj, sub)
+		} else {
+			obj[sub] = value
+		}
+		m[attr] = obj
+		return nil
+	}
+
+	if filter != nil {
+		if op != PatchRemove {
+			return NewError(http.StatusBadRequest, ErrTypeInvalidPath, "filters are supported only by remove")
+		}
+		items, _ := m[attr].([]interface{})
+		m[attr] = removeItems(items, func(item map[string]interface{}) bool {
+			return fmt.Sprintf("%v", item[filter.Attribute]) == filter.Value
+		})
+		return nil
+	}
+
+	items, multiValued := m[attr].([]interface{})
+	if !multiValued && attr == "members" {
+		multiValued = true
+	}
+	switch op {
+	case PatchAdd:
+		if multiValued {
+			m[attr] = addItems(items, value)
+			return nil
+		}
+		m[attr] = value
+	case PatchReplace:
+		if multiValued {
+			m[attr] = addItems(nil, value)
+			return nil
+		}
+		m[attr] = value
+	case PatchRemove:
+		// the values of the multi-valued attributes could be removed by the value of the operation
+		if multiValued && value != nil {
+			values := make(map[string]bool)
+			for _, v := range toSlice(value) {
+				if obj, ok := v.(map[string]interface{}); ok {
+					values[fmt.Sprintf("%v", obj["value"])] = true
+				}
+			}
+			m[attr] = removeItems(items, func(item map[string]interface{}) bool {
+				return values[fmt.Sprintf("%v", item["value"])]
+			})
+			return nil
+		}
+		delete(m, attr)
+	}
+	return nil
+}
+
+// addItems appends the values to the items, the items with the same 'value' are added once
+func addItems(items []interface{}, value interface{}) []interface{} {
+	result := make([]interface{}, 0, len(items))
+	exists := make(map[string]bool)
+	for _, item := range append(items, toSlice(value)...) {
+		if obj, ok := item.(map[string]interface{}); ok {
+			if v, ok := obj["value"]; ok {
+				key := fmt.Sprintf("%v", v)
+				if exists[key] {
+					continue
+				}
+				exists[key] = true
+			}
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func removeItems(items []interface{}, match func(item map[string]interface{}) bool) []interface{} {
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if obj, ok := item.(map[string]interface{}); ok && match(obj) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+func toSlice(value interface{}) []interface{} {
+	switch x := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return x
+	default:
+		return []interface{}{x}
+	}
+}
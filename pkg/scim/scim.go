@@ -0,0 +1,178 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Package scim implements the protocol of SCIM 2.0 (RFC 7643, RFC 7644) for the Users and the
+// Groups resources. The resources are kept by a Backend.
+
+// Schemas
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaGroupNested  = "urn:ietf:params:scim:schemas:extension:nested:2.0:Group"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Error Types (RFC 7644 Section 3.12)
+const (
+	ErrTypeInvalidFilter = "invalidFilter"
+	ErrTypeUniqueness    = "uniqueness"
+	ErrTypeInvalidSyntax = "invalidSyntax"
+	ErrTypeInvalidPath   = "invalidPath"
+	ErrTypeInvalidValue  = "invalidValue"
+	ErrTypeMutability    = "mutability"
+)
+
+// Group Types, the groups are either labels or places of Nested
+const (
+	GroupTypeLabel = "label"
+	GroupTypePlace = "place"
+)
+
+const (
+	// MaxResults is the maximum number of the resources of a list
+	MaxResults = 100
+	// MaxBodySize limits the body of the requests
+	MaxBodySize = 1 << 20
+)
+
+// Error is the error response of SCIM, the backend returns it to set the status of the response
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+	status   int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("scim: %d %s %s", e.status, e.ScimType, e.Detail)
+}
+
+// NewError returns an error with the http status
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{SchemaError},
+		Status:   fmt.Sprintf("%d", status),
+		ScimType: scimType,
+		Detail:   detail,
+		status:   status,
+	}
+}
+
+// ErrNotFound returns the error of the resources which do not exist
+func ErrNotFound(id string) *Error {
+	return NewError(http.StatusNotFound, "", fmt.Sprintf("resource %s not found", id))
+}
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type Email struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// User is the User resource, Password is never returned
+type User struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        Name     `json:"name"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// IsActive returns the 'active' attribute, users are active if it is not set
+func (u *User) IsActive() bool {
+	return u.Active == nil || *u.Active
+}
+
+// PrimaryEmail returns the primary email or the first email of the user
+func (u *User) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return strings.ToLower(e.Value)
+		}
+	}
+	if len(u.Emails) > 0 {
+		return strings.ToLower(u.Emails[0].Value)
+	}
+	return ""
+}
+
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// GroupExtension links the group to a label or a place of Nested, groups are labels by default
+type GroupExtension struct {
+	Type     string `json:"type,omitempty"`
+	TargetID string `json:"targetId,omitempty"`
+}
+
+type Group struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	ExternalID  string          `json:"externalId,omitempty"`
+	DisplayName string          `json:"displayName"`
+	Members     []Member        `json:"members"`
+	Nested      *GroupExtension `json:"urn:ietf:params:scim:schemas:extension:nested:2.0:Group,omitempty"`
+	Meta        *Meta           `json:"meta,omitempty"`
+}
+
+// MemberIDs returns the ids of the members of the group
+func (g *Group) MemberIDs() []string {
+	ids := make([]string, 0, len(g.Members))
+	for _, m := range g.Members {
+		ids = append(ids, m.Value)
+	}
+	return ids
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// Backend keeps the resources. actorID is the account which owns the token of the client.
+type Backend interface {
+	GetUser(id string) (*User, error)
+	// ListUsers returns the users from the zero based offset and the number of all the users
+	ListUsers(filter Filter, offset, count int) ([]User, int, error)
+	CreateUser(actorID string, u User) (*User, error)
+	ReplaceUser(actorID, id string, u User) (*User, error)
+	DeleteUser(actorID, id string) error
+
+	GetGroup(id string) (*Group, error)
+	ListGroups(filter Filter, offset, count int) ([]Group, int, error)
+	CreateGroup(actorID string, g Group) (*Group, error)
+	ReplaceGroup(actorID, id string, g Group) (*Group, error)
+	DeleteGroup(actorID, id string) error
+}
@@ -0,0 +1,328 @@
+package scim_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/scim"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testToken = "scim-token"
+
+// memoryBackend keeps the resources in memory
+type memoryBackend struct {
+	mtx    sync.Mutex
+	users  map[string]scim.User
+	groups map[string]scim.Group
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{
+		users:  make(map[string]scim.User),
+		groups: make(map[string]scim.Group),
+	}
+}
+
+func (b *memoryBackend) GetUser(id string) (*scim.User, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	u, ok := b.users[id]
+	if !ok {
+		return nil, scim.ErrNotFound(id)
+	}
+	return &u, nil
+}
+
+func (b *memoryBackend) ListUsers(filter scim.Filter, offset, count int) ([]scim.User, int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	users := make([]scim.User, 0)
+	for _, u := range b.users {
+		if filter.Attribute == "username" && u.UserName != filter.Value {
+			continue
+		}
+		users = append(users, u)
+	}
+	total := len(users)
+	if offset > len(users) {
+		offset = len(users)
+	}
+	users = users[offset:]
+	if count < len(users) {
+		users = users[:count]
+	}
+	return users, total, nil
+}
+
+func (b *memoryBackend) CreateUser(actorID string, u scim.User) (*scim.User, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.users[u.UserName]; ok {
+		return nil, scim.NewError(http.StatusConflict, scim.ErrTypeUniqueness, "userName exists")
+	}
+	u.ID = u.UserName
+	b.users[u.ID] = u
+	return &u, nil
+}
+
+func (b *memoryBackend) ReplaceUser(actorID, id string, u scim.User) (*scim.User, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.users[id]; !ok {
+		return nil, scim.ErrNotFound(id)
+	}
+	u.ID = id
+	b.users[id] = u
+	return &u, nil
+}
+
+func (b *memoryBackend) DeleteUser(actorID, id string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.users[id]; !ok {
+		return scim.ErrNotFound(id)
+	}
+	delete(b.users, id)
+	return nil
+}
+
+func (b *memoryBackend) GetGroup(id string) (*scim.Group, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	g, ok := b.groups[id]
+	if !ok {
+		return nil, scim.ErrNotFound(id)
+	}
+	return &g, nil
+}
+
+func (b *memoryBackend) ListGroups(filter scim.Filter, offset, count int) ([]scim.Group, int, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	groups := make([]scim.Group, 0)
+	for _, g := range b.groups {
+		groups = append(groups, g)
+	}
+	return groups, len(groups), nil
+}
+
+func (b *memoryBackend) CreateGroup(actorID string, g scim.Group) (*scim.Group, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	g.ID = fmt.Sprintf("g%d", len(b.groups)+1)
+	b.groups[g.ID] = g
+	return &g, nil
+}
+
+func (b *memoryBackend) ReplaceGroup(actorID, id string, g scim.Group) (*scim.Group, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if _, ok := b.groups[id]; !ok {
+		return nil, scim.ErrNotFound(id)
+	}
+	g.ID = id
+	b.groups[id] = g
+	return &g, nil
+}
+
+func (b *memoryBackend) DeleteGroup(actorID, id string) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	delete(b.groups, id)
+	return nil
+}
+
+func do(c C, srv *httptest.Server, method, path, token string, body interface{}, out interface{}) int {
+	var r *bytes.Reader
+	if s, ok := body.(string); ok {
+		r = bytes.NewReader([]byte(s))
+	} else {
+		b, err := json.Marshal(body)
+		c.So(err, ShouldBeNil)
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, srv.URL+"/scim/v2"+path, r)
+	c.So(err, ShouldBeNil)
+	req.Header.Set("Content-Type", "application/scim+json")
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	c.So(err, ShouldBeNil)
+	defer res.Body.Close()
+	if out != nil && res.StatusCode != http.StatusNoContent {
+		c.So(json.NewDecoder(res.Body).Decode(out), ShouldBeNil)
+	}
+	return res.StatusCode
+}
+
+func TestFilter(t *testing.T) {
+	Convey("ParseFilter", t, func(c C) {
+		f, err := scim.ParseFilter(`userName eq "john"`)
+		c.So(err, ShouldBeNil)
+		c.So(f.Attribute, ShouldEqual, "username")
+		c.So(f.Value, ShouldEqual, "john")
+
+		f, err = scim.ParseFilter(`displayName eq "Sales Team"`)
+		c.So(err, ShouldBeNil)
+		c.So(f.Value, ShouldEqual, "Sales Team")
+
+		f, err = scim.ParseFilter("")
+		c.So(err, ShouldBeNil)
+		c.So(f.Attribute, ShouldBeEmpty)
+
+		_, err = scim.ParseFilter(`userName sw "jo"`)
+		c.So(err, ShouldNotBeNil)
+		_, err = scim.ParseFilter(`userName eq john`)
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPatch(t *testing.T) {
+	Convey("Patch", t, func(c C) {
+		Convey("User", func(c C) {
+			u := &scim.User{ID: "john", UserName: "john", Name: scim.Name{GivenName: "John"}}
+			err := scim.PatchUser(u, []scim.PatchOperation{
+				{Op: "Replace", Path: "active", Value: "False"},
+				{Op: "replace", Path: "name.familyName", Value: "Doe"},
+				{Op: "replace", Value: map[string]interface{}{"displayName": "John Doe"}},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(u.IsActive(), ShouldBeFalse)
+			c.So(u.Name.GivenName, ShouldEqual, "John")
+			c.So(u.Name.FamilyName, ShouldEqual, "Doe")
+			c.So(u.DisplayName, ShouldEqual, "John Doe")
+			c.So(u.ID, ShouldEqual, "john")
+
+			err = scim.PatchUser(u, []scim.PatchOperation{{Op: "replace", Path: "title", Value: "x"}})
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Group", func(c C) {
+			g := &scim.Group{ID: "g1", DisplayName: "Sales", Members: []scim.Member{{Value: "a"}, {Value: "b"}}}
+			err := scim.PatchGroup(g, []scim.PatchOperation{
+				{Op: "add", Path: "members", Value: []interface{}{
+					map[string]interface{}{"value": "b"},
+					map[string]interface{}{"value": "c"},
+				}},
+				{Op: "remove", Path: `members[value eq "a"]`},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(g.MemberIDs(), ShouldResemble, []string{"b", "c"})
+
+			err = scim.PatchGroup(g, []scim.PatchOperation{
+				{Op: "remove", Path: "members", Value: []interface{}{map[string]interface{}{"value": "c"}}},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(g.MemberIDs(), ShouldResemble, []string{"b"})
+
+			err = scim.PatchGroup(g, []scim.PatchOperation{{Op: "remove", Path: "members"}})
+			c.So(err, ShouldBeNil)
+			c.So(g.Members, ShouldBeEmpty)
+
+			err = scim.PatchGroup(g, []scim.PatchOperation{
+				{Op: "replace", Path: scim.SchemaGroupNested + ":type", Value: scim.GroupTypePlace},
+			})
+			c.So(err, ShouldBeNil)
+			c.So(g.Nested, ShouldNotBeNil)
+			c.So(g.Nested.Type, ShouldEqual, scim.GroupTypePlace)
+		})
+	})
+}
+
+func TestServer(t *testing.T) {
+	backend := newMemoryBackend()
+	srv := httptest.NewServer(scim.NewServer("/scim/v2", backend, func(token string) (string, bool) {
+		return "admin", token == testToken
+	}))
+	defer srv.Close()
+
+	Convey("Server", t, func(c C) {
+		Convey("Unauthorized", func(c C) {
+			e := scim.Error{}
+			c.So(do(c, srv, http.MethodGet, "/Users", "", nil, &e), ShouldEqual, http.StatusUnauthorized)
+			c.So(do(c, srv, http.MethodGet, "/Users", "wrong", nil, &e), ShouldEqual, http.StatusUnauthorized)
+			c.So(e.Schemas, ShouldResemble, []string{scim.SchemaError})
+		})
+		Convey("Users", func(c C) {
+			u := scim.User{}
+			status := do(c, srv, http.MethodPost, "/Users", testToken, scim.User{
+				Schemas:  []string{scim.SchemaUser},
+				UserName: "jane",
+				Name:     scim.Name{GivenName: "Jane", FamilyName: "Doe"},
+				Emails:   []scim.Email{{Value: "Jane@Example.com", Primary: true}},
+				Password: "secret",
+			}, &u)
+			c.So(status, ShouldEqual, http.StatusCreated)
+			c.So(u.ID, ShouldEqual, "jane")
+			c.So(u.Password, ShouldBeEmpty)
+			c.So(u.Meta.ResourceType, ShouldEqual, "User")
+			c.So(strings.HasSuffix(u.Meta.Location, "/scim/v2/Users/jane"), ShouldBeTrue)
+
+			e := scim.Error{}
+			status = do(c, srv, http.MethodPost, "/Users", testToken, scim.User{UserName: "jane"}, &e)
+			c.So(status, ShouldEqual, http.StatusConflict)
+			c.So(e.ScimType, ShouldEqual, scim.ErrTypeUniqueness)
+
+			list := struct {
+				TotalResults int         `json:"totalResults"`
+				Resources    []scim.User `json:"Resources"`
+			}{}
+			status = do(c, srv, http.MethodGet, `/Users?filter=userName+eq+%22jane%22`, testToken, nil, &list)
+			c.So(status, ShouldEqual, http.StatusOK)
+			c.So(list.TotalResults, ShouldEqual, 1)
+			c.So(list.Resources[0].UserName, ShouldEqual, "jane")
+
+			status = do(c, srv, http.MethodGet, `/Users?filter=userName+co+%22j%22`, testToken, nil, &e)
+			c.So(status, ShouldEqual, http.StatusBadRequest)
+			c.So(e.ScimType, ShouldEqual, scim.ErrTypeInvalidFilter)
+
+			status = do(c, srv, http.MethodPatch, "/Users/jane", testToken, scim.PatchRequest{
+				Schemas:    []string{scim.SchemaPatchOp},
+				Operations: []scim.PatchOperation{{Op: "replace", Path: "active", Value: false}},
+			}, &u)
+			c.So(status, ShouldEqual, http.StatusOK)
+			c.So(u.IsActive(), ShouldBeFalse)
+			c.So(u.Name.FamilyName, ShouldEqual, "Doe")
+
+			status = do(c, srv, http.MethodGet, "/Users/john", testToken, nil, &e)
+			c.So(status, ShouldEqual, http.StatusNotFound)
+
+			status = do(c, srv, http.MethodPatch, "/Users/jane", testToken, "{", &e)
+			c.So(status, ShouldEqual, http.StatusBadRequest)
+
+			status = do(c, srv, http.MethodDelete, "/Users/jane", testToken, nil, nil)
+			c.So(status, ShouldEqual, http.StatusNoContent)
+		})
+		Convey("Groups", func(c C) {
+			g := scim.Group{}
+			status := do(c, srv, http.MethodPost, "/Groups", testToken, scim.Group{
+				Schemas:     []string{scim.SchemaGroup},
+				DisplayName: "Sales",
+				Members:     []scim.Member{{Value: "jane"}},
+			}, &g)
+			c.So(status, ShouldEqual, http.StatusCreated)
+			c.So(g.ID, ShouldNotBeEmpty)
+			c.So(g.MemberIDs(), ShouldResemble, []string{"jane"})
+
+			status = do(c, srv, http.MethodPatch, "/Groups/"+g.ID, testToken, scim.PatchRequest{
+				Schemas: []string{scim.SchemaPatchOp},
+				Operations: []scim.PatchOperation{
+					{Op: "add", Path: "members", Value: []interface{}{map[string]interface{}{"value": "john"}}},
+					{Op: "remove", Path: `members[value eq "jane"]`},
+				},
+			}, &g)
+			c.So(status, ShouldEqual, http.StatusOK)
+			c.So(g.MemberIDs(), ShouldResemble, []string{"john"})
+
+			status = do(c, srv, http.MethodDelete, "/Groups/"+g.ID, testToken, nil, nil)
+			c.So(status, ShouldEqual, http.StatusNoContent)
+		})
+	})
+}
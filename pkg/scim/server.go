@@ -0,0 +1,308 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const contentType = "application/scim+json"
+
+// Server serves the endpoints of SCIM under the Prefix, i.e. /scim/v2/Users
+type Server struct {
+	Prefix  string
+	Backend Backend
+	// Authenticate returns the actor of the bearer token of the request
+	Authenticate func(token string) (actorID string, ok bool)
+}
+
+// NewServer returns a server which serves the resources of the backend
+func NewServer(prefix string, backend Backend, authenticate func(token string) (string, bool)) *Server {
+	return &Server{
+		Prefix:       strings.TrimRight(prefix, "/"),
+		Backend:      backend,
+		Authenticate: authenticate,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(token) < 7 || !strings.EqualFold(token[:7], "bearer ") {
+		s.writeError(w, NewError(http.StatusUnauthorized, "", "bearer token is required"))
+		return
+	}
+	actorID, ok := s.Authenticate(strings.TrimSpace(token[7:]))
+	if !ok {
+		s.writeError(w, NewError(http.StatusUnauthorized, "", "invalid token"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, s.Prefix), "/"), "/")
+	if len(parts) > 2 {
+		s.writeError(w, NewError(http.StatusNotFound, "", "unknown endpoint"))
+		return
+	}
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+	switch parts[0] {
+	case "Users":
+		s.serveUsers(w, r, actorID, id)
+	case "Groups":
+		s.serveGroups(w, r, actorID, id)
+	case "ServiceProviderConfig":
+		s.write(w, http.StatusOK, serviceProviderConfig)
+	default:
+		s.writeError(w, NewError(http.StatusNotFound, "", "unknown endpoint"))
+	}
+}
+
+func (s *Server) serveUsers(w http.ResponseWriter, r *http.Request, actorID, id string) {
+	var (
+		res    *User
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case r.Method == http.MethodGet && len(id) == 0:
+		filter, offset, count, err := listParams(r)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		users, total, err := s.Backend.ListUsers(filter, offset, count)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		for i := range users {
+			s.prepareUser(r, &users[i])
+		}
+		s.write(w, http.StatusOK, ListResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: total,
+			StartIndex:   offset + 1,
+			ItemsPerPage: len(users),
+			Resources:    users,
+		})
+		return
+	case r.Method == http.MethodPost && len(id) == 0:
+		u := User{}
+		if err = decode(r, &u); err == nil {
+			res, err = s.Backend.CreateUser(actorID, u)
+			status = http.StatusCreated
+		}
+	case len(id) == 0:
+		err = NewError(http.StatusMethodNotAllowed, "", "method not allowed")
+	case r.Method == http.MethodGet:
+		res, err = s.Backend.GetUser(id)
+	case r.Method == http.MethodPut:
+		u := User{}
+		if err = decode(r, &u); err == nil {
+			res, err = s.Backend.ReplaceUser(actorID, id, u)
+		}
+	case r.Method == http.MethodPatch:
+		req := PatchRequest{}
+		if err = decode(r, &req); err != nil {
+			break
+		}
+		if res, err = s.Backend.GetUser(id); err != nil {
+			break
+		}
+		if err = PatchUser(res, req.Operations); err == nil {
+			res, err = s.Backend.ReplaceUser(actorID, id, *res)
+		}
+	case r.Method == http.MethodDelete:
+		if err = s.Backend.DeleteUser(actorID, id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		err = NewError(http.StatusMethodNotAllowed, "", "method not allowed")
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.prepareUser(r, res)
+	s.write(w, status, res)
+}
+
+func (s *Server) serveGroups(w http.ResponseWriter, r *http.Request, actorID, id string) {
+	var (
+		res    *Group
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case r.Method == http.MethodGet && len(id) == 0:
+		filter, offset, count, err := listParams(r)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		groups, total, err := s.Backend.ListGroups(filter, offset, count)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		for i := range groups {
+			s.prepareGroup(r, &groups[i])
+		}
+		s.write(w, http.StatusOK, ListResponse{
+			Schemas:      []string{SchemaListResponse},
+			TotalResults: total,
+			StartIndex:   offset + 1,
+			ItemsPerPage: len(groups),
+			Resources:    groups,
+		})
+		return
+	case r.Method == http.MethodPost && len(id) == 0:
+		g := Group{}
+		if err = decode(r, &g); err == nil {
+			res, err = s.Backend.CreateGroup(actorID, g)
+			status = http.StatusCreated
+		}
+	case len(id) == 0:
+		err = NewError(http.StatusMethodNotAllowed, "", "method not allowed")
+	case r.Method == http.MethodGet:
+		res, err = s.Backend.GetGroup(id)
+	case r.Method == http.MethodPut:
+		g := Group{}
+		if err = decode(r, &g); err == nil {
+			res, err = s.Backend.ReplaceGroup(actorID, id, g)
+		}
+	case r.Method == http.MethodPatch:
+		req := PatchRequest{}
+		if err = decode(r, &req); err != nil {
+			break
+		}
+		if res, err = s.Backend.GetGroup(id); err != nil {
+			break
+		}
+		if err = PatchGroup(res, req.Operations); err == nil {
+			res, err = s.Backend.ReplaceGroup(actorID, id, *res)
+		}
+	case r.Method == http.MethodDelete:
+		if err = s.Backend.DeleteGroup(actorID, id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		err = NewError(http.StatusMethodNotAllowed, "", "method not allowed")
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.prepareGroup(r, res)
+	s.write(w, status, res)
+}
+
+func (s *Server) prepareUser(r *http.Request, u *User) {
+	u.Schemas = []string{SchemaUser}
+	u.Password = ""
+	if u.Meta == nil {
+		u.Meta = &Meta{}
+	}
+	u.Meta.ResourceType = "User"
+	u.Meta.Location = s.location(r, "Users", u.ID)
+}
+
+func (s *Server) prepareGroup(r *http.Request, g *Group) {
+	g.Schemas = []string{SchemaGroup}
+	if g.Nested != nil {
+		g.Schemas = append(g.Schemas, SchemaGroupNested)
+	}
+	if g.Members == nil {
+		g.Members = []Member{}
+	}
+	for i := range g.Members {
+		g.Members[i].Ref = s.location(r, "Users", g.Members[i].Value)
+	}
+	if g.Meta == nil {
+		g.Meta = &Meta{}
+	}
+	g.Meta.ResourceType = "Group"
+	g.Meta.Location = s.location(r, "Groups", g.ID)
+}
+
+func (s *Server) location(r *http.Request, resource, id string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s/%s/%s", scheme, r.Host, s.Prefix, resource, id)
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = NewError(http.StatusInternalServerError, "", err.Error())
+	}
+	s.write(w, e.status, e)
+}
+
+// listParams returns the filter, the zero based offset and the count of the list request
+func listParams(r *http.Request) (Filter, int, int, error) {
+	q := r.URL.Query()
+	filter, err := ParseFilter(q.Get("filter"))
+	if err != nil {
+		return filter, 0, 0, err
+	}
+	startIndex := parseInt(q.Get("startIndex"), 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := parseInt(q.Get("count"), MaxResults)
+	if count < 0 {
+		count = 0
+	} else if count > MaxResults {
+		count = MaxResults
+	}
+	return filter, startIndex - 1, count, nil
+}
+
+func decode(r *http.Request, v interface{}) error {
+	b, err := io.ReadAll(io.LimitReader(r.Body, MaxBodySize))
+	if err != nil {
+		return NewError(http.StatusBadRequest, ErrTypeInvalidSyntax, err.Error())
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return NewError(http.StatusBadRequest, ErrTypeInvalidSyntax, err.Error())
+	}
+	return nil
+}
+
+// parseInt returns the integer of the query parameter or the default value
+func parseInt(s string, def int) int {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n
+	}
+	return def
+}
+
+var serviceProviderConfig = map[string]interface{}{
+	"schemas":        []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+	"patch":          map[string]bool{"supported": true},
+	"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+	"filter":         map[string]interface{}{"supported": true, "maxResults": MaxResults},
+	"changePassword": map[string]bool{"supported": true},
+	"sort":           map[string]bool{"supported": false},
+	"etag":           map[string]bool{"supported": false},
+	"authenticationSchemes": []map[string]string{{
+		"type":        "oauthbearertoken",
+		"name":        "OAuth Bearer Token",
+		"description": "Authentication with the SCIM token of an administrator",
+	}},
+}
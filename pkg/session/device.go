@@ -52,14 +52,16 @@ func (dm *DeviceManager) GetByAccountID(accountID string) []Device {
 	return devices
 }
 
-func (dm *DeviceManager) IncrementBadge(accountID string) {
+// SetBadge sets the badge of all the devices of the account, badges are the number of the unread
+// notifications of the account.
+func (dm *DeviceManager) SetBadge(accountID string, badge int) {
 	dbSession := dm.s.Copy()
 	db := dbSession.DB(global.DbName)
 	defer dbSession.Close()
 
 	if _, err := db.C(global.CollectionAccountsDevices).UpdateAll(
-		bson.M{"uid": accountID},
-		bson.M{"$inc": bson.M{"badge": 1}},
+		bson.M{"uid": accountID, "badge": bson.M{"$ne": badge}},
+		bson.M{"$set": bson.M{"badge": badge}},
 	); err != nil {
 		log.Warn(err.Error())
 	}
@@ -121,17 +123,11 @@ func (dm *DeviceManager) SetAsConnected(deviceID, accountID string) bool {
 	db := dbSession.DB(global.DbName)
 	defer dbSession.Close()
 
-	bulk := db.C(global.CollectionAccountsDevices).Bulk()
-	bulk.UpdateAll(
-		bson.M{"uid": accountID},
-		bson.M{"$set": bson.M{"badge": 0}},
-	)
-	bulk.Update(
-		bson.M{"_id": deviceID},
+	if err := db.C(global.CollectionAccountsDevices).Update(
+		bson.M{"_id": deviceID, "uid": accountID},
 		bson.M{"$set": bson.M{"connected": true}},
-	)
-	if _, err := bulk.Run(); err != nil {
-		log.Warn(err.Error())
+	); err != nil {
+		log.Debug("got error on set device connected", zap.String("DeviceID", deviceID), zap.Error(err))
 		return false
 	}
 	return true
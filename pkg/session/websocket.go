@@ -148,7 +148,7 @@ func (wm *WebsocketManager) Remove(websocketID, bundleID string) *Websocket {
 		m, _ := redis.StringMap(c.Do("HGETALL", hashKeyID))
 		hasMoreConnection := false
 		for k := range m {
-			if strings.HasPrefix(k, bundleID) {
+			if strings.HasPrefix(k, fmt.Sprintf("%s:", bundleID)) {
 				hasMoreConnection = true
 				break
 			}
@@ -184,12 +184,16 @@ func (wm *WebsocketManager) RemoveByBundleID(bundleID string) {
 			hashKeyID := fmt.Sprintf("ws:account:%s", accountID)
 			m, _ := redis.StringMap(c.Do("HGETALL", hashKeyID))
 			for k := range m {
-				if strings.HasPrefix(k, bundleID) {
+				// fieldKey :: bundleID:websocketID
+				fieldKey := strings.SplitN(k, ":", 2)
+				if len(fieldKey) == 2 && fieldKey[0] == bundleID {
 					c.Do("HDEL", hashKeyID, k)
+					c.Do("DEL", fmt.Sprintf("bundle-ws:%s:%s", bundleID, fieldKey[1]))
 				}
 			}
 		}
 	}
+	c.Do("DEL", setKeyID)
 }
 
 // IsConnected
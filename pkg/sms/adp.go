@@ -0,0 +1,57 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ADP sends the messages by the url api of ADP Digital, it does not send delivery receipts
+type ADP struct {
+	prefixes
+	HTTPClient *http.Client
+	cfg        Config
+}
+
+func newADP(cfg Config) (*ADP, error) {
+	if len(cfg.URL) == 0 || len(cfg.Username) == 0 || len(cfg.Sender) == 0 {
+		return nil, fmt.Errorf("sms: url, username and sender of adp are required")
+	}
+	return &ADP{
+		prefixes:   cfg.Prefixes,
+		HTTPClient: http.DefaultClient,
+		cfg:        cfg,
+	}, nil
+}
+
+func (adp *ADP) Name() string {
+	return adp.cfg.Name
+}
+
+func (adp *ADP) SendSMS(ctx context.Context, phone, text string) (string, error) {
+	v := url.Values{}
+	v.Set("username", adp.cfg.Username)
+	v.Set("password", adp.cfg.Password)
+	v.Set("dstaddress", phone)
+	v.Set("srcaddress", adp.cfg.Sender)
+	v.Set("body", text)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adp.cfg.URL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err := adp.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("sms: adp responded with %s", res.Status)
+	}
+	return "", nil
+}
@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// HTTP sends the messages by the templates of the config, so the gateways which do not have their
+// own provider could be used. The url and the body are templates of the message, i.e.
+//
+//	{"to": {{json .Phone}}, "text": {{json .Text}}}
+//	https://gw.example.com/send?to={{urlquery .Phone}}&text={{urlquery .Text}}
+//
+// The delivery receipts must have the id and the status of the message in their form or query
+// values (i.e. ?id=123&status=delivered&secret=...).
+type HTTP struct {
+	prefixes
+	HTTPClient *http.Client
+	cfg        Config
+	url        *template.Template
+	body       *template.Template
+}
+
+type httpMessage struct {
+	Phone      string
+	Text       string
+	ReceiptURL string
+}
+
+var httpFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newHTTP(cfg Config) (*HTTP, error) {
+	if len(cfg.URL) == 0 {
+		return nil, fmt.Errorf("sms: url of http provider is required")
+	}
+	if len(cfg.Method) == 0 {
+		cfg.Method = http.MethodPost
+	}
+	p := &HTTP{
+		prefixes:   cfg.Prefixes,
+		HTTPClient: http.DefaultClient,
+		cfg:        cfg,
+	}
+	var err error
+	if p.url, err = template.New("url").Funcs(httpFuncs).Parse(cfg.URL); err != nil {
+		return nil, err
+	}
+	if p.body, err = template.New("body").Funcs(httpFuncs).Parse(cfg.Body); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *HTTP) Name() string {
+	return p.cfg.Name
+}
+
+func (p *HTTP) SendSMS(ctx context.Context, phone, text string) (string, error) {
+	m := httpMessage{Phone: phone, Text: text, ReceiptURL: p.cfg.ReceiptURL}
+	u := new(bytes.Buffer)
+	if err := p.url.Execute(u, m); err != nil {
+		return "", err
+	}
+	body := new(bytes.Buffer)
+	if err := p.body.Execute(body, m); err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, p.cfg.Method, u.String(), body)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range p.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if len(p.cfg.Username) > 0 {
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+	res, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return "", fmt.Errorf("sms: %s responded with %s", p.cfg.Name, res.Status)
+	}
+	if len(p.cfg.IDField) == 0 {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return "", nil
+	}
+	var v interface{}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return "", err
+	}
+	return jsonField(v, p.cfg.IDField), nil
+}
+
+func (p *HTTP) ParseReceipt(r *http.Request) (Receipt, error) {
+	return genericReceipt(r, p.cfg.ReceiptSecret)
+}
+
+// jsonField returns the field of the dotted path (i.e. data.messages.0.id) as a string
+func jsonField(v interface{}, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			v = x[key]
+		case []interface{}:
+			var idx int
+			if _, err := fmt.Sscanf(key, "%d", &idx); err != nil || idx < 0 || idx >= len(x) {
+				return ""
+			}
+			v = x[idx]
+		default:
+			return ""
+		}
+	}
+	switch x := v.(type) {
+	case string:
+		return x
+	case float64:
+		return fmt.Sprintf("%.0f", x)
+	}
+	return ""
+}
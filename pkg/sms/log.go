@@ -0,0 +1,76 @@
+package sms
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"go.uber.org/zap"
+)
+
+// Log writes the messages and the calls to the file of the config, or to the log if the file is
+// not set. It is for the development, the receipts could be sent by hand in the format of the http
+// provider (?id=...&status=delivered).
+type Log struct {
+	prefixes
+	cfg Config
+	mtx sync.Mutex
+}
+
+func newLog(cfg Config) (*Log, error) {
+	return &Log{
+		prefixes: cfg.Prefixes,
+		cfg:      cfg,
+	}, nil
+}
+
+func (l *Log) Name() string {
+	return l.cfg.Name
+}
+
+func (l *Log) SendSMS(_ context.Context, phone, text string) (string, error) {
+	return l.write("sms", phone, text)
+}
+
+func (l *Log) Call(_ context.Context, phone, text string) (string, error) {
+	return l.write("call", phone, text)
+}
+
+func (l *Log) ParseReceipt(r *http.Request) (Receipt, error) {
+	return genericReceipt(r, l.cfg.ReceiptSecret)
+}
+
+func (l *Log) write(kind, phone, text string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	if len(l.cfg.File) == 0 {
+		log.Info("sms",
+			zap.String("Kind", kind),
+			zap.String("ID", id),
+			zap.String("Phone", phone),
+			zap.String("Text", text),
+		)
+		return id, nil
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	f, err := os.OpenFile(l.cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s\t%s\t%s\t%s\t%q\n", time.Now().Format(time.RFC3339), kind, id, phone, text); err != nil {
+		return "", err
+	}
+	return id, nil
+}
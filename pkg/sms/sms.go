@@ -0,0 +1,259 @@
+package sms
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/log"
+	"go.uber.org/zap"
+)
+
+// Types of the providers
+const (
+	ProviderADP    = "adp"
+	ProviderHTTP   = "http"
+	ProviderTwilio = "twilio"
+	ProviderLog    = "log"
+)
+
+var (
+	ErrNoProvider      = errors.New("sms: no provider accepts the phone")
+	ErrUnknownProvider = errors.New("sms: unknown provider")
+	ErrNoReceipts      = errors.New("sms: provider does not send delivery receipts")
+	ErrInvalidReceipt  = errors.New("sms: invalid delivery receipt")
+)
+
+// Status is the delivery status of a message
+type Status int
+
+const (
+	StatusPending Status = iota
+	StatusDelivered
+	StatusFailed
+)
+
+// SMSProvider sends the text messages through a sms gateway
+type SMSProvider interface {
+	Name() string
+	// Accepts returns true if the provider could send messages to the phone
+	Accepts(phone string) bool
+	// SendSMS returns the id of the message in the gateway, it is empty if the gateway does not
+	// send delivery receipts
+	SendSMS(ctx context.Context, phone, text string) (string, error)
+}
+
+// VoiceProvider is implemented by the providers which could call the phone and read the text
+type VoiceProvider interface {
+	SMSProvider
+	Call(ctx context.Context, phone, text string) (string, error)
+}
+
+// ReceiptParser is implemented by the providers which post the delivery receipts to the receipt
+// url of the provider
+type ReceiptParser interface {
+	ParseReceipt(r *http.Request) (Receipt, error)
+}
+
+// Receipt is the delivery status of a message or call
+type Receipt struct {
+	MessageID string
+	Status    Status
+}
+
+// Config is the config of a provider, the fields are used according to the type of the provider
+//
+//	adp:	url, username, password and sender
+//	http:	url, method, headers, body, id_field and receipt_secret
+//	twilio:	url (optional), username (account sid), password (auth token) and sender
+//	log:	file (optional, the messages are logged if it is empty)
+type Config struct {
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	Prefixes      []string          `json:"prefixes"` // the phones which the provider accepts, i.e. 98 (all if empty)
+	URL           string            `json:"url"`
+	Username      string            `json:"username"`
+	Password      string            `json:"password"`
+	Sender        string            `json:"sender"`
+	Method        string            `json:"method"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body"`     // template of the body, with .Phone, .Text and .ReceiptURL
+	IDField       string            `json:"id_field"` // dotted path of the message id in the json response
+	ReceiptSecret string            `json:"receipt_secret"`
+	File          string            `json:"file"`
+	// ReceiptURL is the url which the provider posts the delivery receipts to, it is set by the server
+	ReceiptURL string `json:"-"`
+}
+
+// ParseConfigs parses the json array of the provider configs, the order of the array is the order
+// which the providers are tried in
+func ParseConfigs(s string) ([]Config, error) {
+	cfgs := make([]Config, 0)
+	if len(strings.TrimSpace(s)) == 0 {
+		return cfgs, nil
+	}
+	if err := json.Unmarshal([]byte(s), &cfgs); err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for idx, cfg := range cfgs {
+		if len(cfg.Type) == 0 {
+			return nil, fmt.Errorf("sms: type of the providers is required")
+		}
+		if len(cfg.Name) == 0 {
+			cfg.Name = cfg.Type
+			cfgs[idx] = cfg
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("sms: duplicate provider name: %s", cfg.Name)
+		}
+		names[cfg.Name] = true
+	}
+	return cfgs, nil
+}
+
+// New returns the provider of the config
+func New(cfg Config) (SMSProvider, error) {
+	switch cfg.Type {
+	case ProviderADP:
+		return newADP(cfg)
+	case ProviderHTTP:
+		return newHTTP(cfg)
+	case ProviderTwilio:
+		return newTwilio(cfg)
+	case ProviderLog:
+		return newLog(cfg)
+	}
+	return nil, fmt.Errorf("sms: unknown provider type: %s", cfg.Type)
+}
+
+// Gateway sends the messages through the first provider which accepts the phone, if the provider
+// fails the next providers are tried.
+type Gateway struct {
+	providers []SMSProvider
+	timeout   time.Duration
+}
+
+// NewGateway returns a gateway of the providers in the order of their priority
+func NewGateway(providers ...SMSProvider) *Gateway {
+	return &Gateway{
+		providers: providers,
+		timeout:   10 * time.Second,
+	}
+}
+
+// Len returns the number of the providers
+func (g *Gateway) Len() int {
+	return len(g.providers)
+}
+
+// SendSMS sends the text to the phone and returns the name of the provider which has accepted the
+// message and the id of the message
+func (g *Gateway) SendSMS(phone, text string) (string, string, error) {
+	return g.send(phone, func(ctx context.Context, p SMSProvider) (string, bool, error) {
+		id, err := p.SendSMS(ctx, phone, text)
+		return id, true, err
+	})
+}
+
+// Call calls the phone and reads the text through the providers which support voice calls
+func (g *Gateway) Call(phone, text string) (string, string, error) {
+	return g.send(phone, func(ctx context.Context, p SMSProvider) (string, bool, error) {
+		vp, ok := p.(VoiceProvider)
+		if !ok {
+			return "", false, nil
+		}
+		id, err := vp.Call(ctx, phone, text)
+		return id, true, err
+	})
+}
+
+func (g *Gateway) send(phone string, f func(ctx context.Context, p SMSProvider) (string, bool, error)) (string, string, error) {
+	err := ErrNoProvider
+	for _, p := range g.providers {
+		if !p.Accepts(phone) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+		id, ok, sendErr := f(ctx, p)
+		cancel()
+		if !ok {
+			continue
+		}
+		if sendErr == nil {
+			return p.Name(), id, nil
+		}
+		log.Warn("got error on sending sms, trying the next provider",
+			zap.String("Provider", p.Name()),
+			zap.Error(sendErr),
+		)
+		err = sendErr
+	}
+	return "", "", err
+}
+
+// ParseReceipt parses the delivery receipt which has been posted to the receipt url of the provider
+func (g *Gateway) ParseReceipt(provider string, r *http.Request) (Receipt, error) {
+	for _, p := range g.providers {
+		if p.Name() != provider {
+			continue
+		}
+		rp, ok := p.(ReceiptParser)
+		if !ok {
+			return Receipt{}, ErrNoReceipts
+		}
+		return rp.ParseReceipt(r)
+	}
+	return Receipt{}, ErrUnknownProvider
+}
+
+// prefixes implements Accepts by the prefixes of the config
+type prefixes []string
+
+func (ps prefixes) Accepts(phone string) bool {
+	if len(ps) == 0 {
+		return true
+	}
+	for _, p := range ps {
+		if strings.HasPrefix(phone, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// genericReceipt parses the receipts which have the id and the status of the message in their
+// form or query values. The receipt must have the same secret, hence receipts are not accepted by
+// the providers which have no secret.
+func genericReceipt(r *http.Request, secret string) (Receipt, error) {
+	if len(secret) == 0 {
+		return Receipt{}, ErrInvalidReceipt
+	}
+	if err := r.ParseForm(); err != nil {
+		return Receipt{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Form.Get("secret")), []byte(secret)) != 1 {
+		return Receipt{}, ErrInvalidReceipt
+	}
+	id := r.Form.Get("id")
+	if len(id) == 0 {
+		return Receipt{}, ErrInvalidReceipt
+	}
+	return Receipt{MessageID: id, Status: parseStatus(r.Form.Get("status"))}, nil
+}
+
+// parseStatus maps the common status names of the gateways to the delivery status
+func parseStatus(s string) Status {
+	switch strings.ToLower(s) {
+	case "delivered", "delivrd", "success", "completed":
+		return StatusDelivered
+	case "failed", "undelivered", "undeliv", "rejected", "rejectd", "expired", "busy", "no-answer", "canceled":
+		return StatusFailed
+	}
+	return StatusPending
+}
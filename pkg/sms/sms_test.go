@@ -0,0 +1,233 @@
+package sms_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/sms"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ctx = context.Background()
+
+func newProvider(c C, cfg sms.Config) sms.SMSProvider {
+	p, err := sms.New(cfg)
+	c.So(err, ShouldBeNil)
+	return p
+}
+
+func TestConfigs(t *testing.T) {
+	Convey("ParseConfigs", t, func(c C) {
+		cfgs, err := sms.ParseConfigs(`[{"type": "adp", "prefixes": ["98"]}, {"name": "backup", "type": "log"}]`)
+		c.So(err, ShouldBeNil)
+		c.So(cfgs, ShouldHaveLength, 2)
+		c.So(cfgs[0].Name, ShouldEqual, "adp")
+		c.So(cfgs[0].Prefixes, ShouldResemble, []string{"98"})
+		c.So(cfgs[1].Name, ShouldEqual, "backup")
+
+		cfgs, err = sms.ParseConfigs("")
+		c.So(err, ShouldBeNil)
+		c.So(cfgs, ShouldBeEmpty)
+
+		_, err = sms.ParseConfigs(`[{"name": "x"}]`)
+		c.So(err, ShouldNotBeNil)
+		_, err = sms.ParseConfigs(`[{"type": "log"}, {"type": "log"}]`)
+		c.So(err, ShouldNotBeNil)
+		_, err = sms.New(sms.Config{Name: "x", Type: "unknown"})
+		c.So(err, ShouldNotBeNil)
+		_, err = sms.New(sms.Config{Name: "adp", Type: sms.ProviderADP})
+		c.So(err, ShouldNotBeNil)
+	})
+}
+
+func TestProviders(t *testing.T) {
+	Convey("Providers", t, func(c C) {
+		Convey("ADP", func(c C) {
+			var form url.Values
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				form = r.PostForm
+			}))
+			defer s.Close()
+			p := newProvider(c, sms.Config{Name: "adp", Type: sms.ProviderADP, URL: s.URL, Username: "u", Password: "p", Sender: "1000"})
+			_, err := p.SendSMS(ctx, "989121234567", "code: 123456")
+			c.So(err, ShouldBeNil)
+			c.So(form.Get("dstaddress"), ShouldEqual, "989121234567")
+			c.So(form.Get("srcaddress"), ShouldEqual, "1000")
+			c.So(form.Get("body"), ShouldEqual, "code: 123456")
+		})
+		Convey("HTTP", func(c C) {
+			var body map[string]string
+			var query url.Values
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				_, _ = w.Write([]byte(`{"data": {"messages": [{"id": 42}]}}`))
+			}))
+			defer s.Close()
+			p := newProvider(c, sms.Config{
+				Name:          "gw",
+				Type:          sms.ProviderHTTP,
+				URL:           s.URL + "/send?key=k&to={{urlquery .Phone}}",
+				Body:          `{"text": {{json .Text}}, "callback": {{json .ReceiptURL}}}`,
+				IDField:       "data.messages.0.id",
+				ReceiptSecret: "secret",
+				ReceiptURL:    "https://api.nested.me/sms/receipt/gw",
+			})
+			id, err := p.SendSMS(ctx, "14155550100", `say "hi"`)
+			c.So(err, ShouldBeNil)
+			c.So(id, ShouldEqual, "42")
+			c.So(query.Get("to"), ShouldEqual, "14155550100")
+			c.So(body["text"], ShouldEqual, `say "hi"`)
+			c.So(body["callback"], ShouldEqual, "https://api.nested.me/sms/receipt/gw")
+
+			rp := p.(sms.ReceiptParser)
+			r, err := rp.ParseReceipt(httptest.NewRequest(http.MethodGet, "/sms/receipt/gw?id=42&status=DELIVRD&secret=secret", nil))
+			c.So(err, ShouldBeNil)
+			c.So(r, ShouldResemble, sms.Receipt{MessageID: "42", Status: sms.StatusDelivered})
+			_, err = rp.ParseReceipt(httptest.NewRequest(http.MethodGet, "/sms/receipt/gw?id=42&status=failed&secret=wrong", nil))
+			c.So(err, ShouldEqual, sms.ErrInvalidReceipt)
+		})
+		Convey("Twilio", func(c C) {
+			var form url.Values
+			var path string
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				form, path = r.PostForm, r.URL.Path
+				if u, _, _ := r.BasicAuth(); u != "AC1" {
+					w.WriteHeader(http.StatusUnauthorized)
+					_, _ = w.Write([]byte(`{"message": "Authenticate"}`))
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"sid": "SM1"}`))
+			}))
+			defer s.Close()
+			cfg := sms.Config{
+				Name:       "twilio",
+				Type:       sms.ProviderTwilio,
+				URL:        s.URL,
+				Username:   "AC1",
+				Password:   "token",
+				Sender:     "+15005550006",
+				ReceiptURL: "https://api.nested.me/sms/receipt/twilio",
+			}
+			p := newProvider(c, cfg)
+			id, err := p.SendSMS(ctx, "14155550100", "code: 123456")
+			c.So(err, ShouldBeNil)
+			c.So(id, ShouldEqual, "SM1")
+			c.So(path, ShouldEqual, "/2010-04-01/Accounts/AC1/Messages.json")
+			c.So(form.Get("To"), ShouldEqual, "+14155550100")
+			c.So(form.Get("StatusCallback"), ShouldEqual, cfg.ReceiptURL)
+
+			_, err = p.(sms.VoiceProvider).Call(ctx, "14155550100", "1 2 3 & 4")
+			c.So(err, ShouldBeNil)
+			c.So(path, ShouldEqual, "/2010-04-01/Accounts/AC1/Calls.json")
+			c.So(form.Get("Twiml"), ShouldContainSubstring, "<Say>1 2 3 &amp; 4</Say>")
+
+			// https://www.twilio.com/docs/usage/security#validating-requests
+			v := url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}}
+			req := httptest.NewRequest(http.MethodPost, "/sms/receipt/twilio", strings.NewReader(v.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Twilio-Signature", twilioSignature("token", cfg.ReceiptURL, "MessageSid", "SM1", "MessageStatus", "delivered"))
+			r, err := p.(sms.ReceiptParser).ParseReceipt(req)
+			c.So(err, ShouldBeNil)
+			c.So(r, ShouldResemble, sms.Receipt{MessageID: "SM1", Status: sms.StatusDelivered})
+
+			req = httptest.NewRequest(http.MethodPost, "/sms/receipt/twilio", strings.NewReader(v.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Twilio-Signature", twilioSignature("wrong", cfg.ReceiptURL, "MessageSid", "SM1", "MessageStatus", "delivered"))
+			_, err = p.(sms.ReceiptParser).ParseReceipt(req)
+			c.So(err, ShouldEqual, sms.ErrInvalidReceipt)
+
+			cfg.Username = "AC2"
+			_, err = newProvider(c, cfg).SendSMS(ctx, "14155550100", "code")
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, "Authenticate")
+		})
+		Convey("Log", func(c C) {
+			file := filepath.Join(t.TempDir(), "sms.log")
+			p := newProvider(c, sms.Config{Name: "log", Type: sms.ProviderLog, File: file})
+			id, err := p.SendSMS(ctx, "14155550100", "code: 123456")
+			c.So(err, ShouldBeNil)
+			c.So(id, ShouldNotBeEmpty)
+			b, err := ioutil.ReadFile(file)
+			c.So(err, ShouldBeNil)
+			c.So(string(b), ShouldContainSubstring, id+"\t14155550100\t\"code: 123456\"")
+		})
+	})
+}
+
+func TestGateway(t *testing.T) {
+	Convey("Gateway", t, func(c C) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+		dir := t.TempDir()
+		g := sms.NewGateway(
+			newProvider(c, sms.Config{Name: "local", Type: sms.ProviderADP, URL: failing.URL, Username: "u", Sender: "1000", Prefixes: []string{"98"}}),
+			newProvider(c, sms.Config{Name: "gw", Type: sms.ProviderHTTP, URL: failing.URL}),
+			newProvider(c, sms.Config{Name: "backup", Type: sms.ProviderLog, File: filepath.Join(dir, "backup.log"), Prefixes: []string{"98", "1"}, ReceiptSecret: "secret"}),
+		)
+		c.So(g.Len(), ShouldEqual, 3)
+
+		Convey("Failover", func(c C) {
+			provider, id, err := g.SendSMS("989121234567", "code")
+			c.So(err, ShouldBeNil)
+			c.So(provider, ShouldEqual, "backup")
+			c.So(id, ShouldNotBeEmpty)
+
+			_, _, err = g.SendSMS("441234567890", "code")
+			c.So(err, ShouldNotBeNil)
+			c.So(err, ShouldNotEqual, sms.ErrNoProvider)
+		})
+		Convey("Voice", func(c C) {
+			provider, _, err := g.Call("14155550100", "1 2 3")
+			c.So(err, ShouldBeNil)
+			c.So(provider, ShouldEqual, "backup")
+			_, _, err = g.Call("441234567890", "1 2 3")
+			c.So(err, ShouldEqual, sms.ErrNoProvider)
+		})
+		Convey("Receipts", func(c C) {
+			r, err := g.ParseReceipt("backup", httptest.NewRequest(http.MethodGet, "/?id=1&status=undelivered&secret=secret", nil))
+			c.So(err, ShouldBeNil)
+			c.So(r.Status, ShouldEqual, sms.StatusFailed)
+			r, err = g.ParseReceipt("backup", httptest.NewRequest(http.MethodGet, "/?id=1&status=sent&secret=secret", nil))
+			c.So(err, ShouldBeNil)
+			c.So(r.Status, ShouldEqual, sms.StatusPending)
+			_, err = g.ParseReceipt("backup", httptest.NewRequest(http.MethodGet, "/?id=1&status=delivered", nil))
+			c.So(err, ShouldEqual, sms.ErrInvalidReceipt)
+			// providers without a secret do not accept receipts
+			_, err = g.ParseReceipt("gw", httptest.NewRequest(http.MethodGet, "/?id=1&status=delivered&secret=", nil))
+			c.So(err, ShouldEqual, sms.ErrInvalidReceipt)
+			_, err = g.ParseReceipt("local", httptest.NewRequest(http.MethodGet, "/?id=1", nil))
+			c.So(err, ShouldEqual, sms.ErrNoReceipts)
+			_, err = g.ParseReceipt("unknown", httptest.NewRequest(http.MethodGet, "/?id=1", nil))
+			c.So(err, ShouldEqual, sms.ErrUnknownProvider)
+		})
+	})
+}
+
+// twilioSignature signs the url and the key value pairs which are sorted by their keys
+func twilioSignature(token, u string, kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+kv[i+1])
+	}
+	sort.Strings(pairs)
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(u + strings.Join(pairs, "")))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
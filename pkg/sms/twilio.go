@@ -0,0 +1,137 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Twilio sends the messages and makes the calls by the rest api of Twilio, or the gateways which
+// have the same api. The receipts are posted to the receipt url and are signed by the auth token.
+type Twilio struct {
+	prefixes
+	HTTPClient *http.Client
+	cfg        Config
+}
+
+func newTwilio(cfg Config) (*Twilio, error) {
+	if len(cfg.Username) == 0 || len(cfg.Password) == 0 || len(cfg.Sender) == 0 {
+		return nil, fmt.Errorf("sms: username (account sid), password (auth token) and sender of twilio are required")
+	}
+	if len(cfg.URL) == 0 {
+		cfg.URL = "https://api.twilio.com"
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &Twilio{
+		prefixes:   cfg.Prefixes,
+		HTTPClient: http.DefaultClient,
+		cfg:        cfg,
+	}, nil
+}
+
+func (t *Twilio) Name() string {
+	return t.cfg.Name
+}
+
+func (t *Twilio) SendSMS(ctx context.Context, phone, text string) (string, error) {
+	v := url.Values{}
+	v.Set("To", "+"+phone)
+	v.Set("From", t.cfg.Sender)
+	v.Set("Body", text)
+	return t.post(ctx, "Messages.json", v)
+}
+
+func (t *Twilio) Call(ctx context.Context, phone, text string) (string, error) {
+	say := new(strings.Builder)
+	_ = xml.EscapeText(say, []byte(text))
+	v := url.Values{}
+	v.Set("To", "+"+phone)
+	v.Set("From", t.cfg.Sender)
+	v.Set("Twiml", fmt.Sprintf("<Response><Say>%s</Say><Pause length=\"1\"/><Say>%s</Say></Response>", say, say))
+	return t.post(ctx, "Calls.json", v)
+}
+
+func (t *Twilio) post(ctx context.Context, resource string, v url.Values) (string, error) {
+	if len(t.cfg.ReceiptURL) > 0 {
+		v.Set("StatusCallback", t.cfg.ReceiptURL)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s", t.cfg.URL, url.PathEscape(t.cfg.Username), resource),
+		strings.NewReader(v.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := t.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	r := struct {
+		Sid     string `json:"sid"`
+		Message string `json:"message"`
+	}{}
+	_ = json.NewDecoder(res.Body).Decode(&r)
+	if res.StatusCode/100 != 2 {
+		return "", fmt.Errorf("sms: %s responded with %s: %s", t.cfg.Name, res.Status, r.Message)
+	}
+	return r.Sid, nil
+}
+
+// ParseReceipt parses the status callbacks of the messages and the calls. The callbacks are
+// rejected if their signature is not valid.
+func (t *Twilio) ParseReceipt(r *http.Request) (Receipt, error) {
+	if err := r.ParseForm(); err != nil {
+		return Receipt{}, err
+	}
+	if !t.validSignature(r.Header.Get("X-Twilio-Signature"), r.PostForm) {
+		return Receipt{}, ErrInvalidReceipt
+	}
+	if sid := r.PostForm.Get("MessageSid"); len(sid) > 0 {
+		return Receipt{MessageID: sid, Status: parseStatus(r.PostForm.Get("MessageStatus"))}, nil
+	}
+	if sid := r.PostForm.Get("CallSid"); len(sid) > 0 {
+		return Receipt{MessageID: sid, Status: parseStatus(r.PostForm.Get("CallStatus"))}, nil
+	}
+	return Receipt{}, ErrInvalidReceipt
+}
+
+// validSignature checks the signature of the callback, which is the HMAC-SHA1 of the callback url
+// followed by the sorted post values
+func (t *Twilio) validSignature(signature string, v url.Values) bool {
+	if len(signature) == 0 || len(t.cfg.ReceiptURL) == 0 {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, twilioSignature(t.cfg.Password, t.cfg.ReceiptURL, v))
+}
+
+func twilioSignature(token, u string, v url.Values) []byte {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mac := hmac.New(sha1.New, []byte(token))
+	mac.Write([]byte(u))
+	for _, k := range keys {
+		for _, value := range v[k] {
+			mac.Write([]byte(k))
+			mac.Write([]byte(value))
+		}
+	}
+	return mac.Sum(nil)
+}
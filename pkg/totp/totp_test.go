@@ -0,0 +1,50 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"git.ronaksoft.com/nested/server/pkg/totp"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTOTP(t *testing.T) {
+	Convey("TOTP", t, func(c C) {
+		Convey("RFC 6238 Test Vectors", func(c C) {
+			secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+			// the 6 digits codes are the last digits of the 8 digits codes of the RFC
+			vectors := map[int64]string{
+				59:          "287082",
+				1111111109:  "081804",
+				1111111111:  "050471",
+				1234567890:  "005924",
+				2000000000:  "279037",
+				20000000000: "353130",
+			}
+			for ts, code := range vectors {
+				v, err := totp.Code(secret, totp.Step(time.Unix(ts, 0)))
+				c.So(err, ShouldBeNil)
+				c.So(v, ShouldEqual, code)
+			}
+		})
+		Convey("Validate", func(c C) {
+			secret, err := totp.GenerateSecret()
+			c.So(err, ShouldBeNil)
+			now := time.Now()
+			code, _ := totp.Code(secret, totp.Step(now.Add(-totp.Period*time.Second)))
+			step, ok := totp.Validate(secret, code, now, 1)
+			c.So(ok, ShouldBeTrue)
+			c.So(step, ShouldEqual, totp.Step(now)-1)
+			_, ok = totp.Validate(secret, code, now.Add(2*totp.Period*time.Second), 1)
+			c.So(ok, ShouldBeFalse)
+			_, ok = totp.Validate(secret, "12345", now, 1)
+			c.So(ok, ShouldBeFalse)
+		})
+		Convey("ProvisioningURI", func(c C) {
+			u := totp.ProvisioningURI("Nested", "ehsan", "ABC")
+			c.So(u, ShouldStartWith, "otpauth://totp/Nested:ehsan?")
+			c.So(u, ShouldContainSubstring, "secret=ABC")
+		})
+	})
+}
@@ -0,0 +1,297 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Package webpush implements the Web Push protocol (RFC 8030) with the message encryption of
+// RFC 8291 (aes128gcm) and the VAPID authentication of RFC 8292.
+
+const (
+	recordSize  = 4096
+	headerSize  = 16 + 4 + 1 + 65 // salt, record size, key id length, key id
+	MaxPayload  = recordSize - headerSize - 16 - 1
+	DefaultTTL  = 24 * 3600 // Seconds
+	vapidExpiry = 12 * time.Hour
+)
+
+var (
+	ErrSubscriptionGone = errors.New("webpush: subscription is expired or unsubscribed")
+	ErrPayloadTooLarge  = errors.New("webpush: payload is too large")
+	ErrInvalidKey       = errors.New("webpush: invalid key")
+	ErrInternalEndpoint = errors.New("webpush: endpoint is not on a public network")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Subscription is the PushSubscription of the browser in its JSON form
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// ParseSubscription decodes and validates the JSON form of the PushSubscription
+func ParseSubscription(s string) (*Subscription, error) {
+	sub := new(Subscription)
+	if err := json.Unmarshal([]byte(s), sub); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return nil, fmt.Errorf("webpush: invalid endpoint: %s", sub.Endpoint)
+	}
+	// The endpoints are set by the users, so they must not point to our internal networks. The
+	// hostnames are checked again by the dialer of the client once they are resolved.
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, ErrInternalEndpoint
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return nil, ErrInternalEndpoint
+	}
+	if _, err := ecdh.P256().NewPublicKey(decode(sub.Keys.P256dh)); err != nil {
+		return nil, ErrInvalidKey
+	}
+	if len(decode(sub.Keys.Auth)) != 16 {
+		return nil, ErrInvalidKey
+	}
+	return sub, nil
+}
+
+// GenerateVAPIDKeys returns a new pair of VAPID keys in url safe base64. The private key is the raw
+// 32 bytes scalar and the public key is the uncompressed point which browsers expect as their
+// applicationServerKey.
+func GenerateVAPIDKeys() (privateKey, publicKey string, err error) {
+	k, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return b64.EncodeToString(k.Bytes()), b64.EncodeToString(k.PublicKey().Bytes()), nil
+}
+
+type Client struct {
+	HTTPClient *http.Client
+	key        *ecdsa.PrivateKey
+	publicKey  string
+	subject    string
+}
+
+// NewClient creates a client which signs its requests by the VAPID privateKey. subject is
+// a mailto: or https: url which push services could use to contact us.
+func NewClient(privateKey, subject string) (*Client, error) {
+	k, err := ecdh.P256().NewPrivateKey(decode(privateKey))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	pub := k.PublicKey().Bytes()
+	x, y := elliptic.Unmarshal(elliptic.P256(), pub)
+	if x == nil {
+		return nil, ErrInvalidKey
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: dialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &Client{
+		HTTPClient: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+			// push services do not redirect, following them would bypass the checks of the endpoint
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+			D:         new(big.Int).SetBytes(k.Bytes()),
+		},
+		publicKey: b64.EncodeToString(pub),
+		subject:   subject,
+	}, nil
+}
+
+// dialControl refuses the connections to the internal networks, it runs after the hostname of the
+// endpoint has been resolved.
+func dialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return ErrInternalEndpoint
+	}
+	return nil
+}
+
+// publicIP returns false for the loopback, private, link-local, multicast and unspecified addresses
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// PublicKey returns the VAPID public key, clients use it to subscribe
+func (c *Client) PublicKey() string {
+	return c.publicKey
+}
+
+// Send encrypts the payload for the subscription and delivers it to the push service. If the push
+// service responds by 404 or 410 the subscription is not valid anymore and ErrSubscriptionGone is
+// returned.
+func (c *Client) Send(sub *Subscription, payload []byte, ttl int) error {
+	body, err := Encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+	token, err := c.vapidToken(sub.Endpoint)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(ttl))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, c.publicKey))
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	switch {
+	case res.StatusCode == http.StatusNotFound, res.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		return fmt.Errorf("webpush: unexpected status: %s", res.Status)
+	}
+	return nil
+}
+
+// vapidToken creates the ES256 signed JWT for the origin of the endpoint
+func (c *Client) vapidToken(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	header := b64.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, _ := json.Marshal(map[string]interface{}{
+		"aud": fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+		"exp": time.Now().Add(vapidExpiry).Unix(),
+		"sub": c.subject,
+	})
+	unsigned := header + "." + b64.EncodeToString(claims)
+	h := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, h[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return unsigned + "." + b64.EncodeToString(sig), nil
+}
+
+// Encrypt encrypts the payload for the subscription as a single aes128gcm record
+func Encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayload {
+		return nil, ErrPayloadTooLarge
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(decode(sub.Keys.P256dh))
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	authSecret := decode(sub.Keys.Auth)
+	if len(authSecret) == 0 {
+		return nil, ErrInvalidKey
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	cek, nonce, err := deriveKeys(ecdhSecret, authSecret, salt, uaPublic.Bytes(), asPublic)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, headerSize+len(payload)+17))
+	buf.Write(salt)
+	_ = binary.Write(buf, binary.BigEndian, uint32(recordSize))
+	buf.WriteByte(byte(len(asPublic)))
+	buf.Write(asPublic)
+	// The padding delimiter of the last record
+	plain := append(append(make([]byte, 0, len(payload)+1), payload...), 0x02)
+	buf.Write(gcm.Seal(nil, nonce, plain, nil))
+	return buf.Bytes(), nil
+}
+
+// deriveKeys returns the content encryption key and the nonce as RFC 8291 section 3.4 describes
+func deriveKeys(ecdhSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err = io.ReadFull(hkdf.New(sha256.New, ecdhSecret, authSecret, keyInfo), ikm); err != nil {
+		return
+	}
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek = make([]byte, 16)
+	if _, err = io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return
+	}
+	nonce = make([]byte, 12)
+	_, err = io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce)
+	return
+}
+
+// decode accepts both padded and unpadded, url safe and standard base64 as browsers differ
+func decode(s string) []byte {
+	s = strings.TrimRight(strings.NewReplacer("+", "-", "/", "_").Replace(s), "=")
+	b, _ := b64.DecodeString(s)
+	return b
+}
@@ -0,0 +1,236 @@
+package webpush_test
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.ronaksoft.com/nested/server/pkg/webpush"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/hkdf"
+)
+
+var b64 = base64.RawURLEncoding
+
+// userAgent plays the role of the browser, it owns the subscription keys
+type userAgent struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newUserAgent() *userAgent {
+	k, _ := ecdh.P256().GenerateKey(rand.Reader)
+	auth := make([]byte, 16)
+	_, _ = rand.Read(auth)
+	return &userAgent{key: k, auth: auth}
+}
+
+func (ua *userAgent) subscription(endpoint string) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"endpoint": endpoint,
+		"keys": map[string]string{
+			"p256dh": b64.EncodeToString(ua.key.PublicKey().Bytes()),
+			"auth":   b64.EncodeToString(ua.auth),
+		},
+	})
+	return string(b)
+}
+
+func (ua *userAgent) decrypt(body []byte) ([]byte, error) {
+	if len(body) < 21 {
+		return nil, fmt.Errorf("short body")
+	}
+	salt := body[:16]
+	rs := binary.BigEndian.Uint32(body[16:20])
+	idLen := int(body[20])
+	asPublic := body[21 : 21+idLen]
+	ciphertext := body[21+idLen:]
+	if uint32(len(ciphertext)) > rs {
+		return nil, fmt.Errorf("record is larger than rs")
+	}
+	pub, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := ua.key.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	keyInfo := append(append([]byte("WebPush: info\x00"), ua.key.PublicKey().Bytes()...), asPublic...)
+	ikm := make([]byte, 32)
+	_, _ = io.ReadFull(hkdf.New(sha256.New, secret, ua.auth, keyInfo), ikm)
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek := make([]byte, 16)
+	_, _ = io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: aes128gcm\x00")), cek)
+	nonce := make([]byte, 12)
+	_, _ = io.ReadFull(hkdf.Expand(sha256.New, prk, []byte("Content-Encoding: nonce\x00")), nonce)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	idx := strings.LastIndexByte(string(plain), 0x02)
+	if idx == -1 {
+		return nil, fmt.Errorf("no padding delimiter")
+	}
+	return plain[:idx], nil
+}
+
+// verifyVAPID checks the Authorization header which push services require
+func verifyVAPID(r *http.Request, publicKey string) error {
+	var token, k string
+	for _, p := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "vapid "), ",") {
+		p = strings.TrimSpace(p)
+		switch {
+		case strings.HasPrefix(p, "t="):
+			token = p[2:]
+		case strings.HasPrefix(p, "k="):
+			k = p[2:]
+		}
+	}
+	if k != publicKey {
+		return fmt.Errorf("public key mismatch")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid token")
+	}
+	claims := map[string]interface{}{}
+	cb, _ := b64.DecodeString(parts[1])
+	if err := json.Unmarshal(cb, &claims); err != nil {
+		return err
+	}
+	if claims["aud"] != "https://"+r.Host {
+		return fmt.Errorf("invalid audience: %v", claims["aud"])
+	}
+	pb, _ := b64.DecodeString(k)
+	x, y := elliptic.Unmarshal(elliptic.P256(), pb)
+	sig, _ := b64.DecodeString(parts[2])
+	if x == nil || len(sig) != 64 {
+		return fmt.Errorf("invalid key or signature")
+	}
+	h := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func TestClient_Send(t *testing.T) {
+	privateKey, publicKey, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := webpush.NewClient(privateKey, "mailto:admin@nested.me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ua := newUserAgent()
+
+	var received [][]byte
+	stub := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := verifyVAPID(r, publicKey); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer stub.Close()
+	// the endpoints are on a public host and the stub is reached by its own client, the client of
+	// the package refuses to connect to the loopback
+	endpoint := "https://example.com"
+	stubClient := stub.Client()
+	stubClient.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, stub.Listener.Addr().String())
+	}
+	client.HTTPClient = stubClient
+
+	Convey("WebPush", t, func(c C) {
+		received = received[:0]
+		Convey("Keys", func(c C) {
+			c.So(client.PublicKey(), ShouldEqual, publicKey)
+			_, err := webpush.NewClient("invalid", "")
+			c.So(err, ShouldNotBeNil)
+		})
+		Convey("Parse Subscription", func(c C) {
+			_, err := webpush.ParseSubscription(ua.subscription(endpoint + "/push"))
+			c.So(err, ShouldBeNil)
+			_, err = webpush.ParseSubscription("fcm-token")
+			c.So(err, ShouldNotBeNil)
+			_, err = webpush.ParseSubscription(`{"endpoint":"ftp://push","keys":{"p256dh":"x","auth":"y"}}`)
+			c.So(err, ShouldNotBeNil)
+			_, err = webpush.ParseSubscription(ua.subscription("http://example.com/push"))
+			c.So(err, ShouldNotBeNil)
+			for _, u := range []string{
+				"https://127.0.0.1/push", "https://10.1.2.3/push", "https://192.168.1.1:8443/push",
+				"https://169.254.169.254/latest", "https://[::1]/push", "https://0.0.0.0/push", "https://localhost/push",
+				"https://api.localhost/push",
+			} {
+				_, err = webpush.ParseSubscription(ua.subscription(u))
+				c.So(err, ShouldEqual, webpush.ErrInternalEndpoint)
+			}
+		})
+		Convey("Internal Networks", func(c C) {
+			// i.e. a hostname which resolves to the loopback
+			sub := new(webpush.Subscription)
+			c.So(json.Unmarshal([]byte(ua.subscription(stub.URL+"/push")), sub), ShouldBeNil)
+			defaultClient, _ := webpush.NewClient(privateKey, "mailto:admin@nested.me")
+			err := defaultClient.Send(sub, []byte("x"), webpush.DefaultTTL)
+			c.So(errors.Is(err, webpush.ErrInternalEndpoint), ShouldBeTrue)
+			c.So(received, ShouldBeEmpty)
+		})
+		Convey("Deliver", func(c C) {
+			sub, err := webpush.ParseSubscription(ua.subscription(endpoint + "/push"))
+			c.So(err, ShouldBeNil)
+			payload := []byte(`{"title":"Nested","msg":"Hello"}`)
+			c.So(client.Send(sub, payload, webpush.DefaultTTL), ShouldBeNil)
+			c.So(received, ShouldHaveLength, 1)
+			plain, err := ua.decrypt(received[0])
+			c.So(err, ShouldBeNil)
+			c.So(string(plain), ShouldEqual, string(payload))
+		})
+		Convey("Payload Too Large", func(c C) {
+			sub, _ := webpush.ParseSubscription(ua.subscription(endpoint + "/push"))
+			c.So(client.Send(sub, make([]byte, webpush.MaxPayload+1), webpush.DefaultTTL), ShouldEqual, webpush.ErrPayloadTooLarge)
+			c.So(client.Send(sub, make([]byte, webpush.MaxPayload), webpush.DefaultTTL), ShouldBeNil)
+		})
+		Convey("Gone", func(c C) {
+			for _, path := range []string{"/gone", "/missing"} {
+				sub, _ := webpush.ParseSubscription(ua.subscription(endpoint + path))
+				c.So(client.Send(sub, []byte("x"), webpush.DefaultTTL), ShouldEqual, webpush.ErrSubscriptionGone)
+			}
+		})
+	})
+}